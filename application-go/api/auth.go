@@ -0,0 +1,103 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Principal is the wallet identity that the requests of an API user run as
+type Principal struct {
+	Name     string `json:"name"`
+	Profile  string `json:"profile"`
+	Identity string `json:"identity"`
+}
+
+// Authenticator returns the principal of a request
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+var errUnauthenticated = errors.New("missing or invalid bearer token")
+
+// User is an API user of a users file. Only the SHA-256 hash of the user's
+// bearer token is stored
+type User struct {
+	Principal
+	TokenSHA256 string `json:"tokenSHA256"`
+}
+
+// Tokens authenticates requests by the bearer tokens of users
+type Tokens struct {
+	principals map[string]*Principal
+}
+
+// NewTokens returns an authenticator of the users
+func NewTokens(users []User) (*Tokens, error) {
+
+	tokens := &Tokens{principals: make(map[string]*Principal)}
+	for i, user := range users {
+		hash := strings.ToLower(user.TokenSHA256)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("user %v: tokenSHA256 is not a SHA-256 hex digest", user.Name)
+		}
+		if user.Profile == "" {
+			return nil, fmt.Errorf("user %v: profile is missing", user.Name)
+		}
+		if _, ok := tokens.principals[hash]; ok {
+			return nil, fmt.Errorf("user %v: token is already used by another user", user.Name)
+		}
+		tokens.principals[hash] = &users[i].Principal
+	}
+
+	return tokens, nil
+}
+
+// LoadTokens reads the users of a JSON users file:
+//
+//	{"users": [{"name": "portal", "tokenSHA256": "...", "profile": "org1", "identity": "appUser"}]}
+//
+// A user without identity runs as the identity of its profile
+func LoadTokens(path string) (*Tokens, error) {
+
+	usersJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	var file struct {
+		Users []User `json:"users"`
+	}
+	err = json.Unmarshal(usersJSON, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users: %w", err)
+	}
+
+	return NewTokens(file.Users)
+}
+
+// Authenticate returns the principal of the bearer token of a request
+func (t *Tokens) Authenticate(r *http.Request) (*Principal, error) {
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil, errUnauthenticated
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	principal, ok := t.principals[hex.EncodeToString(hash[:])]
+	if !ok {
+		return nil, errUnauthenticated
+	}
+
+	return principal, nil
+}
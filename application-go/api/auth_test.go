@@ -0,0 +1,78 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/api"
+)
+
+var ctx = context.Background()
+
+func TestLoadTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	users := `{"users": [
+		{"name": "portal", "tokenSHA256": "` + strings.ToUpper(tokenHash("secret")) + `", "profile": "org1", "identity": "appUser"},
+		{"name": "org2", "tokenSHA256": "` + tokenHash("other") + `", "profile": "org2"}
+	]}`
+	if err := os.WriteFile(path, []byte(users), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := api.LoadTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, _ := http.NewRequest("GET", "/me", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	principal, err := tokens.Authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := api.Principal{Name: "portal", Profile: "org1", Identity: "appUser"}
+	if *principal != want {
+		t.Errorf("principal = %+v, want %+v", principal, want)
+	}
+
+	for _, header := range []string{"", "Bearer ", "Bearer wrong", "Basic secret", "secret"} {
+		request.Header.Set("Authorization", header)
+		if principal, err := tokens.Authenticate(request); err == nil {
+			t.Errorf("Authorization %q authenticated %+v", header, principal)
+		}
+	}
+}
+
+func TestNewTokensErrors(t *testing.T) {
+	hash := tokenHash("secret")
+
+	tests := []struct {
+		name        string
+		users       []api.User
+		errContains string
+	}{
+		{"plain token", []api.User{{Principal: api.Principal{Name: "u1", Profile: "org1"}, TokenSHA256: "secret"}}, "not a SHA-256"},
+		{"no profile", []api.User{{Principal: api.Principal{Name: "u1"}, TokenSHA256: hash}}, "profile is missing"},
+		{"shared token", []api.User{
+			{Principal: api.Principal{Name: "u1", Profile: "org1"}, TokenSHA256: hash},
+			{Principal: api.Principal{Name: "u2", Profile: "org2"}, TokenSHA256: hash},
+		}, "user u2: token is already used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := api.NewTokens(tt.users)
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("NewTokens = %v, want error containing %q", err, tt.errContains)
+			}
+		})
+	}
+}
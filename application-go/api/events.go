@@ -0,0 +1,277 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+const (
+	// subscriptionBuffer is the number of messages a subscriber can fall behind
+	// before it is dropped
+	subscriptionBuffer = 64
+
+	// keepAliveInterval is how often idle event streams are kept alive
+	keepAliveInterval = 30 * time.Second
+)
+
+// Feed passes the session events of an event source on to the subscribers of
+// the API. Every subscriber receives the public part of each event, and only
+// the allocations of its own bids
+type Feed struct {
+	source gepx.EventSource
+	retry  time.Duration
+
+	mutex         sync.Mutex
+	subscriptions map[*subscription]struct{}
+}
+
+// Message is a session event as it is sent to a subscriber
+type Message struct {
+	Name        string `json:"name"`
+	BlockNumber uint64 `json:"blockNumber"`
+	TxID        string `json:"txID"`
+	gepx.SessionEvent
+}
+
+// subscription is a subscriber of the feed. dropped is closed when the feed
+// drops a subscriber that falls behind
+type subscription struct {
+	bidder    string
+	sessionID string
+	messages  chan Message
+	dropped   chan struct{}
+}
+
+// NewFeed returns a feed of the events of a source. The feed delivers events
+// while Run runs
+func NewFeed(source gepx.EventSource) *Feed {
+	return &Feed{source: source, retry: 5 * time.Second, subscriptions: make(map[*subscription]struct{})}
+}
+
+// Run subscribes to the source and passes its events on until ctx is done. A
+// failed subscription is renewed after a delay
+func (f *Feed) Run(ctx context.Context) error {
+
+	for {
+		events, err := f.source.Events(ctx)
+		if err != nil {
+			log.Printf("failed to subscribe to chaincode events: %v", err)
+		} else {
+			for event := range events {
+				f.publish(event)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(f.retry):
+		}
+	}
+}
+
+// subscribe adds a subscriber of the events of a bidder, and of a session if
+// sessionID is not empty
+func (f *Feed) subscribe(bidder string, sessionID string) *subscription {
+
+	sub := &subscription{
+		bidder:    bidder,
+		sessionID: sessionID,
+		messages:  make(chan Message, subscriptionBuffer),
+		dropped:   make(chan struct{}),
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.subscriptions[sub] = struct{}{}
+
+	return sub
+}
+
+func (f *Feed) unsubscribe(sub *subscription) {
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.subscriptions, sub)
+}
+
+// publish sends a session event to its subscribers. Other chaincode events are
+// ignored
+func (f *Feed) publish(event gepx.Event) {
+
+	if !gepx.IsSessionEvent(event.Name) {
+		return
+	}
+
+	var sessionEvent gepx.SessionEvent
+	err := json.Unmarshal(event.Payload, &sessionEvent)
+	if err != nil {
+		log.Printf("failed to read event %v of transaction %v: %v", event.Name, event.TxID, err)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for sub := range f.subscriptions {
+		if sub.sessionID != "" && sub.sessionID != sessionEvent.SessionID {
+			continue
+		}
+
+		message := Message{
+			Name:         event.Name,
+			BlockNumber:  event.BlockNumber,
+			TxID:         event.TxID,
+			SessionEvent: forBidder(sessionEvent, sub.bidder),
+		}
+
+		select {
+		case sub.messages <- message:
+		default:
+			delete(f.subscriptions, sub)
+			close(sub.dropped)
+		}
+	}
+}
+
+// forBidder returns a session event with the allocations of a bidder only. It
+// filters what API subscribers receive; the chaincode event itself carries the
+// allocations of every bidder to all members of the channel
+func forBidder(event gepx.SessionEvent, bidder string) gepx.SessionEvent {
+
+	var allocations []gepx.BidAllocation
+	for _, allocation := range event.Allocations {
+		if allocation.Bidder == bidder {
+			allocations = append(allocations, allocation)
+		}
+	}
+	event.Allocations = allocations
+
+	return event
+}
+
+// subscribeCaller subscribes the caller to the events of the session of the
+// request's session query parameter, or of all sessions
+func (s *Server) subscribeCaller(r *http.Request, c *caller) (*subscription, error) {
+
+	bidder, err := c.client.GetID(r.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.feed.subscribe(bidder, r.URL.Query().Get("session")), nil
+}
+
+// streamEvents sends the caller's events as server-sent events
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, c *caller) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	sub, err := s.subscribeCaller(r, c)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer s.feed.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sub.dropped:
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case message := <-sub.messages:
+			messageJSON, err := json.Marshal(message)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: %s\nid: %d/%s\ndata: %s\n\n", message.Name, message.BlockNumber, message.TxID, messageJSON)
+		}
+		flusher.Flush()
+	}
+}
+
+// upgrader accepts WebSocket connections from any origin. Requests are
+// authenticated by bearer token rather than by cookie, so another site cannot
+// open a connection with the credentials of a user's browser
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// socketEvents sends the caller's events as JSON messages over a WebSocket
+func (s *Server) socketEvents(w http.ResponseWriter, r *http.Request, c *caller) {
+
+	sub, err := s.subscribeCaller(r, c)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	defer s.feed.unsubscribe(sub)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has replied with an error
+		return
+	}
+	defer conn.Close()
+
+	// the client does not send messages, but reading detects that it has gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closed:
+			return
+		case <-sub.dropped:
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"), time.Now().Add(time.Second))
+			return
+		case <-keepAlive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case message := <-sub.messages:
+			if err := conn.WriteJSON(message); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/api"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+// streamEvents subscribes a user to the server-sent events of a path, and
+// returns the messages as they are received
+func streamEvents(t *testing.T, server *httptest.Server, user string, path string) <-chan api.Message {
+	t.Helper()
+
+	// the stream ends before the server is closed
+	streamCtx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+
+	request, err := http.NewRequestWithContext(streamCtx, "GET", server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Authorization", "Bearer "+user)
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusOK || response.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET %v = %v %v, want an event stream", path, response.StatusCode, response.Header.Get("Content-Type"))
+	}
+
+	messages := make(chan api.Message)
+	go func() {
+		defer response.Body.Close()
+		defer close(messages)
+
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var message api.Message
+			if json.Unmarshal([]byte(data), &message) == nil {
+				messages <- message
+			}
+		}
+	}()
+
+	return messages
+}
+
+// socketEvents subscribes a user to the WebSocket events of a path
+func socketEvents(t *testing.T, server *httptest.Server, user string, path string) <-chan api.Message {
+	t.Helper()
+
+	header := http.Header{"Authorization": []string{"Bearer " + user}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	messages := make(chan api.Message)
+	go func() {
+		defer close(messages)
+		for {
+			var message api.Message
+			if err := conn.ReadJSON(&message); err != nil {
+				return
+			}
+			messages <- message
+		}
+	}()
+
+	return messages
+}
+
+// receive returns the messages up to the first message of an event
+func receive(t *testing.T, messages <-chan api.Message, last string) []api.Message {
+	t.Helper()
+
+	var received []api.Message
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				t.Fatalf("stream ended after %+v", received)
+			}
+			received = append(received, message)
+			if message.Name == last {
+				return received
+			}
+		case <-timeout:
+			t.Fatalf("no %v event after %+v", last, received)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	server := newServer(t)
+
+	sellerEvents := streamEvents(t, server, "seller", "/events?session=s1")
+	buyerEvents := socketEvents(t, server, "buyer", "/events/ws")
+
+	do(t, server, "admin", "POST", "/sessions", `{"sessionID": "s1"}`, http.StatusCreated, nil)
+	var sell, buy gepx.BidResponse
+	do(t, server, "seller", "POST", "/sessions/s1/bids", `{"bidType": "sell", "volume": 50, "price": 10, "assetID": "pv1"}`, http.StatusCreated, &sell)
+	do(t, server, "seller", "POST", "/sessions/s1/bids/"+sell.TxID+"/submit", "", http.StatusOK, nil)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids", `{"bidType": "buy", "volume": 30, "price": 20}`, http.StatusCreated, &buy)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids/"+buy.TxID+"/submit", "", http.StatusOK, nil)
+	do(t, server, "admin", "POST", "/sessions/s1/close", "", http.StatusOK, nil)
+	reveal(t, server, "seller", sell)
+	reveal(t, server, "buyer", buy)
+	do(t, server, "admin", "POST", "/sessions/s1/end", "", http.StatusOK, nil)
+
+	for _, stream := range []struct {
+		user     string
+		messages <-chan api.Message
+		bid      gepx.BidResponse
+	}{
+		{"seller", sellerEvents, sell},
+		{"buyer", buyerEvents, buy},
+	} {
+		received := receive(t, stream.messages, gepx.SessionEndedEvent)
+
+		var names []string
+		for _, message := range received {
+			names = append(names, message.Name)
+		}
+		if strings.Join(names, ",") != "SessionCreated,SessionClosed,SessionEnded" {
+			t.Errorf("events of the %v = %v, want the session transitions", stream.user, names)
+		}
+
+		// the allocation of the other participant's bid is not sent
+		ended := received[len(received)-1]
+		if ended.SessionID != "s1" || ended.Result == nil || ended.TxID == "" {
+			t.Errorf("SessionEnded event of the %v = %+v, want the result of s1", stream.user, ended)
+		}
+		if len(ended.Allocations) != 1 || !strings.Contains(ended.Allocations[0].BidKey, stream.bid.TxID) || ended.Allocations[0].Allocated != 30 {
+			t.Errorf("allocations sent to the %v = %+v, want 30 allocated to its own bid only", stream.user, ended.Allocations)
+		}
+	}
+}
+
+func TestEventsUnauthenticated(t *testing.T) {
+	server := newServer(t)
+	do(t, server, "", "GET", "/events", "", http.StatusUnauthorized, nil)
+	do(t, server, "", "GET", "/events/ws", "", http.StatusUnauthorized, nil)
+}
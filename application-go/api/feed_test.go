@@ -0,0 +1,65 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+func sessionEvent(t *testing.T, name string, event gepx.SessionEvent) gepx.Event {
+	t.Helper()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gepx.Event{BlockNumber: 1, TxID: "tx1", Name: name, Payload: payload}
+}
+
+func TestFeedPublish(t *testing.T) {
+	feed := NewFeed(nil)
+	all := feed.subscribe("alice", "")
+	s2 := feed.subscribe("bob", "s2")
+
+	ended := gepx.SessionEvent{
+		SessionID: "s1",
+		Status:    gepx.StatusEnded,
+		Allocations: []gepx.BidAllocation{
+			{BidKey: "k1", Bidder: "alice", Allocated: 10},
+			{BidKey: "k2", Bidder: "bob", Allocated: 20},
+		},
+	}
+	feed.publish(sessionEvent(t, gepx.SessionEndedEvent, ended))
+	feed.publish(gepx.Event{Name: "Transfer", Payload: []byte(`{"sessionID": "s1"}`)})
+	feed.publish(gepx.Event{Name: gepx.SessionClosedEvent, Payload: []byte(`not JSON`)})
+
+	if len(all.messages) != 1 {
+		t.Fatalf("subscriber of all sessions received %d messages, want the session event only", len(all.messages))
+	}
+	message := <-all.messages
+	if len(message.Allocations) != 1 || message.Allocations[0].BidKey != "k1" {
+		t.Errorf("allocations sent to alice = %+v, want her own only", message.Allocations)
+	}
+	if len(s2.messages) != 0 {
+		t.Errorf("subscriber of session s2 received an event of s1")
+	}
+
+	// a subscriber that falls behind is dropped
+	for i := 0; i <= subscriptionBuffer; i++ {
+		feed.publish(sessionEvent(t, gepx.SessionCreatedEvent, gepx.SessionEvent{SessionID: "s1"}))
+	}
+	select {
+	case <-all.dropped:
+	default:
+		t.Errorf("subscriber with a full buffer was not dropped")
+	}
+	if _, ok := feed.subscriptions[s2]; !ok || len(feed.subscriptions) != 1 {
+		t.Errorf("subscriptions = %v, want the subscriber of s2 only", feed.subscriptions)
+	}
+}
@@ -0,0 +1,522 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package api serves the sessions, bids, results and settlements of the GEPx
+// chaincode as REST resources, for clients that cannot connect to a Fabric
+// Gateway themselves. Every request is authenticated and runs as the wallet
+// identity of its user, through the gepx client that a backend returns for that
+// identity.
+//
+// The resources are:
+//
+//	GET  /me                                     the caller's identity
+//	POST /sessions                               create a session
+//	GET  /sessions/{sessionID}                   the session with the caller's revealed bids
+//	POST /sessions/{sessionID}/close             close the session
+//	POST /sessions/{sessionID}/end               clear the session
+//	GET  /sessions/{sessionID}/result            the prices and the caller's allocations
+//	POST /sessions/{sessionID}/settle            settle the session
+//	GET  /sessions/{sessionID}/settlement        the settlement of the session, for its admin
+//	GET  /sessions/{sessionID}/invoice           the caller's invoice
+//	POST /sessions/{sessionID}/bids              place a bid
+//	GET  /sessions/{sessionID}/bids/{txID}       a bid of the caller's organization
+//	POST /sessions/{sessionID}/bids/{txID}/submit submit a placed bid
+//	POST /sessions/{sessionID}/bids/{txID}/reveal reveal a submitted bid
+//
+// A server with a feed also streams the session events, as server-sent events
+// or over a WebSocket, optionally for a single session:
+//
+//	GET  /events[?session=sessionID]
+//	GET  /events/ws[?session=sessionID]
+//
+// Errors are returned as {"error": message}.
+//
+// The session, its result and its events only hold the revealed bids and the
+// allocations of the caller. This keeps API users from reading each other's
+// bids, but it is not privacy on the ledger: the SessionEnded chaincode event
+// and QuerySession expose every allocation of a session to the members of the
+// channel, and so to any user with a Fabric Gateway identity of their own.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxBodySize is the size limit of request bodies
+const maxBodySize = 1 << 20
+
+// Backend returns the gepx client of a wallet identity of a profile. It is
+// implemented by gateway.Pool for a Fabric network, and by memory.Wallet for an
+// in-memory ledger
+type Backend interface {
+	Client(profile string, identity string) (*gepx.Client, error)
+}
+
+// Server is the HTTP handler of the API
+type Server struct {
+	backend Backend
+	auth    Authenticator
+	feed    *Feed
+	mux     *http.ServeMux
+}
+
+// Option configures a server
+type Option func(*Server)
+
+// WithFeed streams the events of a feed to the subscribers of the server
+func WithFeed(feed *Feed) Option {
+	return func(s *Server) {
+		s.feed = feed
+	}
+}
+
+// caller is the authenticated principal of a request and its client
+type caller struct {
+	principal *Principal
+	client    *gepx.Client
+}
+
+type handlerFunc func(r *http.Request, c *caller) (int, interface{}, error)
+
+type streamFunc func(w http.ResponseWriter, r *http.Request, c *caller)
+
+// NewServer returns a server that authenticates requests with auth and runs
+// them through the clients of backend
+func NewServer(backend Backend, auth Authenticator, options ...Option) *Server {
+
+	s := &Server{backend: backend, auth: auth, mux: http.NewServeMux()}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.handle("GET /me", s.me)
+	s.handle("POST /sessions", s.createSession)
+	s.handle("GET /sessions/{sessionID}", s.querySession)
+	s.handle("POST /sessions/{sessionID}/close", s.closeSession)
+	s.handle("POST /sessions/{sessionID}/end", s.endSession)
+	s.handle("GET /sessions/{sessionID}/result", s.result)
+	s.handle("POST /sessions/{sessionID}/settle", s.settleSession)
+	s.handle("GET /sessions/{sessionID}/settlement", s.querySettlement)
+	s.handle("GET /sessions/{sessionID}/invoice", s.queryInvoice)
+	s.handle("POST /sessions/{sessionID}/bids", s.bid)
+	s.handle("GET /sessions/{sessionID}/bids/{txID}", s.queryBid)
+	s.handle("POST /sessions/{sessionID}/bids/{txID}/submit", s.submitBid)
+	s.handle("POST /sessions/{sessionID}/bids/{txID}/reveal", s.revealBid)
+
+	if s.feed != nil {
+		s.handleStream("GET /events", s.streamEvents)
+		s.handleStream("GET /events/ws", s.socketEvents)
+	}
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handle registers a handler that runs as the caller of the request
+func (s *Server) handle(pattern string, handler handlerFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+
+		c, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		code, response, err := handler(r, c)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+
+		writeJSON(w, code, response)
+	})
+}
+
+// handleStream registers a handler that writes its own response as the caller
+// of the request
+func (s *Server) handleStream(pattern string, handler streamFunc) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+
+		c, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		handler(w, r, c)
+	})
+}
+
+// authenticate returns the caller of a request, or replies with an error
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*caller, bool) {
+
+	principal, err := s.auth.Authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+
+	client, err := s.backend.Client(principal.Profile, principal.Identity)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("failed to connect as %v: %w", principal.Name, err))
+		return nil, false
+	}
+
+	return &caller{principal: principal, client: client}, true
+}
+
+// Identity is the response of /me
+type Identity struct {
+	Principal
+	Org string `json:"org"`
+	ID  string `json:"id"`
+}
+
+func (s *Server) me(r *http.Request, c *caller) (int, interface{}, error) {
+
+	id, err := c.client.GetID(r.Context())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, Identity{Principal: *c.principal, Org: c.client.Org(), ID: id}, nil
+}
+
+// SessionResponse is the response of the session transactions: the transaction
+// and the session after it
+type SessionResponse struct {
+	TxID    string        `json:"txID"`
+	Session *gepx.Session `json:"session"`
+}
+
+func (s *Server) createSession(r *http.Request, c *caller) (int, interface{}, error) {
+
+	var request gepx.CreateSessionRequest
+	if err := readJSON(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if request.SessionID == "" {
+		return 0, nil, badRequest(errors.New("sessionID is missing"))
+	}
+
+	receipt, err := c.client.CreateSession(r.Context(), request)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return sessionResponse(r.Context(), c, http.StatusCreated, request.SessionID, receipt.TxID)
+}
+
+func (s *Server) querySession(r *http.Request, c *caller) (int, interface{}, error) {
+
+	session, err := ownSession(r.Context(), c, r.PathValue("sessionID"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, session, nil
+}
+
+func (s *Server) closeSession(r *http.Request, c *caller) (int, interface{}, error) {
+
+	sessionID := r.PathValue("sessionID")
+
+	receipt, err := c.client.CloseSession(r.Context(), gepx.SessionRequest{SessionID: sessionID})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return sessionResponse(r.Context(), c, http.StatusOK, sessionID, receipt.TxID)
+}
+
+func (s *Server) endSession(r *http.Request, c *caller) (int, interface{}, error) {
+
+	ended, err := c.client.EndSession(r.Context(), gepx.SessionRequest{SessionID: r.PathValue("sessionID")})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, ended, nil
+}
+
+// sessionResponse reads the session after a transaction
+func sessionResponse(ctx context.Context, c *caller, code int, sessionID string, txID string) (int, interface{}, error) {
+
+	session, err := ownSession(ctx, c, sessionID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return code, SessionResponse{TxID: txID, Session: session}, nil
+}
+
+// ownSession reads a session with only the caller's revealed bids. The session
+// on the channel holds the bids and allocations of every participant, which the
+// API only passes on to their owners
+func ownSession(ctx context.Context, c *caller, sessionID string) (*gepx.Session, error) {
+
+	session, err := c.client.QuerySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := c.client.GetID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for bidKey, bid := range session.FinalizedBids {
+		if bid.Bidder != id {
+			delete(session.FinalizedBids, bidKey)
+		}
+	}
+
+	return session, nil
+}
+
+// Result is the outcome of an ended session for the caller: the prices and
+// flows of the session, and the caller's revealed bids by bid key with their
+// allocations
+type Result struct {
+	SessionID string `json:"sessionID"`
+	gepx.ClearingResult
+	Bids map[string]gepx.FullBid `json:"bids"`
+}
+
+func (s *Server) result(r *http.Request, c *caller) (int, interface{}, error) {
+
+	sessionID := r.PathValue("sessionID")
+
+	session, err := c.client.QuerySession(r.Context(), sessionID)
+	if err != nil {
+		return 0, nil, err
+	}
+	if session.Status == gepx.StatusOpen || session.Status == gepx.StatusClosed {
+		return 0, nil, &httpError{code: http.StatusConflict, err: fmt.Errorf("session %v has not ended", sessionID)}
+	}
+
+	id, err := c.client.GetID(r.Context())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	result := Result{
+		SessionID: sessionID,
+		ClearingResult: gepx.ClearingResult{
+			ClearingPrice: session.ClearingPrice,
+			ZonePrices:    session.ZonePrices,
+			Flows:         session.Flows,
+		},
+		Bids: make(map[string]gepx.FullBid),
+	}
+	for bidKey, bid := range session.FinalizedBids {
+		if bid.Bidder == id {
+			result.Bids[bidKey] = bid
+		}
+	}
+
+	return http.StatusOK, result, nil
+}
+
+func (s *Server) settleSession(r *http.Request, c *caller) (int, interface{}, error) {
+
+	receipt, err := c.client.SettleSession(r.Context(), gepx.SessionRequest{SessionID: r.PathValue("sessionID")})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, receipt, nil
+}
+
+// querySettlement returns the settlement of a session to the session's admin.
+// It holds the invoices of all participants, so participants read their own
+// invoice instead
+func (s *Server) querySettlement(r *http.Request, c *caller) (int, interface{}, error) {
+
+	sessionID := r.PathValue("sessionID")
+
+	session, err := c.client.QuerySession(r.Context(), sessionID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	id, err := c.client.GetID(r.Context())
+	if err != nil {
+		return 0, nil, err
+	}
+	if session.Admin != id {
+		return 0, nil, &httpError{code: http.StatusForbidden, err: fmt.Errorf("settlement of session %v is only available to its admin", sessionID)}
+	}
+
+	settlement, err := c.client.QuerySettlement(r.Context(), sessionID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, settlement, nil
+}
+
+func (s *Server) queryInvoice(r *http.Request, c *caller) (int, interface{}, error) {
+
+	id, err := c.client.GetID(r.Context())
+	if err != nil {
+		return 0, nil, err
+	}
+
+	invoice, err := c.client.QueryInvoice(r.Context(), r.PathValue("sessionID"), id)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, invoice, nil
+}
+
+func (s *Server) bid(r *http.Request, c *caller) (int, interface{}, error) {
+
+	var bid gepx.FullBid
+	if err := readJSON(r, &bid); err != nil {
+		return 0, nil, err
+	}
+
+	placed, err := c.client.Bid(r.Context(), gepx.BidRequest{SessionID: r.PathValue("sessionID"), Bid: bid})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusCreated, placed, nil
+}
+
+func (s *Server) queryBid(r *http.Request, c *caller) (int, interface{}, error) {
+
+	bid, err := c.client.QueryBid(r.Context(), r.PathValue("sessionID"), r.PathValue("txID"))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, bid, nil
+}
+
+func (s *Server) submitBid(r *http.Request, c *caller) (int, interface{}, error) {
+
+	receipt, err := c.client.SubmitBid(r.Context(), gepx.SubmitBidRequest{SessionID: r.PathValue("sessionID"), TxID: r.PathValue("txID")})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, receipt, nil
+}
+
+// RevealRequest is the body of a bid reveal: the bytes of the bid exactly as
+// they were placed, base64 encoded as in the response of the bid
+type RevealRequest struct {
+	BidJSON []byte `json:"bidJSON"`
+}
+
+func (s *Server) revealBid(r *http.Request, c *caller) (int, interface{}, error) {
+
+	var request RevealRequest
+	if err := readJSON(r, &request); err != nil {
+		return 0, nil, err
+	}
+	if len(request.BidJSON) == 0 {
+		return 0, nil, badRequest(errors.New("bidJSON is missing"))
+	}
+
+	receipt, err := c.client.FinalizeBid(r.Context(), gepx.FinalizeBidRequest{
+		SessionID: r.PathValue("sessionID"),
+		TxID:      r.PathValue("txID"),
+		BidJSON:   request.BidJSON,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return http.StatusOK, receipt, nil
+}
+
+// httpError is an error with the HTTP status it is returned with
+type httpError struct {
+	code int
+	err  error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(err error) error {
+	return &httpError{code: http.StatusBadRequest, err: err}
+}
+
+// statusOf returns the HTTP status of an error. Chaincode errors are only known
+// by their messages, so those of missing ledger objects are matched as text
+func statusOf(err error) int {
+
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.code
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable:
+			return http.StatusServiceUnavailable
+		case codes.DeadlineExceeded:
+			return http.StatusGatewayTimeout
+		}
+	}
+
+	message := err.Error()
+	if strings.Contains(message, "does not exist") || strings.Contains(message, "not found") {
+		return http.StatusNotFound
+	}
+
+	return http.StatusBadRequest
+}
+
+// readJSON reads a JSON request body into v. Unknown fields are rejected, so
+// that misspelled bid fields are not silently dropped
+func readJSON(r *http.Request, v interface{}) error {
+
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil {
+		return badRequest(fmt.Errorf("invalid request body: %w", err))
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
@@ -0,0 +1,255 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/api"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory/memorytest"
+)
+
+func tokenHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// newServer returns an API of a market of package memory whose admin and seller
+// are users of profile org1 and whose buyer is a user of profile org2, with
+// their names as tokens. The server streams the events of the ledger's
+// transactions from then on
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	market, err := memorytest.NewMarket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := memory.NewWallet(market.Ledger)
+	wallet.Put("org1", "admin", market.Admin)
+	wallet.Put("org1", "seller", market.Seller)
+	wallet.Put("org2", "buyer", market.Buyer)
+
+	tokens, err := api.NewTokens([]api.User{
+		{Principal: api.Principal{Name: "admin", Profile: "org1", Identity: "admin"}, TokenSHA256: tokenHash("admin")},
+		{Principal: api.Principal{Name: "seller", Profile: "org1", Identity: "seller"}, TokenSHA256: tokenHash("seller")},
+		{Principal: api.Principal{Name: "buyer", Profile: "org2", Identity: "buyer"}, TokenSHA256: tokenHash("buyer")},
+		{Principal: api.Principal{Name: "stranger", Profile: "org3", Identity: "stranger"}, TokenSHA256: tokenHash("stranger")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed := api.NewFeed(memory.NewEventSource(market.Ledger))
+	feedCtx, stop := context.WithCancel(ctx)
+	go feed.Run(feedCtx)
+
+	server := httptest.NewServer(api.NewServer(wallet, tokens, api.WithFeed(feed)))
+	t.Cleanup(func() {
+		stop()
+		server.Close()
+	})
+
+	return server
+}
+
+// do sends a request as a user, and reads the JSON response into v if the
+// response has the wanted status
+func do(t *testing.T, server *httptest.Server, user string, method string, path string, body string, wantCode int, v interface{}) {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "" {
+		request.Header.Set("Authorization", "Bearer "+user)
+	}
+
+	response, err := server.Client().Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var responseBody bytes.Buffer
+	responseBody.ReadFrom(response.Body)
+	if response.StatusCode != wantCode {
+		t.Fatalf("%v %v as %v = %v %s, want %v", method, path, user, response.StatusCode, responseBody.Bytes(), wantCode)
+	}
+	if v != nil {
+		if err := json.Unmarshal(responseBody.Bytes(), v); err != nil {
+			t.Fatalf("%v %v: %v", method, path, err)
+		}
+	}
+}
+
+func reveal(t *testing.T, server *httptest.Server, user string, placed gepx.BidResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(api.RevealRequest{BidJSON: placed.BidJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	do(t, server, user, "POST", "/sessions/s1/bids/"+placed.TxID+"/reveal", string(body), http.StatusOK, nil)
+}
+
+func TestSessionResources(t *testing.T) {
+	server := newServer(t)
+
+	var created api.SessionResponse
+	do(t, server, "admin", "POST", "/sessions", `{"sessionID": "s1"}`, http.StatusCreated, &created)
+	if created.TxID == "" || created.Session.Status != gepx.StatusOpen {
+		t.Fatalf("created session = %+v, want an open session", created)
+	}
+
+	var sell, buy gepx.BidResponse
+	do(t, server, "seller", "POST", "/sessions/s1/bids", `{"bidType": "sell", "volume": 50, "price": 10, "assetID": "pv1"}`, http.StatusCreated, &sell)
+	do(t, server, "seller", "POST", "/sessions/s1/bids/"+sell.TxID+"/submit", "", http.StatusOK, nil)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids", `{"bidType": "buy", "volume": 30, "price": 20}`, http.StatusCreated, &buy)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids/"+buy.TxID+"/submit", "", http.StatusOK, nil)
+
+	var bid gepx.FullBid
+	do(t, server, "buyer", "GET", "/sessions/s1/bids/"+buy.TxID, "", http.StatusOK, &bid)
+	if bid != buy.Bid {
+		t.Errorf("bid of the buyer = %+v, want %+v", bid, buy.Bid)
+	}
+
+	var closed api.SessionResponse
+	do(t, server, "admin", "POST", "/sessions/s1/close", "", http.StatusOK, &closed)
+	if closed.Session.Status != gepx.StatusClosed {
+		t.Errorf("closed session = %+v, want status %v", closed.Session, gepx.StatusClosed)
+	}
+	do(t, server, "seller", "GET", "/sessions/s1/result", "", http.StatusConflict, nil)
+
+	reveal(t, server, "seller", sell)
+	reveal(t, server, "buyer", buy)
+
+	var ended gepx.EndSessionResponse
+	do(t, server, "admin", "POST", "/sessions/s1/end", "", http.StatusOK, &ended)
+	if ended.Result.ClearingPrice <= 0 {
+		t.Fatalf("ended session = %+v, want a clearing price", ended)
+	}
+
+	// the result holds the allocations of the caller's bids only
+	var result api.Result
+	do(t, server, "seller", "GET", "/sessions/s1/result", "", http.StatusOK, &result)
+	if result.ClearingPrice != ended.Result.ClearingPrice || len(result.Bids) != 1 {
+		t.Fatalf("result of the seller = %+v, want the clearing price and one bid", result)
+	}
+	for bidKey, bid := range result.Bids {
+		if !strings.Contains(bidKey, sell.TxID) || bid.Allocated != 30 {
+			t.Errorf("bid %v of the seller = %+v, want bid %v with 30 allocated", bidKey, bid, sell.TxID)
+		}
+	}
+
+	do(t, server, "admin", "POST", "/sessions/s1/settle", "", http.StatusOK, nil)
+	do(t, server, "buyer", "GET", "/sessions/s1/result", "", http.StatusOK, nil)
+
+	// the settlement holds the invoices of every participant, so only the admin reads it
+	var settlement gepx.Settlement
+	do(t, server, "admin", "GET", "/sessions/s1/settlement", "", http.StatusOK, &settlement)
+	if settlement.SessionID != "s1" || len(settlement.OrgBalances) == 0 {
+		t.Errorf("settlement = %+v, want the balances of session s1", settlement)
+	}
+	do(t, server, "buyer", "GET", "/sessions/s1/settlement", "", http.StatusForbidden, nil)
+
+	var me api.Identity
+	do(t, server, "buyer", "GET", "/me", "", http.StatusOK, &me)
+	if me.Name != "buyer" || me.Org != "Org2MSP" || me.ID == "" {
+		t.Errorf("identity of the buyer = %+v, want buyer of Org2MSP", me)
+	}
+
+	var invoice gepx.Invoice
+	do(t, server, "buyer", "GET", "/sessions/s1/invoice", "", http.StatusOK, &invoice)
+	if invoice.Participant != me.ID || len(invoice.LineItems) == 0 {
+		t.Errorf("invoice of the buyer = %+v, want its line items", invoice)
+	}
+}
+
+func TestSessionRedaction(t *testing.T) {
+	server := newServer(t)
+	do(t, server, "admin", "POST", "/sessions", `{"sessionID": "s1"}`, http.StatusCreated, nil)
+
+	var sell, buy gepx.BidResponse
+	do(t, server, "seller", "POST", "/sessions/s1/bids", `{"bidType": "sell", "volume": 50, "price": 10, "assetID": "pv1"}`, http.StatusCreated, &sell)
+	do(t, server, "seller", "POST", "/sessions/s1/bids/"+sell.TxID+"/submit", "", http.StatusOK, nil)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids", `{"bidType": "buy", "volume": 30, "price": 20}`, http.StatusCreated, &buy)
+	do(t, server, "buyer", "POST", "/sessions/s1/bids/"+buy.TxID+"/submit", "", http.StatusOK, nil)
+	do(t, server, "admin", "POST", "/sessions/s1/close", "", http.StatusOK, nil)
+	reveal(t, server, "seller", sell)
+	reveal(t, server, "buyer", buy)
+
+	do(t, server, "admin", "POST", "/sessions/s1/end", "", http.StatusOK, nil)
+
+	// every caller sees the allocations of its own revealed bids only
+	tests := []struct {
+		user     string
+		wantBids []string
+	}{
+		{"buyer", []string{buy.TxID}},
+		{"seller", []string{sell.TxID}},
+		{"admin", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			var session gepx.Session
+			do(t, server, tt.user, "GET", "/sessions/s1", "", http.StatusOK, &session)
+
+			if len(session.FinalizedBids) != len(tt.wantBids) {
+				t.Fatalf("revealed bids seen by the %v = %+v, want bids %v", tt.user, session.FinalizedBids, tt.wantBids)
+			}
+			for _, txID := range tt.wantBids {
+				if bid, ok := session.FinalizedBids[gepx.BidKey("s1", txID)]; !ok || bid.Allocated != 30 {
+					t.Errorf("bid %v seen by the %v = %+v, want its allocation of 30", txID, tt.user, bid)
+				}
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	server := newServer(t)
+	do(t, server, "admin", "POST", "/sessions", `{"sessionID": "s1"}`, http.StatusCreated, nil)
+
+	tests := []struct {
+		name     string
+		user     string
+		method   string
+		path     string
+		body     string
+		wantCode int
+	}{
+		{"no token", "", "GET", "/me", "", http.StatusUnauthorized},
+		{"unknown token", "intruder", "GET", "/me", "", http.StatusUnauthorized},
+		{"identity not in wallet", "stranger", "GET", "/me", "", http.StatusServiceUnavailable},
+		{"missing session", "seller", "GET", "/sessions/missing", "", http.StatusNotFound},
+		{"missing bid", "seller", "POST", "/sessions/s1/bids/missing/submit", "", http.StatusNotFound},
+		{"missing session id", "admin", "POST", "/sessions", `{}`, http.StatusBadRequest},
+		{"unknown bid field", "seller", "POST", "/sessions/s1/bids", `{"bidType": "sell", "volume": 50, "prize": 10}`, http.StatusBadRequest},
+		{"invalid bid", "seller", "POST", "/sessions/s1/bids", `{"bidType": "sell", "volume": 0, "price": 10}`, http.StatusBadRequest},
+		{"reveal without bid", "seller", "POST", "/sessions/s1/bids/tx1/reveal", `{}`, http.StatusBadRequest},
+		{"close by participant", "seller", "POST", "/sessions/s1/close", "", http.StatusBadRequest},
+		{"unknown resource", "seller", "GET", "/auctions", "", http.StatusNotFound},
+		{"wrong method", "seller", "DELETE", "/sessions/s1", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			do(t, server, tt.user, tt.method, tt.path, tt.body, tt.wantCode, nil)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command gepx-api serves the GEPx chaincode as a REST API, see package api.
+// Requests are authenticated by the bearer tokens of a users file, and run as
+// the wallet identities the users are mapped to, through the gateway peers of
+// the profiles file. The session events of the chaincode are streamed to the
+// users, as received by the identity of the events profile.
+//
+// Usage:
+//
+//	gepx-api [-config profiles.json] [-users users.json] [-events-profile org1] [-addr :8080] [-tls-cert cert.pem -tls-key key.pem]
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/api"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/gateway"
+)
+
+func main() {
+	log.SetPrefix("gepx-api: ")
+
+	configPath := flag.String("config", defaultPath("GEPX_CONFIG", "profiles.json"), "profiles file, or $GEPX_CONFIG")
+	usersPath := flag.String("users", defaultPath("GEPX_USERS", "users.json"), "users file, or $GEPX_USERS")
+	eventsProfile := flag.String("events-profile", "", "profile whose identity receives the chaincode events, instead of the default profile")
+	addr := flag.String("addr", ":8080", "address to listen on")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate to serve HTTPS with")
+	tlsKey := flag.String("tls-key", "", "TLS private key of the certificate")
+	flag.Parse()
+
+	config, err := gateway.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens, err := api.LoadTokens(*usersPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	pool := gateway.NewPool(config)
+	defer pool.Close()
+
+	events, err := pool.Connection(*eventsProfile, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	feed := api.NewFeed(events)
+	go feed.Run(ctx)
+
+	// event streams end with the base context, so that they do not hold up the
+	// shutdown of the server
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           api.NewServer(pool, tokens, api.WithFeed(feed)),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	// requests in progress are completed before the server exits
+	idle := make(chan struct{})
+	go func() {
+		defer close(idle)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %v", *addr)
+	if *tlsCert != "" {
+		err = server.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	<-idle
+}
+
+// defaultPath returns the path of an environment variable, or a file in the
+// working directory
+func defaultPath(env string, file string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	return file
+}
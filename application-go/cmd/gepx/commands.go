@@ -0,0 +1,490 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+)
+
+// errUsage is returned for commands with missing or invalid arguments
+var errUsage = errors.New("invalid usage")
+
+// cli runs the commands with a client it connects for the command, and with
+// the vault it opens for the vault commands
+type cli struct {
+	stdout    io.Writer
+	stderr    io.Writer
+	connect   func() (*gepx.Client, func(), error)
+	openVault func() (*vault.Vault, error)
+}
+
+// sessionOutput is the output of the commands that change a session: the
+// transaction and the session after it
+type sessionOutput struct {
+	TxID    string        `json:"txID"`
+	Session *gepx.Session `json:"session"`
+}
+
+// commitRevealOutput is the output of the commit-reveal flow of a bid
+type commitRevealOutput struct {
+	Bid        *gepx.BidResponse `json:"bid"`
+	SubmitTxID string            `json:"submitTxID"`
+	RevealTxID string            `json:"revealTxID"`
+}
+
+// run runs the command of the arguments
+func (c *cli) run(ctx context.Context, args []string) error {
+
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "session":
+		return c.session(ctx, args[1], args[2:])
+	case "bid":
+		return c.bid(ctx, args[1], args[2:])
+	case "query":
+		return c.query(ctx, args[1:])
+	case "vault":
+		return c.vault(ctx, args[1], args[2:])
+	case "collateral":
+		return c.collateral(ctx, args[1], args[2:])
+	case "asset":
+		return c.asset(ctx, args[1], args[2:])
+	case "config":
+		return c.config(ctx, args[1], args[2:])
+	}
+
+	return errUsage
+}
+
+// session runs the session commands
+func (c *cli) session(ctx context.Context, command string, args []string) error {
+
+	flags := c.flagSet("session " + command)
+	configID := ""
+	if command == "create" {
+		flags.StringVar(&configID, "market-config", "", "ID of the market config the session runs under")
+	}
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	sessionID := flags.Arg(0)
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	var receipt *gepx.Receipt
+	switch command {
+	case "create":
+		receipt, err = client.CreateSession(ctx, gepx.CreateSessionRequest{SessionID: sessionID, ConfigID: configID})
+	case "close":
+		receipt, err = client.CloseSession(ctx, gepx.SessionRequest{SessionID: sessionID})
+	case "end":
+		ended, err := client.EndSession(ctx, gepx.SessionRequest{SessionID: sessionID})
+		if err != nil {
+			return err
+		}
+		return c.print(ended)
+	default:
+		return errUsage
+	}
+	if err != nil {
+		return err
+	}
+
+	session, err := client.QuerySession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return c.print(sessionOutput{TxID: receipt.TxID, Session: session})
+}
+
+// bid runs the bid commands
+func (c *cli) bid(ctx context.Context, command string, args []string) error {
+
+	switch command {
+	case "place":
+		return c.placeBid(ctx, args)
+	case "submit":
+		return c.submitBid(ctx, args)
+	case "reveal":
+		return c.revealBid(ctx, args)
+	case "commit-reveal":
+		return c.commitReveal(ctx, args)
+	}
+
+	return errUsage
+}
+
+// placeBid places a bid and prints it with the transaction ID and the bytes
+// that are needed to submit and reveal it
+func (c *cli) placeBid(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("bid place")
+	bid := bidFlags(flags)
+	savePath := flags.String("save", "", "file to save the placed bid to, for bid submit and bid reveal")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+
+	request, err := bid(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	placed, err := c.place(ctx, client, request, *savePath)
+	if err != nil {
+		return err
+	}
+
+	return c.print(placed)
+}
+
+// submitBid adds the hash of a placed bid to its session
+func (c *cli) submitBid(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("bid submit")
+	fromPath := flags.String("from", "", "file of the placed bid, as saved by bid place")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+
+	sessionID, txID, _, err := bidArgs(flags, *fromPath, false)
+	if err != nil {
+		return err
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	receipt, err := client.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: sessionID, TxID: txID})
+	if err != nil {
+		return err
+	}
+
+	return c.print(receipt)
+}
+
+// revealBid reveals a submitted bid to its closed session
+func (c *cli) revealBid(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("bid reveal")
+	fromPath := flags.String("from", "", "file of the placed bid, as saved by bid place")
+	bidJSON := flags.String("bid", "", "JSON of the bid, exactly as it was placed")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if *fromPath != "" && *bidJSON != "" {
+		return errUsage
+	}
+
+	sessionID, txID, placedJSON, err := bidArgs(flags, *fromPath, true)
+	if err != nil {
+		return err
+	}
+	if *bidJSON != "" {
+		placedJSON = []byte(*bidJSON)
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	receipt, err := client.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: sessionID, TxID: txID, BidJSON: placedJSON})
+	if err != nil {
+		return err
+	}
+
+	return c.print(receipt)
+}
+
+// commitReveal places and submits a bid, waits until its session is closed and
+// reveals the bid
+func (c *cli) commitReveal(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("bid commit-reveal")
+	bid := bidFlags(flags)
+	savePath := flags.String("save", "", "file to save the placed bid to, to reveal it later if the flow is interrupted")
+	poll := flags.Duration("poll", 10*time.Second, "interval at which the session is polled until it is closed")
+	timeout := flags.Duration("timeout", 0, "maximum time to wait for the session to close, 0 to wait without limit")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 || *poll <= 0 {
+		return errUsage
+	}
+
+	request, err := bid(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	placed, err := c.place(ctx, client, request, *savePath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.stderr, "placed bid %v in session %v\n", placed.TxID, placed.SessionID)
+
+	submitted, err := client.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: placed.SessionID, TxID: placed.TxID})
+	if err != nil {
+		return c.unrevealed(placed, err)
+	}
+	fmt.Fprintf(c.stderr, "submitted bid %v, waiting for session %v to close\n", placed.TxID, placed.SessionID)
+
+	waitCtx := ctx
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	err = waitForClose(waitCtx, client, placed.SessionID, *poll)
+	if err != nil {
+		return c.unrevealed(placed, err)
+	}
+
+	revealed, err := client.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: placed.SessionID, TxID: placed.TxID, BidJSON: placed.BidJSON})
+	if err != nil {
+		return c.unrevealed(placed, err)
+	}
+	fmt.Fprintf(c.stderr, "revealed bid %v\n", placed.TxID)
+
+	return c.print(commitRevealOutput{Bid: placed, SubmitTxID: submitted.TxID, RevealTxID: revealed.TxID})
+}
+
+// query runs the query commands
+func (c *cli) query(ctx context.Context, args []string) error {
+
+	var run func(client *gepx.Client) (interface{}, error)
+	switch {
+	case args[0] == "session" && len(args) == 2:
+		run = func(client *gepx.Client) (interface{}, error) {
+			return client.QuerySession(ctx, args[1])
+		}
+	case args[0] == "bid" && len(args) == 3:
+		run = func(client *gepx.Client) (interface{}, error) {
+			return client.QueryBid(ctx, args[1], args[2])
+		}
+	case args[0] == "collateral" && len(args) == 2:
+		run = func(client *gepx.Client) (interface{}, error) {
+			return client.QueryCollateral(ctx, args[1])
+		}
+	case args[0] == "asset" && len(args) == 2:
+		run = func(client *gepx.Client) (interface{}, error) {
+			return client.QueryAsset(ctx, args[1])
+		}
+	case args[0] == "id" && len(args) == 1:
+		run = func(client *gepx.Client) (interface{}, error) {
+			clientID, err := client.GetID(ctx)
+			return map[string]string{"clientID": clientID, "org": client.Org()}, err
+		}
+	default:
+		return errUsage
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	result, err := run(client)
+	if err != nil {
+		return err
+	}
+
+	return c.print(result)
+}
+
+// place places a bid and saves it to a file if a path is given. The file is
+// written as soon as the bid is placed, because without its bytes the bid
+// cannot be revealed
+func (c *cli) place(ctx context.Context, client *gepx.Client, request gepx.BidRequest, savePath string) (*gepx.BidResponse, error) {
+
+	placed, err := client.Bid(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	if savePath != "" {
+		placedJSON, err := json.MarshalIndent(placed, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		err = os.WriteFile(savePath, placedJSON, 0600)
+		if err != nil {
+			// the bid is placed, so it is printed for the user to keep
+			c.print(placed)
+			return nil, fmt.Errorf("bid %v was placed but could not be saved: %w", placed.TxID, err)
+		}
+	}
+
+	return placed, nil
+}
+
+// unrevealed prints a placed bid whose commit-reveal flow failed, so that it
+// can still be submitted and revealed with bid submit and bid reveal
+func (c *cli) unrevealed(placed *gepx.BidResponse, err error) error {
+
+	c.print(placed)
+
+	return fmt.Errorf("bid %v was not revealed: %w", placed.TxID, err)
+}
+
+// waitForClose polls a session while it is open. It fails if the session has
+// gone past closed, e.g. ended, settled or completed
+func waitForClose(ctx context.Context, client *gepx.Client, sessionID string, poll time.Duration) error {
+
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	for {
+		session, err := client.QuerySession(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+
+		// every status after Open is final: bids can only be revealed while
+		// the session is closed
+		switch session.Status {
+		case gepx.StatusOpen:
+		case gepx.StatusClosed:
+			return nil
+		default:
+			return fmt.Errorf("session %v was %v before the bid was revealed", sessionID, session.Status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// bidFlags defines the flags of a bid and returns a function that builds the
+// bid request of a session from them
+func bidFlags(flags *flag.FlagSet) func(sessionID string) (gepx.BidRequest, error) {
+
+	bidType := flags.String("type", "", "buy or sell")
+	volume := flags.Int("volume", 0, "volume of the bid")
+	price := flags.Int("price", 0, "price per unit of the bid")
+	zone := flags.String("zone", "", "bidding zone")
+	assetID := flags.String("asset", "", "asset that delivers or takes the volume")
+	connectionPoint := flags.String("connection-point", "", "grid connection point of a sell bid")
+	green := flags.Bool("green", false, "offer certified renewable volume")
+	sourceType := flags.String("source-type", "", "generation source of a sell bid")
+	carbonIntensity := flags.Int("carbon-intensity", 0, "carbon intensity of a sell bid in gCO2/kWh")
+
+	return func(sessionID string) (gepx.BidRequest, error) {
+
+		if !gepx.BidType(*bidType).IsBuy() && !gepx.BidType(*bidType).IsSell() {
+			return gepx.BidRequest{}, fmt.Errorf("bid type must be buy or sell, got %q", *bidType)
+		}
+
+		return gepx.BidRequest{
+			SessionID: sessionID,
+			Bid: gepx.FullBid{
+				BidType:         gepx.BidType(*bidType),
+				Volume:          *volume,
+				Price:           *price,
+				Zone:            *zone,
+				AssetID:         *assetID,
+				ConnectionPoint: *connectionPoint,
+				Green:           *green,
+				SourceType:      *sourceType,
+				CarbonIntensity: *carbonIntensity,
+			},
+		}, nil
+	}
+}
+
+// bidArgs returns the session ID, transaction ID and placed bytes of a bid, from
+// the file saved by bid place or from the arguments
+func bidArgs(flags *flag.FlagSet, fromPath string, needsBytes bool) (string, string, []byte, error) {
+
+	if fromPath == "" {
+		if flags.NArg() != 2 {
+			return "", "", nil, errUsage
+		}
+		return flags.Arg(0), flags.Arg(1), nil, nil
+	}
+
+	if flags.NArg() != 0 {
+		return "", "", nil, errUsage
+	}
+
+	placedJSON, err := os.ReadFile(fromPath)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	var placed gepx.BidResponse
+	err = json.Unmarshal(placedJSON, &placed)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to read placed bid %v: %w", fromPath, err)
+	}
+	if placed.SessionID == "" || placed.TxID == "" || needsBytes && len(placed.BidJSON) == 0 {
+		return "", "", nil, fmt.Errorf("%v is not a bid saved by bid place", fromPath)
+	}
+
+	return placed.SessionID, placed.TxID, placed.BidJSON, nil
+}
+
+// flagSet returns a flag set of a command that reports errors instead of exiting
+func (c *cli) flagSet(name string) *flag.FlagSet {
+
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+
+	return flags
+}
+
+// print writes v as indented JSON
+func (c *cli) print(v interface{}) error {
+
+	encoder := json.NewEncoder(c.stdout)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
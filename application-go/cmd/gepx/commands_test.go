@@ -0,0 +1,449 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+)
+
+// fakeChaincode is a contract with the session and market transactions of a
+// single client. It closes a session on the closeAfter-th query of the session,
+// or moves it to closeTo if that is set
+type fakeChaincode struct {
+	sessions     map[string]*gepx.Session
+	bids         map[string][]byte
+	collateral   map[string]int
+	assets       map[string]*gepx.Asset
+	configs      map[string]int
+	transactions []gepx.Transaction
+	queries      int
+	closeAfter   int
+	closeTo      string
+}
+
+func newFakeChaincode() *fakeChaincode {
+	return &fakeChaincode{
+		sessions:   make(map[string]*gepx.Session),
+		bids:       make(map[string][]byte),
+		collateral: make(map[string]int),
+		assets:     make(map[string]*gepx.Asset),
+		configs:    make(map[string]int),
+	}
+}
+
+func (f *fakeChaincode) Submit(ctx context.Context, transaction gepx.Transaction) ([]byte, string, error) {
+
+	f.transactions = append(f.transactions, transaction)
+	txID := fmt.Sprintf("tx%d", len(f.transactions))
+
+	switch transaction.Name {
+	case "CreateSession":
+		f.sessions[transaction.Args[0]] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+	case "Bid":
+		f.bids[txID] = transaction.Transient["bid"]
+		return []byte(txID), txID, nil
+	case "SubmitBid":
+		if f.bids[transaction.Args[1]] == nil {
+			return nil, txID, fmt.Errorf("bid hash does not exist")
+		}
+	case "CloseSession":
+		f.sessions[transaction.Args[0]].Status = gepx.StatusClosed
+	case "FinalizeBid":
+		if f.sessions[transaction.Args[0]].Status != gepx.StatusClosed {
+			return nil, txID, fmt.Errorf("cannot reveal bid for Placed or ended session")
+		}
+		if !bytes.Equal(transaction.Transient["bid"], f.bids[transaction.Args[1]]) {
+			return nil, txID, fmt.Errorf("hash does not match")
+		}
+	case "EndSession":
+		f.sessions[transaction.Args[0]].Status = gepx.StatusEnded
+		return []byte(`{"clearingPrice":15,"zonePrices":{"":15},"flows":[]}`), txID, nil
+	case "DepositCollateral":
+		amount, _ := strconv.Atoi(transaction.Args[1])
+		if amount <= 0 {
+			return nil, txID, fmt.Errorf("deposit amount must be positive")
+		}
+		f.collateral[transaction.Args[0]] += amount
+	case "RegisterAsset":
+		renewable, _ := strconv.ParseBool(transaction.Args[3])
+		capacity, _ := strconv.Atoi(transaction.Args[4])
+		rampRate, _ := strconv.Atoi(transaction.Args[5])
+		f.assets[transaction.Args[0]] = &gepx.Asset{
+			AssetID:         transaction.Args[0],
+			Owner:           "client1",
+			Org:             "Org1MSP",
+			Kind:            transaction.Args[1],
+			Technology:      transaction.Args[2],
+			Renewable:       renewable,
+			Capacity:        capacity,
+			RampRate:        rampRate,
+			ConnectionPoint: transaction.Args[6],
+		}
+	case "PublishMarketConfig":
+		var config gepx.MarketConfig
+		if err := json.Unmarshal([]byte(transaction.Args[1]), &config); err != nil {
+			return nil, txID, err
+		}
+		f.configs[transaction.Args[0]]++
+		return []byte(strconv.Itoa(f.configs[transaction.Args[0]])), txID, nil
+	}
+
+	return nil, txID, nil
+}
+
+func (f *fakeChaincode) Evaluate(ctx context.Context, transaction gepx.Transaction) ([]byte, error) {
+
+	switch transaction.Name {
+	case "GetID":
+		return []byte("client1"), nil
+	case "QuerySession":
+		session, ok := f.sessions[transaction.Args[0]]
+		if !ok {
+			return nil, fmt.Errorf("session does not exist")
+		}
+		f.queries++
+		if f.queries == f.closeAfter {
+			session.Status = gepx.StatusClosed
+			if f.closeTo != "" {
+				session.Status = f.closeTo
+			}
+		}
+		return json.Marshal(session)
+	case "QueryCollateral":
+		return json.Marshal(gepx.CollateralAccount{Owner: transaction.Args[0], Balance: f.collateral[transaction.Args[0]]})
+	case "QueryAsset":
+		asset, ok := f.assets[transaction.Args[0]]
+		if !ok {
+			return nil, fmt.Errorf("asset %v does not exist", transaction.Args[0])
+		}
+		return json.Marshal(asset)
+	}
+
+	return nil, fmt.Errorf("unexpected query %v", transaction.Name)
+}
+
+// newCLI returns a command line of the chaincode, and its output
+func newCLI(chaincode *fakeChaincode) (*cli, *bytes.Buffer) {
+
+	stdout := new(bytes.Buffer)
+
+	return &cli{
+		stdout: stdout,
+		stderr: new(bytes.Buffer),
+		connect: func() (*gepx.Client, func(), error) {
+			return gepx.NewClient(chaincode, "Org1MSP"), func() {}, nil
+		},
+	}, stdout
+}
+
+func run(t *testing.T, c *cli, stdout *bytes.Buffer, args string) []byte {
+	t.Helper()
+
+	stdout.Reset()
+	err := c.run(context.Background(), strings.Fields(args))
+	if err != nil {
+		t.Fatalf("gepx %v: %v", args, err)
+	}
+
+	return stdout.Bytes()
+}
+
+func TestSessionCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	c, stdout := newCLI(chaincode)
+
+	var created sessionOutput
+	json.Unmarshal(run(t, c, stdout, "session create -market-config daily s1"), &created)
+	if created.TxID != "tx1" || created.Session.Status != gepx.StatusOpen {
+		t.Errorf("session create = %+v, want the open session", created)
+	}
+	if args := chaincode.transactions[0].Args; args[0] != "s1" || args[1] != "daily" {
+		t.Errorf("CreateSession arguments = %v, want s1 daily", args)
+	}
+
+	var closed sessionOutput
+	json.Unmarshal(run(t, c, stdout, "session close s1"), &closed)
+	if closed.Session.Status != gepx.StatusClosed {
+		t.Errorf("session close = %+v, want the closed session", closed)
+	}
+	if orgs := chaincode.transactions[1].EndorsingOrgs; len(orgs) != 1 || orgs[0] != "Org1MSP" {
+		t.Errorf("CloseSession endorsed by %v, want the session orgs", orgs)
+	}
+
+	var ended gepx.EndSessionResponse
+	json.Unmarshal(run(t, c, stdout, "session end s1"), &ended)
+	if ended.Result.ClearingPrice != 15 {
+		t.Errorf("session end = %+v, want the clearing result", ended)
+	}
+}
+
+func TestBidCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	chaincode.sessions["s1"] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+	c, stdout := newCLI(chaincode)
+
+	bidPath := filepath.Join(t.TempDir(), "bid.json")
+
+	var placed gepx.BidResponse
+	json.Unmarshal(run(t, c, stdout, "bid place -type sell -volume 50 -price 10 -asset pv1 -green -save "+bidPath+" s1"), &placed)
+
+	bid := chaincode.transactions[0]
+	if !bytes.Equal(bid.Transient["bid"], placed.BidJSON) || len(bid.EndorsingOrgs) != 1 || bid.EndorsingOrgs[0] != "Org1MSP" {
+		t.Fatalf("Bid transaction = %+v, want the placed bytes endorsed by Org1MSP", bid)
+	}
+	want := gepx.FullBid{BidType: gepx.Sell, Volume: 50, Price: 10, AssetID: "pv1", Green: true, Org: "Org1MSP", Bidder: "client1", Status: "Placed"}
+	if placed.Bid != want {
+		t.Errorf("placed bid = %+v, want %+v", placed.Bid, want)
+	}
+
+	info, err := os.Stat(bidPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("saved bid has mode %v, want 0600", info.Mode().Perm())
+	}
+
+	run(t, c, stdout, "bid submit -from "+bidPath)
+	chaincode.sessions["s1"].Status = gepx.StatusClosed
+
+	var revealed gepx.Receipt
+	json.Unmarshal(run(t, c, stdout, "bid reveal -from "+bidPath), &revealed)
+	if revealed.TxID != "tx3" {
+		t.Errorf("bid reveal = %+v, want the FinalizeBid transaction", revealed)
+	}
+
+	err = c.run(context.Background(), []string{"bid", "reveal", "-bid", `{"bidType":"sell"}`, "s1", placed.TxID})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("bid reveal of other bytes = %v, want a hash mismatch", err)
+	}
+}
+
+func TestCommitReveal(t *testing.T) {
+	chaincode := newFakeChaincode()
+	chaincode.sessions["s1"] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+	chaincode.closeAfter = 4
+	c, stdout := newCLI(chaincode)
+
+	var output commitRevealOutput
+	json.Unmarshal(run(t, c, stdout, "bid commit-reveal -type buy -volume 30 -price 20 -poll 1ms s1"), &output)
+
+	names := []string{}
+	for _, transaction := range chaincode.transactions {
+		names = append(names, transaction.Name)
+	}
+	if strings.Join(names, ",") != "Bid,SubmitBid,FinalizeBid" {
+		t.Errorf("commit-reveal submitted %v, want Bid, SubmitBid and FinalizeBid", names)
+	}
+	if output.Bid.TxID != "tx1" || output.SubmitTxID != "tx2" || output.RevealTxID != "tx3" {
+		t.Errorf("commit-reveal = %+v, want the three transactions", output)
+	}
+}
+
+func TestCommitRevealTimeout(t *testing.T) {
+	chaincode := newFakeChaincode()
+	chaincode.sessions["s1"] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+	c, stdout := newCLI(chaincode)
+
+	err := c.run(context.Background(), strings.Fields("bid commit-reveal -type buy -volume 30 -price 20 -poll 1ms -timeout 20ms s1"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("commit-reveal of a session that stays open = %v, want a timeout", err)
+	}
+
+	// the bid is printed so that it can still be revealed
+	var placed gepx.BidResponse
+	if json.Unmarshal(stdout.Bytes(), &placed); placed.TxID != "tx1" || len(placed.BidJSON) == 0 {
+		t.Errorf("output of failed commit-reveal = %s, want the placed bid", stdout)
+	}
+}
+
+func TestCommitRevealPastClosed(t *testing.T) {
+	for _, status := range []string{gepx.StatusEnded, gepx.StatusSettled, gepx.StatusCompleted} {
+		t.Run(status, func(t *testing.T) {
+			chaincode := newFakeChaincode()
+			chaincode.sessions["s1"] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+			chaincode.closeAfter = 4
+			chaincode.closeTo = status
+			c, _ := newCLI(chaincode)
+
+			// without a timeout, the flow has to stop by itself
+			err := c.run(context.Background(), strings.Fields("bid commit-reveal -type buy -volume 30 -price 20 -poll 1ms s1"))
+			if err == nil || !strings.Contains(err.Error(), "was "+status+" before the bid was revealed") {
+				t.Errorf("commit-reveal of a session that is %v = %v, want an error", status, err)
+			}
+		})
+	}
+}
+
+func TestVaultCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	chaincode.sessions["s1"] = &gepx.Session{Orgs: []string{"Org1MSP"}, Status: gepx.StatusOpen}
+	c, stdout := newCLI(chaincode)
+
+	vaultPath := filepath.Join(t.TempDir(), "bids.vault")
+	c.openVault = func() (*vault.Vault, error) {
+		return vault.Open(vaultPath, []byte("secret"))
+	}
+
+	var committed vault.Record
+	json.Unmarshal(run(t, c, stdout, "vault commit -type buy -volume 30 -price 20 s1"), &committed)
+	if committed.Status != vault.StatusSubmitted || committed.Salt == "" || !bytes.Equal(committed.BidJSON, chaincode.bids[committed.TxID]) {
+		t.Fatalf("vault commit = %+v, want the submitted bid with its salt", committed)
+	}
+
+	// bids of open sessions are left pending
+	run(t, c, stdout, "vault reveal")
+	if err := c.run(context.Background(), strings.Fields("vault reveal s1")); err == nil {
+		t.Error("vault reveal of an open session: want an error")
+	}
+
+	chaincode.sessions["s1"].Status = gepx.StatusClosed
+	var revealed []vault.Record
+	json.Unmarshal(run(t, c, stdout, "vault reveal"), &revealed)
+	if len(revealed) != 1 || revealed[0].Status != vault.StatusRevealed || revealed[0].RevealTxID == "" {
+		t.Errorf("vault reveal = %+v, want the revealed bid", revealed)
+	}
+	if finalize := chaincode.transactions[len(chaincode.transactions)-1]; finalize.Name != "FinalizeBid" || !bytes.Equal(finalize.Transient["bid"], committed.BidJSON) {
+		t.Errorf("last transaction = %+v, want FinalizeBid of the committed bytes", finalize)
+	}
+
+	var listed []vault.Record
+	json.Unmarshal(run(t, c, stdout, "vault list s1"), &listed)
+	if len(listed) != 1 || listed[0].Status != vault.StatusRevealed {
+		t.Errorf("vault list = %+v, want the revealed bid", listed)
+	}
+}
+
+func TestCollateralCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	c, stdout := newCLI(chaincode)
+
+	run(t, c, stdout, "collateral deposit client2 500")
+	var deposited collateralOutput
+	json.Unmarshal(run(t, c, stdout, "collateral deposit client2 250"), &deposited)
+	if deposited.TxID != "tx2" || deposited.Account.Owner != "client2" || deposited.Account.Balance != 750 {
+		t.Errorf("collateral deposit = %+v, want a balance of 750", deposited)
+	}
+
+	var account gepx.CollateralAccount
+	json.Unmarshal(run(t, c, stdout, "query collateral client2"), &account)
+	if account.Balance != 750 {
+		t.Errorf("query collateral = %+v, want a balance of 750", account)
+	}
+
+	err := c.run(context.Background(), strings.Fields("collateral deposit client2 -5"))
+	if err == nil || !strings.Contains(err.Error(), "must be positive") {
+		t.Errorf("collateral deposit of a negative amount = %v, want the contract's error", err)
+	}
+	err = c.run(context.Background(), strings.Fields("collateral deposit client2 ten"))
+	if err == nil || !strings.Contains(err.Error(), "must be a number") {
+		t.Errorf("collateral deposit of ten = %v, want a number error", err)
+	}
+}
+
+func TestAssetCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	c, stdout := newCLI(chaincode)
+
+	var registered assetOutput
+	json.Unmarshal(run(t, c, stdout, "asset register -technology solar -renewable -capacity 100 -connection-point cp1 pv1"), &registered)
+
+	if args := chaincode.transactions[0].Args; strings.Join(args, ",") != "pv1,generation,solar,true,100,0,cp1" {
+		t.Errorf("RegisterAsset arguments = %v, want the flags of the asset", args)
+	}
+	want := gepx.Asset{AssetID: "pv1", Owner: "client1", Org: "Org1MSP", Kind: gepx.Generation, Technology: "solar", Renewable: true, Capacity: 100, ConnectionPoint: "cp1"}
+	if registered.TxID != "tx1" || *registered.Asset != want {
+		t.Errorf("asset register = %+v, want %+v", registered, want)
+	}
+
+	run(t, c, stdout, "asset register -kind load -capacity 20 -ramp-rate 5 heat1")
+	var asset gepx.Asset
+	json.Unmarshal(run(t, c, stdout, "query asset heat1"), &asset)
+	if asset.Kind != gepx.Load || asset.Renewable || asset.RampRate != 5 {
+		t.Errorf("query asset = %+v, want the load heat1", asset)
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	chaincode := newFakeChaincode()
+	c, stdout := newCLI(chaincode)
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(configPath, []byte(`{"clearingAlgorithm":"uniformPrice","allocationRule":"sequential","bidDeposit":250,"currency":"EUR","unit":"kWh"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run(t, c, stdout, "config publish daily "+configPath)
+	var published gepx.PublishMarketConfigResponse
+	json.Unmarshal(run(t, c, stdout, "config publish daily "+configPath), &published)
+	if published.TxID != "tx2" || published.Version != 2 {
+		t.Errorf("config publish = %+v, want version 2", published)
+	}
+
+	var config gepx.MarketConfig
+	json.Unmarshal([]byte(chaincode.transactions[1].Args[1]), &config)
+	if chaincode.transactions[1].Args[0] != "daily" || config.ClearingAlgorithm != "uniformPrice" || config.BidDeposit != 250 {
+		t.Errorf("PublishMarketConfig arguments = %v, want the config file", chaincode.transactions[1].Args)
+	}
+
+	invalidPath := filepath.Join(t.TempDir(), "invalid.json")
+	if err := os.WriteFile(invalidPath, []byte("clearing: uniformPrice"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = c.run(context.Background(), strings.Fields("config publish daily "+invalidPath))
+	if err == nil || !strings.Contains(err.Error(), "failed to read market config") {
+		t.Errorf("config publish of an invalid file = %v, want a read error", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []string{
+		"",
+		"session",
+		"session open s1",
+		"session create",
+		"session close s1 s2",
+		"bid place -type buy -volume 30",
+		"bid submit s1",
+		"bid reveal -from bid.json -bid {} ",
+		"bid commit-reveal -type buy -poll 0s s1",
+		"query bid s1",
+		"query id extra",
+		"vault commit -type buy s1 s2",
+		"vault list s1 s2",
+		"vault watch -poll 0s",
+		"collateral deposit client2",
+		"collateral withdraw client2 10",
+		"asset register -capacity 100",
+		"asset register -solar pv1",
+		"config publish daily",
+		"config show daily",
+		"query collateral",
+		"auction create s1",
+	}
+
+	for _, args := range tests {
+		t.Run(args, func(t *testing.T) {
+			c, _ := newCLI(newFakeChaincode())
+			err := c.run(context.Background(), strings.Fields(args))
+			if !errors.Is(err, errUsage) {
+				t.Errorf("gepx %v = %v, want a usage error", args, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command gepx runs the session and bid transactions of the GEPx chaincode as
+// a wallet identity of an organization. The organization, its gateway peer and
+// its wallet are taken from a profile of a JSON profiles file. Results are
+// printed as JSON.
+//
+// Usage:
+//
+//	gepx [-config profiles.json] [-profile org1] [-user appUser] [-vault bids.vault] <command> [flags] [arguments]
+//
+//	gepx session create [-market-config configID] sessionID
+//	gepx session close sessionID
+//	gepx session end sessionID
+//	gepx bid place -type buy|sell -volume n -price n [bid flags] [-save bid.json] sessionID
+//	gepx bid submit -from bid.json | sessionID txID
+//	gepx bid reveal -from bid.json | -bid bidJSON sessionID txID
+//	gepx bid commit-reveal -type buy|sell -volume n -price n [bid flags] [-save bid.json] [-poll 10s] [-timeout 1h] sessionID
+//	gepx query session sessionID
+//	gepx query bid sessionID txID
+//	gepx query collateral owner
+//	gepx query asset assetID
+//	gepx query id
+//	gepx vault commit -type buy|sell -volume n -price n [bid flags] sessionID
+//	gepx vault list [sessionID]
+//	gepx vault reveal [sessionID]
+//	gepx vault watch [-poll 10s]
+//	gepx collateral deposit owner amount
+//	gepx asset register [-kind generation|load] -technology t [-renewable] -capacity n [-ramp-rate n] [-connection-point cp] assetID
+//	gepx config publish configID config.json
+//
+// The vault commands keep committed bids in an encrypted vault file, from which
+// they are revealed when their sessions close. The vault is opened with the
+// passphrase of $GEPX_VAULT_PASSPHRASE.
+//
+// collateral deposit and config publish need an identity with the operator role.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/gateway"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gepx: ")
+
+	configPath := flag.String("config", defaultConfigPath(), "profiles file, or $GEPX_CONFIG")
+	profileName := flag.String("profile", os.Getenv("GEPX_PROFILE"), "profile to connect with, or $GEPX_PROFILE")
+	user := flag.String("user", "", "wallet identity to connect as, instead of the identity of the profile")
+	vaultPath := flag.String("vault", defaultVaultPath(), "vault file of committed bids, or $GEPX_VAULT")
+	flag.Usage = usage
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	c := &cli{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		connect: func() (*gepx.Client, func(), error) {
+			return connect(*configPath, *profileName, *user)
+		},
+		openVault: func() (*vault.Vault, error) {
+			return openVault(*vaultPath)
+		},
+	}
+
+	err := c.run(ctx, flag.Args())
+	if errors.Is(err, errUsage) {
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: gepx [-config profiles.json] [-profile name] [-user label] [-vault bids.vault] <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "       gepx session create [-market-config configID] sessionID")
+	fmt.Fprintln(os.Stderr, "       gepx session close|end sessionID")
+	fmt.Fprintln(os.Stderr, "       gepx bid place -type buy|sell -volume n -price n [bid flags] [-save bid.json] sessionID")
+	fmt.Fprintln(os.Stderr, "       gepx bid submit -from bid.json | sessionID txID")
+	fmt.Fprintln(os.Stderr, "       gepx bid reveal -from bid.json | -bid bidJSON sessionID txID")
+	fmt.Fprintln(os.Stderr, "       gepx bid commit-reveal -type buy|sell -volume n -price n [bid flags] [-save bid.json] [-poll 10s] [-timeout 1h] sessionID")
+	fmt.Fprintln(os.Stderr, "       gepx query session sessionID | bid sessionID txID | collateral owner | asset assetID | id")
+	fmt.Fprintln(os.Stderr, "       gepx vault commit -type buy|sell -volume n -price n [bid flags] sessionID")
+	fmt.Fprintln(os.Stderr, "       gepx vault list|reveal [sessionID]")
+	fmt.Fprintln(os.Stderr, "       gepx vault watch [-poll 10s]")
+	fmt.Fprintln(os.Stderr, "       gepx collateral deposit owner amount")
+	fmt.Fprintln(os.Stderr, "       gepx asset register [-kind generation|load] -technology t [-renewable] -capacity n [-ramp-rate n] [-connection-point cp] assetID")
+	fmt.Fprintln(os.Stderr, "       gepx config publish configID config.json")
+	os.Exit(2)
+}
+
+// defaultConfigPath returns the profiles file of the environment, or
+// profiles.json in the working directory
+func defaultConfigPath() string {
+	if path := os.Getenv("GEPX_CONFIG"); path != "" {
+		return path
+	}
+	return "profiles.json"
+}
+
+// defaultVaultPath returns the vault file of the environment, or bids.vault in
+// the working directory
+func defaultVaultPath() string {
+	if path := os.Getenv("GEPX_VAULT"); path != "" {
+		return path
+	}
+	return "bids.vault"
+}
+
+// openVault opens a vault file with the passphrase of the environment
+func openVault(path string) (*vault.Vault, error) {
+
+	passphrase := os.Getenv("GEPX_VAULT_PASSPHRASE")
+	if passphrase == "" {
+		return nil, fmt.Errorf("set GEPX_VAULT_PASSPHRASE to open vault %v", path)
+	}
+
+	return vault.Open(path, []byte(passphrase))
+}
+
+// connect connects the identity of a profile to its gateway peer. The returned
+// function closes the connection
+func connect(configPath string, profileName string, user string) (*gepx.Client, func(), error) {
+
+	config, err := gateway.LoadConfig(configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile, err := config.Profile(profileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := gateway.Dial(*profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	connection, err := gateway.Connect(conn, *profile, user)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return connection.Client, func() {
+		connection.Close()
+		conn.Close()
+	}, nil
+}
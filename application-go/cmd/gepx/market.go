@@ -0,0 +1,157 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+// collateralOutput is the output of collateral deposit: the transaction and the
+// collateral account after it
+type collateralOutput struct {
+	TxID    string                  `json:"txID"`
+	Account *gepx.CollateralAccount `json:"account"`
+}
+
+// assetOutput is the output of asset register: the transaction and the asset
+type assetOutput struct {
+	TxID  string      `json:"txID"`
+	Asset *gepx.Asset `json:"asset"`
+}
+
+// collateral runs the collateral commands
+func (c *cli) collateral(ctx context.Context, command string, args []string) error {
+
+	if command != "deposit" {
+		return errUsage
+	}
+
+	flags := c.flagSet("collateral deposit")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 2 {
+		return errUsage
+	}
+	owner := flags.Arg(0)
+	amount, err := strconv.Atoi(flags.Arg(1))
+	if err != nil {
+		return fmt.Errorf("collateral amount must be a number, got %q", flags.Arg(1))
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	receipt, err := client.DepositCollateral(ctx, gepx.DepositCollateralRequest{Owner: owner, Amount: amount})
+	if err != nil {
+		return err
+	}
+
+	account, err := client.QueryCollateral(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	return c.print(collateralOutput{TxID: receipt.TxID, Account: account})
+}
+
+// asset runs the asset commands
+func (c *cli) asset(ctx context.Context, command string, args []string) error {
+
+	if command != "register" {
+		return errUsage
+	}
+
+	flags := c.flagSet("asset register")
+	kind := flags.String("kind", gepx.Generation, "generation or load")
+	technology := flags.String("technology", "", "technology of the asset, e.g. solar")
+	renewable := flags.Bool("renewable", false, "the asset generates renewable energy, for which certificates can be issued")
+	capacity := flags.Int("capacity", 0, "capacity of the asset")
+	rampRate := flags.Int("ramp-rate", 0, "maximum change of output between sessions, 0 for no limit")
+	connectionPoint := flags.String("connection-point", "", "grid connection point of the asset")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+	assetID := flags.Arg(0)
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	receipt, err := client.RegisterAsset(ctx, gepx.RegisterAssetRequest{
+		AssetID:         assetID,
+		Kind:            *kind,
+		Technology:      *technology,
+		Renewable:       *renewable,
+		Capacity:        *capacity,
+		RampRate:        *rampRate,
+		ConnectionPoint: *connectionPoint,
+	})
+	if err != nil {
+		return err
+	}
+
+	asset, err := client.QueryAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	return c.print(assetOutput{TxID: receipt.TxID, Asset: asset})
+}
+
+// config runs the market config commands
+func (c *cli) config(ctx context.Context, command string, args []string) error {
+
+	if command != "publish" {
+		return errUsage
+	}
+
+	flags := c.flagSet("config publish")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 2 {
+		return errUsage
+	}
+	configID, configPath := flags.Arg(0), flags.Arg(1)
+
+	configJSON, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	var config gepx.MarketConfig
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return fmt.Errorf("failed to read market config %v: %w", configPath, err)
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	published, err := client.PublishMarketConfig(ctx, gepx.PublishMarketConfigRequest{ConfigID: configID, Config: config})
+	if err != nil {
+		return err
+	}
+
+	return c.print(published)
+}
@@ -0,0 +1,168 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+)
+
+// vault runs the vault commands
+func (c *cli) vault(ctx context.Context, command string, args []string) error {
+
+	switch command {
+	case "commit":
+		return c.vaultCommit(ctx, args)
+	case "list":
+		return c.vaultList(args)
+	case "reveal":
+		return c.vaultReveal(ctx, args)
+	case "watch":
+		return c.vaultWatch(ctx, args)
+	}
+
+	return errUsage
+}
+
+// vaultCommit places and submits a bid, and records it in the vault
+func (c *cli) vaultCommit(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("vault commit")
+	bid := bidFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 1 {
+		return errUsage
+	}
+
+	request, err := bid(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	bidder, closeBidder, err := c.bidder()
+	if err != nil {
+		return err
+	}
+	defer closeBidder()
+
+	record, err := bidder.Commit(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	return c.print(record)
+}
+
+// vaultList prints the records of the vault, of a session or of all sessions
+func (c *cli) vaultList(args []string) error {
+
+	if len(args) > 1 {
+		return errUsage
+	}
+	sessionID := ""
+	if len(args) == 1 {
+		sessionID = args[0]
+	}
+
+	v, err := c.openVault()
+	if err != nil {
+		return err
+	}
+
+	return c.print(v.Records(sessionID))
+}
+
+// vaultReveal reveals the pending bids of a closed session, or of all closed
+// sessions
+func (c *cli) vaultReveal(ctx context.Context, args []string) error {
+
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	bidder, closeBidder, err := c.bidder()
+	if err != nil {
+		return err
+	}
+	defer closeBidder()
+
+	var records []vault.Record
+	if len(args) == 1 {
+		records, err = bidder.Reveal(ctx, args[0])
+	} else {
+		records, err = bidder.RevealClosed(ctx)
+	}
+	if records != nil {
+		c.print(records)
+	}
+
+	return err
+}
+
+// vaultWatch polls the sessions of the pending bids in the vault, and reveals
+// the bids of each session as soon as it is closed
+func (c *cli) vaultWatch(ctx context.Context, args []string) error {
+
+	flags := c.flagSet("vault watch")
+	poll := flags.Duration("poll", 10*time.Second, "interval at which the sessions of pending bids are polled")
+	if err := flags.Parse(args); err != nil {
+		return errUsage
+	}
+	if flags.NArg() != 0 || *poll <= 0 {
+		return errUsage
+	}
+
+	bidder, closeBidder, err := c.bidder()
+	if err != nil {
+		return err
+	}
+	defer closeBidder()
+
+	ticker := time.NewTicker(*poll)
+	defer ticker.Stop()
+
+	for {
+		records, err := bidder.RevealClosed(ctx)
+		for _, record := range records {
+			switch record.Status {
+			case vault.StatusRevealed:
+				fmt.Fprintf(c.stderr, "revealed bid %v in session %v\n", record.TxID, record.SessionID)
+			case vault.StatusExpired:
+				fmt.Fprintf(c.stderr, "bid %v in session %v has expired\n", record.TxID, record.SessionID)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(c.stderr, "failed to reveal bids: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// bidder connects the client and opens the vault of its bids. The returned
+// function closes the connection
+func (c *cli) bidder() (*vault.Bidder, func(), error) {
+
+	v, err := c.openVault()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, closeClient, err := c.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return vault.NewBidder(client, v), closeClient, nil
+}
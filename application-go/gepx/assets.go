@@ -0,0 +1,86 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Asset is a generation or load asset of a participant. Sell bids have to
+// reference a generation asset of the bidder
+type Asset struct {
+	AssetID         string `json:"assetID"`
+	Owner           string `json:"owner"`
+	Org             string `json:"org"`
+	Kind            string `json:"kind"`
+	Technology      string `json:"technology"`
+	Renewable       bool   `json:"renewable"`
+	Capacity        int    `json:"capacity"`
+	RampRate        int    `json:"rampRate"`
+	ConnectionPoint string `json:"connectionPoint"`
+}
+
+// The kinds of an asset
+const (
+	Generation = "generation"
+	Load       = "load"
+)
+
+// RegisterAssetRequest registers an asset of the client. Kind is Generation or
+// Load, and a ramp rate of zero leaves the ramping of the asset unchecked
+type RegisterAssetRequest struct {
+	AssetID         string `json:"assetID"`
+	Kind            string `json:"kind"`
+	Technology      string `json:"technology"`
+	Renewable       bool   `json:"renewable"`
+	Capacity        int    `json:"capacity"`
+	RampRate        int    `json:"rampRate,omitempty"`
+	ConnectionPoint string `json:"connectionPoint,omitempty"`
+}
+
+// RegisterAsset registers an asset with the client as its owner
+func (c *Client) RegisterAsset(ctx context.Context, request RegisterAssetRequest) (*Receipt, error) {
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name: "RegisterAsset",
+		Args: []string{
+			request.AssetID,
+			request.Kind,
+			request.Technology,
+			strconv.FormatBool(request.Renewable),
+			strconv.Itoa(request.Capacity),
+			strconv.Itoa(request.RampRate),
+			request.ConnectionPoint,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register asset %v: %w", request.AssetID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// QueryAsset reads a registered asset
+func (c *Client) QueryAsset(ctx context.Context, assetID string) (*Asset, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name: "QueryAsset",
+		Args: []string{assetID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query asset %v: %w", assetID, err)
+	}
+
+	var asset Asset
+	err = json.Unmarshal(result, &asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read asset %v: %w", assetID, err)
+	}
+
+	return &asset, nil
+}
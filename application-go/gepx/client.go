@@ -0,0 +1,59 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package gepx is a client for the session contract of the GEPx chaincode. It
+// wraps the transactions of a session, from CreateSession to EndSession, in
+// typed requests and responses, and targets the endorsing organizations that
+// each transaction needs. The transactions are sent through a Contract, which is
+// either a Fabric Gateway connection (package gateway) or an in-memory ledger
+// (package memory).
+package gepx
+
+import (
+	"context"
+)
+
+// Transaction is a transaction of the chaincode as it is sent to the peers. Name
+// is the transaction name, prefixed by the contract name for contracts other
+// than the session contract, e.g. "energy:Transfer". EndorsingOrgs is empty to
+// let the gateway select the endorsers
+type Transaction struct {
+	Name          string
+	Args          []string
+	Transient     map[string][]byte
+	EndorsingOrgs []string
+}
+
+// Contract sends transactions of the chaincode as a single client identity
+type Contract interface {
+	// Submit endorses the transaction, commits it to the ledger and waits for
+	// the commit. It returns the result of the transaction and its ID
+	Submit(ctx context.Context, transaction Transaction) ([]byte, string, error)
+
+	// Evaluate runs the transaction on a peer without committing it
+	Evaluate(ctx context.Context, transaction Transaction) ([]byte, error)
+}
+
+// Client runs the session transactions of a client identity of an organization
+type Client struct {
+	contract Contract
+	org      string
+}
+
+// NewClient returns a client that sends its transactions through the contract.
+// org is the MSP ID of the client identity of the contract
+func NewClient(contract Contract, org string) *Client {
+	return &Client{contract: contract, org: org}
+}
+
+// Org returns the MSP ID of the client
+func (c *Client) Org() string {
+	return c.org
+}
+
+// Contract returns the contract the client sends its transactions through, for
+// transactions the client does not wrap
+func (c *Client) Contract() Contract {
+	return c.contract
+}
@@ -0,0 +1,66 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// CollateralAccount is the prepaid collateral of a participant. Reserved is the
+// part of the balance that is locked against bids that have not been settled
+type CollateralAccount struct {
+	Owner    string `json:"owner"`
+	Balance  int    `json:"balance"`
+	Reserved int    `json:"reserved"`
+}
+
+// Available returns the part of the collateral balance that can back new bids
+func (a *CollateralAccount) Available() int {
+	return a.Balance - a.Reserved
+}
+
+// DepositCollateralRequest credits collateral to the account of a participant
+type DepositCollateralRequest struct {
+	Owner  string `json:"owner"`
+	Amount int    `json:"amount"`
+}
+
+// DepositCollateral credits collateral to a participant once the funds have been
+// received off-chain. The client has to be a market operator
+func (c *Client) DepositCollateral(ctx context.Context, request DepositCollateralRequest) (*Receipt, error) {
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name: "DepositCollateral",
+		Args: []string{request.Owner, strconv.Itoa(request.Amount)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to deposit collateral of %v: %w", request.Owner, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// QueryCollateral reads the collateral account of a participant
+func (c *Client) QueryCollateral(ctx context.Context, owner string) (*CollateralAccount, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name: "QueryCollateral",
+		Args: []string{owner},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query collateral of %v: %w", owner, err)
+	}
+
+	var account CollateralAccount
+	err = json.Unmarshal(result, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collateral of %v: %w", owner, err)
+	}
+
+	return &account, nil
+}
@@ -0,0 +1,51 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PublishMarketConfigRequest creates a market config or publishes a new version
+// of it. The ID and version of Config are set by the contract
+type PublishMarketConfigRequest struct {
+	ConfigID string       `json:"configID"`
+	Config   MarketConfig `json:"config"`
+}
+
+// PublishMarketConfigResponse is the version a market config was published as
+type PublishMarketConfigResponse struct {
+	TxID    string `json:"txID"`
+	Version int    `json:"version"`
+}
+
+// PublishMarketConfig publishes a market config. Sessions that are created
+// afterwards under the config run under the new version. The client has to be a
+// market operator
+func (c *Client) PublishMarketConfig(ctx context.Context, request PublishMarketConfigRequest) (*PublishMarketConfigResponse, error) {
+
+	configJSON, err := json.Marshal(request.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	result, txID, err := c.contract.Submit(ctx, Transaction{
+		Name: "PublishMarketConfig",
+		Args: []string{request.ConfigID, string(configJSON)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish market config %v: %w", request.ConfigID, err)
+	}
+
+	response := PublishMarketConfigResponse{TxID: txID}
+	err = json.Unmarshal(result, &response.Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read version of market config %v: %w", request.ConfigID, err)
+	}
+
+	return &response, nil
+}
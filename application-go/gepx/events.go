@@ -0,0 +1,60 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import "context"
+
+// The names of the chaincode events of session transitions
+const (
+	SessionCreatedEvent = "SessionCreated"
+	SessionClosedEvent  = "SessionClosed"
+	SessionEndedEvent   = "SessionEnded"
+	SessionSettledEvent = "SessionSettled"
+)
+
+// Event is a chaincode event of a committed transaction
+type Event struct {
+	BlockNumber uint64
+	TxID        string
+	Name        string
+	Payload     []byte
+}
+
+// EventSource delivers the chaincode events of committed transactions. The
+// channel is closed when ctx is done or the subscription fails
+type EventSource interface {
+	Events(ctx context.Context) (<-chan Event, error)
+}
+
+// SessionEvent is the payload of a session event. Result and Allocations are
+// only set by the SessionEnded event
+type SessionEvent struct {
+	SessionID   string          `json:"sessionID"`
+	Status      string          `json:"status"`
+	Result      *ClearingResult `json:"result,omitempty"`
+	Allocations []BidAllocation `json:"allocations,omitempty"`
+}
+
+// BidAllocation is the outcome of a revealed bid when its session is cleared
+type BidAllocation struct {
+	BidKey          string  `json:"bidKey"`
+	Bidder          string  `json:"bidder"`
+	Org             string  `json:"org"`
+	BidType         BidType `json:"bidType"`
+	Volume          int     `json:"volume"`
+	Allocated       int     `json:"allocatedVolume"`
+	Delivered       int     `json:"deliveredVolume"`
+	SettlementPrice int     `json:"settlementPrice"`
+	Status          string  `json:"status"`
+}
+
+// IsSessionEvent reports whether an event is emitted by a session transition
+func IsSessionEvent(name string) bool {
+	switch name {
+	case SessionCreatedEvent, SessionClosedEvent, SessionEndedEvent, SessionSettledEvent:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// Connection is a gateway connection of a wallet identity to the chaincode
+type Connection struct {
+	*gepx.Client
+
+	gateway    *client.Gateway
+	network    *client.Network
+	chaincode  string
+	checkpoint *client.InMemoryCheckpointer
+}
+
+// Dial opens a TLS connection to the gateway peer of a profile. The connection
+// can be shared by the identities that connect through it
+func Dial(profile Profile) (*grpc.ClientConn, error) {
+
+	certificatePEM, err := os.ReadFile(profile.TLSCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(certificatePEM) {
+		return nil, fmt.Errorf("no certificate found in %v", profile.TLSCertPath)
+	}
+
+	transportCredentials := credentials.NewClientTLSFromCert(certPool, profile.GatewayPeer)
+
+	conn, err := grpc.Dial(profile.PeerEndpoint, grpc.WithTransportCredentials(transportCredentials))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %v: %w", profile.PeerEndpoint, err)
+	}
+
+	return conn, nil
+}
+
+// Connect connects an identity of the profile's wallet to the chaincode of the
+// profile, through a connection returned by Dial. The identity of the profile is
+// used if label is empty
+func Connect(conn grpc.ClientConnInterface, profile Profile, label string) (*Connection, error) {
+
+	if label == "" {
+		label = profile.Identity
+	}
+	if label == "" {
+		return nil, fmt.Errorf("no identity given and the profile has no identity")
+	}
+
+	id, sign, err := ReadWalletIdentity(profile.WalletPath, label)
+	if err != nil {
+		return nil, err
+	}
+	if id.MspID() != profile.MSPID {
+		return nil, fmt.Errorf("identity %v is a member of %v, not of %v", label, id.MspID(), profile.MSPID)
+	}
+
+	gw, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(conn),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	network := gw.GetNetwork(profile.Channel)
+	contract := New(network.GetContract(profile.Chaincode))
+
+	return &Connection{
+		Client:     gepx.NewClient(contract, profile.MSPID),
+		gateway:    gw,
+		network:    network,
+		chaincode:  profile.Chaincode,
+		checkpoint: new(client.InMemoryCheckpointer),
+	}, nil
+}
+
+// Network returns the channel of the connection
+func (c *Connection) Network() *client.Network {
+	return c.network
+}
+
+// Close closes the gateway of the identity. The gRPC connection it was created
+// with stays open
+func (c *Connection) Close() error {
+	return c.gateway.Close()
+}
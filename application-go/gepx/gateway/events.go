@@ -0,0 +1,40 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"context"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+// Events delivers the chaincode events of the connection's chaincode. The
+// first subscription starts with the next committed block; later ones resume
+// after the last event that was delivered, so that no event is lost when a
+// subscription is renewed after a failure. Subscriptions of a connection must
+// not overlap
+func (c *Connection) Events(ctx context.Context) (<-chan gepx.Event, error) {
+
+	events, err := c.network.ChaincodeEvents(ctx, c.chaincode, client.WithCheckpoint(c.checkpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan gepx.Event)
+	go func() {
+		defer close(out)
+		for event := range events {
+			select {
+			case out <- gepx.Event{BlockNumber: event.BlockNumber, TxID: event.TransactionID, Name: event.EventName, Payload: event.Payload}:
+				c.checkpoint.CheckpointChaincodeEvent(event)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,117 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package gateway sends the transactions of the gepx client through the Fabric
+// Gateway of a peer.
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"google.golang.org/grpc/status"
+)
+
+// Contract is a gepx contract on a chaincode of a Fabric Gateway connection
+type Contract struct {
+	contract *client.Contract
+}
+
+// New returns a contract that sends transactions to the chaincode of a gateway
+// connection, as the identity the gateway was connected with
+func New(contract *client.Contract) *Contract {
+	return &Contract{contract: contract}
+}
+
+// Submit endorses the transaction, submits it to the orderer and waits until it
+// is committed. A transaction that is committed as invalid returns an error
+func (c *Contract) Submit(ctx context.Context, transaction gepx.Transaction) ([]byte, string, error) {
+
+	proposal, err := c.contract.NewProposal(transaction.Name, proposalOptions(transaction)...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	endorsed, err := proposal.EndorseWithContext(ctx)
+	if err != nil {
+		return nil, proposal.TransactionID(), withDetails(err)
+	}
+
+	commit, err := endorsed.SubmitWithContext(ctx)
+	if err != nil {
+		return nil, proposal.TransactionID(), err
+	}
+
+	status, err := commit.StatusWithContext(ctx)
+	if err != nil {
+		return nil, proposal.TransactionID(), err
+	}
+	if !status.Successful {
+		return nil, status.TransactionID, fmt.Errorf("transaction %v was committed with status %v", status.TransactionID, status.Code)
+	}
+
+	return endorsed.Result(), status.TransactionID, nil
+}
+
+// Evaluate runs the transaction on a peer of the endorsing organizations, or on
+// a peer the gateway selects
+func (c *Contract) Evaluate(ctx context.Context, transaction gepx.Transaction) ([]byte, error) {
+	result, err := c.contract.EvaluateWithContext(ctx, transaction.Name, proposalOptions(transaction)...)
+	if err != nil {
+		return nil, withDetails(err)
+	}
+
+	return result, nil
+}
+
+// detailedError is a gateway error with the messages of the peers that failed
+// it. The gateway's own message does not say why the chaincode failed
+type detailedError struct {
+	err      error
+	messages []string
+}
+
+func (e *detailedError) Error() string {
+	return e.err.Error() + ": " + strings.Join(e.messages, "; ")
+}
+
+func (e *detailedError) Unwrap() error {
+	return e.err
+}
+
+// withDetails adds the peer messages attached to the gRPC status of an error to
+// its message
+func withDetails(err error) error {
+
+	var messages []string
+	for _, detail := range status.Convert(err).Details() {
+		if detail, ok := detail.(*gateway.ErrorDetail); ok {
+			messages = append(messages, fmt.Sprintf("%v (%v): %v", detail.GetAddress(), detail.GetMspId(), detail.GetMessage()))
+		}
+	}
+	if len(messages) == 0 {
+		return err
+	}
+
+	return &detailedError{err: err, messages: messages}
+}
+
+// proposalOptions returns the arguments, transient data and endorsing
+// organizations of a transaction as proposal options
+func proposalOptions(transaction gepx.Transaction) []client.ProposalOption {
+
+	options := []client.ProposalOption{client.WithArguments(transaction.Args...)}
+	if len(transaction.Transient) > 0 {
+		options = append(options, client.WithTransient(transaction.Transient))
+	}
+	if len(transaction.EndorsingOrgs) > 0 {
+		options = append(options, client.WithEndorsingOrganizations(transaction.EndorsingOrgs...))
+	}
+
+	return options
+}
@@ -0,0 +1,36 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestWithDetails(t *testing.T) {
+	endorseErr, err := status.New(codes.Aborted, "failed to endorse transaction, see attached details for more info").
+		WithDetails(&gateway.ErrorDetail{Address: "peer0.org1.example.com:7051", MspId: "Org1MSP", Message: "chaincode response 500, session does not exist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	detailed := withDetails(endorseErr.Err())
+	if !strings.Contains(detailed.Error(), "peer0.org1.example.com:7051 (Org1MSP): chaincode response 500, session does not exist") {
+		t.Errorf("error = %v, want the message of the peer", detailed)
+	}
+	if status.Code(detailed) != codes.Aborted {
+		t.Errorf("code of the error = %v, want the code of the gateway", status.Code(detailed))
+	}
+
+	plain := errors.New("connection refused")
+	if withDetails(plain) != plain {
+		t.Errorf("error without details was changed")
+	}
+}
@@ -0,0 +1,107 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"google.golang.org/grpc"
+)
+
+// Pool connects the wallet identities of the profiles of a configuration on
+// first use, and keeps them connected until it is closed. The identities of a
+// profile share one connection to its gateway peer
+type Pool struct {
+	config *Config
+
+	mutex       sync.Mutex
+	conns       map[string]*grpc.ClientConn
+	connections map[poolKey]*Connection
+}
+
+type poolKey struct {
+	profile string
+	label   string
+}
+
+// NewPool returns a pool of connections of the profiles of a configuration
+func NewPool(config *Config) *Pool {
+	return &Pool{
+		config:      config,
+		conns:       make(map[string]*grpc.ClientConn),
+		connections: make(map[poolKey]*Connection),
+	}
+}
+
+// Connection returns the connection of an identity of a profile, connecting it
+// if it is not connected yet. The identity of the profile is used if label is
+// empty
+func (p *Pool) Connection(profileName string, label string) (*Connection, error) {
+
+	profile, err := p.config.Profile(profileName)
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		label = profile.Identity
+	}
+	key := poolKey{profile: profileName, label: label}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if connection, ok := p.connections[key]; ok {
+		return connection, nil
+	}
+
+	conn, ok := p.conns[profileName]
+	if !ok {
+		conn, err = Dial(*profile)
+		if err != nil {
+			return nil, err
+		}
+		p.conns[profileName] = conn
+	}
+
+	connection, err := Connect(conn, *profile, label)
+	if err != nil {
+		return nil, err
+	}
+	p.connections[key] = connection
+
+	return connection, nil
+}
+
+// Client returns the client of an identity of a profile
+func (p *Pool) Client(profileName string, label string) (*gepx.Client, error) {
+
+	connection, err := p.Connection(profileName, label)
+	if err != nil {
+		return nil, err
+	}
+
+	return connection.Client, nil
+}
+
+// Close closes the connections of the pool
+func (p *Pool) Close() error {
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var errs []error
+	for key, connection := range p.connections {
+		errs = append(errs, connection.Close())
+		delete(p.connections, key)
+	}
+	for name, conn := range p.conns {
+		errs = append(errs, conn.Close())
+		delete(p.conns, name)
+	}
+
+	return errors.Join(errs...)
+}
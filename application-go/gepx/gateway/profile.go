@@ -0,0 +1,144 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	defaultChannel   = "mychannel"
+	defaultChaincode = "gepx"
+)
+
+// Config is a set of connection profiles by name
+type Config struct {
+	DefaultProfile string             `json:"defaultProfile,omitempty"`
+	Profiles       map[string]Profile `json:"profiles"`
+}
+
+// Profile describes how a client of an organization connects to the chaincode:
+// the gateway peer of the organization, the wallet of its identities and the
+// channel and chaincode. GatewayPeer is the host name of the peer's TLS
+// certificate, if it differs from the host of PeerEndpoint. Identity is the
+// wallet label that is used when no other identity is given
+type Profile struct {
+	MSPID        string `json:"mspID"`
+	PeerEndpoint string `json:"peerEndpoint"`
+	GatewayPeer  string `json:"gatewayPeer,omitempty"`
+	TLSCertPath  string `json:"tlsCertPath"`
+	WalletPath   string `json:"walletPath"`
+	Identity     string `json:"identity,omitempty"`
+	Channel      string `json:"channel,omitempty"`
+	Chaincode    string `json:"chaincode,omitempty"`
+}
+
+// LoadConfig reads connection profiles from a JSON file. Relative paths of the
+// profiles are taken relative to the directory of the file
+func LoadConfig(path string) (*Config, error) {
+
+	configJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles %v: %w", path, err)
+	}
+	if len(config.Profiles) == 0 {
+		return nil, fmt.Errorf("no profiles in %v", path)
+	}
+
+	dir := filepath.Dir(path)
+	for name, profile := range config.Profiles {
+		profile.TLSCertPath = resolve(dir, profile.TLSCertPath)
+		profile.WalletPath = resolve(dir, profile.WalletPath)
+		if profile.Channel == "" {
+			profile.Channel = defaultChannel
+		}
+		if profile.Chaincode == "" {
+			profile.Chaincode = defaultChaincode
+		}
+
+		err = profile.validate()
+		if err != nil {
+			return nil, fmt.Errorf("profile %v: %w", name, err)
+		}
+		config.Profiles[name] = profile
+	}
+
+	return &config, nil
+}
+
+// Profile returns the profile of a name, or the default profile if the name is
+// empty. A config with a single profile has that profile as default
+func (c *Config) Profile(name string) (*Profile, error) {
+
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" && len(c.Profiles) == 1 {
+		for single := range c.Profiles {
+			name = single
+		}
+	}
+	if name == "" {
+		return nil, fmt.Errorf("no profile selected and no default profile, profiles are %v", c.names())
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %v not found, profiles are %v", name, c.names())
+	}
+
+	return &profile, nil
+}
+
+// names returns the sorted names of the profiles
+func (c *Config) names() []string {
+
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// validate checks that a profile has everything needed to connect
+func (p *Profile) validate() error {
+
+	if p.MSPID == "" {
+		return fmt.Errorf("mspID is missing")
+	}
+	if p.PeerEndpoint == "" {
+		return fmt.Errorf("peerEndpoint is missing")
+	}
+	if p.TLSCertPath == "" {
+		return fmt.Errorf("tlsCertPath is missing")
+	}
+	if p.WalletPath == "" {
+		return fmt.Errorf("walletPath is missing")
+	}
+
+	return nil
+}
+
+// resolve returns a path relative to dir, unless the path is absolute or empty
+func resolve(dir string, path string) string {
+
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,106 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.json")
+	writeFile(t, path, `{
+		"defaultProfile": "org1",
+		"profiles": {
+			"org1": {"mspID": "Org1MSP", "peerEndpoint": "localhost:7051", "tlsCertPath": "org1/ca.crt", "walletPath": "wallet/org1", "identity": "appUser"},
+			"org2": {"mspID": "Org2MSP", "peerEndpoint": "localhost:9051", "tlsCertPath": "/etc/org2/ca.crt", "walletPath": "wallet/org2", "channel": "gepx", "chaincode": "market"}
+		}
+	}`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	org1, err := config.Profile("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Profile{
+		MSPID:        "Org1MSP",
+		PeerEndpoint: "localhost:7051",
+		TLSCertPath:  filepath.Join(dir, "org1/ca.crt"),
+		WalletPath:   filepath.Join(dir, "wallet/org1"),
+		Identity:     "appUser",
+		Channel:      "mychannel",
+		Chaincode:    "gepx",
+	}
+	if *org1 != want {
+		t.Errorf("default profile = %+v, want %+v", org1, want)
+	}
+
+	org2, err := config.Profile("org2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if org2.TLSCertPath != "/etc/org2/ca.crt" || org2.Channel != "gepx" || org2.Chaincode != "market" {
+		t.Errorf("profile org2 = %+v, want its absolute path, channel and chaincode", org2)
+	}
+
+	_, err = config.Profile("org3")
+	if err == nil || !strings.Contains(err.Error(), "profiles are [org1 org2]") {
+		t.Errorf("Profile(org3) = %v, want an error naming the profiles", err)
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		errContains string
+	}{
+		{"invalid JSON", `{"profiles": [}`, "failed to read profiles"},
+		{"no profiles", `{"profiles": {}}`, "no profiles"},
+		{"missing msp", `{"profiles": {"org1": {"peerEndpoint": "localhost:7051", "tlsCertPath": "ca.crt", "walletPath": "wallet"}}}`, "profile org1: mspID is missing"},
+		{"missing endpoint", `{"profiles": {"org1": {"mspID": "Org1MSP", "tlsCertPath": "ca.crt", "walletPath": "wallet"}}}`, "peerEndpoint is missing"},
+		{"missing wallet", `{"profiles": {"org1": {"mspID": "Org1MSP", "peerEndpoint": "localhost:7051", "tlsCertPath": "ca.crt"}}}`, "walletPath is missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "profiles.json")
+			writeFile(t, path, tt.config)
+
+			_, err := LoadConfig(path)
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("LoadConfig = %v, want error containing %q", err, tt.errContains)
+			}
+		})
+	}
+}
+
+func TestProfileSelection(t *testing.T) {
+	single := Config{Profiles: map[string]Profile{"org1": {MSPID: "Org1MSP"}}}
+	if profile, err := single.Profile(""); err != nil || profile.MSPID != "Org1MSP" {
+		t.Errorf("Profile of a single profile config = %+v, %v, want the single profile", profile, err)
+	}
+
+	several := Config{Profiles: map[string]Profile{"org1": {MSPID: "Org1MSP"}, "org2": {MSPID: "Org2MSP"}}}
+	if _, err := several.Profile(""); err == nil {
+		t.Errorf("Profile without a default profile succeeded")
+	}
+}
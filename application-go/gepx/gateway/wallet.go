@@ -0,0 +1,72 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// walletIdentity is an X.509 identity as the file system wallets of the
+// javascript applications store it, in a file <label>.id
+type walletIdentity struct {
+	Credentials struct {
+		Certificate string `json:"certificate"`
+		PrivateKey  string `json:"privateKey"`
+	} `json:"credentials"`
+	MSPID   string `json:"mspId"`
+	Type    string `json:"type"`
+	Version int    `json:"version"`
+}
+
+// ReadWalletIdentity reads the identity of a label from a file system wallet,
+// such as the wallets that enrollAdmin.js and registerEnrollUser.js create. It
+// returns the identity and the signer of its private key
+func ReadWalletIdentity(walletPath string, label string) (*identity.X509Identity, identity.Sign, error) {
+
+	if label == "" || filepath.Base(label) != label {
+		return nil, nil, fmt.Errorf("invalid wallet label %q", label)
+	}
+
+	idJSON, err := os.ReadFile(filepath.Join(walletPath, label+".id"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("identity %v not found in wallet %v: %w", label, walletPath, err)
+	}
+
+	var stored walletIdentity
+	err = json.Unmarshal(idJSON, &stored)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read identity %v: %w", label, err)
+	}
+	if stored.Type != "X.509" {
+		return nil, nil, fmt.Errorf("identity %v has unsupported type %q", label, stored.Type)
+	}
+
+	certificate, err := identity.CertificateFromPEM([]byte(stored.Credentials.Certificate))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read certificate of identity %v: %w", label, err)
+	}
+
+	id, err := identity.NewX509Identity(stored.MSPID, certificate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	privateKey, err := identity.PrivateKeyFromPEM([]byte(stored.Credentials.PrivateKey))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read private key of identity %v: %w", label, err)
+	}
+
+	sign, err := identity.NewPrivateKeySign(privateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return id, sign, nil
+}
@@ -0,0 +1,111 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeWalletIdentity stores a new self-signed identity in a wallet, in the
+// format of the javascript wallets, and returns its private key
+func writeWalletIdentity(t *testing.T, walletPath string, label string, mspID string, idType string) *ecdsa.PrivateKey {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: label, OrganizationalUnit: []string{"client"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var stored walletIdentity
+	stored.Credentials.Certificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}))
+	stored.Credentials.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}))
+	stored.MSPID = mspID
+	stored.Type = idType
+	stored.Version = 1
+
+	idJSON, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(walletPath, label+".id"), string(idJSON))
+
+	return privateKey
+}
+
+func TestReadWalletIdentity(t *testing.T) {
+	wallet := t.TempDir()
+	privateKey := writeWalletIdentity(t, wallet, "appUser", "Org1MSP", "X.509")
+
+	id, sign, err := ReadWalletIdentity(wallet, "appUser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.MspID() != "Org1MSP" || !strings.Contains(string(id.Credentials()), "BEGIN CERTIFICATE") {
+		t.Errorf("identity = %v %s, want the certificate of Org1MSP", id.MspID(), id.Credentials())
+	}
+
+	// the signer signs with the private key of the identity
+	digest := sha256.Sum256([]byte("proposal"))
+	signature, err := sign(digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], signature) {
+		t.Errorf("signature does not verify with the identity's key")
+	}
+}
+
+func TestReadWalletIdentityErrors(t *testing.T) {
+	wallet := t.TempDir()
+	writeWalletIdentity(t, wallet, "hsmUser", "Org1MSP", "HSM-X.509")
+	writeFile(t, filepath.Join(wallet, "broken.id"), `{"credentials": {"certificate": "none"}, "mspId": "Org1MSP", "type": "X.509"}`)
+
+	tests := []struct {
+		label       string
+		errContains string
+	}{
+		{"missing", "identity missing not found"},
+		{"../appUser", "invalid wallet label"},
+		{"", "invalid wallet label"},
+		{"hsmUser", "unsupported type"},
+		{"broken", "failed to read certificate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			_, _, err := ReadWalletIdentity(wallet, tt.label)
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("ReadWalletIdentity(%q) = %v, want error containing %q", tt.label, err, tt.errContains)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memory
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// pollInterval is how often an event source looks for new events
+const pollInterval = 10 * time.Millisecond
+
+// EventSource delivers the events of the transactions committed to an
+// in-memory ledger. The ledger has no blocks, so every event is given the
+// block number of its position among the ledger's events
+type EventSource struct {
+	ledger *mockledger.Ledger
+	next   int
+}
+
+// NewEventSource returns a source of the events that are committed to the
+// ledger from now on
+func NewEventSource(ledger *mockledger.Ledger) *EventSource {
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	return &EventSource{ledger: ledger, next: len(ledger.Events())}
+}
+
+// Events polls the ledger for new events until ctx is done. A subscription
+// resumes after the last event that an earlier one delivered. Subscriptions of
+// a source must not overlap
+func (s *EventSource) Events(ctx context.Context) (<-chan gepx.Event, error) {
+
+	out := make(chan gepx.Event)
+	go func() {
+		defer close(out)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			mutex.Lock()
+			events := s.ledger.Events()[s.next:]
+			mutex.Unlock()
+
+			for _, event := range events {
+				select {
+				case out <- gepx.Event{BlockNumber: uint64(s.next + 1), TxID: event.TxID, Name: event.Name, Payload: event.Payload}:
+					s.next++
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,215 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package memory runs the transactions of the gepx client against the GEPx
+// contracts on an in-memory ledger, for tests and simulations without a Fabric
+// network. It links the chaincode, whose Fabric protobufs conflict with those of
+// the gateway client, so a program cannot use both this package and package
+// gateway.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/energy-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/intraday-market"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+// the mock ledger passes the peer organization to the chaincode through the
+// process environment, so transactions are run one at a time across ledgers
+var mutex sync.Mutex
+
+// contracts are the contracts of the chaincode by name, as they are registered
+// by the chaincode's main package
+var contracts = map[string]interface{}{
+	"":         new(session.SmartContract),
+	"energy":   new(energy.EnergyContract),
+	"payment":  new(payment.PaymentContract),
+	"intraday": new(intraday.IntradayContract),
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Contract runs transactions on an in-memory ledger as a client identity
+type Contract struct {
+	ledger *mockledger.Ledger
+	client *mockledger.Identity
+}
+
+// New returns a contract that runs the transactions of the client on the ledger
+func New(ledger *mockledger.Ledger, client *mockledger.Identity) *Contract {
+	return &Contract{ledger: ledger, client: client}
+}
+
+// Submit runs the transaction and commits its writes if it succeeds. The
+// transaction runs on a peer of the client's organization if that organization
+// is one of the endorsing organizations, and on a peer of the first endorsing
+// organization otherwise
+func (c *Contract) Submit(ctx context.Context, transaction gepx.Transaction) ([]byte, string, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var result []byte
+	txID, err := c.ledger.Submit(c.client, func(txCtx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = invoke(txCtx, transaction)
+		return err
+	}, c.options(transaction)...)
+	if err != nil {
+		return nil, txID, err
+	}
+
+	return result, txID, nil
+}
+
+// Evaluate runs the transaction and discards its writes
+func (c *Contract) Evaluate(ctx context.Context, transaction gepx.Transaction) ([]byte, error) {
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var result []byte
+	err := c.ledger.Evaluate(c.client, func(txCtx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = invoke(txCtx, transaction)
+		return err
+	}, c.options(transaction)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// options returns the transient data and peer organization of a transaction
+func (c *Contract) options(transaction gepx.Transaction) []mockledger.Option {
+
+	options := []mockledger.Option{mockledger.WithTransient(transaction.Transient)}
+
+	if len(transaction.EndorsingOrgs) > 0 {
+		peerOrg := transaction.EndorsingOrgs[0]
+		for _, org := range transaction.EndorsingOrgs {
+			if org == c.client.MSPID {
+				peerOrg = org
+			}
+		}
+		options = append(options, mockledger.WithPeerOrg(peerOrg))
+	}
+
+	return options
+}
+
+// invoke calls the contract function of a transaction with its string arguments
+// converted to the parameter types of the function, and returns the result as
+// the contract API serializes it: strings as they are, other values as JSON
+func invoke(ctx contractapi.TransactionContextInterface, transaction gepx.Transaction) ([]byte, error) {
+
+	contractName, function := "", transaction.Name
+	if i := strings.LastIndex(transaction.Name, ":"); i >= 0 {
+		contractName, function = transaction.Name[:i], transaction.Name[i+1:]
+	}
+
+	contract, ok := contracts[contractName]
+	if !ok {
+		return nil, fmt.Errorf("contract %v not found", contractName)
+	}
+
+	method := reflect.ValueOf(contract).MethodByName(function)
+	if !method.IsValid() {
+		return nil, fmt.Errorf("function %v not found in contract %v", function, contractName)
+	}
+
+	methodType := method.Type()
+	if methodType.NumIn() != len(transaction.Args)+1 {
+		return nil, fmt.Errorf("function %v expects %d arguments, got %d", function, methodType.NumIn()-1, len(transaction.Args))
+	}
+
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+	for i, arg := range transaction.Args {
+		value, err := parseArg(arg, methodType.In(i+1))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d of function %v: %v", i+1, function, err)
+		}
+		in = append(in, value)
+	}
+
+	out := method.Call(in)
+
+	if len(out) > 0 && out[len(out)-1].Type() == errorType {
+		if err := out[len(out)-1]; !err.IsNil() {
+			return nil, err.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return nil, nil
+	}
+
+	result := out[0]
+	if result.Kind() == reflect.String {
+		return []byte(result.String()), nil
+	}
+	if result.Kind() == reflect.Ptr && result.IsNil() {
+		return nil, nil
+	}
+
+	return json.Marshal(result.Interface())
+}
+
+// parseArg converts a string argument to a parameter type: numbers and booleans
+// are parsed, and slices, maps and structs are read as JSON
+func parseArg(arg string, paramType reflect.Type) (reflect.Value, error) {
+
+	value := reflect.New(paramType).Elem()
+
+	switch paramType.Kind() {
+	case reflect.String:
+		value.SetString(arg)
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		n, err := strconv.ParseInt(arg, 10, paramType.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetInt(n)
+	case reflect.Float64, reflect.Float32:
+		f, err := strconv.ParseFloat(arg, paramType.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(arg)
+		if err != nil {
+			return value, err
+		}
+		value.SetBool(b)
+	default:
+		err := json.Unmarshal([]byte(arg), value.Addr().Interface())
+		if err != nil {
+			return value, err
+		}
+	}
+
+	return value, nil
+}
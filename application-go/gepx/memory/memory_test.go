@@ -0,0 +1,74 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memory
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestContract(t *testing.T) {
+	ledger := mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC))
+	client := mockledger.NewIdentity("admin", "Org1MSP")
+	contract := New(ledger, client)
+	ctx := context.Background()
+
+	_, txID, err := contract.Submit(ctx, gepx.Transaction{Name: "CreateSession", Args: []string{"s1", ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txID != "tx000001" || ledger.State("s1") == nil {
+		t.Fatalf("CreateSession committed as %v, want the session in state", txID)
+	}
+
+	// strings are returned as they are, other values as JSON
+	id, err := contract.Evaluate(ctx, gepx.Transaction{Name: "GetID"})
+	if err != nil || string(id) != client.ID() {
+		t.Errorf("GetID = %s, %v, want %v", id, err, client.ID())
+	}
+	session, err := contract.Evaluate(ctx, gepx.Transaction{Name: "QuerySession", Args: []string{"s1"}})
+	if err != nil || !strings.HasPrefix(string(session), `{"admin":`) {
+		t.Errorf("QuerySession = %s, %v, want the session JSON", session, err)
+	}
+	balance, err := contract.Evaluate(ctx, gepx.Transaction{Name: "payment:BalanceOf", Args: []string{client.ID()}})
+	if err != nil || string(balance) != "0" {
+		t.Errorf("payment:BalanceOf = %s, %v, want 0", balance, err)
+	}
+
+	tests := []struct {
+		name        string
+		transaction gepx.Transaction
+		errContains string
+	}{
+		{"unknown contract", gepx.Transaction{Name: "bank:Transfer"}, "contract bank not found"},
+		{"unknown function", gepx.Transaction{Name: "Missing"}, "function Missing not found"},
+		{"missing arguments", gepx.Transaction{Name: "QuerySession"}, "expects 1 arguments, got 0"},
+		{"invalid number", gepx.Transaction{Name: "DepositCollateral", Args: []string{"owner", "ten"}}, "argument 2"},
+		{"contract error", gepx.Transaction{Name: "CloseSession", Args: []string{"missing"}}, "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := contract.Submit(ctx, tt.transaction)
+			if err == nil || !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Submit = %v, want error containing %q", err, tt.errContains)
+			}
+		})
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, err := contract.Submit(cancelled, gepx.Transaction{Name: "CloseSession", Args: []string{"s1"}}); err != context.Canceled {
+		t.Errorf("Submit with cancelled context = %v, want %v", err, context.Canceled)
+	}
+	if !strings.Contains(string(ledger.State("s1")), `"status":"Open"`) {
+		t.Errorf("session s1 = %s, want it open after failed transactions", ledger.State("s1"))
+	}
+}
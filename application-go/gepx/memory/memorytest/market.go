@@ -0,0 +1,78 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package memorytest provides a market on an in-memory ledger that is set up
+// for the tests of the gepx clients. It is only meant to be imported by tests.
+package memorytest
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// roleAttribute is the certificate attribute the contracts read market roles from
+const roleAttribute = "gepx.role"
+
+// Market is an in-memory ledger that is set up for trading, as the tests of the
+// gepx clients need it. The seller of Org1MSP and the buyer of Org2MSP each hold
+// 10000 of collateral and of payment tokens, and the seller owns the renewable
+// generation asset pv1 with a capacity of 100. Admin creates sessions, Operator
+// has the operator role. No session is created
+type Market struct {
+	Ledger   *mockledger.Ledger
+	Admin    *mockledger.Identity
+	Operator *mockledger.Identity
+	Seller   *mockledger.Identity
+	Buyer    *mockledger.Identity
+}
+
+// NewMarket returns a market on a ledger that starts on 1 March 2021 at noon UTC
+func NewMarket(ctx context.Context) (*Market, error) {
+
+	m := &Market{
+		Ledger:   mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)),
+		Admin:    mockledger.NewIdentity("admin", "Org1MSP"),
+		Operator: mockledger.NewIdentity("operator", "Org1MSP").WithAttribute(roleAttribute, "operator"),
+		Seller:   mockledger.NewIdentity("seller", "Org1MSP"),
+		Buyer:    mockledger.NewIdentity("buyer", "Org2MSP"),
+	}
+
+	operator := m.Client(m.Operator)
+	issuer := memory.New(m.Ledger, mockledger.NewIdentity("issuer", "Org1MSP").WithAttribute(roleAttribute, "paymentIssuer"))
+
+	for _, participant := range []*mockledger.Identity{m.Seller, m.Buyer} {
+		_, err := operator.DepositCollateral(ctx, gepx.DepositCollateralRequest{Owner: participant.ID(), Amount: 10000})
+		if err != nil {
+			return nil, err
+		}
+		_, _, err = issuer.Submit(ctx, gepx.Transaction{Name: "payment:Mint", Args: []string{participant.ID(), "10000"}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to mint payment tokens of %v: %w", participant.ID(), err)
+		}
+	}
+
+	_, err := m.Client(m.Seller).RegisterAsset(ctx, gepx.RegisterAssetRequest{
+		AssetID:    "pv1",
+		Kind:       gepx.Generation,
+		Technology: "solar",
+		Renewable:  true,
+		Capacity:   100,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Client returns a client that runs the transactions of an identity on the
+// ledger of the market
+func (m *Market) Client(identity *mockledger.Identity) *gepx.Client {
+	return gepx.NewClient(memory.New(m.Ledger, identity), identity.MSPID)
+}
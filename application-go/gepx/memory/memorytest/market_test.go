@@ -0,0 +1,49 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memorytest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestNewMarket(t *testing.T) {
+	ctx := context.Background()
+
+	market, err := NewMarket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, participant := range []*mockledger.Identity{market.Seller, market.Buyer} {
+		client := market.Client(participant)
+
+		account, err := client.QueryCollateral(ctx, participant.ID())
+		if err != nil || account.Balance != 10000 {
+			t.Errorf("collateral of %v = %+v, %v, want 10000", participant.ID(), account, err)
+		}
+		balance, err := client.Contract().Evaluate(ctx, gepx.Transaction{Name: "payment:BalanceOf", Args: []string{participant.ID()}})
+		if err != nil || string(balance) != "10000" {
+			t.Errorf("payment balance of %v = %s, %v, want 10000", participant.ID(), balance, err)
+		}
+	}
+
+	asset, err := market.Client(market.Buyer).QueryAsset(ctx, "pv1")
+	if err != nil || asset.Owner != market.Seller.ID() || asset.Capacity != 100 {
+		t.Errorf("asset pv1 = %+v, %v, want the seller's asset of 100", asset, err)
+	}
+
+	// only the operator can deposit collateral
+	request := gepx.DepositCollateralRequest{Owner: market.Admin.ID(), Amount: 100}
+	if _, err := market.Client(market.Operator).DepositCollateral(ctx, request); err != nil {
+		t.Errorf("DepositCollateral by the operator = %v", err)
+	}
+	if _, err := market.Client(market.Admin).DepositCollateral(ctx, request); err == nil {
+		t.Errorf("DepositCollateral by the admin succeeded")
+	}
+}
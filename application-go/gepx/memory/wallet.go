@@ -0,0 +1,45 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package memory
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// Wallet holds identities of an in-memory ledger under the profile and label
+// they would have in the wallets of a gateway configuration, so that code that
+// selects identities by profile and label can run against the ledger
+type Wallet struct {
+	ledger     *mockledger.Ledger
+	identities map[string]map[string]*mockledger.Identity
+}
+
+// NewWallet returns an empty wallet of the ledger
+func NewWallet(ledger *mockledger.Ledger) *Wallet {
+	return &Wallet{ledger: ledger, identities: make(map[string]map[string]*mockledger.Identity)}
+}
+
+// Put stores an identity under a profile and label
+func (w *Wallet) Put(profile string, label string, identity *mockledger.Identity) {
+
+	if w.identities[profile] == nil {
+		w.identities[profile] = make(map[string]*mockledger.Identity)
+	}
+	w.identities[profile][label] = identity
+}
+
+// Client returns a client of the identity stored under a profile and label
+func (w *Wallet) Client(profile string, label string) (*gepx.Client, error) {
+
+	identity, ok := w.identities[profile][label]
+	if !ok {
+		return nil, fmt.Errorf("identity %v not found in profile %v", label, profile)
+	}
+
+	return gepx.NewClient(New(w.ledger, identity), identity.MSPID), nil
+}
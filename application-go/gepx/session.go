@@ -0,0 +1,273 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// CreateSessionRequest creates a session under the latest version of a market
+// config, or under the default config if ConfigID is empty
+type CreateSessionRequest struct {
+	SessionID string `json:"sessionID"`
+	ConfigID  string `json:"configID,omitempty"`
+}
+
+// BidRequest places a bid in a session. The org, bidder and status of the bid
+// are set to the client's when they are empty
+type BidRequest struct {
+	SessionID string  `json:"sessionID"`
+	Bid       FullBid `json:"bid"`
+}
+
+// BidResponse is a placed bid. TxID identifies the bid in the session, and
+// BidJSON are the exact bytes that were placed: FinalizeBid has to reveal the
+// same bytes, or the hash check of the contract fails
+type BidResponse struct {
+	SessionID string  `json:"sessionID"`
+	TxID      string  `json:"txID"`
+	Bid       FullBid `json:"bid"`
+	BidJSON   []byte  `json:"bidJSON"`
+}
+
+// SubmitBidRequest adds the hash of a placed bid to its session
+type SubmitBidRequest struct {
+	SessionID string `json:"sessionID"`
+	TxID      string `json:"txID"`
+}
+
+// FinalizeBidRequest reveals a submitted bid after its session is closed.
+// BidJSON are the bytes the bid was placed with
+type FinalizeBidRequest struct {
+	SessionID string `json:"sessionID"`
+	TxID      string `json:"txID"`
+	BidJSON   []byte `json:"bidJSON"`
+}
+
+// SessionRequest closes or ends a session
+type SessionRequest struct {
+	SessionID string `json:"sessionID"`
+}
+
+// Receipt identifies the committed transaction of a request
+type Receipt struct {
+	TxID string `json:"txID"`
+}
+
+// EndSessionResponse is the outcome of ending a session
+type EndSessionResponse struct {
+	TxID   string         `json:"txID"`
+	Result ClearingResult `json:"result"`
+}
+
+// CreateSession creates a session with the client as its admin
+func (c *Client) CreateSession(ctx context.Context, request CreateSessionRequest) (*Receipt, error) {
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name: "CreateSession",
+		Args: []string{request.SessionID, request.ConfigID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session %v: %w", request.SessionID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// Bid places a bid in the private data collection of the client's organization.
+// The bid is passed as transient data and endorsed by the client's organization
+// only, so that it is not seen by the peers of other organizations
+func (c *Client) Bid(ctx context.Context, request BidRequest) (*BidResponse, error) {
+
+	bid := request.Bid
+	if bid.Org == "" {
+		bid.Org = c.org
+	}
+	if bid.Bidder == "" {
+		clientID, err := c.GetID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		bid.Bidder = clientID
+	}
+	if bid.Status == "" {
+		bid.Status = "Placed"
+	}
+
+	bidJSON, err := json.Marshal(bid)
+	if err != nil {
+		return nil, err
+	}
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "Bid",
+		Args:          []string{request.SessionID},
+		Transient:     map[string][]byte{"bid": bidJSON},
+		EndorsingOrgs: []string{c.org},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to place bid in session %v: %w", request.SessionID, err)
+	}
+
+	return &BidResponse{SessionID: request.SessionID, TxID: txID, Bid: bid, BidJSON: bidJSON}, nil
+}
+
+// SubmitBid adds the hash of a placed bid to its session. The transaction is
+// endorsed by the organizations of the session
+func (c *Client) SubmitBid(ctx context.Context, request SubmitBidRequest) (*Receipt, error) {
+
+	orgs, err := c.sessionOrgs(ctx, request.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "SubmitBid",
+		Args:          []string{request.SessionID, request.TxID},
+		EndorsingOrgs: orgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit bid %v to session %v: %w", request.TxID, request.SessionID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// FinalizeBid reveals a bid to its closed session. The transaction is endorsed
+// by the organizations of the session
+func (c *Client) FinalizeBid(ctx context.Context, request FinalizeBidRequest) (*Receipt, error) {
+
+	if len(request.BidJSON) == 0 {
+		return nil, fmt.Errorf("bid %v cannot be revealed without the bytes it was placed with", request.TxID)
+	}
+
+	orgs, err := c.sessionOrgs(ctx, request.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "FinalizeBid",
+		Args:          []string{request.SessionID, request.TxID},
+		Transient:     map[string][]byte{"bid": request.BidJSON},
+		EndorsingOrgs: orgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reveal bid %v in session %v: %w", request.TxID, request.SessionID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// CloseSession closes a session to new bids, so that the bids can be revealed
+func (c *Client) CloseSession(ctx context.Context, request SessionRequest) (*Receipt, error) {
+
+	orgs, err := c.sessionOrgs(ctx, request.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "CloseSession",
+		Args:          []string{request.SessionID},
+		EndorsingOrgs: orgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to close session %v: %w", request.SessionID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// EndSession clears the revealed bids of a closed session
+func (c *Client) EndSession(ctx context.Context, request SessionRequest) (*EndSessionResponse, error) {
+
+	orgs, err := c.sessionOrgs(ctx, request.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "EndSession",
+		Args:          []string{request.SessionID},
+		EndorsingOrgs: orgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to end session %v: %w", request.SessionID, err)
+	}
+
+	response := EndSessionResponse{TxID: txID}
+	err = json.Unmarshal(result, &response.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clearing result of session %v: %w", request.SessionID, err)
+	}
+
+	return &response, nil
+}
+
+// QuerySession reads a session from the public channel
+func (c *Client) QuerySession(ctx context.Context, sessionID string) (*Session, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name: "QuerySession",
+		Args: []string{sessionID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query session %v: %w", sessionID, err)
+	}
+
+	var session Session
+	err = json.Unmarshal(result, &session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session %v: %w", sessionID, err)
+	}
+
+	return &session, nil
+}
+
+// QueryBid reads a bid of the client from the private data of its organization
+func (c *Client) QueryBid(ctx context.Context, sessionID string, txID string) (*FullBid, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name:          "QueryBid",
+		Args:          []string{sessionID, txID},
+		EndorsingOrgs: []string{c.org},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bid %v in session %v: %w", txID, sessionID, err)
+	}
+
+	var bid FullBid
+	err = json.Unmarshal(result, &bid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bid %v in session %v: %w", txID, sessionID, err)
+	}
+
+	return &bid, nil
+}
+
+// GetID returns the client ID of the client, as the contract sees it
+func (c *Client) GetID(ctx context.Context) (string, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{Name: "GetID"})
+	if err != nil {
+		return "", fmt.Errorf("failed to get client ID: %w", err)
+	}
+
+	return string(result), nil
+}
+
+// sessionOrgs returns the organizations that endorse the transactions of a session
+func (c *Client) sessionOrgs(ctx context.Context, sessionID string) ([]string, error) {
+
+	session, err := c.QuerySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return session.Orgs, nil
+}
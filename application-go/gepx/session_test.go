@@ -0,0 +1,338 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory/memorytest"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+var ctx = context.Background()
+
+// market is a market of package memory with clients of its admin, operator,
+// seller and buyer
+type market struct {
+	t        *testing.T
+	ledger   *mockledger.Ledger
+	admin    *gepx.Client
+	operator *gepx.Client
+	seller   *gepx.Client
+	buyer    *gepx.Client
+}
+
+func newMarket(t *testing.T) *market {
+	t.Helper()
+
+	shared, err := memorytest.NewMarket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &market{
+		t:        t,
+		ledger:   shared.Ledger,
+		admin:    shared.Client(shared.Admin),
+		operator: shared.Client(shared.Operator),
+		seller:   shared.Client(shared.Seller),
+		buyer:    shared.Client(shared.Buyer),
+	}
+
+	if _, err := m.admin.CreateSession(ctx, gepx.CreateSessionRequest{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+// bid places and submits a bid of the client in session s1
+func (m *market) bid(client *gepx.Client, bid gepx.FullBid) *gepx.BidResponse {
+	m.t.Helper()
+
+	placed, err := client.Bid(ctx, gepx.BidRequest{SessionID: "s1", Bid: bid})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	if _, err := client.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: "s1", TxID: placed.TxID}); err != nil {
+		m.t.Fatal(err)
+	}
+
+	return placed
+}
+
+func (m *market) finalize(client *gepx.Client, placed *gepx.BidResponse) {
+	m.t.Helper()
+
+	_, err := client.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: placed.SessionID, TxID: placed.TxID, BidJSON: placed.BidJSON})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	m := newMarket(t)
+
+	sell := m.bid(m.seller, gepx.FullBid{BidType: gepx.Sell, Volume: 50, Price: 10, AssetID: "pv1"})
+	buy := m.bid(m.buyer, gepx.FullBid{BidType: gepx.Buy, Volume: 30, Price: 20})
+
+	session, err := m.admin.QuerySession(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(session.Orgs, ",") != "Org1MSP,Org2MSP" || len(session.PrivateBids) != 2 {
+		t.Fatalf("session after bidding = %+v, want two private bids of both orgs", session)
+	}
+
+	if _, err := m.admin.CloseSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	m.finalize(m.seller, sell)
+	m.finalize(m.buyer, buy)
+
+	ended, err := m.admin.EndSession(ctx, gepx.SessionRequest{SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ended.TxID == "" || ended.Result.ClearingPrice <= 0 {
+		t.Fatalf("EndSession = %+v, want a transaction and a clearing price", ended)
+	}
+
+	session, err = m.admin.QuerySession(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Status != gepx.StatusEnded || session.ClearingPrice != ended.Result.ClearingPrice {
+		t.Fatalf("session after ending = %+v, want ended at price %d", session, ended.Result.ClearingPrice)
+	}
+
+	for _, placed := range []*gepx.BidResponse{sell, buy} {
+		var bidKey string
+		for key := range session.FinalizedBids {
+			if strings.Contains(key, placed.TxID) {
+				bidKey = key
+			}
+		}
+		if bid := session.FinalizedBids[bidKey]; bid.Allocated != 30 {
+			t.Errorf("bid %v = %+v, want 30 allocated", placed.TxID, bid)
+		}
+	}
+}
+
+func TestBid(t *testing.T) {
+	m := newMarket(t)
+
+	placed, err := m.buyer.Bid(ctx, gepx.BidRequest{SessionID: "s1", Bid: gepx.FullBid{BidType: gepx.Buy, Volume: 30, Price: 20}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buyerID, err := m.buyer.GetID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Bid.Org != "Org2MSP" || placed.Bid.Bidder != buyerID || placed.Bid.Status != "Placed" {
+		t.Errorf("placed bid = %+v, want the org, bidder and status of the buyer", placed.Bid)
+	}
+
+	// the bid is stored in the private data of the buyer's organization only
+	if m.ledger.PrivateData("_implicit_org_Org2MSP", "\x00bid\x00s1\x00"+placed.TxID+"\x00") == nil {
+		t.Errorf("bid %v is not in the private data of Org2MSP", placed.TxID)
+	}
+
+	bid, err := m.buyer.QueryBid(ctx, "s1", placed.TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *bid != placed.Bid {
+		t.Errorf("QueryBid = %+v, want %+v", bid, placed.Bid)
+	}
+
+	if _, err := m.seller.QueryBid(ctx, "s1", placed.TxID); err == nil {
+		t.Errorf("seller of Org1MSP read the bid of Org2MSP")
+	}
+
+	_, err = m.buyer.Bid(ctx, gepx.BidRequest{SessionID: "s1", Bid: gepx.FullBid{BidType: gepx.Buy, Volume: 0, Price: 20}})
+	if err == nil || !strings.Contains(err.Error(), "must be positive") {
+		t.Errorf("Bid without volume = %v, want the contract's error", err)
+	}
+}
+
+func TestFinalizeBid(t *testing.T) {
+	m := newMarket(t)
+
+	placed := m.bid(m.seller, gepx.FullBid{BidType: gepx.Sell, Volume: 50, Price: 10, AssetID: "pv1"})
+	if _, err := m.admin.CloseSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := m.seller.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: "s1", TxID: placed.TxID})
+	if err == nil {
+		t.Errorf("FinalizeBid without the placed bytes succeeded")
+	}
+
+	// a bid that differs from the placed bytes fails the hash check
+	changed := strings.Replace(string(placed.BidJSON), `"price":10`, `"price":9`, 1)
+	_, err = m.seller.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: "s1", TxID: placed.TxID, BidJSON: []byte(changed)})
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("FinalizeBid with changed bytes = %v, want a hash mismatch", err)
+	}
+
+	m.finalize(m.seller, placed)
+
+	session, err := m.admin.QuerySession(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(session.FinalizedBids) != 1 {
+		t.Errorf("session has %d revealed bids, want 1", len(session.FinalizedBids))
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	m := newMarket(t)
+
+	if _, err := m.admin.QuerySession(ctx, "missing"); err == nil {
+		t.Errorf("QuerySession of a missing session succeeded")
+	}
+	if _, err := m.seller.CloseSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err == nil {
+		t.Errorf("CloseSession by a participant succeeded")
+	}
+	if _, err := m.admin.EndSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err == nil {
+		t.Errorf("EndSession of an open session succeeded")
+	}
+	if _, err := m.seller.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: "s1", TxID: "missing"}); err == nil {
+		t.Errorf("SubmitBid of a missing bid succeeded")
+	}
+}
+
+func TestSettlement(t *testing.T) {
+	m := newMarket(t)
+
+	sell := m.bid(m.seller, gepx.FullBid{BidType: gepx.Sell, Volume: 50, Price: 10, AssetID: "pv1"})
+	buy := m.bid(m.buyer, gepx.FullBid{BidType: gepx.Buy, Volume: 30, Price: 20})
+	if _, err := m.admin.CloseSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	m.finalize(m.seller, sell)
+	m.finalize(m.buyer, buy)
+
+	if _, err := m.admin.SettleSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err == nil {
+		t.Errorf("SettleSession of a closed session succeeded")
+	}
+
+	ended, err := m.admin.EndSession(ctx, gepx.SessionRequest{SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.admin.SettleSession(ctx, gepx.SessionRequest{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	settlement, err := m.admin.QuerySettlement(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settlement.ClearingPrice != ended.Result.ClearingPrice || len(settlement.OrgBalances) == 0 {
+		t.Errorf("settlement = %+v, want the balances at price %d", settlement, ended.Result.ClearingPrice)
+	}
+
+	buyerID, err := m.buyer.GetID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice, err := m.buyer.QueryInvoice(ctx, "s1", buyerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.Participant != buyerID || invoice.Org != "Org2MSP" || len(invoice.LineItems) == 0 {
+		t.Errorf("invoice of the buyer = %+v, want its line items", invoice)
+	}
+}
+
+func TestCollateral(t *testing.T) {
+	m := newMarket(t)
+
+	sellerID, err := m.seller.GetID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.operator.DepositCollateral(ctx, gepx.DepositCollateralRequest{Owner: sellerID, Amount: 500}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.seller.DepositCollateral(ctx, gepx.DepositCollateralRequest{Owner: sellerID, Amount: 500}); err == nil {
+		t.Errorf("DepositCollateral by a participant succeeded")
+	}
+
+	m.bid(m.seller, gepx.FullBid{BidType: gepx.Sell, Volume: 50, Price: 10, AssetID: "pv1"})
+
+	account, err := m.seller.QueryCollateral(ctx, sellerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gepx.CollateralAccount{Owner: sellerID, Balance: 10500, Reserved: 100}
+	if *account != want || account.Available() != 10400 {
+		t.Errorf("QueryCollateral = %+v, want %+v", account, want)
+	}
+}
+
+func TestAsset(t *testing.T) {
+	m := newMarket(t)
+
+	asset, err := m.buyer.QueryAsset(ctx, "pv1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sellerID, err := m.seller.GetID(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gepx.Asset{AssetID: "pv1", Owner: sellerID, Org: "Org1MSP", Kind: gepx.Generation, Technology: "solar", Renewable: true, Capacity: 100}
+	if *asset != want {
+		t.Errorf("QueryAsset = %+v, want %+v", asset, want)
+	}
+
+	_, err = m.buyer.RegisterAsset(ctx, gepx.RegisterAssetRequest{AssetID: "pv1", Kind: gepx.Load, Capacity: 10})
+	if err == nil {
+		t.Errorf("RegisterAsset of a registered asset succeeded")
+	}
+	if _, err := m.buyer.QueryAsset(ctx, "missing"); err == nil {
+		t.Errorf("QueryAsset of a missing asset succeeded")
+	}
+}
+
+func TestPublishMarketConfig(t *testing.T) {
+	m := newMarket(t)
+
+	config := gepx.MarketConfig{ClearingAlgorithm: "uniformPrice", AllocationRule: "sequential", BidDeposit: 250, Currency: "EUR", Unit: "kWh"}
+	for version := 1; version <= 2; version++ {
+		published, err := m.operator.PublishMarketConfig(ctx, gepx.PublishMarketConfigRequest{ConfigID: "day-ahead", Config: config})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if published.TxID == "" || published.Version != version {
+			t.Errorf("PublishMarketConfig = %+v, want version %d", published, version)
+		}
+	}
+
+	if _, err := m.admin.CreateSession(ctx, gepx.CreateSessionRequest{SessionID: "s2", ConfigID: "day-ahead"}); err != nil {
+		t.Fatal(err)
+	}
+	session, err := m.admin.QuerySession(ctx, "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.Config.ConfigID != "day-ahead" || session.Config.Version != 2 || session.Config.BidDeposit != 250 {
+		t.Errorf("session config = %+v, want version 2 of day-ahead", session.Config)
+	}
+
+	_, err = m.seller.PublishMarketConfig(ctx, gepx.PublishMarketConfigRequest{ConfigID: "day-ahead", Config: config})
+	if err == nil {
+		t.Errorf("PublishMarketConfig by a participant succeeded")
+	}
+}
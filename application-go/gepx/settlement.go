@@ -0,0 +1,110 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Settlement is the financial outcome of a settled session. OrgBalances holds
+// the net amount per organization, positive when the organization is owed money.
+// ImbalancePool is what the imbalance charges collected beyond the imbalance
+// credits they paid
+type Settlement struct {
+	SessionID     string         `json:"sessionID"`
+	ClearingPrice int            `json:"clearingPrice"`
+	ZonePrices    map[string]int `json:"zonePrices,omitempty"`
+	Invoices      []Invoice      `json:"invoices"`
+	OrgBalances   map[string]int `json:"orgBalances"`
+	ImbalancePool int            `json:"imbalancePool"`
+}
+
+// Invoice lists the settlement entries of one participant of a session.
+// UnsettledImbalance is the part of the imbalance that was not booked against
+// collateral, negative when the participant still owes it
+type Invoice struct {
+	SessionID          string     `json:"sessionID"`
+	Participant        string     `json:"participant"`
+	Org                string     `json:"org"`
+	LineItems          []LineItem `json:"lineItems"`
+	Total              int        `json:"total"`
+	Paid               int        `json:"paid"`
+	UnsettledImbalance int        `json:"unsettledImbalance"`
+}
+
+// LineItem is a debit or credit entry of an invoice
+type LineItem struct {
+	Item      string  `json:"item"`
+	BidKey    string  `json:"bidKey,omitempty"`
+	BidType   BidType `json:"bidType,omitempty"`
+	Entry     string  `json:"entry"`
+	Volume    int     `json:"volume"`
+	UnitPrice int     `json:"unitPrice"`
+	Amount    int     `json:"amount"`
+}
+
+// SettleSession turns the allocations of an ended session into invoices. The
+// transaction is endorsed by the organizations of the session
+func (c *Client) SettleSession(ctx context.Context, request SessionRequest) (*Receipt, error) {
+
+	orgs, err := c.sessionOrgs(ctx, request.SessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, txID, err := c.contract.Submit(ctx, Transaction{
+		Name:          "SettleSession",
+		Args:          []string{request.SessionID},
+		EndorsingOrgs: orgs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to settle session %v: %w", request.SessionID, err)
+	}
+
+	return &Receipt{TxID: txID}, nil
+}
+
+// QuerySettlement reads the settlement of a session with the invoices of all
+// its participants
+func (c *Client) QuerySettlement(ctx context.Context, sessionID string) (*Settlement, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name: "QuerySettlement",
+		Args: []string{sessionID},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query settlement of session %v: %w", sessionID, err)
+	}
+
+	var settlement Settlement
+	err = json.Unmarshal(result, &settlement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settlement of session %v: %w", sessionID, err)
+	}
+
+	return &settlement, nil
+}
+
+// QueryInvoice reads the invoice of a participant of a settled session
+func (c *Client) QueryInvoice(ctx context.Context, sessionID string, participant string) (*Invoice, error) {
+
+	result, err := c.contract.Evaluate(ctx, Transaction{
+		Name: "QueryInvoice",
+		Args: []string{sessionID, participant},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoice of session %v: %w", sessionID, err)
+	}
+
+	var invoice Invoice
+	err = json.Unmarshal(result, &invoice)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read invoice of session %v: %w", sessionID, err)
+	}
+
+	return &invoice, nil
+}
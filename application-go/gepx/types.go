@@ -0,0 +1,139 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package gepx
+
+// The types below mirror the JSON of the session contract. They are kept in
+// this package, rather than imported from the chaincode, so that clients do not
+// link the chaincode and its Fabric dependencies
+
+// Session is a session as it is stored on the public channel
+type Session struct {
+	Admin           string             `json:"admin"`
+	Orgs            []string           `json:"organizations"`
+	PrivateBids     map[string]BidHash `json:"privateBids"`
+	FinalizedBids   map[string]FullBid `json:"finalizedBids"`
+	Status          string             `json:"status"`
+	Config          MarketConfig       `json:"config"`
+	ClearingPrice   int                `json:"clearingPrice"`
+	Interconnectors []Interconnector   `json:"interconnectors,omitempty"`
+	ZonePrices      map[string]int     `json:"zonePrices,omitempty"`
+	Flows           []Flow             `json:"flows,omitempty"`
+}
+
+// The statuses of a session
+const (
+	StatusOpen      = "Open"
+	StatusClosed    = "Close"
+	StatusEnded     = "ended"
+	StatusSettled   = "settled"
+	StatusCompleted = "completed"
+)
+
+// FullBid is a bid as it is placed in the private data of the bidder's
+// organization, and as it is revealed and cleared in the session
+type FullBid struct {
+	BidType         BidType `json:"bidType"`
+	Volume          int     `json:"volume"`
+	Price           int     `json:"price"`
+	Zone            string  `json:"zone,omitempty"`
+	ConnectionPoint string  `json:"connectionPoint,omitempty"`
+	AssetID         string  `json:"assetID,omitempty"`
+	Green           bool    `json:"green,omitempty"`
+	SourceType      string  `json:"sourceType,omitempty"`
+	CarbonIntensity int     `json:"carbonIntensity,omitempty"`
+	Org             string  `json:"org"`
+	Bidder          string  `json:"bidder"`
+	Status          string  `json:"status"`
+	Allocated       int     `json:"allocatedVolume"`
+	LossFactor      float64 `json:"lossFactor,omitempty"`
+	Delivered       int     `json:"deliveredVolume"`
+	SettlementPrice int     `json:"settlementPrice"`
+
+	// Salt is a random value that keeps the hash of a bid from being guessed
+	// from the few likely volumes and prices. The chaincode ignores it
+	Salt string `json:"salt,omitempty"`
+}
+
+// BidKey returns the key of a bid in the private data of its organization and
+// in the bids of its session: the composite key of the session and the ID of
+// the transaction that placed the bid
+func BidKey(sessionID string, txID string) string {
+	return "\x00bid\x00" + sessionID + "\x00" + txID + "\x00"
+}
+
+// BidHash is the hash of a private bid that was submitted to a session
+type BidHash struct {
+	Org  string `json:"org"`
+	Hash string `json:"hash"`
+}
+
+// BidType is the side of a bid
+type BidType string
+
+const (
+	Sell BidType = "sell"
+	Buy  BidType = "buy"
+)
+
+// IsSell reports whether the bid offers volume to the session
+func (t BidType) IsSell() bool {
+	return t == "sell" || t == "Sell"
+}
+
+// IsBuy reports whether the bid requests volume from the session
+func (t BidType) IsBuy() bool {
+	return t == "buy" || t == "Buy"
+}
+
+// MarketConfig is the market config a session runs under
+type MarketConfig struct {
+	ConfigID          string      `json:"configID"`
+	Version           int         `json:"version"`
+	ClearingAlgorithm string      `json:"clearingAlgorithm"`
+	AllocationRule    string      `json:"allocationRule"`
+	Rules             MarketRules `json:"rules"`
+	BidDeposit        int         `json:"bidDeposit,omitempty"`
+	Schedule          Schedule    `json:"schedule"`
+	Currency          string      `json:"currency"`
+	Unit              string      `json:"unit"`
+}
+
+// MarketRules are the limits that bids of a session have to respect
+type MarketRules struct {
+	MinVolume             int `json:"minVolume"`
+	MaxVolume             int `json:"maxVolume"`
+	PriceFloor            int `json:"priceFloor"`
+	PriceCap              int `json:"priceCap"`
+	TickSize              int `json:"tickSize"`
+	MaxBidsPerParticipant int `json:"maxBidsPerParticipant"`
+}
+
+// Schedule describes when the sessions of a market are run
+type Schedule struct {
+	BiddingOpens     string `json:"biddingOpens"`
+	GateClosure      string `json:"gateClosure"`
+	DeliveryInterval int    `json:"deliveryInterval"`
+}
+
+// Interconnector is the transfer capacity from one bidding zone to another
+type Interconnector struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Capacity int    `json:"capacity"`
+}
+
+// Flow is the volume that the clearing of a session moves between two zones
+type Flow struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Volume int    `json:"volume"`
+}
+
+// ClearingResult is the outcome of ending a session
+type ClearingResult struct {
+	ClearingPrice int            `json:"clearingPrice"`
+	ZonePrices    map[string]int `json:"zonePrices"`
+	Flows         []Flow         `json:"flows"`
+}
@@ -0,0 +1,304 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vault
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+)
+
+// Bidder places the bids of a client identity and keeps them in a vault, so
+// that they can be revealed when their sessions close
+type Bidder struct {
+	client *gepx.Client
+	vault  *Vault
+	retry  time.Duration
+
+	// id is the client ID of the bidder, read from the contract on first use
+	id string
+}
+
+// NewBidder returns a bidder of a client that records its bids in a vault
+func NewBidder(client *gepx.Client, vault *Vault) *Bidder {
+	return &Bidder{client: client, vault: vault, retry: 5 * time.Second}
+}
+
+// Commit places a bid and submits its hash to the session. The bid is recorded
+// in the vault before it is submitted, so that a submitted bid can always be
+// revealed. A random salt is added to the bid if it has none
+func (b *Bidder) Commit(ctx context.Context, request gepx.BidRequest) (*Record, error) {
+
+	if request.Bid.Salt == "" {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		request.Bid.Salt = hex.EncodeToString(salt)
+	}
+
+	placed, err := b.client.Bid(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	record := Record{
+		SessionID: placed.SessionID,
+		TxID:      placed.TxID,
+		BidKey:    gepx.BidKey(placed.SessionID, placed.TxID),
+		Bidder:    placed.Bid.Bidder,
+		Salt:      placed.Bid.Salt,
+		BidJSON:   placed.BidJSON,
+		Status:    StatusPlaced,
+	}
+	err = b.vault.Put(record)
+	if err != nil {
+		return nil, fmt.Errorf("bid %v is placed but not submitted: %w", placed.TxID, err)
+	}
+
+	_, err = b.client.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: placed.SessionID, TxID: placed.TxID})
+	if err != nil {
+		record.Error = err.Error()
+		if putErr := b.vault.Put(record); putErr != nil {
+			return nil, errors.Join(err, putErr)
+		}
+		return nil, err
+	}
+
+	record.Status = StatusSubmitted
+	err = b.vault.Put(record)
+	if err != nil {
+		return nil, fmt.Errorf("bid %v is submitted but its status is not recorded: %w", placed.TxID, err)
+	}
+
+	return &record, nil
+}
+
+// Reveal reveals the pending bids of the bidder in a closed session. Pending
+// bids of a session that has ended are expired, as they can no longer be
+// revealed. A bid that is recorded as placed is revealed as well if its hash is
+// in the session, as its submission may have been committed without the vault
+// recording it. It returns the records it has updated
+func (b *Bidder) Reveal(ctx context.Context, sessionID string) ([]Record, error) {
+
+	session, err := b.client.QuerySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status == gepx.StatusOpen {
+		return nil, fmt.Errorf("session %v is not closed", sessionID)
+	}
+
+	return b.reveal(ctx, sessionID, session)
+}
+
+// RevealClosed reveals the pending bids of every closed session in the vault,
+// and expires those of the sessions that have ended. Sessions that are still
+// open are left for later
+func (b *Bidder) RevealClosed(ctx context.Context) ([]Record, error) {
+
+	var updated []Record
+	var errs []error
+	for _, sessionID := range b.pendingSessions() {
+		session, err := b.client.QuerySession(ctx, sessionID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if session.Status == gepx.StatusOpen {
+			continue
+		}
+
+		records, err := b.reveal(ctx, sessionID, session)
+		updated = append(updated, records...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return updated, errors.Join(errs...)
+}
+
+// Watch reveals the pending bids of each session as soon as the event source
+// reports that the session is closed, until ctx is done. Bids of sessions that
+// closed while the bidder was not watching are revealed whenever the
+// subscription starts. A failed subscription is renewed after a delay
+func (b *Bidder) Watch(ctx context.Context, source gepx.EventSource) error {
+
+	for {
+		events, err := source.Events(ctx)
+		if err != nil {
+			log.Printf("failed to subscribe to chaincode events: %v", err)
+		} else {
+			b.logReveal(b.RevealClosed(ctx))
+
+			for event := range events {
+				if event.Name != gepx.SessionClosedEvent && event.Name != gepx.SessionEndedEvent {
+					continue
+				}
+				sessionID, err := eventSession(event)
+				if err != nil {
+					log.Print(err)
+					continue
+				}
+				if !b.hasPending(sessionID) {
+					continue
+				}
+				b.logReveal(b.Reveal(ctx, sessionID))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(b.retry):
+		}
+	}
+}
+
+// reveal reveals the pending bids of the bidder in a session that is no longer
+// open
+func (b *Bidder) reveal(ctx context.Context, sessionID string, session *gepx.Session) ([]Record, error) {
+
+	bidder, err := b.bidderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []Record
+	var errs []error
+	for _, record := range b.vault.Records(sessionID) {
+		if !unrevealed(record) || record.Bidder != bidder {
+			continue
+		}
+
+		if record.Status == StatusPlaced {
+			if _, ok := session.PrivateBids[record.BidKey]; ok {
+				record.Status = StatusSubmitted
+			}
+		}
+
+		switch {
+		case record.Status == StatusPlaced:
+			// the session no longer takes bids, so the bid can never be submitted
+			record.Status = StatusExpired
+			record.Error = fmt.Sprintf("bid %v was not submitted before session %v closed", record.TxID, sessionID)
+		case hasBid(session.FinalizedBids, record.BidKey):
+			// the bid was revealed before its status was recorded
+			record.Status = StatusRevealed
+			record.Error = ""
+		case session.Status != gepx.StatusClosed:
+			record.Status = StatusExpired
+			record.Error = fmt.Sprintf("session %v was %v before the bid was revealed", sessionID, session.Status)
+		default:
+			receipt, err := b.client.FinalizeBid(ctx, gepx.FinalizeBidRequest{
+				SessionID: record.SessionID,
+				TxID:      record.TxID,
+				BidJSON:   record.BidJSON,
+			})
+			if err != nil {
+				errs = append(errs, err)
+				record.Error = err.Error()
+			} else {
+				record.Status = StatusRevealed
+				record.RevealTxID = receipt.TxID
+				record.Error = ""
+			}
+		}
+
+		if err := b.vault.Put(record); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		updated = append(updated, record)
+	}
+
+	return updated, errors.Join(errs...)
+}
+
+// bidderID returns the client ID of the bidder
+func (b *Bidder) bidderID(ctx context.Context) (string, error) {
+
+	if b.id == "" {
+		id, err := b.client.GetID(ctx)
+		if err != nil {
+			return "", err
+		}
+		b.id = id
+	}
+
+	return b.id, nil
+}
+
+// pendingSessions returns the sessions that have unrevealed bids in the vault
+func (b *Bidder) pendingSessions() []string {
+
+	var sessions []string
+	for _, record := range b.vault.Records("") {
+		if unrevealed(record) && (len(sessions) == 0 || sessions[len(sessions)-1] != record.SessionID) {
+			sessions = append(sessions, record.SessionID)
+		}
+	}
+
+	return sessions
+}
+
+// hasPending reports whether a session has unrevealed bids in the vault
+func (b *Bidder) hasPending(sessionID string) bool {
+
+	for _, record := range b.vault.Records(sessionID) {
+		if unrevealed(record) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// logReveal logs the outcome of revealing bids
+func (b *Bidder) logReveal(records []Record, err error) {
+
+	for _, record := range records {
+		switch record.Status {
+		case StatusRevealed:
+			log.Printf("revealed bid %v in session %v", record.TxID, record.SessionID)
+		case StatusExpired:
+			log.Printf("bid %v in session %v has expired: %v", record.TxID, record.SessionID, record.Error)
+		}
+	}
+	if err != nil {
+		log.Printf("failed to reveal bids: %v", err)
+	}
+}
+
+// eventSession returns the session of a session event
+func eventSession(event gepx.Event) (string, error) {
+
+	var sessionEvent gepx.SessionEvent
+	err := json.Unmarshal(event.Payload, &sessionEvent)
+	if err != nil {
+		return "", fmt.Errorf("failed to read event %v of transaction %v: %w", event.Name, event.TxID, err)
+	}
+
+	return sessionEvent.SessionID, nil
+}
+
+// unrevealed reports whether a recorded bid may still wait to be revealed: a
+// pending bid, or a placed bid whose submission was not recorded
+func unrevealed(record Record) bool {
+	return record.Pending() || record.Status == StatusPlaced
+}
+
+func hasBid(bids map[string]gepx.FullBid, bidKey string) bool {
+	_, ok := bids[bidKey]
+	return ok
+}
@@ -0,0 +1,263 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vault_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/memory/memorytest"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+var ctx = context.Background()
+
+// market is a market of package memory whose buyer keeps its bids in a vault.
+// Sessions s1 and s2 are open
+type market struct {
+	t      *testing.T
+	ledger *mockledger.Ledger
+	admin  *gepx.Client
+	client *gepx.Client
+	buyer  *vault.Bidder
+	vault  *vault.Vault
+}
+
+func newMarket(t *testing.T) *market {
+	t.Helper()
+
+	shared, err := memorytest.NewMarket(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := vault.Open(filepath.Join(t.TempDir(), "bids.vault"), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buyer := shared.Client(shared.Buyer)
+	m := &market{
+		t:      t,
+		ledger: shared.Ledger,
+		admin:  shared.Client(shared.Admin),
+		client: buyer,
+		buyer:  vault.NewBidder(buyer, v),
+		vault:  v,
+	}
+	for _, sessionID := range []string{"s1", "s2"} {
+		if _, err := m.admin.CreateSession(ctx, gepx.CreateSessionRequest{SessionID: sessionID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return m
+}
+
+func (m *market) commit(sessionID string, volume int) *vault.Record {
+	m.t.Helper()
+
+	record, err := m.buyer.Commit(ctx, gepx.BidRequest{SessionID: sessionID, Bid: gepx.FullBid{BidType: gepx.Buy, Volume: volume, Price: 20}})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return record
+}
+
+func (m *market) close(sessionID string) {
+	m.t.Helper()
+
+	if _, err := m.admin.CloseSession(ctx, gepx.SessionRequest{SessionID: sessionID}); err != nil {
+		m.t.Fatal(err)
+	}
+}
+
+func (m *market) finalizedBids(sessionID string) map[string]gepx.FullBid {
+	m.t.Helper()
+
+	session, err := m.admin.QuerySession(ctx, sessionID)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return session.FinalizedBids
+}
+
+func TestCommit(t *testing.T) {
+	m := newMarket(t)
+
+	record := m.commit("s1", 30)
+	if record.Status != vault.StatusSubmitted || len(record.Salt) != 32 || record.BidKey != gepx.BidKey("s1", record.TxID) {
+		t.Fatalf("record = %+v, want a submitted bid with a salt", record)
+	}
+	stored, ok := m.vault.Get(record.BidKey)
+	if !ok || stored.Status != vault.StatusSubmitted || string(stored.BidJSON) != string(record.BidJSON) {
+		t.Fatalf("stored record = %+v, %v, want %+v", stored, ok, record)
+	}
+
+	session, err := m.admin.QuerySession(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := session.PrivateBids[record.BidKey]; !ok {
+		t.Errorf("private bids = %v, want %v", session.PrivateBids, record.BidKey)
+	}
+
+	if _, err := m.buyer.Reveal(ctx, "s1"); err == nil {
+		t.Error("reveal in open session: want an error")
+	}
+}
+
+func TestRevealClosed(t *testing.T) {
+	m := newMarket(t)
+
+	first := m.commit("s1", 30)
+	second := m.commit("s1", 40)
+	open := m.commit("s2", 50)
+	early := m.commit("s2", 60)
+	m.close("s1")
+
+	revealed, err := m.buyer.RevealClosed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revealed) != 2 {
+		t.Fatalf("revealed = %+v, want the bids of s1", revealed)
+	}
+	for _, record := range revealed {
+		if record.Status != vault.StatusRevealed || record.RevealTxID == "" {
+			t.Errorf("record = %+v, want a revealed bid", record)
+		}
+	}
+	finalized := m.finalizedBids("s1")
+	if finalized[first.BidKey].Volume != 30 || finalized[second.BidKey].Volume != 40 {
+		t.Errorf("finalized bids = %+v, want both bids of the buyer", finalized)
+	}
+	if stored, _ := m.vault.Get(open.BidKey); !stored.Pending() {
+		t.Errorf("bid in open session = %+v, want it pending", stored)
+	}
+
+	// a session that ends before its bids are revealed expires them. A bid
+	// that was revealed without the vault is recorded as revealed
+	m.close("s2")
+	_, err = m.client.FinalizeBid(ctx, gepx.FinalizeBidRequest{SessionID: "s2", TxID: early.TxID, BidJSON: early.BidJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.admin.EndSession(ctx, gepx.SessionRequest{SessionID: "s2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.buyer.RevealClosed(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := m.vault.Get(open.BidKey); stored.Status != vault.StatusExpired {
+		t.Errorf("bid of ended session = %+v, want it expired", stored)
+	}
+	if stored, _ := m.vault.Get(early.BidKey); stored.Status != vault.StatusRevealed {
+		t.Errorf("bid revealed without the vault = %+v, want it revealed", stored)
+	}
+}
+
+// place places a bid of the buyer and records it in the vault as placed, as
+// Commit does before it submits the bid
+func (m *market) place(sessionID string, volume int, submit bool) vault.Record {
+	m.t.Helper()
+
+	placed, err := m.client.Bid(ctx, gepx.BidRequest{SessionID: sessionID, Bid: gepx.FullBid{BidType: gepx.Buy, Volume: volume, Price: 20}})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	record := vault.Record{
+		SessionID: sessionID,
+		TxID:      placed.TxID,
+		BidKey:    gepx.BidKey(sessionID, placed.TxID),
+		Bidder:    placed.Bid.Bidder,
+		BidJSON:   placed.BidJSON,
+		Status:    vault.StatusPlaced,
+	}
+	if err := m.vault.Put(record); err != nil {
+		m.t.Fatal(err)
+	}
+
+	if submit {
+		_, err := m.client.SubmitBid(ctx, gepx.SubmitBidRequest{SessionID: sessionID, TxID: placed.TxID})
+		if err != nil {
+			m.t.Fatal(err)
+		}
+	}
+
+	return record
+}
+
+func TestRevealPlaced(t *testing.T) {
+	m := newMarket(t)
+
+	// the submission of one bid was committed, but the vault was not told
+	submitted := m.place("s1", 30, true)
+	unsubmitted := m.place("s1", 40, false)
+	m.close("s1")
+
+	revealed, err := m.buyer.RevealClosed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revealed) != 2 {
+		t.Fatalf("revealed = %+v, want both placed bids of s1", revealed)
+	}
+
+	if stored, _ := m.vault.Get(submitted.BidKey); stored.Status != vault.StatusRevealed || stored.RevealTxID == "" {
+		t.Errorf("submitted bid = %+v, want it revealed", stored)
+	}
+	if stored, _ := m.vault.Get(unsubmitted.BidKey); stored.Status != vault.StatusExpired {
+		t.Errorf("bid that was never submitted = %+v, want it expired", stored)
+	}
+	finalized := m.finalizedBids("s1")
+	if len(finalized) != 1 || finalized[submitted.BidKey].Volume != 30 {
+		t.Errorf("finalized bids = %+v, want the submitted bid only", finalized)
+	}
+
+	// neither bid is left to reveal
+	if revealed, err := m.buyer.RevealClosed(ctx); err != nil || len(revealed) != 0 {
+		t.Errorf("second reveal = %+v, %v, want nothing to reveal", revealed, err)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	m := newMarket(t)
+
+	record := m.commit("s1", 30)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- m.buyer.Watch(watchCtx, memory.NewEventSource(m.ledger))
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	m.close("s1")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if stored, _ := m.vault.Get(record.BidKey); stored.Status == vault.StatusRevealed {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("bid was not revealed after the session closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := m.finalizedBids("s1")[record.BidKey]; !ok {
+		t.Errorf("finalized bids of s1 do not contain %v", record.BidKey)
+	}
+}
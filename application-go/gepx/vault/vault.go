@@ -0,0 +1,283 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package vault keeps the secrets of committed bids on the bidder's machine.
+// A bid can only be revealed with the exact bytes it was placed with, so the
+// vault records every committed bid with its salt and bid key, encrypted with
+// a key derived from a passphrase, and a Bidder reveals the pending bids of a
+// session when the session closes.
+//
+// A vault file is meant for one process at a time.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// The statuses of a recorded bid. Submitted bids are pending until they are
+// revealed, or until their session ends without them
+const (
+	StatusPlaced    = "placed"
+	StatusSubmitted = "submitted"
+	StatusRevealed  = "revealed"
+	StatusExpired   = "expired"
+)
+
+// Record is a committed bid with the secrets that its reveal needs
+type Record struct {
+	SessionID  string    `json:"sessionID"`
+	TxID       string    `json:"txID"`
+	BidKey     string    `json:"bidKey"`
+	Bidder     string    `json:"bidder"`
+	Salt       string    `json:"salt"`
+	BidJSON    []byte    `json:"bidJSON"`
+	Status     string    `json:"status"`
+	RevealTxID string    `json:"revealTxID,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Updated    time.Time `json:"updated"`
+}
+
+// Pending reports whether the bid waits to be revealed
+func (r *Record) Pending() bool {
+	return r.Status == StatusSubmitted
+}
+
+// ErrDecrypt is returned when a vault cannot be opened with a passphrase
+var ErrDecrypt = errors.New("wrong passphrase or damaged vault")
+
+// version is the format of vault files. It is authenticated together with the
+// records
+const version = 1
+
+var additionalData = []byte("gepx-vault-v1")
+
+// kdf are the scrypt parameters of the vault key
+type kdf struct {
+	Salt []byte `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+// vaultFile is the stored form of a vault
+type vaultFile struct {
+	Version    int    `json:"version"`
+	KDF        kdf    `json:"kdf"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Vault is an encrypted file of bid records
+type Vault struct {
+	path string
+	kdf  kdf
+	aead cipher.AEAD
+
+	mutex   sync.Mutex
+	records map[string]*Record
+}
+
+// Open opens the vault of a file with a passphrase, and creates the file if it
+// does not exist
+func Open(path string, passphrase []byte) (*Vault, error) {
+
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("vault passphrase is empty")
+	}
+
+	stored, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return create(path, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var file vaultFile
+	err = json.Unmarshal(stored, &file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+	if file.Version != version {
+		return nil, fmt.Errorf("unsupported vault version %d", file.Version)
+	}
+
+	v := &Vault{path: path, kdf: file.KDF}
+	if err := v.deriveKey(passphrase); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := v.aead.Open(nil, file.Nonce, file.Ciphertext, additionalData)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	var records []*Record
+	err = json.Unmarshal(plaintext, &records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault records: %w", err)
+	}
+	v.records = make(map[string]*Record)
+	for _, record := range records {
+		v.records[record.BidKey] = record
+	}
+
+	return v, nil
+}
+
+// create creates an empty vault file
+func create(path string, passphrase []byte) (*Vault, error) {
+
+	v := &Vault{path: path, kdf: kdf{Salt: make([]byte, 16), N: 1 << 15, R: 8, P: 1}, records: make(map[string]*Record)}
+	if _, err := rand.Read(v.kdf.Salt); err != nil {
+		return nil, err
+	}
+	if err := v.deriveKey(passphrase); err != nil {
+		return nil, err
+	}
+
+	return v, v.save()
+}
+
+// deriveKey sets up the cipher of the vault key
+func (v *Vault) deriveKey(passphrase []byte) error {
+
+	key, err := scrypt.Key(passphrase, v.kdf.Salt, v.kdf.N, v.kdf.R, v.kdf.P, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive vault key: %w", err)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	v.aead, err = cipher.NewGCM(block)
+
+	return err
+}
+
+// Put records a bid, replacing the record of the same bid key, and saves the
+// vault
+func (v *Vault) Put(record Record) error {
+
+	if record.BidKey == "" {
+		return fmt.Errorf("record of bid %v has no bid key", record.TxID)
+	}
+	record.Updated = time.Now().UTC()
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	previous := v.records[record.BidKey]
+	v.records[record.BidKey] = &record
+
+	err := v.save()
+	if err != nil {
+		// the vault keeps the records that are stored
+		if previous != nil {
+			v.records[record.BidKey] = previous
+		} else {
+			delete(v.records, record.BidKey)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the record of a bid
+func (v *Vault) Get(bidKey string) (Record, bool) {
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	record, ok := v.records[bidKey]
+	if !ok {
+		return Record{}, false
+	}
+
+	return *record, true
+}
+
+// Records returns the records of a session, or of all sessions if sessionID is
+// empty, ordered by session and bid key
+func (v *Vault) Records(sessionID string) []Record {
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	records := []Record{}
+	for _, record := range v.records {
+		if sessionID == "" || record.SessionID == sessionID {
+			records = append(records, *record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].SessionID != records[j].SessionID {
+			return records[i].SessionID < records[j].SessionID
+		}
+		return records[i].BidKey < records[j].BidKey
+	})
+
+	return records
+}
+
+// save encrypts the records with a new nonce and replaces the vault file, so
+// that an interrupted save leaves the previous file intact
+func (v *Vault) save() error {
+
+	records := make([]*Record, 0, len(v.records))
+	for _, record := range v.records {
+		records = append(records, record)
+	}
+	plaintext, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	file := vaultFile{Version: version, KDF: v.kdf, Nonce: make([]byte, v.aead.NonceSize())}
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Ciphertext = v.aead.Seal(nil, file.Nonce, plaintext, additionalData)
+
+	stored, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(v.path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+	defer os.Remove(temp.Name())
+
+	_, err = temp.Write(stored)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), v.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save vault: %w", err)
+	}
+
+	return nil
+}
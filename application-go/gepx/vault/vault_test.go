@@ -0,0 +1,71 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package vault_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/application-go/gepx/vault"
+)
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bids.vault")
+
+	v, err := vault.Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := vault.Record{SessionID: "s1", TxID: "tx1", BidKey: "k1", Salt: "c0ffee", BidJSON: []byte(`{"volume":50}`), Status: vault.StatusSubmitted}
+	if err := v.Put(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Put(vault.Record{SessionID: "s2", TxID: "tx2", BidKey: "k2", Status: vault.StatusPlaced}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("vault mode = %v, want -rw-------", info.Mode().Perm())
+	}
+	stored, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stored), "c0ffee") || strings.Contains(string(stored), "tx1") {
+		t.Errorf("vault file contains the records in clear: %s", stored)
+	}
+
+	reopened, err := vault.Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := reopened.Get("k1")
+	if !ok || got.Salt != "c0ffee" || string(got.BidJSON) != `{"volume":50}` || !got.Pending() || got.Updated.IsZero() {
+		t.Errorf("reopened record = %+v, %v, want the stored pending record", got, ok)
+	}
+	if records := reopened.Records(""); len(records) != 2 || records[0].BidKey != "k1" || records[1].BidKey != "k2" {
+		t.Errorf("records = %+v, want k1 and k2", records)
+	}
+	if records := reopened.Records("s2"); len(records) != 1 || records[0].Pending() {
+		t.Errorf("records of s2 = %+v, want the placed bid only", records)
+	}
+
+	if _, err := vault.Open(path, []byte("wrong")); !errors.Is(err, vault.ErrDecrypt) {
+		t.Errorf("open with wrong passphrase: err = %v, want %v", err, vault.ErrDecrypt)
+	}
+	if _, err := vault.Open(path, nil); err == nil {
+		t.Error("open without passphrase: want an error")
+	}
+	if err := reopened.Put(vault.Record{TxID: "tx3"}); err == nil {
+		t.Error("put without bid key: want an error")
+	}
+}
@@ -23,7 +23,7 @@ function prettyJSONString(inputString) {
     }
 }
 
-async function bid(ccp,wallet,user,orgMSP,sessionID,volume,bidType) {
+async function bid(ccp,wallet,user,orgMSP,sessionID,volume,price,bidType,assetID,zone,connectionPoint,green,sourceType,carbonIntensity) {
     try {
 
         const gateway = new Gateway();
@@ -39,7 +39,7 @@ async function bid(ccp,wallet,user,orgMSP,sessionID,volume,bidType) {
         let bidder = await contract.evaluateTransaction('GetID');
         console.log('*** Result:  Bidder ID is ' + bidder.toString());
 
-        let bidData = { bidType: bidType.toString(), volume: parseInt(volume), org: orgMSP, bidder: bidder.toString(), status: "Placed"};
+        let bidData = { bidType: bidType.toString(), volume: parseInt(volume), price: parseInt(price), assetID: assetID, zone: zone, connectionPoint: connectionPoint, green: green, sourceType: sourceType, carbonIntensity: parseInt(carbonIntensity) || 0, org: orgMSP, bidder: bidder.toString(), status: "Placed"};
 
         let statefulTxn = contract.createTransaction('Bid');
         statefulTxn.setEndorsingOrganizations(orgMSP);
@@ -73,8 +73,9 @@ async function main() {
     try {
 
         if (process.argv[2] == undefined || process.argv[3] == undefined
-            || process.argv[4] == undefined || process.argv[5] == undefined || process.argv[6] == undefined) {
-            console.log("Usage: node bid.js org userID sessionID volume bidType");
+            || process.argv[4] == undefined || process.argv[5] == undefined || process.argv[6] == undefined
+            || process.argv[7] == undefined) {
+            console.log("Usage: node bid.js org userID sessionID volume price bidType [assetID] [zone] [connectionPoint] [green] [sourceType] [carbonIntensity]");
             process.exit(1);
         }
 
@@ -82,7 +83,16 @@ async function main() {
         const user = process.argv[3];
         const sessionID = process.argv[4];
         const volume = process.argv[5];
-        const bidType = process.argv[6];
+        const price = process.argv[6];
+        const bidType = process.argv[7];
+        // optional arguments can be skipped with '-'
+        const optional = (arg) => (arg == undefined || arg == '-') ? '' : arg;
+        const assetID = optional(process.argv[8]);
+        const zone = optional(process.argv[9]);
+        const connectionPoint = optional(process.argv[10]);
+        const green = process.argv[11] == 'green';
+        const sourceType = optional(process.argv[12]);
+        const carbonIntensity = optional(process.argv[13]) || '0';
 
         if (org == 'Org1' || org == 'org1') {
 
@@ -90,7 +100,7 @@ async function main() {
             const ccp = buildCCPOrg1();
             const walletPath = path.join(__dirname, 'wallet/org1');
             const wallet = await buildWallet(Wallets, walletPath);
-            await bid(ccp,wallet,user,orgMSP,sessionID,volume, bidType);
+            await bid(ccp,wallet,user,orgMSP,sessionID,volume,price,bidType,assetID,zone,connectionPoint,green,sourceType,carbonIntensity);
         }
         else if (org == 'Org2' || org == 'org2') {
 
@@ -98,9 +108,9 @@ async function main() {
             const ccp = buildCCPOrg2();
             const walletPath = path.join(__dirname, 'wallet/org2');
             const wallet = await buildWallet(Wallets, walletPath);
-            await bid(ccp,wallet,user,orgMSP,sessionID,volume, bidType);
+            await bid(ccp,wallet,user,orgMSP,sessionID,volume,price,bidType,assetID,zone,connectionPoint,green,sourceType,carbonIntensity);
         }  else {
-            console.log("Usage: node bid.js org userID sessionID volume");
+            console.log("Usage: node bid.js org userID sessionID volume price bidType [assetID] [zone] [connectionPoint] [green] [sourceType] [carbonIntensity]");
             console.log("Org must be Org1 or Org2");
           }
     } catch (error) {
@@ -23,7 +23,7 @@ function prettyJSONString(inputString) {
     }
 }
 
-async function createSession(ccp,wallet,user,sessionID) {
+async function createSession(ccp,wallet,user,sessionID,configID) {
     try {
 
         const gateway = new Gateway();
@@ -38,7 +38,7 @@ async function createSession(ccp,wallet,user,sessionID) {
         let statefulTxn = contract.createTransaction('CreateSession');
 
         console.log('\n--> Submit Session: Propose a new session');
-        await statefulTxn.submit(sessionID);
+        await statefulTxn.submit(sessionID, configID);
         console.log('*** Result: committed');
 
         console.log('\n--> Evaluate Session: query the session that was just created');
@@ -56,13 +56,14 @@ async function main() {
 
         if (process.argv[2] == undefined || process.argv[3] == undefined
             || process.argv[4] == undefined) {
-            console.log("Usage: node createSession.js org userID sessionID");
+            console.log("Usage: node createSession.js org userID sessionID [configID]");
             process.exit(1);
         }
 
         const org = process.argv[2]
         const user = process.argv[3];
         const sessionID = process.argv[4];
+        const configID = process.argv[5] || '';
 
         if (org == 'Org1' || org == 'org1') {
 
@@ -70,7 +71,7 @@ async function main() {
             const ccp = buildCCPOrg1();
             const walletPath = path.join(__dirname, 'wallet/org1');
             const wallet = await buildWallet(Wallets, walletPath);
-            await createSession(ccp,wallet,user,sessionID);
+            await createSession(ccp,wallet,user,sessionID,configID);
         }
         else if (org == 'Org2' || org == 'org2') {
 
@@ -78,9 +79,9 @@ async function main() {
             const ccp = buildCCPOrg2();
             const walletPath = path.join(__dirname, 'wallet/org2');
             const wallet = await buildWallet(Wallets, walletPath);
-            await createSession(ccp,wallet,user,sessionID);
+            await createSession(ccp,wallet,user,sessionID,configID);
         }  else {
-            console.log("Usage: node createSession.js org userID sessionID");
+            console.log("Usage: node createSession.js org userID sessionID [configID]");
             console.log("Org must be Org1 or Org2");
           }
     } catch (error) {
@@ -0,0 +1,100 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'gepx';
+
+
+function prettyJSONString(inputString) {
+    if (inputString) {
+        return JSON.stringify(JSON.parse(inputString), null, 2);
+    }
+    else {
+        return inputString;
+    }
+}
+
+async function depositCollateral(ccp,wallet,operator,participantWallet,participant,amount) {
+    try {
+
+        const gateway = new Gateway();
+      //connect using Discovery enabled
+
+      await gateway.connect(ccp,
+          { wallet: wallet, identity: operator, discovery: { enabled: true, asLocalhost: true } });
+
+        const network = await gateway.getNetwork(myChannel);
+        const contract = network.getContract(myChaincodeName);
+
+        // the collateral account is keyed by the client ID of the participant
+        const participantGateway = new Gateway();
+        await participantGateway.connect(ccp,
+            { wallet: participantWallet, identity: participant, discovery: { enabled: true, asLocalhost: true } });
+        const participantContract = (await participantGateway.getNetwork(myChannel)).getContract(myChaincodeName);
+
+        console.log('\n--> Evaluate Transaction: get the participant client ID');
+        let owner = await participantContract.evaluateTransaction('GetID');
+        participantGateway.disconnect();
+
+        console.log('\n--> Submit Transaction: deposit collateral');
+        await contract.submitTransaction('DepositCollateral', owner.toString(), amount);
+        console.log('*** Result: committed');
+
+        console.log('\n--> Evaluate Transaction: query the collateral account');
+        let result = await contract.evaluateTransaction('QueryCollateral', owner.toString());
+        console.log('*** Result: Collateral: ' + prettyJSONString(result.toString()));
+
+        gateway.disconnect();
+    } catch (error) {
+        console.error(`******** FAILED to deposit collateral: ${error}`);
+        process.exit(1);
+	}
+}
+
+async function main() {
+    try {
+
+        if (process.argv[2] == undefined || process.argv[3] == undefined
+            || process.argv[4] == undefined || process.argv[5] == undefined) {
+            console.log("Usage: node depositCollateral.js org operatorID participantID amount");
+            process.exit(1);
+        }
+
+        const org = process.argv[2]
+        const operator = process.argv[3];
+        const participant = process.argv[4];
+        const amount = process.argv[5];
+
+        if (org == 'Org1' || org == 'org1') {
+
+            const ccp = buildCCPOrg1();
+            const walletPath = path.join(__dirname, 'wallet/org1');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await depositCollateral(ccp,wallet,operator,wallet,participant,amount);
+        }
+        else if (org == 'Org2' || org == 'org2') {
+
+            const ccp = buildCCPOrg2();
+            const walletPath = path.join(__dirname, 'wallet/org2');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await depositCollateral(ccp,wallet,operator,wallet,participant,amount);
+        }  else {
+            console.log("Usage: node depositCollateral.js org operatorID participantID amount");
+            console.log("Org must be Org1 or Org2");
+          }
+    } catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+    }
+}
+
+
+main();
@@ -0,0 +1,90 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'gepx';
+
+
+function prettyJSONString(inputString) {
+    if (inputString) {
+        return JSON.stringify(JSON.parse(inputString), null, 2);
+    }
+    else {
+        return inputString;
+    }
+}
+
+async function publishMarketConfig(ccp,wallet,user,configID,config) {
+    try {
+
+        const gateway = new Gateway();
+      //connect using Discovery enabled
+
+      await gateway.connect(ccp,
+          { wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+        const network = await gateway.getNetwork(myChannel);
+        const contract = network.getContract(myChaincodeName);
+
+        console.log('\n--> Submit Transaction: publish the market config');
+        let version = await contract.submitTransaction('PublishMarketConfig', configID, config);
+        console.log('*** Result: committed version ' + version.toString());
+
+        console.log('\n--> Evaluate Transaction: query the market config');
+        let result = await contract.evaluateTransaction('QueryMarketConfig', configID, version.toString());
+        console.log('*** Result: Market config: ' + prettyJSONString(result.toString()));
+
+        gateway.disconnect();
+    } catch (error) {
+        console.error(`******** FAILED to publish market config: ${error}`);
+        process.exit(1);
+	}
+}
+
+async function main() {
+    try {
+
+        if (process.argv[2] == undefined || process.argv[3] == undefined
+            || process.argv[4] == undefined || process.argv[5] == undefined) {
+            console.log("Usage: node publishMarketConfig.js org operatorID configID configJSON");
+            process.exit(1);
+        }
+
+        const org = process.argv[2]
+        const user = process.argv[3];
+        const configID = process.argv[4];
+        const config = process.argv[5];
+
+        if (org == 'Org1' || org == 'org1') {
+
+            const ccp = buildCCPOrg1();
+            const walletPath = path.join(__dirname, 'wallet/org1');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await publishMarketConfig(ccp,wallet,user,configID,config);
+        }
+        else if (org == 'Org2' || org == 'org2') {
+
+            const ccp = buildCCPOrg2();
+            const walletPath = path.join(__dirname, 'wallet/org2');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await publishMarketConfig(ccp,wallet,user,configID,config);
+        }  else {
+            console.log("Usage: node publishMarketConfig.js org operatorID configID configJSON");
+            console.log("Org must be Org1 or Org2");
+          }
+    } catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+    }
+}
+
+
+main();
@@ -0,0 +1,96 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Gateway, Wallets } = require('fabric-network');
+const path = require('path');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet } = require('../../test-application/javascript/AppUtil.js');
+
+const myChannel = 'mychannel';
+const myChaincodeName = 'gepx';
+
+
+function prettyJSONString(inputString) {
+    if (inputString) {
+        return JSON.stringify(JSON.parse(inputString), null, 2);
+    }
+    else {
+        return inputString;
+    }
+}
+
+async function registerAsset(ccp,wallet,user,assetID,kind,technology,renewable,capacity,rampRate,connectionPoint) {
+    try {
+
+        const gateway = new Gateway();
+      //connect using Discovery enabled
+
+      await gateway.connect(ccp,
+          { wallet: wallet, identity: user, discovery: { enabled: true, asLocalhost: true } });
+
+        const network = await gateway.getNetwork(myChannel);
+        const contract = network.getContract(myChaincodeName);
+
+        console.log('\n--> Submit Transaction: register the asset');
+        await contract.submitTransaction('RegisterAsset', assetID, kind, technology, renewable, capacity, rampRate, connectionPoint);
+        console.log('*** Result: committed');
+
+        console.log('\n--> Evaluate Transaction: query the asset');
+        let result = await contract.evaluateTransaction('QueryAsset', assetID);
+        console.log('*** Result: Asset: ' + prettyJSONString(result.toString()));
+
+        gateway.disconnect();
+    } catch (error) {
+        console.error(`******** FAILED to register asset: ${error}`);
+        process.exit(1);
+	}
+}
+
+async function main() {
+    try {
+
+        if (process.argv[2] == undefined || process.argv[3] == undefined
+            || process.argv[4] == undefined || process.argv[5] == undefined || process.argv[6] == undefined
+            || process.argv[7] == undefined || process.argv[8] == undefined || process.argv[9] == undefined) {
+            console.log("Usage: node registerAsset.js org userID assetID generation|load technology renewable|- capacity rampRate [connectionPoint]");
+            process.exit(1);
+        }
+
+        const org = process.argv[2]
+        const user = process.argv[3];
+        const assetID = process.argv[4];
+        const kind = process.argv[5];
+        const technology = process.argv[6];
+        const renewable = (process.argv[7] == 'renewable').toString();
+        const capacity = process.argv[8];
+        const rampRate = process.argv[9];
+        const connectionPoint = process.argv[10] || '';
+
+        if (org == 'Org1' || org == 'org1') {
+
+            const ccp = buildCCPOrg1();
+            const walletPath = path.join(__dirname, 'wallet/org1');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await registerAsset(ccp,wallet,user,assetID,kind,technology,renewable,capacity,rampRate,connectionPoint);
+        }
+        else if (org == 'Org2' || org == 'org2') {
+
+            const ccp = buildCCPOrg2();
+            const walletPath = path.join(__dirname, 'wallet/org2');
+            const wallet = await buildWallet(Wallets, walletPath);
+            await registerAsset(ccp,wallet,user,assetID,kind,technology,renewable,capacity,rampRate,connectionPoint);
+        }  else {
+            console.log("Usage: node registerAsset.js org userID assetID generation|load technology renewable|- capacity rampRate [connectionPoint]");
+            console.log("Org must be Org1 or Org2");
+          }
+    } catch (error) {
+		console.error(`******** FAILED to run the application: ${error}`);
+    }
+}
+
+
+main();
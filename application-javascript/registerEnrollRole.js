@@ -0,0 +1,111 @@
+/*
+ * Copyright IBM Corp. All Rights Reserved.
+ *
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+'use strict';
+
+const { Wallets } = require('fabric-network');
+const FabricCAServices = require('fabric-ca-client');
+const path = require('path');
+const { buildCAClient } = require('../../test-application/javascript/CAUtil.js');
+const { buildCCPOrg1, buildCCPOrg2, buildWallet } = require('../../test-application/javascript/AppUtil.js');
+
+const mspOrg1 = 'Org1MSP';
+const mspOrg2 = 'Org2MSP';
+const adminUserId = 'admin';
+
+// the chaincode reads the market role of a client from this certificate attribute
+const roleAttribute = 'gepx.role';
+
+async function registerAndEnrollRole(caClient, wallet, orgMspId, userId, affiliation, role) {
+    const userIdentity = await wallet.get(userId);
+    if (userIdentity) {
+        console.log(`An identity for the user ${userId} already exists in the wallet`);
+        return;
+    }
+
+    const adminIdentity = await wallet.get(adminUserId);
+    if (!adminIdentity) {
+        console.log('An identity for the admin user does not exist in the wallet');
+        console.log('Enroll the admin user before retrying');
+        return;
+    }
+
+    const provider = wallet.getProviderRegistry().getProvider(adminIdentity.type);
+    const adminUser = await provider.getUserContext(adminIdentity, adminUserId);
+
+    const secret = await caClient.register({
+        affiliation: affiliation,
+        enrollmentID: userId,
+        role: 'client',
+        attrs: [{ name: roleAttribute, value: role, ecert: true }]
+    }, adminUser);
+    const enrollment = await caClient.enroll({
+        enrollmentID: userId,
+        enrollmentSecret: secret
+    });
+    const x509Identity = {
+        credentials: {
+            certificate: enrollment.certificate,
+            privateKey: enrollment.key.toBytes(),
+        },
+        mspId: orgMspId,
+        type: 'X.509',
+    };
+    await wallet.put(userId, x509Identity);
+    console.log(`Successfully registered and enrolled user ${userId} with role ${role} and imported it into the wallet`);
+}
+
+async function connectToOrg1CA(UserID, role) {
+    console.log('\n--> Register and enrolling new user with market role');
+    const ccpOrg1 = buildCCPOrg1();
+    const caOrg1Client = buildCAClient(FabricCAServices, ccpOrg1, 'ca.org1.example.com');
+
+    const walletPathOrg1 = path.join(__dirname, 'wallet/org1');
+    const walletOrg1 = await buildWallet(Wallets, walletPathOrg1);
+
+    await registerAndEnrollRole(caOrg1Client, walletOrg1, mspOrg1, UserID, 'org1.department1', role);
+}
+
+async function connectToOrg2CA(UserID, role) {
+    console.log('\n--> Register and enrolling new user with market role');
+    const ccpOrg2 = buildCCPOrg2();
+    const caOrg2Client = buildCAClient(FabricCAServices, ccpOrg2, 'ca.org2.example.com');
+
+    const walletPathOrg2 = path.join(__dirname, 'wallet/org2');
+    const walletOrg2 = await buildWallet(Wallets, walletPathOrg2);
+
+    await registerAndEnrollRole(caOrg2Client, walletOrg2, mspOrg2, UserID, 'org2.department1', role);
+}
+
+async function main() {
+
+    if (process.argv[2] == undefined || process.argv[3] == undefined || process.argv[4] == undefined) {
+        console.log("Usage: node registerEnrollRole.js org userID role");
+        process.exit(1);
+    }
+
+    const org = process.argv[2];
+    const userId = process.argv[3];
+    const role = process.argv[4];
+
+    try {
+
+      if (org == 'Org1' || org == 'org1') {
+        await connectToOrg1CA(userId, role);
+      }
+      else if (org == 'Org2' || org == 'org2') {
+        await connectToOrg2CA(userId, role);
+      } else {
+        console.log("Usage: node registerEnrollRole.js org userID role");
+        console.log("Org must be Org1 or Org2");
+      }
+    } catch (error) {
+        console.error(`Error in enrolling user: ${error}`);
+        process.exit(1);
+    }
+}
+
+main();
@@ -0,0 +1,344 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package energy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// EnergyContract keeps a fungible token ledger of delivered energy, one token per kWh
+type EnergyContract struct {
+	contractapi.Contract
+}
+
+// Obligation is the commitment of a participant to deliver energy into, or take
+// energy out of, the pool of a settled session
+type Obligation struct {
+	SessionID string `json:"sessionID"`
+	Account   string `json:"account"`
+	Direction string `json:"direction"`
+	Volume    int    `json:"volume"`
+	Fulfilled int    `json:"fulfilled"`
+	Status    string `json:"status"`
+}
+
+const (
+	Deliver = "deliver"
+	Receive = "receive"
+)
+
+const balanceKeyType = "energyBalance"
+const poolKeyType = "energyPool"
+const obligationKeyType = "obligation"
+const totalSupplyKey = "energyTotalSupply"
+
+// roleAttribute is the certificate attribute that carries the market role of a client
+const roleAttribute = "gepx.role"
+
+const gridOperatorRole = "gridOperator"
+
+// Mint is used by the grid operator to issue tokens for metered delivery into
+// the account of the producer
+func (c *EnergyContract) Mint(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+
+	err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, gridOperatorRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to mint energy tokens: %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
+
+	err = addBalance(ctx, balanceKeyType, account, amount)
+	if err != nil {
+		return err
+	}
+
+	return addTotalSupply(ctx, amount)
+}
+
+// Transfer moves tokens from the account of the submitting client to the recipient
+func (c *EnergyContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+
+	if clientID == recipient {
+		return fmt.Errorf("cannot transfer to and from the same account")
+	}
+
+	err = addBalance(ctx, balanceKeyType, clientID, -amount)
+	if err != nil {
+		return err
+	}
+
+	return addBalance(ctx, balanceKeyType, recipient, amount)
+}
+
+// Burn removes tokens from the account of the submitting client when the energy
+// they represent is consumed
+func (c *EnergyContract) Burn(ctx contractapi.TransactionContextInterface, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("burn amount must be positive")
+	}
+
+	err = addBalance(ctx, balanceKeyType, clientID, -amount)
+	if err != nil {
+		return err
+	}
+
+	return addTotalSupply(ctx, -amount)
+}
+
+// BalanceOf returns the token balance of an account
+func (c *EnergyContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+	return getBalance(ctx, balanceKeyType, account)
+}
+
+// TotalSupply returns the number of tokens in circulation
+func (c *EnergyContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	supplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read total supply: %v", err)
+	}
+	if supplyBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(supplyBytes))
+}
+
+// FulfilObligation settles as much as possible of the obligation of the submitting
+// client in a session. Deliveries move tokens from the account into the session
+// pool, receipts move them from the pool into the account
+func (c *EnergyContract) FulfilObligation(ctx contractapi.TransactionContextInterface, sessionID string, direction string) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	obligation, err := GetObligation(ctx, sessionID, clientID, direction)
+	if err != nil {
+		return err
+	}
+	if obligation == nil {
+		return fmt.Errorf("no %v obligation for client in session %v", direction, sessionID)
+	}
+
+	if obligation.Status == "fulfilled" {
+		return fmt.Errorf("obligation is already fulfilled")
+	}
+
+	from, to := balanceKeyType, poolKeyType
+	fromAccount, toAccount := clientID, sessionID
+	if direction == Receive {
+		from, to = poolKeyType, balanceKeyType
+		fromAccount, toAccount = sessionID, clientID
+	}
+
+	available, err := getBalance(ctx, from, fromAccount)
+	if err != nil {
+		return err
+	}
+
+	amount := obligation.Volume - obligation.Fulfilled
+	if available < amount {
+		amount = available
+	}
+	if amount == 0 {
+		return fmt.Errorf("no energy available to fulfil the obligation")
+	}
+
+	err = addBalance(ctx, from, fromAccount, -amount)
+	if err != nil {
+		return err
+	}
+
+	err = addBalance(ctx, to, toAccount, amount)
+	if err != nil {
+		return err
+	}
+
+	obligation.Fulfilled += amount
+	if obligation.Fulfilled == obligation.Volume {
+		obligation.Status = "fulfilled"
+	}
+
+	return putObligation(ctx, obligation)
+}
+
+// QueryObligations returns the delivery obligations created for a session
+func (c *EnergyContract) QueryObligations(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Obligation, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(obligationKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get obligations of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	obligations := []*Obligation{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var obligation Obligation
+		err = json.Unmarshal(queryResponse.Value, &obligation)
+		if err != nil {
+			return nil, err
+		}
+		obligations = append(obligations, &obligation)
+	}
+
+	return obligations, nil
+}
+
+// CreateObligation records that an account has to deliver or receive volume for a
+// session. It is called by the session contract when a session is settled
+func CreateObligation(ctx contractapi.TransactionContextInterface, sessionID string, account string, direction string, volume int) error {
+
+	if direction != Deliver && direction != Receive {
+		return fmt.Errorf("unknown obligation direction %v", direction)
+	}
+
+	obligation, err := GetObligation(ctx, sessionID, account, direction)
+	if err != nil {
+		return err
+	}
+	if obligation == nil {
+		obligation = &Obligation{
+			SessionID: sessionID,
+			Account:   account,
+			Direction: direction,
+		}
+	}
+
+	obligation.Volume += volume
+	obligation.Status = "open"
+
+	return putObligation(ctx, obligation)
+}
+
+// GetObligation reads the obligation of an account in a session from state. It
+// returns nil if the account has no such obligation
+func GetObligation(ctx contractapi.TransactionContextInterface, sessionID string, account string, direction string) (*Obligation, error) {
+
+	obligationKey, err := ctx.GetStub().CreateCompositeKey(obligationKeyType, []string{sessionID, account, direction})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	obligationBytes, err := ctx.GetStub().GetState(obligationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read obligation: %v", err)
+	}
+	if obligationBytes == nil {
+		return nil, nil
+	}
+
+	var obligation Obligation
+	err = json.Unmarshal(obligationBytes, &obligation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &obligation, nil
+}
+
+// putObligation is an internal helper that writes an obligation to state
+func putObligation(ctx contractapi.TransactionContextInterface, obligation *Obligation) error {
+
+	obligationKey, err := ctx.GetStub().CreateCompositeKey(obligationKeyType, []string{obligation.SessionID, obligation.Account, obligation.Direction})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	obligationBytes, err := json.Marshal(obligation)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(obligationKey, obligationBytes)
+}
+
+// getBalance is an internal helper that reads a token balance. Accounts and
+// session pools use different key types so that they can never collide
+func getBalance(ctx contractapi.TransactionContextInterface, keyType string, account string) (int, error) {
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(keyType, []string{account})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance: %v", err)
+	}
+	if balanceBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(balanceBytes))
+}
+
+// addBalance is an internal helper that changes a token balance by delta and
+// refuses to let it become negative
+func addBalance(ctx contractapi.TransactionContextInterface, keyType string, account string, delta int) error {
+
+	balance, err := getBalance(ctx, keyType, account)
+	if err != nil {
+		return err
+	}
+
+	if balance+delta < 0 {
+		return fmt.Errorf("insufficient energy balance: %d, required %d", balance, -delta)
+	}
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(keyType, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(balanceKey, []byte(strconv.Itoa(balance+delta)))
+}
+
+// addTotalSupply is an internal helper that changes the total supply by delta
+func addTotalSupply(ctx contractapi.TransactionContextInterface, delta int) error {
+
+	supplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to read total supply: %v", err)
+	}
+
+	supply := 0
+	if supplyBytes != nil {
+		supply, err = strconv.Atoi(string(supplyBytes))
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(supply+delta)))
+}
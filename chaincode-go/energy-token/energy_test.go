@@ -0,0 +1,353 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package energy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+var contract = new(EnergyContract)
+
+var (
+	gridOperator = mockledger.NewIdentity("gridOperator", "Org1MSP").WithAttribute(roleAttribute, gridOperatorRole)
+	producer     = mockledger.NewIdentity("producer", "Org1MSP")
+	consumer     = mockledger.NewIdentity("consumer", "Org2MSP")
+)
+
+// newLedger returns a ledger on which the producer holds 100 tokens
+func newLedger(t *testing.T) *mockledger.Ledger {
+	t.Helper()
+
+	ledger := mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC))
+	mustSubmit(t, ledger, gridOperator, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.Mint(ctx, producer.ID(), 100)
+	})
+
+	return ledger
+}
+
+// mustSubmit runs a transaction of the client and fails the test if it fails
+func mustSubmit(t *testing.T, ledger *mockledger.Ledger, client *mockledger.Identity, fn func(ctx contractapi.TransactionContextInterface) error) {
+	t.Helper()
+
+	txID, err := ledger.Submit(client, fn)
+	if err != nil {
+		t.Fatalf("transaction %v failed: %v", txID, err)
+	}
+}
+
+// balances returns the token balance of every account, the pool of s1 and the total supply
+func balances(t *testing.T, ledger *mockledger.Ledger, accounts ...string) map[string]int {
+	t.Helper()
+
+	result := make(map[string]int)
+	err := ledger.Evaluate(producer, func(ctx contractapi.TransactionContextInterface) error {
+		for _, account := range accounts {
+			balance, err := contract.BalanceOf(ctx, account)
+			if err != nil {
+				return err
+			}
+			result[account] = balance
+		}
+
+		pool, err := getBalance(ctx, poolKeyType, "s1")
+		if err != nil {
+			return err
+		}
+		result["pool"] = pool
+
+		supply, err := contract.TotalSupply(ctx)
+		result["supply"] = supply
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want an error containing %q", err, want)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		name         string
+		client       *mockledger.Identity
+		transaction  func(ctx contractapi.TransactionContextInterface) error
+		wantErr      string
+		wantProducer int
+		wantConsumer int
+		wantSupply   int
+	}{
+		{
+			name:   "mint",
+			client: gridOperator,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, consumer.ID(), 20)
+			},
+			wantProducer: 100, wantConsumer: 20, wantSupply: 120,
+		},
+		{
+			name:   "mint without the grid operator role",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, producer.ID(), 20)
+			},
+			wantErr:      "client is not authorized to mint energy tokens",
+			wantProducer: 100, wantSupply: 100,
+		},
+		{
+			name:   "mint nothing",
+			client: gridOperator,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, producer.ID(), 0)
+			},
+			wantErr:      "mint amount must be positive",
+			wantProducer: 100, wantSupply: 100,
+		},
+		{
+			name:   "transfer",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, consumer.ID(), 30)
+			},
+			wantProducer: 70, wantConsumer: 30, wantSupply: 100,
+		},
+		{
+			name:   "transfer above the balance",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, consumer.ID(), 101)
+			},
+			wantErr:      "insufficient energy balance: 100, required 101",
+			wantProducer: 100, wantSupply: 100,
+		},
+		{
+			name:   "transfer to yourself",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, producer.ID(), 10)
+			},
+			wantErr:      "cannot transfer to and from the same account",
+			wantProducer: 100, wantSupply: 100,
+		},
+		{
+			name:   "transfer nothing",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, consumer.ID(), -5)
+			},
+			wantErr:      "transfer amount must be positive",
+			wantProducer: 100, wantSupply: 100,
+		},
+		{
+			name:   "burn",
+			client: producer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Burn(ctx, 40)
+			},
+			wantProducer: 60, wantSupply: 60,
+		},
+		{
+			name:   "burn above the balance",
+			client: consumer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Burn(ctx, 1)
+			},
+			wantErr:      "insufficient energy balance: 0, required 1",
+			wantProducer: 100, wantSupply: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger(t)
+
+			_, err := ledger.Submit(tt.client, tt.transaction)
+			checkError(t, err, tt.wantErr)
+
+			got := balances(t, ledger, producer.ID(), consumer.ID())
+			if got[producer.ID()] != tt.wantProducer || got[consumer.ID()] != tt.wantConsumer || got["supply"] != tt.wantSupply {
+				t.Errorf("producer %d, consumer %d, supply %d, want %d, %d, %d",
+					got[producer.ID()], got[consumer.ID()], got["supply"], tt.wantProducer, tt.wantConsumer, tt.wantSupply)
+			}
+		})
+	}
+}
+
+func TestCreateObligation(t *testing.T) {
+	ledger := newLedger(t)
+
+	_, err := ledger.Submit(producer, func(ctx contractapi.TransactionContextInterface) error {
+		return CreateObligation(ctx, "s1", producer.ID(), "hold", 10)
+	})
+	checkError(t, err, "unknown obligation direction hold")
+
+	// obligations of the same account and direction add up
+	for _, volume := range []int{10, 15} {
+		volume := volume
+		mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+			return CreateObligation(ctx, "s1", producer.ID(), Deliver, volume)
+		})
+	}
+
+	var obligations []*Obligation
+	err = ledger.Evaluate(producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		obligations, err = contract.QueryObligations(ctx, "s1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Obligation{SessionID: "s1", Account: producer.ID(), Direction: Deliver, Volume: 25, Status: "open"}
+	if len(obligations) != 1 || *obligations[0] != want {
+		t.Errorf("obligations = %+v, want %+v", obligations, want)
+	}
+}
+
+func TestFulfilObligation(t *testing.T) {
+	tests := []struct {
+		name          string
+		deliver       int
+		receive       int
+		client        *mockledger.Identity
+		direction     string
+		wantErr       string
+		wantFulfilled int
+		wantStatus    string
+		wantBalances  map[string]int
+	}{
+		{
+			name:          "full delivery",
+			deliver:       60,
+			client:        producer,
+			direction:     Deliver,
+			wantFulfilled: 60,
+			wantStatus:    "fulfilled",
+			wantBalances:  map[string]int{producer.ID(): 40, "pool": 60},
+		},
+		{
+			name:          "partial delivery",
+			deliver:       150,
+			client:        producer,
+			direction:     Deliver,
+			wantFulfilled: 100,
+			wantStatus:    "open",
+			wantBalances:  map[string]int{producer.ID(): 0, "pool": 100},
+		},
+		{
+			name:          "receipt from the pool",
+			deliver:       60,
+			receive:       80,
+			client:        consumer,
+			direction:     Receive,
+			wantFulfilled: 60,
+			wantStatus:    "open",
+			wantBalances:  map[string]int{producer.ID(): 40, consumer.ID(): 60, "pool": 0},
+		},
+		{
+			name:         "empty pool",
+			receive:      80,
+			client:       consumer,
+			direction:    Receive,
+			wantErr:      "no energy available to fulfil the obligation",
+			wantBalances: map[string]int{producer.ID(): 100, "pool": 0},
+		},
+		{
+			name:         "no obligation",
+			deliver:      60,
+			client:       consumer,
+			direction:    Deliver,
+			wantErr:      "no deliver obligation for client in session s1",
+			wantBalances: map[string]int{producer.ID(): 100, "pool": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger(t)
+			if tt.deliver > 0 {
+				mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+					return CreateObligation(ctx, "s1", producer.ID(), Deliver, tt.deliver)
+				})
+			}
+			if tt.receive > 0 {
+				mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+					return CreateObligation(ctx, "s1", consumer.ID(), Receive, tt.receive)
+				})
+			}
+			if tt.direction == Receive && tt.deliver > 0 {
+				mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.FulfilObligation(ctx, "s1", Deliver)
+				})
+			}
+
+			_, err := ledger.Submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.FulfilObligation(ctx, "s1", tt.direction)
+			})
+			checkError(t, err, tt.wantErr)
+
+			got := balances(t, ledger, producer.ID(), consumer.ID())
+			for account, want := range tt.wantBalances {
+				if got[account] != want {
+					t.Errorf("balance of %v = %d, want %d", account, got[account], want)
+				}
+			}
+			if got["supply"] != 100 {
+				t.Errorf("total supply = %d, want 100", got["supply"])
+			}
+			if err != nil {
+				return
+			}
+
+			var obligation *Obligation
+			err = ledger.Evaluate(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				obligation, err = GetObligation(ctx, "s1", tt.client.ID(), tt.direction)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obligation.Fulfilled != tt.wantFulfilled || obligation.Status != tt.wantStatus {
+				t.Errorf("obligation = %+v, want %d fulfilled and %v", obligation, tt.wantFulfilled, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFulfilledObligation(t *testing.T) {
+	ledger := newLedger(t)
+	mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+		return CreateObligation(ctx, "s1", producer.ID(), Deliver, 10)
+	})
+	mustSubmit(t, ledger, producer, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.FulfilObligation(ctx, "s1", Deliver)
+	})
+
+	_, err := ledger.Submit(producer, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.FulfilObligation(ctx, "s1", Deliver)
+	})
+	checkError(t, err, "obligation is already fulfilled")
+}
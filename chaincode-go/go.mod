@@ -3,6 +3,8 @@ module github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go
 go 1.15
 
 require (
-	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200728190242-9b3ae92d8664 // indirect
-	github.com/hyperledger/fabric-contract-api-go v1.1.0 // indirect
+	github.com/golang/protobuf v1.3.2
+	github.com/hyperledger/fabric-chaincode-go v0.0.0-20200728190242-9b3ae92d8664
+	github.com/hyperledger/fabric-contract-api-go v1.1.0
+	github.com/hyperledger/fabric-protos-go v0.0.0-20200424173316-dd554ba3746e
 )
@@ -0,0 +1,674 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package intraday
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+// IntradayContract is a continuous market with one limit order book per delivery
+// product. Orders are matched in price-time priority as soon as they are submitted
+type IntradayContract struct {
+	contractapi.Contract
+}
+
+// Product is a delivery interval that is traded continuously until gate closure
+type Product struct {
+	ProductID     string `json:"productID"`
+	DeliveryStart string `json:"deliveryStart"`
+	DeliveryEnd   string `json:"deliveryEnd"`
+	Status        string `json:"status"`
+	LastPrice     int    `json:"lastPrice"`
+}
+
+// Order is a limit order for a product. Priority is the time priority of the
+// order: the timestamp in nanoseconds of the transaction that placed it or last
+// moved it to the back of the queue. Orders with the same timestamp rank by
+// order ID. Remaining is the volume that is not traded yet
+type Order struct {
+	OrderID   string          `json:"orderID"`
+	ProductID string          `json:"productID"`
+	Side      session.BidType `json:"side"`
+	Price     int             `json:"price"`
+	Volume    int             `json:"volume"`
+	Remaining int             `json:"remaining"`
+	Owner     string          `json:"owner"`
+	Org       string          `json:"org"`
+	Priority  int64           `json:"priority"`
+	Status    string          `json:"status"`
+}
+
+// Trade is a match between a buy and a sell order. Trades execute at the price
+// of the order that was resting in the book
+type Trade struct {
+	TradeID     string `json:"tradeID"`
+	ProductID   string `json:"productID"`
+	BuyOrderID  string `json:"buyOrderID"`
+	SellOrderID string `json:"sellOrderID"`
+	Buyer       string `json:"buyer"`
+	Seller      string `json:"seller"`
+	Price       int    `json:"price"`
+	Volume      int    `json:"volume"`
+	Timestamp   string `json:"timestamp"`
+}
+
+// OrderResult is the state of an order after it was submitted or modified, with
+// the trades it caused
+type OrderResult struct {
+	Order  Order   `json:"order"`
+	Trades []Trade `json:"trades"`
+}
+
+// OrderBook holds the open orders of a product in priority order: Bids are the
+// buy orders, best price first, Asks the sell orders, best price first
+type OrderBook struct {
+	ProductID string  `json:"productID"`
+	Bids      []Order `json:"bids"`
+	Asks      []Order `json:"asks"`
+}
+
+const (
+	ProductOpen   = "open"
+	ProductClosed = "closed"
+)
+
+const (
+	OrderOpen      = "open"
+	OrderFilled    = "filled"
+	OrderCancelled = "cancelled"
+)
+
+const productKeyType = "intradayProduct"
+const orderKeyType = "intradayOrder"
+const tradeKeyType = "intradayTrade"
+
+// bookKeyType indexes the open orders of a product by side, so that matching
+// does not read the filled and cancelled orders
+const bookKeyType = "intradayBook"
+
+// roleAttribute is the certificate attribute that carries the market role of a client
+const roleAttribute = "gepx.role"
+
+const operatorRole = "operator"
+
+// OpenProduct is used by the market operator to open continuous trading for a
+// delivery interval
+func (c *IntradayContract) OpenProduct(ctx contractapi.TransactionContextInterface, productID string, deliveryStart string, deliveryEnd string) error {
+
+	err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, operatorRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to open products: %v", err)
+	}
+
+	existing, err := getProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("product %v already exists", productID)
+	}
+
+	start, err := time.Parse(time.RFC3339, deliveryStart)
+	if err != nil {
+		return fmt.Errorf("delivery start must be an RFC3339 time: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, deliveryEnd)
+	if err != nil {
+		return fmt.Errorf("delivery end must be an RFC3339 time: %v", err)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("delivery end must be after delivery start")
+	}
+
+	product := Product{
+		ProductID:     productID,
+		DeliveryStart: deliveryStart,
+		DeliveryEnd:   deliveryEnd,
+		Status:        ProductOpen,
+	}
+
+	return putProduct(ctx, &product)
+}
+
+// CloseProduct is used by the market operator at gate closure. Open orders stay
+// in the book but can no longer trade
+func (c *IntradayContract) CloseProduct(ctx contractapi.TransactionContextInterface, productID string) error {
+
+	err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, operatorRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to close products: %v", err)
+	}
+
+	product, err := c.QueryProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	product.Status = ProductClosed
+
+	return putProduct(ctx, product)
+}
+
+// SubmitOrder places a limit order for a product. The order is matched against
+// the opposite side of the book right away, and the volume that does not trade
+// rests in the book. The transaction ID identifies the order
+func (c *IntradayContract) SubmitOrder(ctx contractapi.TransactionContextInterface, productID string, side string, price int, volume int) (*OrderResult, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	orderSide := session.BidType(side)
+	if !orderSide.IsSell() && !orderSide.IsBuy() {
+		return nil, fmt.Errorf("order side must be %v or %v", session.Sell, session.Buy)
+	}
+	if price <= 0 || volume <= 0 {
+		return nil, fmt.Errorf("order price and volume must be positive")
+	}
+
+	product, err := getOpenProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := Order{
+		OrderID:   ctx.GetStub().GetTxID(),
+		ProductID: productID,
+		Side:      orderSide,
+		Price:     price,
+		Volume:    volume,
+		Remaining: volume,
+		Owner:     clientID,
+		Org:       clientOrgID,
+		Status:    OrderOpen,
+	}
+
+	return matchOrder(ctx, product, &order)
+}
+
+// ModifyOrder changes the price and the remaining volume of an open order of the
+// submitting client. Reducing the volume at the same price keeps the time
+// priority of the order; any other change moves it to the back of the queue and
+// matches it against the book again
+func (c *IntradayContract) ModifyOrder(ctx contractapi.TransactionContextInterface, productID string, orderID string, price int, volume int) (*OrderResult, error) {
+
+	order, err := getOwnOpenOrder(ctx, productID, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if price <= 0 || volume <= 0 {
+		return nil, fmt.Errorf("order price and volume must be positive")
+	}
+
+	product, err := getOpenProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	if price == order.Price && volume <= order.Remaining {
+		order.Volume -= order.Remaining - volume
+		order.Remaining = volume
+
+		err = putOrder(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+
+		return &OrderResult{Order: *order, Trades: []Trade{}}, nil
+	}
+
+	order.Volume += volume - order.Remaining
+	order.Remaining = volume
+	order.Price = price
+
+	return matchOrder(ctx, product, order)
+}
+
+// CancelOrder takes an open order of the submitting client out of the book
+func (c *IntradayContract) CancelOrder(ctx contractapi.TransactionContextInterface, productID string, orderID string) error {
+
+	order, err := getOwnOpenOrder(ctx, productID, orderID)
+	if err != nil {
+		return err
+	}
+
+	order.Status = OrderCancelled
+
+	return putOrder(ctx, order)
+}
+
+// QueryProduct returns a product
+func (c *IntradayContract) QueryProduct(ctx contractapi.TransactionContextInterface, productID string) (*Product, error) {
+
+	product, err := getProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, fmt.Errorf("product %v does not exist", productID)
+	}
+
+	return product, nil
+}
+
+// QueryOrder returns an order of a product
+func (c *IntradayContract) QueryOrder(ctx contractapi.TransactionContextInterface, productID string, orderID string) (*Order, error) {
+
+	order, err := getOrder(ctx, productID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("order %v does not exist", orderID)
+	}
+
+	return order, nil
+}
+
+// QueryOrderBook returns the open orders of a product in priority order
+func (c *IntradayContract) QueryOrderBook(ctx contractapi.TransactionContextInterface, productID string) (*OrderBook, error) {
+
+	bids, err := getOpenOrders(ctx, productID, session.Buy)
+	if err != nil {
+		return nil, err
+	}
+
+	asks, err := getOpenOrders(ctx, productID, session.Sell)
+	if err != nil {
+		return nil, err
+	}
+
+	book := OrderBook{ProductID: productID, Bids: []Order{}, Asks: []Order{}}
+	for _, order := range bids {
+		book.Bids = append(book.Bids, *order)
+	}
+	for _, order := range asks {
+		book.Asks = append(book.Asks, *order)
+	}
+
+	return &book, nil
+}
+
+// QueryTrades returns the trades of a product
+func (c *IntradayContract) QueryTrades(ctx contractapi.TransactionContextInterface, productID string) ([]*Trade, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(tradeKeyType, []string{productID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trades of product %v: %v", productID, err)
+	}
+	defer resultsIterator.Close()
+
+	var trades []*Trade
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var trade Trade
+		err = json.Unmarshal(queryResponse.Value, &trade)
+		if err != nil {
+			return nil, err
+		}
+		trades = append(trades, &trade)
+	}
+
+	return trades, nil
+}
+
+// matchOrder gives an incoming order the time priority of its transaction and
+// trades it against the opposite side of the book for as long as the prices
+// cross. When the best resting order belongs to the same client, matching stops
+// and the rest of the incoming order is cancelled, so a client never trades
+// with itself and the book does not cross. Every resting order is read and
+// written at most once, because Fabric does not return the writes of a
+// transaction to its own reads. The product is only written when the order
+// trades, so orders that only rest in the book do not conflict with each other
+func matchOrder(ctx contractapi.TransactionContextInterface, product *Product, order *Order) (*OrderResult, error) {
+
+	opposite := session.BidType(session.Sell)
+	if order.Side.IsSell() {
+		opposite = session.Buy
+	}
+
+	resting, err := getOpenOrders(ctx, product.ProductID, opposite)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	txTime := time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC()
+	tradeTime := txTime.Format(time.RFC3339)
+
+	order.Priority = txTime.UnixNano()
+
+	selfTrade := false
+	result := OrderResult{Trades: []Trade{}}
+	for _, other := range resting {
+		if order.Remaining == 0 || !crosses(order, other) {
+			break
+		}
+		if other.Owner == order.Owner {
+			selfTrade = true
+			break
+		}
+
+		volume := order.Remaining
+		if other.Remaining < volume {
+			volume = other.Remaining
+		}
+
+		trade := Trade{
+			TradeID:   fmt.Sprintf("%v-%d", ctx.GetStub().GetTxID(), len(result.Trades)),
+			ProductID: product.ProductID,
+			Price:     other.Price,
+			Volume:    volume,
+			Timestamp: tradeTime,
+		}
+		if order.Side.IsBuy() {
+			trade.BuyOrderID, trade.Buyer = order.OrderID, order.Owner
+			trade.SellOrderID, trade.Seller = other.OrderID, other.Owner
+		} else {
+			trade.BuyOrderID, trade.Buyer = other.OrderID, other.Owner
+			trade.SellOrderID, trade.Seller = order.OrderID, order.Owner
+		}
+
+		err = putTrade(ctx, &trade)
+		if err != nil {
+			return nil, err
+		}
+
+		order.Remaining -= volume
+		other.Remaining -= volume
+		if other.Remaining == 0 {
+			other.Status = OrderFilled
+		}
+		err = putOrder(ctx, other)
+		if err != nil {
+			return nil, err
+		}
+
+		product.LastPrice = trade.Price
+		result.Trades = append(result.Trades, trade)
+	}
+
+	if order.Remaining == 0 {
+		order.Status = OrderFilled
+	} else if selfTrade {
+		order.Status = OrderCancelled
+	}
+
+	err = putOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Trades) > 0 {
+		err = putProduct(ctx, product)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result.Order = *order
+
+	return &result, nil
+}
+
+// crosses reports whether an incoming order can trade with a resting order
+func crosses(incoming *Order, resting *Order) bool {
+	if incoming.Side.IsBuy() {
+		return incoming.Price >= resting.Price
+	}
+	return incoming.Price <= resting.Price
+}
+
+// getOpenOrders is an internal helper that returns the open orders on one side
+// of the book of a product, in price-time priority. It reads the orders through
+// the book index, which only holds open orders
+func getOpenOrders(ctx contractapi.TransactionContextInterface, productID string, side session.BidType) ([]*Order, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(bookKeyType, []string{productID, bookSide(side)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get orders of product %v: %v", productID, err)
+	}
+	defer resultsIterator.Close()
+
+	var orders []*Order
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		order, err := getOrder(ctx, productID, keyParts[2])
+		if err != nil {
+			return nil, err
+		}
+		if order == nil {
+			return nil, fmt.Errorf("order %v of the book does not exist", keyParts[2])
+		}
+		orders = append(orders, order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		if orders[i].Price != orders[j].Price {
+			if side.IsSell() {
+				return orders[i].Price < orders[j].Price
+			}
+			return orders[i].Price > orders[j].Price
+		}
+		if orders[i].Priority != orders[j].Priority {
+			return orders[i].Priority < orders[j].Priority
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+
+	return orders, nil
+}
+
+// getOwnOpenOrder is an internal helper that reads an open order and checks that
+// it belongs to the submitting client
+func getOwnOpenOrder(ctx contractapi.TransactionContextInterface, productID string, orderID string) (*Order, error) {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	order, err := getOrder(ctx, productID, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, fmt.Errorf("order %v does not exist", orderID)
+	}
+
+	if order.Owner != clientID {
+		return nil, fmt.Errorf("order can only be changed by its owner")
+	}
+	if order.Status != OrderOpen {
+		return nil, fmt.Errorf("order %v is %v", orderID, order.Status)
+	}
+
+	return order, nil
+}
+
+// getOpenProduct is an internal helper that reads a product that is open for trading
+func getOpenProduct(ctx contractapi.TransactionContextInterface, productID string) (*Product, error) {
+
+	product, err := getProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, fmt.Errorf("product %v does not exist", productID)
+	}
+	if product.Status != ProductOpen {
+		return nil, fmt.Errorf("product %v is closed for trading", productID)
+	}
+
+	return product, nil
+}
+
+// getProduct is an internal helper that reads a product from state. It returns
+// nil if the product does not exist
+func getProduct(ctx contractapi.TransactionContextInterface, productID string) (*Product, error) {
+
+	productKey, err := ctx.GetStub().CreateCompositeKey(productKeyType, []string{productID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	productBytes, err := ctx.GetStub().GetState(productKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get product %v: %v", productID, err)
+	}
+	if productBytes == nil {
+		return nil, nil
+	}
+
+	var product Product
+	err = json.Unmarshal(productBytes, &product)
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// putProduct is an internal helper that writes a product to state
+func putProduct(ctx contractapi.TransactionContextInterface, product *Product) error {
+
+	productKey, err := ctx.GetStub().CreateCompositeKey(productKeyType, []string{product.ProductID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	productBytes, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(productKey, productBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put product: %v", err)
+	}
+
+	return nil
+}
+
+// getOrder is an internal helper that reads an order from state. It returns nil
+// if the order does not exist
+func getOrder(ctx contractapi.TransactionContextInterface, productID string, orderID string) (*Order, error) {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(orderKeyType, []string{productID, orderID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	orderBytes, err := ctx.GetStub().GetState(orderKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get order %v: %v", orderID, err)
+	}
+	if orderBytes == nil {
+		return nil, nil
+	}
+
+	var order Order
+	err = json.Unmarshal(orderBytes, &order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// putOrder is an internal helper that writes an order to state and keeps the
+// book index of its product up to date
+func putOrder(ctx contractapi.TransactionContextInterface, order *Order) error {
+
+	orderKey, err := ctx.GetStub().CreateCompositeKey(orderKeyType, []string{order.ProductID, order.OrderID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	orderBytes, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(orderKey, orderBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put order: %v", err)
+	}
+
+	bookKey, err := ctx.GetStub().CreateCompositeKey(bookKeyType, []string{order.ProductID, bookSide(order.Side), order.OrderID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// only the key of an index entry is needed, but an empty value would delete it
+	if order.Status == OrderOpen {
+		err = ctx.GetStub().PutState(bookKey, []byte{0x00})
+	} else {
+		err = ctx.GetStub().DelState(bookKey)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update the book of product %v: %v", order.ProductID, err)
+	}
+
+	return nil
+}
+
+// bookSide returns the side of the book an order rests on
+func bookSide(side session.BidType) string {
+	if side.IsSell() {
+		return session.Sell
+	}
+	return session.Buy
+}
+
+// putTrade is an internal helper that writes a trade to state
+func putTrade(ctx contractapi.TransactionContextInterface, trade *Trade) error {
+
+	tradeKey, err := ctx.GetStub().CreateCompositeKey(tradeKeyType, []string{trade.ProductID, trade.TradeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	tradeBytes, err := json.Marshal(trade)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(tradeKey, tradeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put trade: %v", err)
+	}
+
+	return nil
+}
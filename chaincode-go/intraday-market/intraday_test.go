@@ -0,0 +1,367 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package intraday
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+var contract = new(IntradayContract)
+
+var (
+	operator = mockledger.NewIdentity("operator", "Org1MSP").WithAttribute(roleAttribute, operatorRole)
+	seller   = mockledger.NewIdentity("seller", "Org1MSP")
+	trader   = mockledger.NewIdentity("trader", "Org1MSP")
+	buyer    = mockledger.NewIdentity("buyer", "Org2MSP")
+)
+
+// market is a ledger with the open product p1
+type market struct {
+	t      *testing.T
+	ledger *mockledger.Ledger
+}
+
+func newMarket(t *testing.T) *market {
+	t.Helper()
+
+	m := &market{t: t, ledger: mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC))}
+	m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.OpenProduct(ctx, "p1", "2021-03-01T14:00:00Z", "2021-03-01T15:00:00Z")
+	})
+
+	return m
+}
+
+// mustSubmit runs a transaction of the client and fails the test if it fails
+func (m *market) mustSubmit(client *mockledger.Identity, fn func(ctx contractapi.TransactionContextInterface) error) {
+	m.t.Helper()
+
+	txID, err := m.ledger.Submit(client, fn)
+	if err != nil {
+		m.t.Fatalf("transaction %v failed: %v", txID, err)
+	}
+}
+
+// submitOrder places an order of the client for p1
+func (m *market) submitOrder(client *mockledger.Identity, side string, price int, volume int) (*OrderResult, error) {
+	var result *OrderResult
+	_, err := m.ledger.Submit(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = contract.SubmitOrder(ctx, "p1", side, price, volume)
+		return err
+	})
+	return result, err
+}
+
+// mustSubmitOrder places an order of the client for p1 and fails the test if it fails
+func (m *market) mustSubmitOrder(client *mockledger.Identity, side string, price int, volume int) *OrderResult {
+	m.t.Helper()
+
+	result, err := m.submitOrder(client, side, price, volume)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return result
+}
+
+// book returns the order book of p1
+func (m *market) book() *OrderBook {
+	m.t.Helper()
+
+	var book *OrderBook
+	err := m.ledger.Evaluate(operator, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		book, err = contract.QueryOrderBook(ctx, "p1")
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return book
+}
+
+// order returns an order of p1
+func (m *market) order(orderID string) *Order {
+	m.t.Helper()
+
+	var order *Order
+	err := m.ledger.Evaluate(operator, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		order, err = contract.QueryOrder(ctx, "p1", orderID)
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return order
+}
+
+// orderIDs returns the IDs of the orders on one side of a book
+func orderIDs(orders []Order) []string {
+	ids := []string{}
+	for _, order := range orders {
+		ids = append(ids, order.OrderID)
+	}
+	return ids
+}
+
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want an error containing %q", err, want)
+	}
+}
+
+func TestOpenProduct(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *mockledger.Identity
+		product string
+		start   string
+		end     string
+		wantErr string
+	}{
+		{name: "operator", client: operator, product: "p2", start: "2021-03-01T15:00:00Z", end: "2021-03-01T16:00:00Z"},
+		{name: "not an operator", client: seller, product: "p2", start: "2021-03-01T15:00:00Z", end: "2021-03-01T16:00:00Z", wantErr: "not authorized"},
+		{name: "existing product", client: operator, product: "p1", start: "2021-03-01T15:00:00Z", end: "2021-03-01T16:00:00Z", wantErr: "already exists"},
+		{name: "invalid time", client: operator, product: "p2", start: "15:00", end: "2021-03-01T16:00:00Z", wantErr: "RFC3339"},
+		{name: "end before start", client: operator, product: "p2", start: "2021-03-01T16:00:00Z", end: "2021-03-01T15:00:00Z", wantErr: "must be after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			_, err := m.ledger.Submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.OpenProduct(ctx, tt.product, tt.start, tt.end)
+			})
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestSubmitOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		side    string
+		price   int
+		volume  int
+		closed  bool
+		wantErr string
+	}{
+		{name: "buy order", side: session.Buy, price: 10, volume: 5},
+		{name: "sell order", side: session.Sell, price: 10, volume: 5},
+		{name: "unknown side", side: "hold", price: 10, volume: 5, wantErr: "order side must be"},
+		{name: "zero price", side: session.Buy, price: 0, volume: 5, wantErr: "must be positive"},
+		{name: "negative volume", side: session.Sell, price: 10, volume: -5, wantErr: "must be positive"},
+		{name: "closed product", side: session.Buy, price: 10, volume: 5, closed: true, wantErr: "closed for trading"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.closed {
+				m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.CloseProduct(ctx, "p1")
+				})
+			}
+
+			result, err := m.submitOrder(trader, tt.side, tt.price, tt.volume)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if result.Order.Status != OrderOpen || result.Order.Remaining != tt.volume || len(result.Trades) != 0 {
+				t.Errorf("result = %+v, want an open order without trades", result)
+			}
+		})
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	m := newMarket(t)
+
+	first := m.mustSubmitOrder(seller, session.Sell, 30, 10).Order
+	second := m.mustSubmitOrder(trader, session.Sell, 30, 10).Order
+	cheap := m.mustSubmitOrder(trader, session.Sell, 20, 5).Order
+
+	// the cheapest ask trades first, then the older of the two asks at 30
+	result := m.mustSubmitOrder(buyer, session.Buy, 35, 12)
+	if len(result.Trades) != 2 {
+		t.Fatalf("trades = %+v, want 2", result.Trades)
+	}
+	if trade := result.Trades[0]; trade.SellOrderID != cheap.OrderID || trade.Price != 20 || trade.Volume != 5 {
+		t.Errorf("first trade = %+v, want 5 of the ask at 20", trade)
+	}
+	if trade := result.Trades[1]; trade.SellOrderID != first.OrderID || trade.Price != 30 || trade.Volume != 7 || trade.Buyer != buyer.ID() {
+		t.Errorf("second trade = %+v, want 7 of the oldest ask at 30", trade)
+	}
+	if result.Order.Status != OrderFilled {
+		t.Errorf("buy order status = %v, want %v", result.Order.Status, OrderFilled)
+	}
+
+	// filled orders leave the book, the partially filled one keeps its place
+	book := m.book()
+	if got := orderIDs(book.Asks); len(got) != 2 || got[0] != first.OrderID || got[1] != second.OrderID {
+		t.Errorf("asks = %v, want %v then %v", got, first.OrderID, second.OrderID)
+	}
+	if len(book.Bids) != 0 {
+		t.Errorf("bids = %v, want none", orderIDs(book.Bids))
+	}
+	if order := m.order(first.OrderID); order.Remaining != 3 || order.Status != OrderOpen {
+		t.Errorf("partially filled ask = %+v, want 3 open", order)
+	}
+	if order := m.order(cheap.OrderID); order.Status != OrderFilled {
+		t.Errorf("cheap ask status = %v, want %v", order.Status, OrderFilled)
+	}
+
+	var product *Product
+	err := m.ledger.Evaluate(operator, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		product, err = contract.QueryProduct(ctx, "p1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.LastPrice != 30 {
+		t.Errorf("last price = %d, want 30", product.LastPrice)
+	}
+
+	// a buy below the best ask rests in the book
+	resting := m.mustSubmitOrder(buyer, session.Buy, 25, 4)
+	if len(resting.Trades) != 0 || resting.Order.Status != OrderOpen {
+		t.Errorf("result = %+v, want a resting order", resting)
+	}
+	if got := orderIDs(m.book().Bids); len(got) != 1 || got[0] != resting.Order.OrderID {
+		t.Errorf("bids = %v, want %v", got, resting.Order.OrderID)
+	}
+}
+
+func TestSelfTrade(t *testing.T) {
+	m := newMarket(t)
+
+	own := m.mustSubmitOrder(trader, session.Sell, 20, 5).Order
+	other := m.mustSubmitOrder(seller, session.Sell, 25, 5).Order
+
+	// the crossing buy of the same client is cancelled, and the cheaper ask of
+	// the trader is not skipped to trade with the seller
+	result := m.mustSubmitOrder(trader, session.Buy, 30, 8)
+	if len(result.Trades) != 0 {
+		t.Errorf("trades = %+v, want none", result.Trades)
+	}
+	if result.Order.Status != OrderCancelled || result.Order.Remaining != 8 {
+		t.Errorf("buy order = %+v, want 8 cancelled", result.Order)
+	}
+
+	book := m.book()
+	if len(book.Bids) != 0 {
+		t.Errorf("bids = %v, want none", orderIDs(book.Bids))
+	}
+	if got := orderIDs(book.Asks); len(got) != 2 || got[0] != own.OrderID || got[1] != other.OrderID {
+		t.Errorf("asks = %v, want %v then %v", got, own.OrderID, other.OrderID)
+	}
+
+	// once the own ask is taken by the buyer, the trader trades with the seller
+	m.mustSubmitOrder(buyer, session.Buy, 20, 5)
+	result = m.mustSubmitOrder(trader, session.Buy, 30, 8)
+	if len(result.Trades) != 1 || result.Trades[0].SellOrderID != other.OrderID {
+		t.Errorf("trades = %+v, want the ask of the seller traded", result.Trades)
+	}
+	if result.Order.Status != OrderOpen || result.Order.Remaining != 3 {
+		t.Errorf("buy order = %+v, want 3 open", result.Order)
+	}
+}
+
+func TestModifyOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *mockledger.Identity
+		price     int
+		volume    int
+		wantFirst bool
+		wantErr   string
+	}{
+		{name: "reduce volume keeps priority", client: seller, price: 30, volume: 4, wantFirst: true},
+		{name: "raise volume loses priority", client: seller, price: 30, volume: 12},
+		{name: "change price loses priority", client: seller, price: 31, volume: 10},
+		{name: "not the owner", client: trader, price: 30, volume: 4, wantErr: "only be changed by its owner"},
+		{name: "zero volume", client: seller, price: 30, volume: 0, wantErr: "must be positive"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			order := m.mustSubmitOrder(seller, session.Sell, 30, 10).Order
+			m.mustSubmitOrder(trader, session.Sell, 30, 10)
+
+			_, err := m.ledger.Submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.ModifyOrder(ctx, "p1", order.OrderID, tt.price, tt.volume)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			modified := m.order(order.OrderID)
+			if modified.Remaining != tt.volume || modified.Price != tt.price {
+				t.Errorf("order = %+v, want %d at %d", modified, tt.volume, tt.price)
+			}
+
+			asks := orderIDs(m.book().Asks)
+			if first := asks[0] == order.OrderID; first != tt.wantFirst {
+				t.Errorf("asks = %v, want the modified order first: %v", asks, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	m := newMarket(t)
+	order := m.mustSubmitOrder(seller, session.Sell, 30, 10).Order
+
+	_, err := m.ledger.Submit(trader, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CancelOrder(ctx, "p1", order.OrderID)
+	})
+	checkError(t, err, "only be changed by its owner")
+
+	m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CancelOrder(ctx, "p1", order.OrderID)
+	})
+	if len(m.book().Asks) != 0 {
+		t.Errorf("asks = %v, want none", orderIDs(m.book().Asks))
+	}
+	if status := m.order(order.OrderID).Status; status != OrderCancelled {
+		t.Errorf("order status = %v, want %v", status, OrderCancelled)
+	}
+
+	_, err = m.ledger.Submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CancelOrder(ctx, "p1", order.OrderID)
+	})
+	checkError(t, err, "is cancelled")
+
+	// a cancelled order does not trade
+	result := m.mustSubmitOrder(buyer, session.Buy, 30, 10)
+	if len(result.Trades) != 0 {
+		t.Errorf("trades = %+v, want none", result.Trades)
+	}
+}
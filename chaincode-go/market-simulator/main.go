@@ -0,0 +1,119 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command market-simulator runs GEPx market sessions on an in-memory ledger, so
+// that market rules and clearing algorithms can be tried without a Fabric
+// network. Bids go through the same commit-reveal transactions as on the
+// channel and are cleared and settled by the session contract.
+//
+// Usage:
+//
+//	market-simulator run [-json] scenario.json|bids.csv
+//	market-simulator synthetic [-sessions 1000] [-participants 20] [-seed 1] [-config config.json] [-json]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("market-simulator: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "synthetic":
+		err = synthetic(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: market-simulator run [-json] scenario.json|bids.csv")
+	fmt.Fprintln(os.Stderr, "       market-simulator synthetic [-sessions n] [-participants n] [-seed n] [-config config.json] [-json]")
+	os.Exit(2)
+}
+
+// run runs the sessions of a scenario file and prints their clearing and settlement
+func run(args []string) error {
+
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the session reports as JSON")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	scenario, err := LoadScenario(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	reports, err := NewSimulator().Run(scenario)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, reports)
+	}
+	return writeReports(os.Stdout, reports)
+}
+
+// synthetic replays random sessions and prints a summary of their outcome
+func synthetic(args []string) error {
+
+	flags := flag.NewFlagSet("synthetic", flag.ExitOnError)
+	sessions := flags.Int("sessions", 1000, "number of sessions")
+	participants := flags.Int("participants", 20, "number of participants per session")
+	seed := flags.Int64("seed", 1, "seed of the random sessions")
+	configPath := flags.String("config", "", "market config JSON file the sessions run under")
+	asJSON := flags.Bool("json", false, "print the summary as JSON")
+	flags.Parse(args)
+
+	if *sessions <= 0 || *participants <= 0 {
+		return fmt.Errorf("the number of sessions and participants must be positive")
+	}
+
+	var config *session.MarketConfig
+	if *configPath != "" {
+		configJSON, err := ioutil.ReadFile(*configPath)
+		if err != nil {
+			return err
+		}
+		config = new(session.MarketConfig)
+		err = json.Unmarshal(configJSON, config)
+		if err != nil {
+			return fmt.Errorf("failed to read market config: %v", err)
+		}
+	}
+
+	summary, err := RunSynthetic(*sessions, *participants, *seed, config)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(os.Stdout, summary)
+	}
+	return writeSummary(os.Stdout, summary)
+}
@@ -0,0 +1,130 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// writeReports writes the clearing and settlement of every session as tables
+func writeReports(w io.Writer, reports []*SessionReport) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Session %v\n", report.SessionID)
+
+		if report.Error != "" {
+			fmt.Fprintf(tw, "  not cleared: %v\n", report.Error)
+		}
+		if report.Result != nil {
+			fmt.Fprintf(tw, "  algorithm %v, clearing price %d\n", report.Algorithm, report.Result.ClearingPrice)
+			for _, zone := range sortedZones(report.Result.ZonePrices) {
+				fmt.Fprintf(tw, "  zone %v\tprice %d\n", zoneName(zone), report.Result.ZonePrices[zone])
+			}
+			for _, flow := range report.Result.Flows {
+				fmt.Fprintf(tw, "  flow %v -> %v\tvolume %d\n", zoneName(flow.From), zoneName(flow.To), flow.Volume)
+			}
+		}
+
+		if len(report.Bids) > 0 {
+			fmt.Fprintln(tw, "\n  PARTICIPANT\tTYPE\tZONE\tVOLUME\tPRICE\tSTATUS\tALLOCATED\tDELIVERED\tSETTLEMENT PRICE")
+			for _, bid := range report.Bids {
+				fmt.Fprintf(tw, "  %v\t%v\t%v\t%d\t%d\t%v\t%d\t%d\t%d\n", bid.Participant, bid.BidType, zoneName(bid.Zone), bid.Volume, bid.Price, bid.Status, bid.Allocated, bid.Delivered, bid.SettlementPrice)
+			}
+		}
+
+		if len(report.Rejected) > 0 {
+			fmt.Fprintln(tw, "\n  REJECTED\tTYPE\tVOLUME\tPRICE\tSTEP\tERROR")
+			for _, rejection := range report.Rejected {
+				fmt.Fprintf(tw, "  %v\t%v\t%d\t%d\t%v\t%v\n", rejection.Participant, rejection.BidType, rejection.Volume, rejection.Price, rejection.Step, rejection.Error)
+			}
+		}
+
+		if report.Settlement != nil {
+			fmt.Fprintln(tw, "\n  INVOICE\tORG\tITEM\tENTRY\tVOLUME\tUNIT PRICE\tAMOUNT")
+			for _, invoice := range report.Settlement.Invoices {
+				for _, line := range invoice.LineItems {
+					fmt.Fprintf(tw, "  %v\t%v\t%v\t%v\t%d\t%d\t%d\n", invoice.Participant, invoice.Org, line.Item, line.Entry, line.Volume, line.UnitPrice, line.Amount)
+				}
+				fmt.Fprintf(tw, "  %v\t%v\ttotal\t\t\t\t%d\n", invoice.Participant, invoice.Org, invoice.Total)
+			}
+
+			orgs := make([]string, 0, len(report.Settlement.OrgBalances))
+			for org := range report.Settlement.OrgBalances {
+				orgs = append(orgs, org)
+			}
+			sort.Strings(orgs)
+			fmt.Fprintln(tw, "\n  ORG\tBALANCE")
+			for _, org := range orgs {
+				fmt.Fprintf(tw, "  %v\t%d\n", org, report.Settlement.OrgBalances[org])
+			}
+		}
+	}
+
+	return tw.Flush()
+}
+
+// writeSummary writes the summary of synthetic sessions
+func writeSummary(w io.Writer, summary *Summary) error {
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "sessions\t%d\n", summary.Sessions)
+	fmt.Fprintf(tw, "cleared\t%d\n", summary.Cleared)
+	fmt.Fprintf(tw, "congested\t%d\n", summary.Congested)
+	fmt.Fprintf(tw, "bids\t%d\n", summary.Bids)
+
+	steps := make([]string, 0, len(summary.Rejected))
+	for step := range summary.Rejected {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	for _, step := range steps {
+		fmt.Fprintf(tw, "rejected in %v\t%d\n", step, summary.Rejected[step])
+	}
+
+	fmt.Fprintf(tw, "approved\t%d\n", summary.Approved)
+	fmt.Fprintf(tw, "partially approved\t%d\n", summary.PartiallyApproved)
+	fmt.Fprintf(tw, "not approved\t%d\n", summary.NotApproved)
+	fmt.Fprintf(tw, "bought volume\t%d\n", summary.BoughtVolume)
+	fmt.Fprintf(tw, "average price\t%.2f\n", summary.AveragePrice)
+	fmt.Fprintf(tw, "clearing price range\t%d - %d\n", summary.MinPrice, summary.MaxPrice)
+
+	return tw.Flush()
+}
+
+// sortedZones returns the zones of a session in sorted order
+func sortedZones(prices map[string]int) []string {
+	zones := make([]string, 0, len(prices))
+	for zone := range prices {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// zoneName returns a printable name of a zone, bids without zone are in the default zone
+func zoneName(zone string) string {
+	if strings.TrimSpace(zone) == "" {
+		return "-"
+	}
+	return zone
+}
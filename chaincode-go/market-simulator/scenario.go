@@ -0,0 +1,297 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+// defaultOrg is the organization of participants that do not name one
+const defaultOrg = "Org1MSP"
+
+// Scenario describes the participants of a market and the sessions they bid in.
+// The sessions run one after the other on the same ledger, under the market
+// config of the scenario or the default config
+type Scenario struct {
+	Config       *session.MarketConfig `json:"config,omitempty"`
+	LossFactors  map[string]float64    `json:"lossFactors,omitempty"`
+	Participants []Participant         `json:"participants"`
+	Sessions     []SessionScenario     `json:"sessions"`
+}
+
+// Participant is a market participant with the collateral and payment tokens
+// it starts with and the assets it registers
+type Participant struct {
+	Name       string  `json:"name"`
+	Org        string  `json:"org,omitempty"`
+	Collateral int     `json:"collateral"`
+	Funds      int     `json:"funds"`
+	Assets     []Asset `json:"assets,omitempty"`
+}
+
+// Asset is an asset of a participant
+type Asset struct {
+	AssetID         string `json:"assetID"`
+	Kind            string `json:"kind"`
+	Technology      string `json:"technology,omitempty"`
+	Renewable       bool   `json:"renewable,omitempty"`
+	Capacity        int    `json:"capacity"`
+	RampRate        int    `json:"rampRate,omitempty"`
+	ConnectionPoint string `json:"connectionPoint,omitempty"`
+}
+
+// SessionScenario is a session with the transmission capacities between its
+// zones, its bids and the meter readings of its participants, keyed by name
+type SessionScenario struct {
+	SessionID       string                   `json:"sessionID"`
+	Interconnectors []session.Interconnector `json:"interconnectors,omitempty"`
+	Bids            []Bid                    `json:"bids"`
+	MeterReadings   map[string]int           `json:"meterReadings,omitempty"`
+}
+
+// Bid is a bid of a participant in a session
+type Bid struct {
+	Participant     string          `json:"participant"`
+	BidType         session.BidType `json:"bidType"`
+	Volume          int             `json:"volume"`
+	Price           int             `json:"price"`
+	Zone            string          `json:"zone,omitempty"`
+	ConnectionPoint string          `json:"connectionPoint,omitempty"`
+	AssetID         string          `json:"assetID,omitempty"`
+	Green           bool            `json:"green,omitempty"`
+	SourceType      string          `json:"sourceType,omitempty"`
+	CarbonIntensity int             `json:"carbonIntensity,omitempty"`
+}
+
+// LoadScenario reads a scenario from a JSON file, or from a CSV file of bids
+func LoadScenario(path string) (*Scenario, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		return ReadCSVScenario(file)
+	}
+
+	return ReadJSONScenario(file)
+}
+
+// ReadJSONScenario reads a scenario in JSON
+func ReadJSONScenario(r io.Reader) (*Scenario, error) {
+
+	var scenario Scenario
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(&scenario)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %v", err)
+	}
+
+	return &scenario, scenario.validate()
+}
+
+// ReadCSVScenario reads a scenario from a CSV file with one bid per row. The
+// header names the columns session, participant, bidType, volume and price, and
+// optionally org, zone, assetID, connectionPoint and green. The participants are
+// taken from the bids: every participant gets the collateral and funds its bids
+// need, sell bids without asset are made with a generation asset of their
+// participant, and every asset is large enough for its bids in any session
+func ReadCSVScenario(r io.Reader) (*Scenario, error) {
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"session", "participant", "bidType", "volume", "price"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %v column", name)
+		}
+	}
+
+	scenario := Scenario{Participants: []Participant{}, Sessions: []SessionScenario{}}
+	sessions := make(map[string]int)
+	orgs := make(map[string]string)
+	participants := []string{}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %v", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		bid := Bid{
+			Participant:     field("participant"),
+			BidType:         session.BidType(field("bidType")),
+			Zone:            field("zone"),
+			ConnectionPoint: field("connectionPoint"),
+			AssetID:         field("assetID"),
+		}
+		if bid.Volume, err = strconv.Atoi(field("volume")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid volume: %v", line, err)
+		}
+		if bid.Price, err = strconv.Atoi(field("price")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid price: %v", line, err)
+		}
+		if green := field("green"); green != "" {
+			if bid.Green, err = strconv.ParseBool(green); err != nil {
+				return nil, fmt.Errorf("line %d: invalid green flag: %v", line, err)
+			}
+		}
+		if bid.BidType.IsSell() && bid.AssetID == "" {
+			bid.AssetID = bid.Participant + "-generation"
+		}
+
+		org := field("org")
+		if org == "" {
+			org = defaultOrg
+		}
+		if existing, ok := orgs[bid.Participant]; !ok {
+			orgs[bid.Participant] = org
+			participants = append(participants, bid.Participant)
+		} else if existing != org {
+			return nil, fmt.Errorf("line %d: participant %v is in %v and %v", line, bid.Participant, existing, org)
+		}
+
+		sessionID := field("session")
+		i, ok := sessions[sessionID]
+		if !ok {
+			i = len(scenario.Sessions)
+			sessions[sessionID] = i
+			scenario.Sessions = append(scenario.Sessions, SessionScenario{SessionID: sessionID})
+		}
+		scenario.Sessions[i].Bids = append(scenario.Sessions[i].Bids, bid)
+	}
+
+	for _, name := range participants {
+		participant, err := inferParticipant(name, orgs[name], scenario.Sessions)
+		if err != nil {
+			return nil, err
+		}
+		scenario.Participants = append(scenario.Participants, *participant)
+	}
+
+	return &scenario, scenario.validate()
+}
+
+// inferParticipant returns a participant with enough collateral, funds and asset
+// capacity for all its bids in the sessions
+func inferParticipant(name string, org string, sessions []SessionScenario) (*Participant, error) {
+
+	participant := Participant{Name: name, Org: org}
+
+	capacity := make(map[string]int)
+	kinds := make(map[string]string)
+	assetIDs := []string{}
+
+	for _, sessionScenario := range sessions {
+		volumes := make(map[string]int)
+		for _, bid := range sessionScenario.Bids {
+			if bid.Participant != name {
+				continue
+			}
+
+			participant.Collateral += bid.Volume * bid.Price
+			if bid.BidType.IsBuy() {
+				participant.Funds += bid.Volume * bid.Price
+			}
+
+			if bid.AssetID == "" {
+				continue
+			}
+			kind := session.Generation
+			if bid.BidType.IsBuy() {
+				kind = session.Load
+			}
+			if existing, ok := kinds[bid.AssetID]; !ok {
+				kinds[bid.AssetID] = kind
+				assetIDs = append(assetIDs, bid.AssetID)
+			} else if existing != kind {
+				return nil, fmt.Errorf("asset %v of %v is used for buy and sell bids", bid.AssetID, name)
+			}
+
+			volumes[bid.AssetID] += bid.Volume
+			if volumes[bid.AssetID] > capacity[bid.AssetID] {
+				capacity[bid.AssetID] = volumes[bid.AssetID]
+			}
+		}
+	}
+
+	for _, assetID := range assetIDs {
+		participant.Assets = append(participant.Assets, Asset{AssetID: assetID, Kind: kinds[assetID], Capacity: capacity[assetID]})
+	}
+
+	return &participant, nil
+}
+
+// validate checks that every bid and meter reading names a participant of the
+// scenario and that session IDs are unique
+func (s *Scenario) validate() error {
+
+	participants := make(map[string]bool)
+	for _, participant := range s.Participants {
+		if participant.Name == "" {
+			return fmt.Errorf("participant without name")
+		}
+		if participants[participant.Name] {
+			return fmt.Errorf("participant %v is defined twice", participant.Name)
+		}
+		participants[participant.Name] = true
+	}
+
+	sessions := make(map[string]bool)
+	for _, sessionScenario := range s.Sessions {
+		if sessionScenario.SessionID == "" {
+			return fmt.Errorf("session without ID")
+		}
+		if sessions[sessionScenario.SessionID] {
+			return fmt.Errorf("session %v is defined twice", sessionScenario.SessionID)
+		}
+		sessions[sessionScenario.SessionID] = true
+
+		for _, bid := range sessionScenario.Bids {
+			if !participants[bid.Participant] {
+				return fmt.Errorf("bid in session %v of unknown participant %v", sessionScenario.SessionID, bid.Participant)
+			}
+		}
+		for name := range sessionScenario.MeterReadings {
+			if !participants[name] {
+				return fmt.Errorf("meter reading in session %v of unknown participant %v", sessionScenario.SessionID, name)
+			}
+		}
+	}
+
+	return nil
+}
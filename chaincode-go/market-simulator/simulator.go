@@ -0,0 +1,430 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+// roleAttribute is the certificate attribute that carries the market role of a client
+const roleAttribute = "gepx.role"
+
+// scenarioConfigID is the ID under which the market config of a scenario is published
+const scenarioConfigID = "scenario"
+
+// ledgerStart is the time of the first transaction on the ledger of a simulation
+var ledgerStart = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Simulator runs the sessions of a scenario on an in-memory ledger. The market
+// roles are held by clients of the default organization, and every participant
+// is a client of its own organization
+type Simulator struct {
+	ledger   *mockledger.Ledger
+	contract *session.SmartContract
+	configID string
+
+	admin         *mockledger.Identity
+	operator      *mockledger.Identity
+	issuer        *mockledger.Identity
+	gridOperator  *mockledger.Identity
+	meteringAgent *mockledger.Identity
+
+	participants map[string]*mockledger.Identity
+	names        map[string]string
+	renewables   map[string][]Asset
+}
+
+// SessionReport is the outcome of a simulated session. Bids lists the revealed
+// bids in the order of the scenario, Rejected the bids the contract refused
+type SessionReport struct {
+	SessionID  string                  `json:"sessionID"`
+	Algorithm  string                  `json:"clearingAlgorithm"`
+	Result     *session.ClearingResult `json:"result,omitempty"`
+	Bids       []BidReport             `json:"bids"`
+	Rejected   []Rejection             `json:"rejected"`
+	Settlement *session.Settlement     `json:"settlement,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// BidReport is a revealed bid with its allocation
+type BidReport struct {
+	Bid
+	Status          string `json:"status"`
+	Allocated       int    `json:"allocatedVolume"`
+	Delivered       int    `json:"deliveredVolume"`
+	SettlementPrice int    `json:"settlementPrice"`
+}
+
+// Rejection is a bid that failed in one of the steps of the commit-reveal
+// bidding, with the error of the contract
+type Rejection struct {
+	Bid
+	Step  string `json:"step"`
+	Error string `json:"error"`
+}
+
+// NewSimulator returns a simulator with an empty ledger
+func NewSimulator() *Simulator {
+	return &Simulator{
+		ledger:        mockledger.New(ledgerStart),
+		contract:      new(session.SmartContract),
+		admin:         mockledger.NewIdentity("admin", defaultOrg),
+		operator:      mockledger.NewIdentity("operator", defaultOrg).WithAttribute(roleAttribute, "operator"),
+		issuer:        mockledger.NewIdentity("issuer", defaultOrg).WithAttribute(roleAttribute, "paymentIssuer"),
+		gridOperator:  mockledger.NewIdentity("gridOperator", defaultOrg).WithAttribute(roleAttribute, "gridOperator"),
+		meteringAgent: mockledger.NewIdentity("meteringAgent", defaultOrg).WithAttribute(roleAttribute, "meteringAgent"),
+		participants:  make(map[string]*mockledger.Identity),
+		names:         make(map[string]string),
+		renewables:    make(map[string][]Asset),
+	}
+}
+
+// Run sets up the scenario and runs its sessions one after the other
+func (s *Simulator) Run(scenario *Scenario) ([]*SessionReport, error) {
+
+	err := s.Setup(scenario)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []*SessionReport{}
+	for _, sessionScenario := range scenario.Sessions {
+		report, err := s.RunSession(sessionScenario)
+		if err != nil {
+			return nil, fmt.Errorf("session %v: %v", sessionScenario.SessionID, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// Setup publishes the market config and loss factors of the scenario, and funds
+// the participants and registers their assets
+func (s *Simulator) Setup(scenario *Scenario) error {
+
+	if scenario.Config != nil {
+		configJSON, err := json.Marshal(scenario.Config)
+		if err != nil {
+			return err
+		}
+		err = s.submit(s.operator, "PublishMarketConfig", func(ctx contractapi.TransactionContextInterface) error {
+			_, err := s.contract.PublishMarketConfig(ctx, scenarioConfigID, string(configJSON))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		s.configID = scenarioConfigID
+	}
+
+	connectionPoints := make([]string, 0, len(scenario.LossFactors))
+	for connectionPoint := range scenario.LossFactors {
+		connectionPoints = append(connectionPoints, connectionPoint)
+	}
+	sort.Strings(connectionPoints)
+	for _, connectionPoint := range connectionPoints {
+		lossFactor := scenario.LossFactors[connectionPoint]
+		err := s.submit(s.gridOperator, "SetLossFactor", func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.SetLossFactor(ctx, connectionPoint, lossFactor)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, participant := range scenario.Participants {
+		err := s.addParticipant(participant)
+		if err != nil {
+			return fmt.Errorf("participant %v: %v", participant.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// addParticipant creates the client of a participant, deposits its collateral,
+// mints its funds and registers its assets
+func (s *Simulator) addParticipant(participant Participant) error {
+
+	org := participant.Org
+	if org == "" {
+		org = defaultOrg
+	}
+	client := mockledger.NewIdentity(participant.Name, org)
+	s.participants[participant.Name] = client
+	s.names[client.ID()] = participant.Name
+
+	if participant.Collateral > 0 {
+		err := s.submit(s.operator, "DepositCollateral", func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.DepositCollateral(ctx, client.ID(), participant.Collateral)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if participant.Funds > 0 {
+		err := s.submit(s.issuer, "payment:Mint", func(ctx contractapi.TransactionContextInterface) error {
+			return new(payment.PaymentContract).Mint(ctx, client.ID(), participant.Funds)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, asset := range participant.Assets {
+		err := s.submit(client, "RegisterAsset", func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.RegisterAsset(ctx, asset.AssetID, asset.Kind, asset.Technology, asset.Renewable, asset.Capacity, asset.RampRate, asset.ConnectionPoint)
+		})
+		if err != nil {
+			return err
+		}
+
+		if asset.Renewable {
+			s.renewables[participant.Name] = append(s.renewables[participant.Name], asset)
+		}
+	}
+
+	return nil
+}
+
+// RunSession runs a session from its creation to its settlement. Bids that the
+// contract rejects are reported and left out. A session in which no bid was
+// revealed cannot be ended, which is reported as the error of the session
+func (s *Simulator) RunSession(sessionScenario SessionScenario) (*SessionReport, error) {
+
+	sessionID := sessionScenario.SessionID
+	report := SessionReport{SessionID: sessionID, Bids: []BidReport{}, Rejected: []Rejection{}}
+
+	err := s.submit(s.admin, "CreateSession", func(ctx contractapi.TransactionContextInterface) error {
+		return s.contract.CreateSession(ctx, sessionID, s.configID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, interconnector := range sessionScenario.Interconnectors {
+		err = s.submit(s.admin, "SetTransmissionCapacity", func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.SetTransmissionCapacity(ctx, sessionID, interconnector.From, interconnector.To, interconnector.Capacity)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// commit: every bid is placed in private data and its hash added to the session
+	placed := make([]string, len(sessionScenario.Bids))
+	for i, bid := range sessionScenario.Bids {
+		txID, step, err := s.placeBid(sessionID, bid)
+		if err != nil {
+			report.Rejected = append(report.Rejected, Rejection{Bid: bid, Step: step, Error: err.Error()})
+			continue
+		}
+		placed[i] = txID
+	}
+
+	err = s.submit(s.admin, "CloseSession", func(ctx contractapi.TransactionContextInterface) error {
+		return s.contract.CloseSession(ctx, sessionID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// reveal
+	revealed := make(map[int]string)
+	for i, bid := range sessionScenario.Bids {
+		if placed[i] == "" {
+			continue
+		}
+		txID := placed[i]
+		err := s.submitWithTransient(s.participants[bid.Participant], "FinalizeBid", s.bidJSON(bid), func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.FinalizeBid(ctx, sessionID, txID)
+		})
+		if err != nil {
+			report.Rejected = append(report.Rejected, Rejection{Bid: bid, Step: "FinalizeBid", Error: err.Error()})
+			continue
+		}
+		revealed[i] = txID
+	}
+
+	var result *session.ClearingResult
+	err = s.submit(s.admin, "EndSession", func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = s.contract.EndSession(ctx, sessionID)
+		return err
+	})
+	if err != nil {
+		report.Error = err.Error()
+		return &report, nil
+	}
+	report.Result = result
+
+	for _, name := range sortedKeys(sessionScenario.MeterReadings) {
+		participant, volume := s.participants[name].ID(), sessionScenario.MeterReadings[name]
+		err = s.submit(s.meteringAgent, "SubmitMeterReading", func(ctx contractapi.TransactionContextInterface) error {
+			return s.contract.SubmitMeterReading(ctx, sessionID, participant, volume)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// the metered injection is certified for the renewable assets of the
+		// participant, up to their capacity
+		for _, asset := range s.renewables[name] {
+			if volume <= 0 {
+				break
+			}
+			certified := volume
+			if certified > asset.Capacity {
+				certified = asset.Capacity
+			}
+			err = s.submit(s.meteringAgent, "IssueCertificate", func(ctx contractapi.TransactionContextInterface) error {
+				_, err := s.contract.IssueCertificate(ctx, asset.AssetID, sessionID, certified)
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+			volume -= certified
+		}
+	}
+
+	err = s.submit(s.admin, "SettleSession", func(ctx contractapi.TransactionContextInterface) error {
+		return s.contract.SettleSession(ctx, sessionID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionJSON *session.Session
+	err = s.ledger.Evaluate(s.admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		sessionJSON, err = s.contract.QuerySession(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		report.Settlement, err = s.contract.QuerySettlement(ctx, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// invoices name their participant instead of its client ID
+	for i := range report.Settlement.Invoices {
+		report.Settlement.Invoices[i].Participant = s.Name(report.Settlement.Invoices[i].Participant)
+	}
+	report.Algorithm = sessionJSON.Config.ClearingAlgorithm
+
+	for i, bid := range sessionScenario.Bids {
+		txID, ok := revealed[i]
+		if !ok {
+			continue
+		}
+		bidKey, _ := shim.CreateCompositeKey("bid", []string{sessionID, txID})
+		finalized := sessionJSON.FinalizedBids[bidKey]
+		report.Bids = append(report.Bids, BidReport{
+			Bid:             bid,
+			Status:          finalized.Status,
+			Allocated:       finalized.Allocated,
+			Delivered:       finalized.Delivered,
+			SettlementPrice: finalized.SettlementPrice,
+		})
+	}
+
+	return &report, nil
+}
+
+// placeBid places a bid in the private data of its participant's organization and
+// adds its hash to the session. It returns the bid ID, or the failed step
+func (s *Simulator) placeBid(sessionID string, bid Bid) (string, string, error) {
+
+	client := s.participants[bid.Participant]
+
+	var txID string
+	err := s.submitWithTransient(client, "Bid", s.bidJSON(bid), func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		txID, err = s.contract.Bid(ctx, sessionID)
+		return err
+	})
+	if err != nil {
+		return "", "Bid", err
+	}
+
+	err = s.submit(client, "SubmitBid", func(ctx contractapi.TransactionContextInterface) error {
+		return s.contract.SubmitBid(ctx, sessionID, txID)
+	})
+	if err != nil {
+		return "", "SubmitBid", err
+	}
+
+	return txID, "", nil
+}
+
+// bidJSON returns the transient bid of a participant, as the bid application creates it
+func (s *Simulator) bidJSON(bid Bid) []byte {
+
+	client := s.participants[bid.Participant]
+
+	bidJSON, _ := json.Marshal(session.FullBid{
+		BidType:         bid.BidType,
+		Volume:          bid.Volume,
+		Price:           bid.Price,
+		Zone:            bid.Zone,
+		ConnectionPoint: bid.ConnectionPoint,
+		AssetID:         bid.AssetID,
+		Green:           bid.Green,
+		SourceType:      bid.SourceType,
+		CarbonIntensity: bid.CarbonIntensity,
+		Org:             client.MSPID,
+		Bidder:          client.ID(),
+	})
+
+	return bidJSON
+}
+
+// Name returns the name of the participant with a client ID, or the ID itself
+// for clients that are not participants
+func (s *Simulator) Name(clientID string) string {
+	if name, ok := s.names[clientID]; ok {
+		return name
+	}
+	return clientID
+}
+
+// submit runs a transaction of the client and names the transaction in its error
+func (s *Simulator) submit(client *mockledger.Identity, name string, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	_, err := s.ledger.Submit(client, fn)
+	if err != nil {
+		return fmt.Errorf("%v: %v", name, err)
+	}
+	return nil
+}
+
+// submitWithTransient runs a transaction of the client with a bid in the transient map
+func (s *Simulator) submitWithTransient(client *mockledger.Identity, name string, bidJSON []byte, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	_, err := s.ledger.Submit(client, fn, mockledger.WithTransient(map[string][]byte{"bid": bidJSON}))
+	return err
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
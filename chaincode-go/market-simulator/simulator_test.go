@@ -0,0 +1,143 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunScenario(t *testing.T) {
+	scenario, err := LoadScenario("examples/scenario.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reports, err := NewSimulator().Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("%d session reports, want 2", len(reports))
+	}
+
+	first := reports[0]
+	if first.Algorithm != "uniformPrice" || first.Result == nil || first.Settlement == nil {
+		t.Fatalf("session %v was not cleared and settled under the scenario config: %+v", first.SessionID, first)
+	}
+	if len(first.Rejected) != 1 || first.Rejected[0].Step != "Bid" || !strings.Contains(first.Rejected[0].Error, "above the maximum of 200") {
+		t.Errorf("rejected bids = %+v, want the bid above the maximum volume", first.Rejected)
+	}
+
+	// the injection metered in the first session is certified and backs the
+	// certified sell bid of the second
+	if second := reports[1]; len(second.Rejected) != 0 || len(second.Bids) != 2 {
+		t.Errorf("bids of session %v = %+v, rejected %+v, want both green bids revealed", second.SessionID, second.Bids, second.Rejected)
+	}
+
+	for _, report := range reports {
+		bought, sold := 0, 0
+		for _, bid := range report.Bids {
+			if bid.BidType.IsBuy() {
+				bought += bid.Allocated
+			} else {
+				sold += bid.Delivered
+			}
+		}
+		if bought != sold || bought == 0 {
+			t.Errorf("session %v bought %d and sold %d", report.SessionID, bought, sold)
+		}
+
+		total := 0
+		for _, invoice := range report.Settlement.Invoices {
+			if strings.HasPrefix(invoice.Participant, "eDUwOT") {
+				t.Errorf("invoice names client ID %v instead of participant", invoice.Participant)
+			}
+			total += invoice.Total
+		}
+		if want := report.Settlement.OrgBalances["Org1MSP"] + report.Settlement.OrgBalances["Org2MSP"]; total != want {
+			t.Errorf("session %v invoices total %d, org balances %d", report.SessionID, total, want)
+		}
+	}
+}
+
+func TestReadCSVScenario(t *testing.T) {
+	csv := `session, participant, org, bidType, volume, price, assetID
+s1, alice, Org1MSP, sell, 100, 20,
+s1, alice, Org1MSP, sell, 30, 25,
+s1, carol, Org2MSP, buy, 120, 30, plant
+s2, alice, Org1MSP, sell, 80, 18,
+`
+
+	scenario, err := ReadCSVScenario(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Participant{
+		{Name: "alice", Org: "Org1MSP", Collateral: 100*20 + 30*25 + 80*18, Assets: []Asset{{AssetID: "alice-generation", Kind: "generation", Capacity: 130}}},
+		{Name: "carol", Org: "Org2MSP", Collateral: 120 * 30, Funds: 120 * 30, Assets: []Asset{{AssetID: "plant", Kind: "load", Capacity: 120}}},
+	}
+	if !reflect.DeepEqual(scenario.Participants, want) {
+		t.Errorf("participants = %+v, want %+v", scenario.Participants, want)
+	}
+	if len(scenario.Sessions) != 2 || len(scenario.Sessions[0].Bids) != 3 || len(scenario.Sessions[1].Bids) != 1 {
+		t.Errorf("sessions = %+v, want s1 with 3 bids and s2 with 1", scenario.Sessions)
+	}
+
+	reports, err := NewSimulator().Run(scenario)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, report := range reports {
+		if len(report.Rejected) != 0 || report.Result == nil {
+			t.Errorf("session %v was not cleared with all bids: %+v", report.SessionID, report)
+		}
+	}
+}
+
+func TestReadCSVScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		wantErr string
+	}{
+		{name: "missing column", csv: "session,participant,bidType,volume\n", wantErr: "missing the price column"},
+		{name: "invalid volume", csv: "session,participant,bidType,volume,price\ns1,alice,sell,ten,20\n", wantErr: "line 2: invalid volume"},
+		{name: "participant in two orgs", csv: "session,participant,org,bidType,volume,price\ns1,alice,Org1MSP,sell,10,20\ns1,alice,Org2MSP,buy,10,20\n", wantErr: "participant alice is in Org1MSP and Org2MSP"},
+		{name: "asset bought and sold", csv: "session,participant,bidType,volume,price,assetID\ns1,alice,sell,10,20,a1\ns1,alice,buy,10,20,a1\n", wantErr: "asset a1 of alice is used for buy and sell bids"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadCSVScenario(strings.NewReader(tt.csv))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunSyntheticIsReproducible(t *testing.T) {
+	first, err := RunSynthetic(20, 10, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RunSynthetic(20, 10, 7, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("summaries of the same seed differ: %+v and %+v", first, second)
+	}
+	if first.Sessions != 20 || first.Bids != 200 || first.Cleared == 0 {
+		t.Errorf("summary = %+v, want 20 cleared sessions of 10 bids", first)
+	}
+	if first.Approved+first.PartiallyApproved+first.NotApproved != first.Bids {
+		t.Errorf("summary = %+v, not every bid has an outcome", first)
+	}
+}
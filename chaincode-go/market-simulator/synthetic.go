@@ -0,0 +1,175 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
+)
+
+// syntheticZones are the bidding zones of synthetic sessions, each with its own
+// connection point and loss factor
+var syntheticZones = []string{"north", "south"}
+
+var syntheticLossFactors = map[string]float64{"cp-north": 0.02, "cp-south": 0.05}
+
+// Summary aggregates the outcome of many simulated sessions. The average price is
+// weighted by the volume bought in every session
+type Summary struct {
+	Sessions          int            `json:"sessions"`
+	Cleared           int            `json:"cleared"`
+	Congested         int            `json:"congested"`
+	Bids              int            `json:"bids"`
+	Rejected          map[string]int `json:"rejected"`
+	Approved          int            `json:"approved"`
+	PartiallyApproved int            `json:"partiallyApproved"`
+	NotApproved       int            `json:"notApproved"`
+	BoughtVolume      int            `json:"boughtVolume"`
+	AveragePrice      float64        `json:"averagePrice"`
+	MinPrice          int            `json:"minPrice"`
+	MaxPrice          int            `json:"maxPrice"`
+
+	turnover int
+}
+
+// SyntheticScenario returns a random scenario with a single session. Half of the
+// participants sell from a generation asset and half buy, spread over two zones
+// that are coupled by interconnectors of random capacity
+func SyntheticScenario(r *rand.Rand, sessionID string, participants int, config *session.MarketConfig) *Scenario {
+
+	scenario := Scenario{
+		Config:       config,
+		LossFactors:  syntheticLossFactors,
+		Participants: []Participant{},
+	}
+
+	sessionScenario := SessionScenario{
+		SessionID: sessionID,
+		Interconnectors: []session.Interconnector{
+			{From: syntheticZones[0], To: syntheticZones[1], Capacity: r.Intn(101)},
+			{From: syntheticZones[1], To: syntheticZones[0], Capacity: r.Intn(101)},
+		},
+		Bids: []Bid{},
+	}
+
+	for i := 0; i < participants; i++ {
+		participant := Participant{
+			Name:       fmt.Sprintf("p%03d", i+1),
+			Org:        []string{"Org1MSP", "Org2MSP"}[i%2],
+			Collateral: 1000000,
+			Funds:      1000000,
+		}
+		zone := syntheticZones[r.Intn(len(syntheticZones))]
+
+		bid := Bid{
+			Participant: participant.Name,
+			BidType:     session.Buy,
+			Volume:      10 + r.Intn(91),
+			Price:       20 + r.Intn(31),
+			Zone:        zone,
+		}
+		if i%2 == 0 {
+			asset := Asset{
+				AssetID:         participant.Name + "-generation",
+				Kind:            session.Generation,
+				Technology:      "solar",
+				Renewable:       true,
+				Capacity:        100,
+				ConnectionPoint: "cp-" + zone,
+			}
+			participant.Assets = []Asset{asset}
+
+			bid.BidType = session.Sell
+			bid.Price = 10 + r.Intn(31)
+			bid.AssetID = asset.AssetID
+		}
+
+		scenario.Participants = append(scenario.Participants, participant)
+		sessionScenario.Bids = append(sessionScenario.Bids, bid)
+	}
+
+	scenario.Sessions = []SessionScenario{sessionScenario}
+
+	return &scenario
+}
+
+// RunSynthetic runs random sessions, every one on a ledger of its own so that the
+// sessions are independent, and summarizes their outcome
+func RunSynthetic(sessions int, participants int, seed int64, config *session.MarketConfig) (*Summary, error) {
+
+	r := rand.New(rand.NewSource(seed))
+	summary := Summary{Rejected: make(map[string]int)}
+
+	for i := 0; i < sessions; i++ {
+		scenario := SyntheticScenario(r, fmt.Sprintf("synthetic-%06d", i+1), participants, config)
+
+		reports, err := NewSimulator().Run(scenario)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.add(reports[0])
+	}
+
+	if summary.BoughtVolume > 0 {
+		summary.AveragePrice = float64(summary.turnover) / float64(summary.BoughtVolume)
+	}
+
+	return &summary, nil
+}
+
+// add adds the outcome of a session to the summary
+func (s *Summary) add(report *SessionReport) {
+
+	s.Sessions++
+	s.Bids += len(report.Bids) + len(report.Rejected)
+	for _, rejection := range report.Rejected {
+		s.Rejected[rejection.Step]++
+	}
+
+	if report.Result == nil {
+		return
+	}
+	s.Cleared++
+
+	prices := make(map[int]bool)
+	for _, price := range report.Result.ZonePrices {
+		prices[price] = true
+	}
+	if len(prices) > 1 {
+		s.Congested++
+	}
+
+	bought := 0
+	for _, bid := range report.Bids {
+		switch {
+		case bid.Allocated == 0:
+			s.NotApproved++
+		case bid.Status == "Approved":
+			s.Approved++
+		default:
+			s.PartiallyApproved++
+		}
+
+		if bid.BidType.IsBuy() {
+			bought += bid.Allocated
+			s.turnover += bid.Allocated * bid.SettlementPrice
+		}
+	}
+	if bought == 0 {
+		return
+	}
+	s.BoughtVolume += bought
+
+	price := report.Result.ClearingPrice
+	if s.MinPrice == 0 || price < s.MinPrice {
+		s.MinPrice = price
+	}
+	if price > s.MaxPrice {
+		s.MaxPrice = price
+	}
+}
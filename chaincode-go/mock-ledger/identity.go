@@ -0,0 +1,86 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mockledger
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+)
+
+// Identity is a client of the ledger. It implements the client identity of the
+// transaction context, with an ID in the format of an X.509 identity
+type Identity struct {
+	Name       string
+	MSPID      string
+	Attributes map[string]string
+}
+
+// NewIdentity returns a client of an organization without attributes
+func NewIdentity(name string, mspID string) *Identity {
+	return &Identity{
+		Name:       name,
+		MSPID:      mspID,
+		Attributes: make(map[string]string),
+	}
+}
+
+// WithAttribute returns a copy of the identity with an additional certificate attribute
+func (i *Identity) WithAttribute(name string, value string) *Identity {
+
+	attributes := make(map[string]string)
+	for attribute, existing := range i.Attributes {
+		attributes[attribute] = existing
+	}
+	attributes[name] = value
+
+	return &Identity{Name: i.Name, MSPID: i.MSPID, Attributes: attributes}
+}
+
+// ID returns the client ID of the identity, as the contracts see it
+func (i *Identity) ID() string {
+	id := fmt.Sprintf("x509::CN=%v,OU=client::CN=ca.%v", i.Name, i.MSPID)
+	return base64.StdEncoding.EncodeToString([]byte(id))
+}
+
+// GetID implements the client identity
+func (i *Identity) GetID() (string, error) {
+	return i.ID(), nil
+}
+
+// GetMSPID implements the client identity
+func (i *Identity) GetMSPID() (string, error) {
+	return i.MSPID, nil
+}
+
+// GetAttributeValue implements the client identity
+func (i *Identity) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := i.Attributes[attrName]
+	return value, found, nil
+}
+
+// AssertAttributeValue implements the client identity
+func (i *Identity) AssertAttributeValue(attrName string, attrValue string) error {
+
+	value, found := i.Attributes[attrName]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", attrName)
+	}
+	if value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+
+	return nil
+}
+
+// GetX509Certificate implements the client identity. The certificate only
+// carries the subject and issuer of the identity and is not signed
+func (i *Identity) GetX509Certificate() (*x509.Certificate, error) {
+	return &x509.Certificate{
+		Subject: pkix.Name{CommonName: i.Name, OrganizationalUnit: []string{"client"}},
+		Issuer:  pkix.Name{CommonName: "ca." + i.MSPID},
+	}, nil
+}
@@ -0,0 +1,209 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package mockledger is an in-memory ledger for testing and simulating the
+// GEPx contracts without a Fabric network. Transactions run against a stub that
+// behaves like the peer's: reads return the state committed by earlier
+// transactions, never the transaction's own writes, and the writes are only
+// committed when the transaction succeeds.
+package mockledger
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Ledger holds the committed world state, private data and endorsement
+// policies of a channel. A ledger is not safe for concurrent use, because the
+// peer organization of a transaction is passed to the chaincode through the
+// process environment, as on a peer
+type Ledger struct {
+	ChannelID string
+
+	state      map[string][]byte
+	private    map[string]map[string][]byte
+	validation map[string][]byte
+	events     []Event
+	txCount    int
+	clock      time.Time
+}
+
+// Event is a chaincode event emitted by a committed transaction
+type Event struct {
+	TxID    string
+	Name    string
+	Payload []byte
+}
+
+// Option configures a single transaction
+type Option func(*Stub)
+
+// New returns an empty ledger. Transaction timestamps start at the given time
+// and advance by one second per transaction
+func New(start time.Time) *Ledger {
+	return &Ledger{
+		ChannelID:  "mychannel",
+		state:      make(map[string][]byte),
+		private:    make(map[string]map[string][]byte),
+		validation: make(map[string][]byte),
+		clock:      start,
+	}
+}
+
+// WithTransient passes a transient map to the transaction
+func WithTransient(transient map[string][]byte) Option {
+	return func(stub *Stub) {
+		stub.transient = transient
+	}
+}
+
+// WithPeerOrg runs the transaction on a peer of the given organization. By
+// default the transaction runs on a peer of the client's organization
+func WithPeerOrg(mspID string) Option {
+	return func(stub *Stub) {
+		stub.peerOrg = mspID
+	}
+}
+
+// WithTxID sets the ID of the transaction instead of a generated one
+func WithTxID(txID string) Option {
+	return func(stub *Stub) {
+		stub.txID = txID
+	}
+}
+
+// NextTxID returns the ID that the next transaction without WithTxID gets
+func (l *Ledger) NextTxID() string {
+	return fmt.Sprintf("tx%06d", l.txCount+1)
+}
+
+// Advance moves the clock of the ledger forward, so that the next transaction
+// runs d plus one second after the previous one
+func (l *Ledger) Advance(d time.Duration) {
+	l.clock = l.clock.Add(d)
+}
+
+// Submit runs fn as a transaction of the client. The writes of the transaction
+// are committed if fn returns nil and discarded otherwise. It returns the
+// transaction ID
+func (l *Ledger) Submit(client *Identity, fn func(ctx contractapi.TransactionContextInterface) error, options ...Option) (string, error) {
+
+	stub, err := l.run(client, fn, options)
+	if err != nil {
+		return stub.txID, err
+	}
+
+	l.commit(stub)
+
+	return stub.txID, nil
+}
+
+// Evaluate runs fn as a query of the client. Its writes are always discarded
+func (l *Ledger) Evaluate(client *Identity, fn func(ctx contractapi.TransactionContextInterface) error, options ...Option) error {
+	_, err := l.run(client, fn, options)
+	return err
+}
+
+// State returns the committed value of a key
+func (l *Ledger) State(key string) []byte {
+	return l.state[key]
+}
+
+// PrivateData returns the committed value of a key in a private data collection
+func (l *Ledger) PrivateData(collection string, key string) []byte {
+	return l.private[collection][key]
+}
+
+// EndorsingOrgs returns the organizations that the state-based endorsement
+// policy of a key requires, or nil if the key has no such policy
+func (l *Ledger) EndorsingOrgs(key string) ([]string, error) {
+
+	policy, ok := l.validation[key]
+	if !ok {
+		return nil, nil
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := endorsementPolicy.ListOrgs()
+	sort.Strings(orgs)
+
+	return orgs, nil
+}
+
+// Events returns the events of all committed transactions, oldest first
+func (l *Ledger) Events() []Event {
+	return l.events
+}
+
+// run executes fn on a new stub for the client
+func (l *Ledger) run(client *Identity, fn func(ctx contractapi.TransactionContextInterface) error, options []Option) (*Stub, error) {
+
+	l.txCount++
+	l.clock = l.clock.Add(time.Second)
+
+	stub := newStub(l, fmt.Sprintf("tx%06d", l.txCount), l.clock)
+	stub.peerOrg = client.MSPID
+	for _, option := range options {
+		option(stub)
+	}
+
+	ctx := new(contractapi.TransactionContext)
+	ctx.SetStub(stub)
+	ctx.SetClientIdentity(client)
+
+	// the chaincode reads the organization of its peer from the environment
+	previous, set := os.LookupEnv("CORE_PEER_LOCALMSPID")
+	os.Setenv("CORE_PEER_LOCALMSPID", stub.peerOrg)
+	defer func() {
+		if set {
+			os.Setenv("CORE_PEER_LOCALMSPID", previous)
+		} else {
+			os.Unsetenv("CORE_PEER_LOCALMSPID")
+		}
+	}()
+
+	return stub, fn(ctx)
+}
+
+// commit applies the writes of a successful transaction to the ledger
+func (l *Ledger) commit(stub *Stub) {
+
+	for key, value := range stub.writes {
+		if len(value) == 0 {
+			delete(l.state, key)
+		} else {
+			l.state[key] = value
+		}
+	}
+
+	for collection, writes := range stub.privateWrites {
+		if _, ok := l.private[collection]; !ok {
+			l.private[collection] = make(map[string][]byte)
+		}
+		for key, value := range writes {
+			if len(value) == 0 {
+				delete(l.private[collection], key)
+			} else {
+				l.private[collection][key] = value
+			}
+		}
+	}
+
+	for key, policy := range stub.validationWrites {
+		l.validation[key] = policy
+	}
+
+	if stub.event != nil {
+		l.events = append(l.events, *stub.event)
+	}
+}
@@ -0,0 +1,311 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mockledger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/statebased"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+var start = time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+var client = NewIdentity("alice", "Org1MSP")
+
+func TestSubmitCommitsWritesOnSuccess(t *testing.T) {
+	ledger := New(start)
+
+	txID, err := ledger.Submit(client, func(ctx contractapi.TransactionContextInterface) error {
+		if err := ctx.GetStub().PutState("a", []byte("1")); err != nil {
+			return err
+		}
+
+		// a transaction does not read its own writes
+		value, err := ctx.GetStub().GetState("a")
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			return fmt.Errorf("read own write %s", value)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if txID != "tx000001" {
+		t.Errorf("Submit() txID = %v, want tx000001", txID)
+	}
+	if got := ledger.State("a"); string(got) != "1" {
+		t.Errorf("State(a) = %s, want 1", got)
+	}
+}
+
+func TestSubmitDiscardsWritesOnError(t *testing.T) {
+	ledger := New(start)
+
+	_, err := ledger.Submit(client, func(ctx contractapi.TransactionContextInterface) error {
+		ctx.GetStub().PutState("a", []byte("1"))
+		ctx.GetStub().PutPrivateData("collection", "b", []byte("2"))
+		ctx.GetStub().SetEvent("event", nil)
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatal("Submit() error = nil, want error")
+	}
+	if ledger.State("a") != nil || ledger.PrivateData("collection", "b") != nil || len(ledger.Events()) != 0 {
+		t.Error("writes of a failed transaction were committed")
+	}
+}
+
+func TestEvaluateDiscardsWrites(t *testing.T) {
+	ledger := New(start)
+
+	err := ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().PutState("a", []byte("1"))
+	})
+	if err != nil {
+		t.Fatalf("Evaluate() error = %v", err)
+	}
+	if ledger.State("a") != nil {
+		t.Error("Evaluate() committed a write")
+	}
+}
+
+func TestDeleteState(t *testing.T) {
+	ledger := New(start)
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		ctx.GetStub().PutState("a", []byte("1"))
+		return ctx.GetStub().PutState("b", []byte("2"))
+	})
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		ctx.GetStub().DelState("a")
+		return ctx.GetStub().PutState("b", nil)
+	})
+
+	if ledger.State("a") != nil || ledger.State("b") != nil {
+		t.Error("deleted keys are still in state")
+	}
+}
+
+func TestPrivateDataHash(t *testing.T) {
+	ledger := New(start)
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().PutPrivateData("collection", "a", []byte("secret"))
+	})
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		want := sha256.Sum256([]byte("secret"))
+
+		hash, err := ctx.GetStub().GetPrivateDataHash("collection", "a")
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(hash, want[:]) {
+			return fmt.Errorf("GetPrivateDataHash() = %x, want %x", hash, want)
+		}
+
+		hash, err = ctx.GetStub().GetPrivateDataHash("collection", "missing")
+		if err != nil {
+			return err
+		}
+		if hash != nil {
+			return fmt.Errorf("GetPrivateDataHash() of a missing key = %x, want nil", hash)
+		}
+
+		return nil
+	})
+}
+
+func TestCompositeKeys(t *testing.T) {
+	ledger := New(start)
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		for _, attributes := range [][]string{{"s2", "b"}, {"s1", "b"}, {"s1", "a"}} {
+			key, _ := ctx.GetStub().CreateCompositeKey("bid", attributes)
+			ctx.GetStub().PutState(key, []byte("bid"))
+			ctx.GetStub().PutPrivateData("collection", key, []byte("bid"))
+		}
+		key, _ := ctx.GetStub().CreateCompositeKey("other", []string{"s1", "c"})
+		ctx.GetStub().PutState(key, []byte("other"))
+		return ctx.GetStub().PutState("simple", []byte("simple"))
+	})
+
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		stub := ctx.GetStub()
+
+		iterator, err := stub.GetStateByPartialCompositeKey("bid", []string{"s1"})
+		if err != nil {
+			return err
+		}
+		if got, want := splitKeys(t, stub, iterator), [][]string{{"s1", "a"}, {"s1", "b"}}; !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("GetStateByPartialCompositeKey() = %v, want %v", got, want)
+		}
+
+		iterator, err = stub.GetPrivateDataByPartialCompositeKey("collection", "bid", []string{})
+		if err != nil {
+			return err
+		}
+		if got, want := splitKeys(t, stub, iterator), [][]string{{"s1", "a"}, {"s1", "b"}, {"s2", "b"}}; !reflect.DeepEqual(got, want) {
+			return fmt.Errorf("GetPrivateDataByPartialCompositeKey() = %v, want %v", got, want)
+		}
+
+		// range queries only return simple keys
+		iterator, err = stub.GetStateByRange("", "")
+		if err != nil {
+			return err
+		}
+		if !iterator.HasNext() {
+			return fmt.Errorf("GetStateByRange() returned no keys")
+		}
+		kv, _ := iterator.Next()
+		if kv.Key != "simple" || iterator.HasNext() {
+			return fmt.Errorf("GetStateByRange() did not return only the simple key")
+		}
+
+		return nil
+	})
+}
+
+func TestValidationParameters(t *testing.T) {
+	ledger := New(start)
+	mustSubmit(t, ledger, func(ctx contractapi.TransactionContextInterface) error {
+		policy, _ := statebased.NewStateEP(nil)
+		policy.AddOrgs(statebased.RoleTypePeer, "Org2MSP", "Org1MSP")
+		ep, _ := policy.Policy()
+		return ctx.GetStub().SetStateValidationParameter("a", ep)
+	})
+
+	orgs, err := ledger.EndorsingOrgs("a")
+	if err != nil {
+		t.Fatalf("EndorsingOrgs() error = %v", err)
+	}
+	if want := []string{"Org1MSP", "Org2MSP"}; !reflect.DeepEqual(orgs, want) {
+		t.Errorf("EndorsingOrgs() = %v, want %v", orgs, want)
+	}
+
+	orgs, err = ledger.EndorsingOrgs("b")
+	if err != nil || orgs != nil {
+		t.Errorf("EndorsingOrgs() of a key without policy = %v, %v, want nil", orgs, err)
+	}
+}
+
+func TestTransactionOptions(t *testing.T) {
+	ledger := New(start)
+	os.Unsetenv("CORE_PEER_LOCALMSPID")
+
+	transient := map[string][]byte{"bid": []byte("{}")}
+
+	txID, err := ledger.Submit(client, func(ctx contractapi.TransactionContextInterface) error {
+		got, _ := ctx.GetStub().GetTransient()
+		if !reflect.DeepEqual(got, transient) {
+			return fmt.Errorf("GetTransient() = %v, want %v", got, transient)
+		}
+
+		peerOrg, err := shim.GetMSPID()
+		if err != nil {
+			return err
+		}
+		if peerOrg != "Org2MSP" {
+			return fmt.Errorf("peer org = %v, want Org2MSP", peerOrg)
+		}
+
+		timestamp, _ := ctx.GetStub().GetTxTimestamp()
+		if timestamp.Seconds != start.Add(time.Second).Unix() {
+			return fmt.Errorf("GetTxTimestamp() = %v, want %v", timestamp.Seconds, start.Add(time.Second).Unix())
+		}
+
+		return ctx.GetStub().SetEvent("Placed", []byte("payload"))
+	}, WithTransient(transient), WithPeerOrg("Org2MSP"), WithTxID("custom"))
+	if err != nil {
+		t.Fatalf("Submit() error = %v", err)
+	}
+	if txID != "custom" {
+		t.Errorf("Submit() txID = %v, want custom", txID)
+	}
+	if _, set := os.LookupEnv("CORE_PEER_LOCALMSPID"); set {
+		t.Error("peer org was not reset after the transaction")
+	}
+
+	want := []Event{{TxID: "custom", Name: "Placed", Payload: []byte("payload")}}
+	if !reflect.DeepEqual(ledger.Events(), want) {
+		t.Errorf("Events() = %v, want %v", ledger.Events(), want)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+	ledger := New(start)
+	ledger.Advance(time.Hour)
+
+	err := ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		timestamp, _ := ctx.GetStub().GetTxTimestamp()
+		if want := start.Add(time.Hour + time.Second).Unix(); timestamp.Seconds != want {
+			return fmt.Errorf("GetTxTimestamp() = %v, want %v", timestamp.Seconds, want)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	operator := client.WithAttribute("gepx.role", "operator")
+
+	if err := operator.AssertAttributeValue("gepx.role", "operator"); err != nil {
+		t.Errorf("AssertAttributeValue() error = %v", err)
+	}
+	if err := operator.AssertAttributeValue("gepx.role", "meteringAgent"); err == nil {
+		t.Error("AssertAttributeValue() of a different value error = nil")
+	}
+	if err := client.AssertAttributeValue("gepx.role", "operator"); err == nil {
+		t.Error("AssertAttributeValue() of a missing attribute error = nil")
+	}
+	if operator.ID() != client.ID() {
+		t.Error("attributes changed the ID of the identity")
+	}
+	if client.ID() == NewIdentity("bob", "Org1MSP").ID() {
+		t.Error("different clients have the same ID")
+	}
+}
+
+// mustSubmit submits a transaction of the client and fails the test if it fails
+func mustSubmit(t *testing.T, ledger *Ledger, fn func(ctx contractapi.TransactionContextInterface) error) {
+	t.Helper()
+
+	if _, err := ledger.Submit(client, fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// splitKeys returns the attributes of the composite keys of an iterator
+func splitKeys(t *testing.T, stub shim.ChaincodeStubInterface, iterator shim.StateQueryIteratorInterface) [][]string {
+	t.Helper()
+	defer iterator.Close()
+
+	keys := [][]string{}
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, attributes, err := stub.SplitCompositeKey(kv.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, attributes)
+	}
+
+	return keys
+}
@@ -0,0 +1,390 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package mockledger
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+const (
+	compositeKeyNamespace = "\x00"
+	minUnicodeRuneValue   = "\x00"
+)
+
+// Stub implements the chaincode stub for a single transaction on a ledger.
+// Writes are buffered in the stub and reads only see the committed ledger, as
+// on a peer, where a transaction does not read its own writes
+type Stub struct {
+	ledger    *Ledger
+	txID      string
+	timestamp time.Time
+	transient map[string][]byte
+	peerOrg   string
+
+	writes           map[string][]byte
+	privateWrites    map[string]map[string][]byte
+	validationWrites map[string][]byte
+	event            *Event
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+// newStub returns a stub for a transaction on the ledger
+func newStub(ledger *Ledger, txID string, timestamp time.Time) *Stub {
+	return &Stub{
+		ledger:           ledger,
+		txID:             txID,
+		timestamp:        timestamp,
+		transient:        make(map[string][]byte),
+		writes:           make(map[string][]byte),
+		privateWrites:    make(map[string]map[string][]byte),
+		validationWrites: make(map[string][]byte),
+	}
+}
+
+// GetArgs is not supported, the contracts are invoked directly
+func (s *Stub) GetArgs() [][]byte {
+	return nil
+}
+
+// GetStringArgs is not supported, the contracts are invoked directly
+func (s *Stub) GetStringArgs() []string {
+	return nil
+}
+
+// GetFunctionAndParameters is not supported, the contracts are invoked directly
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	return "", nil
+}
+
+// GetArgsSlice is not supported, the contracts are invoked directly
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	return nil, fmt.Errorf("arguments are not supported by the mock ledger")
+}
+
+// GetTxID returns the ID of the transaction
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+// GetChannelID returns the channel of the ledger
+func (s *Stub) GetChannelID() string {
+	return s.ledger.ChannelID
+}
+
+// InvokeChaincode is not supported by the mock ledger
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	return shim.Error("chaincode to chaincode calls are not supported by the mock ledger")
+}
+
+// GetState returns the committed value of a key
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return copyBytes(s.ledger.state[key]), nil
+}
+
+// PutState writes a key when the transaction commits. As on a peer, writing an
+// empty value deletes the key
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	s.writes[key] = copyBytes(value)
+	return nil
+}
+
+// DelState deletes a key when the transaction commits
+func (s *Stub) DelState(key string) error {
+	s.writes[key] = nil
+	return nil
+}
+
+// SetStateValidationParameter sets the endorsement policy of a key when the
+// transaction commits
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validationWrites[key] = copyBytes(ep)
+	return nil
+}
+
+// GetStateValidationParameter returns the committed endorsement policy of a key
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return copyBytes(s.ledger.validation[key]), nil
+}
+
+// GetStateByRange iterates over the committed simple keys from startKey up to
+// but excluding endKey. An empty endKey iterates to the last key
+func (s *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+
+	keys := make([]string, 0)
+	for key := range s.ledger.state {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			continue
+		}
+		if key >= startKey && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+
+	return newIterator(keys, s.ledger.state), nil
+}
+
+// GetStateByRangeWithPagination is not supported by the mock ledger
+func (s *Stub) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("pagination is not supported by the mock ledger")
+}
+
+// GetStateByPartialCompositeKey iterates over the committed composite keys of
+// an object type that start with the given attributes
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return newIterator(keysWithPrefix(s.ledger.state, prefix), s.ledger.state), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination is not supported by the mock ledger
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("pagination is not supported by the mock ledger")
+}
+
+// CreateCompositeKey combines an object type and attributes into a key
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+
+	components := strings.Split(strings.TrimSuffix(compositeKey[1:], minUnicodeRuneValue), minUnicodeRuneValue)
+
+	return components[0], components[1:], nil
+}
+
+// GetQueryResult is not supported, the mock ledger has no state database
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("rich queries are not supported by the mock ledger")
+}
+
+// GetQueryResultWithPagination is not supported, the mock ledger has no state database
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("rich queries are not supported by the mock ledger")
+}
+
+// GetHistoryForKey is not supported, the mock ledger keeps no history
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("key history is not supported by the mock ledger")
+}
+
+// GetPrivateData returns the committed value of a key in a collection
+func (s *Stub) GetPrivateData(collection string, key string) ([]byte, error) {
+	return copyBytes(s.ledger.private[collection][key]), nil
+}
+
+// GetPrivateDataHash returns the hash of the committed value of a key in a
+// collection, or nil if the key does not exist
+func (s *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+
+	value, ok := s.ledger.private[collection][key]
+	if !ok {
+		return nil, nil
+	}
+
+	hash := sha256.Sum256(value)
+
+	return hash[:], nil
+}
+
+// PutPrivateData writes a key of a collection when the transaction commits.
+// Writing an empty value deletes the key
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return fmt.Errorf("collection must not be an empty string")
+	}
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if _, ok := s.privateWrites[collection]; !ok {
+		s.privateWrites[collection] = make(map[string][]byte)
+	}
+	s.privateWrites[collection][key] = copyBytes(value)
+	return nil
+}
+
+// DelPrivateData deletes a key of a collection when the transaction commits
+func (s *Stub) DelPrivateData(collection string, key string) error {
+	if _, ok := s.privateWrites[collection]; !ok {
+		s.privateWrites[collection] = make(map[string][]byte)
+	}
+	s.privateWrites[collection][key] = nil
+	return nil
+}
+
+// SetPrivateDataValidationParameter sets the endorsement policy of a key of a
+// collection when the transaction commits
+func (s *Stub) SetPrivateDataValidationParameter(collection string, key string, ep []byte) error {
+	s.validationWrites[privateValidationKey(collection, key)] = copyBytes(ep)
+	return nil
+}
+
+// GetPrivateDataValidationParameter returns the committed endorsement policy of
+// a key of a collection
+func (s *Stub) GetPrivateDataValidationParameter(collection string, key string) ([]byte, error) {
+	return copyBytes(s.ledger.validation[privateValidationKey(collection, key)]), nil
+}
+
+// GetPrivateDataByRange iterates over the committed keys of a collection from
+// startKey up to but excluding endKey
+func (s *Stub) GetPrivateDataByRange(collection string, startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+
+	values := s.ledger.private[collection]
+
+	keys := make([]string, 0)
+	for key := range values {
+		if key >= startKey && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+
+	return newIterator(keys, values), nil
+}
+
+// GetPrivateDataByPartialCompositeKey iterates over the committed composite
+// keys of a collection that start with the given attributes
+func (s *Stub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+
+	prefix, err := s.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	values := s.ledger.private[collection]
+
+	return newIterator(keysWithPrefix(values, prefix), values), nil
+}
+
+// GetPrivateDataQueryResult is not supported, the mock ledger has no state database
+func (s *Stub) GetPrivateDataQueryResult(collection string, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("rich queries are not supported by the mock ledger")
+}
+
+// GetCreator is not supported, the client is available from the client identity
+func (s *Stub) GetCreator() ([]byte, error) {
+	return nil, fmt.Errorf("the creator is not supported by the mock ledger")
+}
+
+// GetTransient returns the transient map of the transaction
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// GetBinding is not supported by the mock ledger
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, fmt.Errorf("the binding is not supported by the mock ledger")
+}
+
+// GetDecorations returns no decorations
+func (s *Stub) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+// GetSignedProposal is not supported by the mock ledger
+func (s *Stub) GetSignedProposal() (*pb.SignedProposal, error) {
+	return nil, fmt.Errorf("signed proposals are not supported by the mock ledger")
+}
+
+// GetTxTimestamp returns the timestamp of the transaction
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{
+		Seconds: s.timestamp.Unix(),
+		Nanos:   int32(s.timestamp.Nanosecond()),
+	}, nil
+}
+
+// SetEvent sets the event of the transaction. A transaction has at most one
+// event, so setting it again replaces the previous event
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	s.event = &Event{TxID: s.txID, Name: name, Payload: copyBytes(payload)}
+	return nil
+}
+
+// iterator iterates over a snapshot of sorted keys
+type iterator struct {
+	keys   []string
+	values map[string][]byte
+}
+
+// newIterator returns an iterator over the keys in sorted order
+func newIterator(keys []string, values map[string][]byte) *iterator {
+	sort.Strings(keys)
+	return &iterator{keys: keys, values: values}
+}
+
+// HasNext returns whether the iterator has more keys
+func (i *iterator) HasNext() bool {
+	return len(i.keys) > 0
+}
+
+// Next returns the next key and its value
+func (i *iterator) Next() (*queryresult.KV, error) {
+	if len(i.keys) == 0 {
+		return nil, fmt.Errorf("iterator has no more keys")
+	}
+
+	key := i.keys[0]
+	i.keys = i.keys[1:]
+
+	return &queryresult.KV{Key: key, Value: copyBytes(i.values[key])}, nil
+}
+
+// Close releases the iterator
+func (i *iterator) Close() error {
+	i.keys = nil
+	return nil
+}
+
+// keysWithPrefix returns the keys of values that start with prefix
+func keysWithPrefix(values map[string][]byte, prefix string) []string {
+	keys := make([]string, 0)
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// privateValidationKey is the key under which the ledger keeps the endorsement
+// policy of a private key, apart from the policies of public keys
+func privateValidationKey(collection string, key string) string {
+	return "private" + minUnicodeRuneValue + collection + minUnicodeRuneValue + key
+}
+
+// copyBytes returns a copy of b, so callers cannot modify the ledger
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
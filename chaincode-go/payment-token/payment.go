@@ -0,0 +1,401 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package payment
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PaymentContract keeps a ledger of fiat backed payment tokens, one token per
+// minor currency unit, and the escrows that hold buyers' funds for matched trades
+type PaymentContract struct {
+	contractapi.Contract
+}
+
+// Escrow holds the funds a buyer committed to a session until they are released
+// to sellers or refunded
+type Escrow struct {
+	SessionID string `json:"sessionID"`
+	Payer     string `json:"payer"`
+	Amount    int    `json:"amount"`
+	Released  int    `json:"released"`
+	Refunded  int    `json:"refunded"`
+}
+
+const balanceKeyType = "paymentBalance"
+const escrowKeyType = "escrow"
+const totalSupplyKey = "paymentTotalSupply"
+
+// roleAttribute is the certificate attribute that carries the market role of a client
+const roleAttribute = "gepx.role"
+
+const issuerRole = "paymentIssuer"
+
+// Remaining returns the funds still held in the escrow
+func (e *Escrow) Remaining() int {
+	return e.Amount - e.Released - e.Refunded
+}
+
+// Mint is used by the issuer to create tokens once the backing fiat has been received
+func (c *PaymentContract) Mint(ctx contractapi.TransactionContextInterface, account string, amount int) error {
+
+	err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, issuerRole)
+	if err != nil {
+		return fmt.Errorf("client is not authorized to mint payment tokens: %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("mint amount must be positive")
+	}
+
+	err = addBalance(ctx, account, amount)
+	if err != nil {
+		return err
+	}
+
+	return addTotalSupply(ctx, amount)
+}
+
+// Redeem burns tokens of the submitting client so that the issuer pays out the
+// backing fiat
+func (c *PaymentContract) Redeem(ctx contractapi.TransactionContextInterface, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("redeem amount must be positive")
+	}
+
+	err = addBalance(ctx, clientID, -amount)
+	if err != nil {
+		return err
+	}
+
+	return addTotalSupply(ctx, -amount)
+}
+
+// Transfer moves tokens from the account of the submitting client to the recipient
+func (c *PaymentContract) Transfer(ctx contractapi.TransactionContextInterface, recipient string, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+
+	return Pay(ctx, clientID, recipient, amount)
+}
+
+// BalanceOf returns the token balance of an account
+func (c *PaymentContract) BalanceOf(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+	return getBalance(ctx, account)
+}
+
+// TotalSupply returns the number of tokens in circulation
+func (c *PaymentContract) TotalSupply(ctx contractapi.TransactionContextInterface) (int, error) {
+
+	supplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read total supply: %v", err)
+	}
+	if supplyBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(supplyBytes))
+}
+
+// QueryEscrows returns the escrows held for a session
+func (c *PaymentContract) QueryEscrows(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Escrow, error) {
+	return getEscrows(ctx, sessionID)
+}
+
+// Pay moves tokens between two accounts
+func Pay(ctx contractapi.TransactionContextInterface, from string, to string, amount int) error {
+
+	if from == to {
+		return fmt.Errorf("cannot transfer to and from the same account")
+	}
+
+	err := addBalance(ctx, from, -amount)
+	if err != nil {
+		return err
+	}
+
+	return addBalance(ctx, to, amount)
+}
+
+// LockEscrow moves funds of the payer into the escrow of a session. It is called
+// by the session contract when a buy bid is revealed
+func LockEscrow(ctx contractapi.TransactionContextInterface, sessionID string, payer string, amount int) error {
+
+	err := addBalance(ctx, payer, -amount)
+	if err != nil {
+		return fmt.Errorf("failed to escrow funds of buyer: %v", err)
+	}
+
+	escrow, err := GetEscrow(ctx, sessionID, payer)
+	if err != nil {
+		return err
+	}
+
+	escrow.Amount += amount
+
+	return putEscrow(ctx, escrow)
+}
+
+// ReleaseEscrow pays amount out of the escrows of a session to the payee. Every
+// escrow contributes in proportion to the funds it still holds
+func ReleaseEscrow(ctx contractapi.TransactionContextInterface, sessionID string, payee string, amount int) error {
+
+	escrows, err := getEscrows(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	shares, err := proRata(escrows, amount)
+	if err != nil {
+		return err
+	}
+
+	for i, escrow := range escrows {
+		escrow.Released += shares[i]
+		err = putEscrow(ctx, escrow)
+		if err != nil {
+			return err
+		}
+	}
+
+	return addBalance(ctx, payee, amount)
+}
+
+// RefundPayer returns part of the funds a payer holds in the escrow of a session.
+// It is called by the session contract for the funds a buyer locked that are not
+// needed for the buyer's allocations
+func RefundPayer(ctx contractapi.TransactionContextInterface, sessionID string, payer string, amount int) error {
+
+	escrow, err := GetEscrow(ctx, sessionID, payer)
+	if err != nil {
+		return err
+	}
+
+	if amount > escrow.Remaining() {
+		return fmt.Errorf("insufficient escrowed funds of payer: %d, required %d", escrow.Remaining(), amount)
+	}
+
+	escrow.Refunded += amount
+	err = putEscrow(ctx, escrow)
+	if err != nil {
+		return err
+	}
+
+	return addBalance(ctx, payer, amount)
+}
+
+// RefundEscrow returns the funds still held for a session to the payers
+func RefundEscrow(ctx contractapi.TransactionContextInterface, sessionID string) error {
+
+	escrows, err := getEscrows(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	for _, escrow := range escrows {
+		refund := escrow.Remaining()
+		if refund == 0 {
+			continue
+		}
+
+		escrow.Refunded += refund
+		err = putEscrow(ctx, escrow)
+		if err != nil {
+			return err
+		}
+
+		err = addBalance(ctx, escrow.Payer, refund)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// proRata splits amount over the escrows in proportion to their remaining funds.
+// The shares are rounded down, and the tokens that rounding leaves over go one
+// at a time to the escrows in key order whose share was rounded, so the shares
+// add up to amount and no escrow pays out more than it holds
+func proRata(escrows []*Escrow, amount int) ([]int, error) {
+
+	total := 0
+	for _, escrow := range escrows {
+		total += escrow.Remaining()
+	}
+
+	if amount > total {
+		return nil, fmt.Errorf("insufficient escrowed funds: %d, required %d", total, amount)
+	}
+
+	shares := make([]int, len(escrows))
+	if amount == 0 {
+		return shares, nil
+	}
+
+	assigned := 0
+	for i, escrow := range escrows {
+		shares[i] = amount * escrow.Remaining() / total
+		assigned += shares[i]
+	}
+
+	for i, escrow := range escrows {
+		if assigned == amount {
+			break
+		}
+		if amount*escrow.Remaining()%total != 0 {
+			shares[i]++
+			assigned++
+		}
+	}
+
+	return shares, nil
+}
+
+// GetEscrow reads the escrow of a payer in a session from state. A payer without
+// escrow has an empty one
+func GetEscrow(ctx contractapi.TransactionContextInterface, sessionID string, payer string) (*Escrow, error) {
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowKeyType, []string{sessionID, payer})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	escrowBytes, err := ctx.GetStub().GetState(escrowKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read escrow: %v", err)
+	}
+	if escrowBytes == nil {
+		return &Escrow{SessionID: sessionID, Payer: payer}, nil
+	}
+
+	var escrow Escrow
+	err = json.Unmarshal(escrowBytes, &escrow)
+	if err != nil {
+		return nil, err
+	}
+
+	return &escrow, nil
+}
+
+// getEscrows is an internal helper that reads all escrows of a session in key order
+func getEscrows(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Escrow, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(escrowKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get escrows of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	escrows := []*Escrow{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var escrow Escrow
+		err = json.Unmarshal(queryResponse.Value, &escrow)
+		if err != nil {
+			return nil, err
+		}
+		escrows = append(escrows, &escrow)
+	}
+
+	return escrows, nil
+}
+
+// putEscrow is an internal helper that writes an escrow to state
+func putEscrow(ctx contractapi.TransactionContextInterface, escrow *Escrow) error {
+
+	escrowKey, err := ctx.GetStub().CreateCompositeKey(escrowKeyType, []string{escrow.SessionID, escrow.Payer})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	escrowBytes, err := json.Marshal(escrow)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(escrowKey, escrowBytes)
+}
+
+// getBalance is an internal helper that reads a token balance
+func getBalance(ctx contractapi.TransactionContextInterface, account string) (int, error) {
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(balanceKeyType, []string{account})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	balanceBytes, err := ctx.GetStub().GetState(balanceKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read balance: %v", err)
+	}
+	if balanceBytes == nil {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(balanceBytes))
+}
+
+// addBalance is an internal helper that changes a token balance by delta and
+// refuses to let it become negative
+func addBalance(ctx contractapi.TransactionContextInterface, account string, delta int) error {
+
+	balance, err := getBalance(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	if balance+delta < 0 {
+		return fmt.Errorf("insufficient payment token balance: %d, required %d", balance, -delta)
+	}
+
+	balanceKey, err := ctx.GetStub().CreateCompositeKey(balanceKeyType, []string{account})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(balanceKey, []byte(strconv.Itoa(balance+delta)))
+}
+
+// addTotalSupply is an internal helper that changes the total supply by delta
+func addTotalSupply(ctx contractapi.TransactionContextInterface, delta int) error {
+
+	supplyBytes, err := ctx.GetStub().GetState(totalSupplyKey)
+	if err != nil {
+		return fmt.Errorf("failed to read total supply: %v", err)
+	}
+
+	supply := 0
+	if supplyBytes != nil {
+		supply, err = strconv.Atoi(string(supplyBytes))
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.GetStub().PutState(totalSupplyKey, []byte(strconv.Itoa(supply+delta)))
+}
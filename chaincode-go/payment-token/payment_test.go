@@ -0,0 +1,441 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package payment
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+var contract = new(PaymentContract)
+
+var (
+	issuer = mockledger.NewIdentity("issuer", "Org1MSP").WithAttribute(roleAttribute, issuerRole)
+	seller = mockledger.NewIdentity("seller", "Org1MSP")
+	buyer  = mockledger.NewIdentity("buyer", "Org2MSP")
+	trader = mockledger.NewIdentity("trader", "Org2MSP")
+)
+
+// newLedger returns a ledger on which the buyer and the trader hold 1000 tokens each
+func newLedger(t *testing.T) *mockledger.Ledger {
+	t.Helper()
+
+	ledger := mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC))
+	for _, account := range []string{buyer.ID(), trader.ID()} {
+		account := account
+		mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+			return contract.Mint(ctx, account, 1000)
+		})
+	}
+
+	return ledger
+}
+
+// mustSubmit runs a transaction of the client and fails the test if it fails
+func mustSubmit(t *testing.T, ledger *mockledger.Ledger, client *mockledger.Identity, fn func(ctx contractapi.TransactionContextInterface) error) {
+	t.Helper()
+
+	txID, err := ledger.Submit(client, fn)
+	if err != nil {
+		t.Fatalf("transaction %v failed: %v", txID, err)
+	}
+}
+
+// balance returns the token balance of an account
+func balance(t *testing.T, ledger *mockledger.Ledger, client *mockledger.Identity) int {
+	t.Helper()
+
+	var balance int
+	err := ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		balance, err = contract.BalanceOf(ctx, client.ID())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return balance
+}
+
+// escrows returns the escrows of s1
+func escrows(t *testing.T, ledger *mockledger.Ledger) []*Escrow {
+	t.Helper()
+
+	var escrows []*Escrow
+	err := ledger.Evaluate(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		escrows, err = contract.QueryEscrows(ctx, "s1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return escrows
+}
+
+// checkSupply fails the test if the balances and the funds held in escrow do
+// not add up to the total supply
+func checkSupply(t *testing.T, ledger *mockledger.Ledger) {
+	t.Helper()
+
+	held := 0
+	for _, client := range []*mockledger.Identity{issuer, seller, buyer, trader} {
+		held += balance(t, ledger, client)
+	}
+	for _, escrow := range escrows(t, ledger) {
+		held += escrow.Remaining()
+	}
+
+	var supply int
+	err := ledger.Evaluate(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		supply, err = contract.TotalSupply(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if held != supply {
+		t.Errorf("balances and escrows hold %d tokens, total supply is %d", held, supply)
+	}
+}
+
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %v, want an error containing %q", err, want)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *mockledger.Identity
+		transaction func(ctx contractapi.TransactionContextInterface) error
+		wantErr     string
+		wantBuyer   int
+		wantSeller  int
+	}{
+		{
+			name:   "mint",
+			client: issuer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, seller.ID(), 50)
+			},
+			wantBuyer: 1000, wantSeller: 50,
+		},
+		{
+			name:   "mint without the issuer role",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, buyer.ID(), 50)
+			},
+			wantErr:   "client is not authorized to mint payment tokens",
+			wantBuyer: 1000,
+		},
+		{
+			name:   "mint nothing",
+			client: issuer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Mint(ctx, seller.ID(), 0)
+			},
+			wantErr:   "mint amount must be positive",
+			wantBuyer: 1000,
+		},
+		{
+			name:   "redeem",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Redeem(ctx, 300)
+			},
+			wantBuyer: 700,
+		},
+		{
+			name:   "redeem above the balance",
+			client: seller,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Redeem(ctx, 1)
+			},
+			wantErr:   "insufficient payment token balance: 0, required 1",
+			wantBuyer: 1000,
+		},
+		{
+			name:   "transfer",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, seller.ID(), 250)
+			},
+			wantBuyer: 750, wantSeller: 250,
+		},
+		{
+			name:   "transfer above the balance",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, seller.ID(), 1001)
+			},
+			wantErr:   "insufficient payment token balance: 1000, required 1001",
+			wantBuyer: 1000,
+		},
+		{
+			name:   "transfer to yourself",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, buyer.ID(), 10)
+			},
+			wantErr:   "cannot transfer to and from the same account",
+			wantBuyer: 1000,
+		},
+		{
+			name:   "transfer nothing",
+			client: buyer,
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return contract.Transfer(ctx, seller.ID(), 0)
+			},
+			wantErr:   "transfer amount must be positive",
+			wantBuyer: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger(t)
+
+			_, err := ledger.Submit(tt.client, tt.transaction)
+			checkError(t, err, tt.wantErr)
+
+			if got := balance(t, ledger, buyer); got != tt.wantBuyer {
+				t.Errorf("buyer balance = %d, want %d", got, tt.wantBuyer)
+			}
+			if got := balance(t, ledger, seller); got != tt.wantSeller {
+				t.Errorf("seller balance = %d, want %d", got, tt.wantSeller)
+			}
+			checkSupply(t, ledger)
+		})
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	tests := []struct {
+		name        string
+		transaction func(ctx contractapi.TransactionContextInterface) error
+		wantErr     string
+		wantBuyer   int
+		wantTrader  int
+		wantSeller  int
+		wantEscrows []Escrow
+	}{
+		{
+			name: "lock",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return LockEscrow(ctx, "s1", buyer.ID(), 200)
+			},
+			wantBuyer: 400, wantTrader: 900,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 600}, {Payer: trader.ID(), Amount: 100}},
+		},
+		{
+			name: "lock above the balance",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return LockEscrow(ctx, "s1", buyer.ID(), 601)
+			},
+			wantErr:   "failed to escrow funds of buyer: insufficient payment token balance: 600, required 601",
+			wantBuyer: 600, wantTrader: 900,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400}, {Payer: trader.ID(), Amount: 100}},
+		},
+		{
+			name: "release in proportion to the funds held",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return ReleaseEscrow(ctx, "s1", seller.ID(), 250)
+			},
+			wantBuyer: 600, wantTrader: 900, wantSeller: 250,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400, Released: 200}, {Payer: trader.ID(), Amount: 100, Released: 50}},
+		},
+		{
+			name: "release with a rounding remainder",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return ReleaseEscrow(ctx, "s1", seller.ID(), 7)
+			},
+			wantBuyer: 600, wantTrader: 900, wantSeller: 7,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400, Released: 6}, {Payer: trader.ID(), Amount: 100, Released: 1}},
+		},
+		{
+			name: "release above the funds held",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return ReleaseEscrow(ctx, "s1", seller.ID(), 501)
+			},
+			wantErr:   "insufficient escrowed funds: 500, required 501",
+			wantBuyer: 600, wantTrader: 900,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400}, {Payer: trader.ID(), Amount: 100}},
+		},
+		{
+			name: "refund a payer",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return RefundPayer(ctx, "s1", trader.ID(), 40)
+			},
+			wantBuyer: 600, wantTrader: 940,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400}, {Payer: trader.ID(), Amount: 100, Refunded: 40}},
+		},
+		{
+			name: "refund a payer above the funds held",
+			transaction: func(ctx contractapi.TransactionContextInterface) error {
+				return RefundPayer(ctx, "s1", trader.ID(), 101)
+			},
+			wantErr:   "insufficient escrowed funds of payer: 100, required 101",
+			wantBuyer: 600, wantTrader: 900,
+			wantEscrows: []Escrow{{Payer: buyer.ID(), Amount: 400}, {Payer: trader.ID(), Amount: 100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := newLedger(t)
+			mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+				return LockEscrow(ctx, "s1", buyer.ID(), 400)
+			})
+			mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+				return LockEscrow(ctx, "s1", trader.ID(), 100)
+			})
+
+			_, err := ledger.Submit(issuer, tt.transaction)
+			checkError(t, err, tt.wantErr)
+
+			if got := balance(t, ledger, buyer); got != tt.wantBuyer {
+				t.Errorf("buyer balance = %d, want %d", got, tt.wantBuyer)
+			}
+			if got := balance(t, ledger, trader); got != tt.wantTrader {
+				t.Errorf("trader balance = %d, want %d", got, tt.wantTrader)
+			}
+			if got := balance(t, ledger, seller); got != tt.wantSeller {
+				t.Errorf("seller balance = %d, want %d", got, tt.wantSeller)
+			}
+
+			got := escrows(t, ledger)
+			if len(got) != len(tt.wantEscrows) {
+				t.Fatalf("escrows = %+v, want %+v", got, tt.wantEscrows)
+			}
+			for i, want := range tt.wantEscrows {
+				want.SessionID = "s1"
+				if *got[i] != want {
+					t.Errorf("escrow %d = %+v, want %+v", i, *got[i], want)
+				}
+			}
+			checkSupply(t, ledger)
+		})
+	}
+}
+
+func TestRefundEscrow(t *testing.T) {
+	ledger := newLedger(t)
+	mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return LockEscrow(ctx, "s1", buyer.ID(), 400)
+	})
+	mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return LockEscrow(ctx, "s1", trader.ID(), 100)
+	})
+	mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return ReleaseEscrow(ctx, "s1", seller.ID(), 250)
+	})
+	mustSubmit(t, ledger, issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return RefundEscrow(ctx, "s1")
+	})
+
+	// the payers get back what was not released, in the same proportion
+	if got := balance(t, ledger, buyer); got != 800 {
+		t.Errorf("buyer balance = %d, want 800", got)
+	}
+	if got := balance(t, ledger, trader); got != 950 {
+		t.Errorf("trader balance = %d, want 950", got)
+	}
+	for _, escrow := range escrows(t, ledger) {
+		if escrow.Remaining() != 0 {
+			t.Errorf("escrow %+v still holds %d", escrow, escrow.Remaining())
+		}
+	}
+	checkSupply(t, ledger)
+}
+
+func TestProRata(t *testing.T) {
+	tests := []struct {
+		name       string
+		remaining  []int
+		amount     int
+		wantShares []int
+		wantErr    string
+	}{
+		{name: "even split", remaining: []int{100, 100}, amount: 50, wantShares: []int{25, 25}},
+		{name: "remainder to the first rounded escrows", remaining: []int{1, 1, 1}, amount: 2, wantShares: []int{1, 1, 0}},
+		{name: "empty escrows are skipped", remaining: []int{0, 3, 0, 3}, amount: 3, wantShares: []int{0, 2, 0, 1}},
+		{name: "everything", remaining: []int{7, 5}, amount: 12, wantShares: []int{7, 5}},
+		{name: "nothing from empty escrows", remaining: []int{0, 0}, amount: 0, wantShares: []int{0, 0}},
+		{name: "more than held", remaining: []int{7, 5}, amount: 13, wantErr: "insufficient escrowed funds: 12, required 13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var escrows []*Escrow
+			for _, remaining := range tt.remaining {
+				escrows = append(escrows, &Escrow{Amount: remaining})
+			}
+
+			shares, err := proRata(escrows, tt.amount)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			for i := range shares {
+				if shares[i] != tt.wantShares[i] {
+					t.Fatalf("proRata() = %v, want %v", shares, tt.wantShares)
+				}
+			}
+		})
+	}
+}
+
+// TestProRataKeepsTokens checks on random escrows that the shares add up to the
+// amount and that no escrow pays out more than it holds
+func TestProRataKeepsTokens(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for run := 0; run < 1000; run++ {
+		escrows := make([]*Escrow, 1+random.Intn(6))
+		total := 0
+		for i := range escrows {
+			escrows[i] = &Escrow{Amount: random.Intn(20)}
+			total += escrows[i].Amount
+		}
+		amount := random.Intn(total + 1)
+
+		shares, err := proRata(escrows, amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sum := 0
+		for i, share := range shares {
+			if share < 0 || share > escrows[i].Remaining() {
+				t.Fatalf("proRata(%v) = %v, share %d of escrow %d holding %d", amount, shares, share, i, escrows[i].Remaining())
+			}
+			sum += share
+		}
+		if sum != amount {
+			t.Fatalf("proRata(%v) = %v, adds up to %d", amount, shares, sum)
+		}
+	}
+}
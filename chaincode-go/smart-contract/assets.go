@@ -0,0 +1,334 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Asset is a generation or load asset registered by its owner. Capacity is the
+// most volume the asset can produce or consume in one session interval, and
+// RampRate the most its output can change between consecutive intervals
+type Asset struct {
+	AssetID         string `json:"assetID"`
+	Owner           string `json:"owner"`
+	Org             string `json:"org"`
+	Kind            string `json:"kind"`
+	Technology      string `json:"technology"`
+	Renewable       bool   `json:"renewable"`
+	Capacity        int    `json:"capacity"`
+	RampRate        int    `json:"rampRate"`
+	ConnectionPoint string `json:"connectionPoint"`
+}
+
+// AssetCommitment is the volume a revealed bid committed of an asset. It is kept
+// until the session of the bid ends, so that the capacity of the asset cannot be
+// lowered below what it has to deliver in sessions that are still being cleared
+type AssetCommitment struct {
+	AssetID   string `json:"assetID"`
+	SessionID string `json:"sessionID"`
+	TxID      string `json:"txID"`
+	Volume    int    `json:"volume"`
+}
+
+const assetKeyType = "asset"
+const assetCommitmentKeyType = "assetCommitment"
+
+const (
+	Generation = "generation"
+	Load       = "load"
+)
+
+// RegisterAsset is used by a participant to register a generation or load asset.
+// Sell bids have to reference a generation asset of the bidder, and certificates
+// can only be issued for renewable generation assets
+func (s *SmartContract) RegisterAsset(ctx contractapi.TransactionContextInterface, assetID string, kind string, technology string, renewable bool, capacity int, rampRate int, connectionPoint string) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if kind != Generation && kind != Load {
+		return fmt.Errorf("asset kind must be %v or %v", Generation, Load)
+	}
+	if renewable && kind != Generation {
+		return fmt.Errorf("only generation assets can be renewable")
+	}
+	if capacity <= 0 {
+		return fmt.Errorf("asset capacity must be positive")
+	}
+	if rampRate < 0 {
+		return fmt.Errorf("asset ramp rate cannot be negative")
+	}
+
+	existing, err := getAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("asset %v is already registered", assetID)
+	}
+
+	asset := Asset{
+		AssetID:         assetID,
+		Owner:           clientID,
+		Org:             clientOrgID,
+		Kind:            kind,
+		Technology:      technology,
+		Renewable:       renewable,
+		Capacity:        capacity,
+		RampRate:        rampRate,
+		ConnectionPoint: connectionPoint,
+	}
+
+	return putAsset(ctx, &asset)
+}
+
+// UpdateAssetCapacity is used by the owner of an asset to change its registered
+// capacity and ramp rate, e.g. after a repowering or during a partial outage. The
+// capacity cannot fall below the volume that revealed bids committed of the asset
+// in a session that has not ended
+func (s *SmartContract) UpdateAssetCapacity(ctx contractapi.TransactionContextInterface, assetID string, capacity int, rampRate int) error {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	asset, err := s.QueryAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	if asset.Owner != clientID {
+		return fmt.Errorf("asset can only be updated by its owner")
+	}
+	if capacity <= 0 {
+		return fmt.Errorf("asset capacity must be positive")
+	}
+	if rampRate < 0 {
+		return fmt.Errorf("asset ramp rate cannot be negative")
+	}
+
+	committed, err := committedAssetVolume(ctx, assetID)
+	if err != nil {
+		return err
+	}
+	if capacity < committed {
+		return fmt.Errorf("asset capacity %d is below the volume of %d committed in a session that has not ended", capacity, committed)
+	}
+
+	asset.Capacity = capacity
+	asset.RampRate = rampRate
+
+	return putAsset(ctx, asset)
+}
+
+// QueryAsset returns a registered asset
+func (s *SmartContract) QueryAsset(ctx contractapi.TransactionContextInterface, assetID string) (*Asset, error) {
+
+	asset, err := getAsset(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, fmt.Errorf("asset %v does not exist", assetID)
+	}
+
+	return asset, nil
+}
+
+// getAsset is an internal helper that reads an asset from state. It returns nil
+// if the asset is not registered
+func getAsset(ctx contractapi.TransactionContextInterface, assetID string) (*Asset, error) {
+
+	assetKey, err := ctx.GetStub().CreateCompositeKey(assetKeyType, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	assetBytes, err := ctx.GetStub().GetState(assetKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get asset %v: %v", assetID, err)
+	}
+	if assetBytes == nil {
+		return nil, nil
+	}
+
+	var asset Asset
+	err = json.Unmarshal(assetBytes, &asset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &asset, nil
+}
+
+// putAsset is an internal helper that writes an asset to state
+func putAsset(ctx contractapi.TransactionContextInterface, asset *Asset) error {
+
+	assetKey, err := ctx.GetStub().CreateCompositeKey(assetKeyType, []string{asset.AssetID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	assetBytes, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(assetKey, assetBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put asset: %v", err)
+	}
+
+	return nil
+}
+
+// checkBidAsset validates the asset referenced by a bid. Sell bids must reference
+// a generation asset of the bidder, buy bids can optionally reference a load
+// asset. The volume of the bid, together with the volume the bidder already bid
+// with the asset in the session, cannot exceed the capacity of the asset. A bid
+// without connection point takes the one of its asset, and a sell bid that
+// declares its source type has to declare the technology of its asset
+func checkBidAsset(ctx contractapi.TransactionContextInterface, bid *FullBid, owner string, committed int) error {
+
+	if bid.AssetID == "" {
+		if bid.BidType.IsSell() {
+			return fmt.Errorf("sell bids must reference a generation asset")
+		}
+		return nil
+	}
+
+	asset, err := getAsset(ctx, bid.AssetID)
+	if err != nil {
+		return err
+	}
+	if asset == nil {
+		return fmt.Errorf("asset %v does not exist", bid.AssetID)
+	}
+
+	if asset.Owner != owner {
+		return fmt.Errorf("asset %v is not owned by the bidder", bid.AssetID)
+	}
+	if bid.BidType.IsSell() && asset.Kind != Generation {
+		return fmt.Errorf("sell bids must reference a generation asset")
+	}
+	if bid.BidType.IsBuy() && asset.Kind != Load {
+		return fmt.Errorf("buy bids can only reference a load asset")
+	}
+
+	if bid.Volume+committed > asset.Capacity {
+		return fmt.Errorf("bid volume %d exceeds the capacity of asset %v: %d, already bid %d", bid.Volume, bid.AssetID, asset.Capacity, committed)
+	}
+
+	if bid.ConnectionPoint == "" {
+		bid.ConnectionPoint = asset.ConnectionPoint
+	} else if asset.ConnectionPoint != "" && bid.ConnectionPoint != asset.ConnectionPoint {
+		return fmt.Errorf("bid connection point %v does not match the connection point of asset %v", bid.ConnectionPoint, bid.AssetID)
+	}
+
+	// the carbon report counts sell volume by its declared source
+	if bid.BidType.IsSell() && bid.SourceType != "" && asset.Technology != "" && bid.SourceType != asset.Technology {
+		return fmt.Errorf("bid source type %v does not match the technology of asset %v: %v", bid.SourceType, bid.AssetID, asset.Technology)
+	}
+
+	return nil
+}
+
+// commitAssetVolume records the volume a revealed bid committed of its asset.
+// Revealing the same bid again replaces its commitment
+func commitAssetVolume(ctx contractapi.TransactionContextInterface, commitment *AssetCommitment) error {
+
+	commitmentKey, err := ctx.GetStub().CreateCompositeKey(assetCommitmentKeyType, []string{commitment.AssetID, commitment.SessionID, commitment.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	commitmentBytes, err := json.Marshal(commitment)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(commitmentKey, commitmentBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put asset commitment: %v", err)
+	}
+
+	return nil
+}
+
+// releaseAssetCommitments removes the commitments of the revealed bids of an
+// ended session
+func releaseAssetCommitments(ctx contractapi.TransactionContextInterface, sessionID string, bids map[string]FullBid) error {
+
+	for bidKey, bid := range bids {
+		if bid.AssetID == "" {
+			continue
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(bidKey)
+		if err != nil {
+			return fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		commitmentKey, err := ctx.GetStub().CreateCompositeKey(assetCommitmentKeyType, []string{bid.AssetID, sessionID, keyParts[1]})
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+
+		err = ctx.GetStub().DelState(commitmentKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete asset commitment: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// committedAssetVolume returns the most volume that revealed bids committed of
+// an asset in any single session that has not ended
+func committedAssetVolume(ctx contractapi.TransactionContextInterface, assetID string) (int, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(assetCommitmentKeyType, []string{assetID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get commitments of asset %v: %v", assetID, err)
+	}
+	defer resultsIterator.Close()
+
+	sessions := make(map[string]int)
+	committed := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var commitment AssetCommitment
+		err = json.Unmarshal(queryResponse.Value, &commitment)
+		if err != nil {
+			return 0, err
+		}
+
+		sessions[commitment.SessionID] += commitment.Volume
+		if sessions[commitment.SessionID] > committed {
+			committed = sessions[commitment.SessionID]
+		}
+	}
+
+	return committed, nil
+}
@@ -0,0 +1,91 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestUpdateAssetCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(m *market)
+		client   *mockledger.Identity
+		assetID  string
+		capacity int
+		rampRate int
+		wantErr  string
+	}{
+		{name: "owner", client: seller, assetID: "pv1", capacity: 80, rampRate: 10},
+		{name: "not the owner", client: trader, assetID: "pv1", capacity: 80, wantErr: "asset can only be updated by its owner"},
+		{name: "unknown asset", client: seller, assetID: "pv9", capacity: 80, wantErr: "asset pv9 does not exist"},
+		{name: "zero capacity", client: seller, assetID: "pv1", capacity: 0, wantErr: "asset capacity must be positive"},
+		{name: "negative capacity", client: seller, assetID: "pv1", capacity: -10, wantErr: "asset capacity must be positive"},
+		{name: "negative ramp rate", client: seller, assetID: "pv1", capacity: 80, rampRate: -1, wantErr: "asset ramp rate cannot be negative"},
+		{
+			name:     "below the volume committed in a session that has not ended",
+			setup:    revealBids,
+			client:   seller,
+			assetID:  "pv1",
+			capacity: 40,
+			wantErr:  "asset capacity 40 is below the volume of 50 committed in a session that has not ended",
+		},
+		{name: "at the committed volume", setup: revealBids, client: seller, assetID: "pv1", capacity: 50},
+		{
+			name: "volume committed in an ended session",
+			setup: func(m *market) {
+				revealBids(m)
+				m.endSession("s1")
+			},
+			client:   seller,
+			assetID:  "pv1",
+			capacity: 40,
+		},
+		{
+			name: "sealed bid",
+			setup: func(m *market) {
+				m.placeAndSubmitBid(seller, "s1", sellBid(seller, "pv1", 50, 10))
+			},
+			client:   seller,
+			assetID:  "pv1",
+			capacity: 40,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.UpdateAssetCapacity(ctx, tt.assetID, tt.capacity, tt.rampRate)
+			})
+			checkError(t, err, tt.wantErr)
+
+			var asset *Asset
+			err = m.ledger.Evaluate(seller, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				asset, err = contract.QueryAsset(ctx, "pv1")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantCapacity, wantRampRate := 100, 0
+			if tt.wantErr == "" {
+				wantCapacity, wantRampRate = tt.capacity, tt.rampRate
+			}
+			if asset.Capacity != wantCapacity || asset.RampRate != wantRampRate {
+				t.Errorf("asset = %+v, want a capacity of %d and a ramp rate of %d", asset, wantCapacity, wantRampRate)
+			}
+		})
+	}
+}
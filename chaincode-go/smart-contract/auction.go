@@ -0,0 +1,164 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"sort"
+)
+
+// uniformPrice clears a session as a double auction. The bids are matched in
+// merit order and every allocation settles at the price of its zone
+type uniformPrice struct{}
+
+// Clear implements ClearingAlgorithm
+func (uniformPrice) Clear(input ClearingInput) (map[string]Allocation, *ClearingResult) {
+	return clearWithinBuyPrices(input, clearMeritOrder)
+}
+
+// payAsBid clears a session in merit order like uniformPrice, but every
+// allocation settles at the price of its own bid
+type payAsBid struct{}
+
+// Clear implements ClearingAlgorithm
+func (payAsBid) Clear(input ClearingInput) (map[string]Allocation, *ClearingResult) {
+	allocations, result := clearMeritOrder(input)
+	for bidKey, allocated := range allocations {
+		if allocated.Volume > 0 {
+			allocated.Price = input.Bids[bidKey].Price
+			allocations[bidKey] = allocated
+		}
+	}
+	return allocations, result
+}
+
+// clearMeritOrder matches the buy bids, most expensive first, with the cheapest
+// sell bids that do not ask more than the buyer offers. A buy bid can be served
+// from its own zone, or from another zone as far as the interconnector between
+// the two zones has capacity left. Green buy bids are only served by certified
+// sell bids of their own zone. Sell volume is counted after the losses of its
+// connection point, and bids with the same price are visited in key order
+func clearMeritOrder(input ClearingInput) (map[string]Allocation, *ClearingResult) {
+
+	bids := input.Bids
+
+	var sellKeys, buyKeys []string
+	for bidKey, bid := range bids {
+		if bid.BidType.IsSell() {
+			sellKeys = append(sellKeys, bidKey)
+		}
+		if bid.BidType.IsBuy() {
+			buyKeys = append(buyKeys, bidKey)
+		}
+	}
+	sort.Strings(sellKeys)
+	sort.Strings(buyKeys)
+	sort.SliceStable(sellKeys, func(i, j int) bool {
+		return bids[sellKeys[i]].Price < bids[sellKeys[j]].Price
+	})
+	sort.SliceStable(buyKeys, func(i, j int) bool {
+		return bids[buyKeys[i]].Price > bids[buyKeys[j]].Price
+	})
+
+	// the volume every sell bid can still deliver to the buyers
+	deliverable := make(map[string]int)
+	for _, bidKey := range sellKeys {
+		bid := bids[bidKey]
+		deliverable[bidKey] = withdrawal(bid.Volume, input.LossFactors[bid.ConnectionPoint])
+	}
+
+	capacity := make(map[Flow]int)
+	for _, interconnector := range input.Interconnectors {
+		capacity[Flow{From: interconnector.From, To: interconnector.To}] = interconnector.Capacity
+	}
+
+	delivered := make(map[string]int)
+	transferred := make(map[Flow]int)
+
+	for _, buyKey := range buyKeys {
+		buy := bids[buyKey]
+		for _, sellKey := range sellKeys {
+			sell := bids[sellKey]
+			if sell.Price > buy.Price {
+				break
+			}
+			if buy.Green && (!sell.Green || sell.Zone != buy.Zone) {
+				continue
+			}
+
+			volume := buy.Volume - delivered[buyKey]
+			if deliverable[sellKey] < volume {
+				volume = deliverable[sellKey]
+			}
+
+			link := Flow{From: sell.Zone, To: buy.Zone}
+			if sell.Zone != buy.Zone && capacity[link]-transferred[link] < volume {
+				volume = capacity[link] - transferred[link]
+			}
+			if volume <= 0 {
+				continue
+			}
+
+			if sell.Zone != buy.Zone {
+				transferred[link] += volume
+			}
+			deliverable[sellKey] -= volume
+			delivered[sellKey] += volume
+			delivered[buyKey] += volume
+
+			if delivered[buyKey] == buy.Volume {
+				break
+			}
+		}
+	}
+
+	allocations := make(map[string]Allocation)
+	for _, bidKey := range sellKeys {
+		bid := bids[bidKey]
+		lossFactor := input.LossFactors[bid.ConnectionPoint]
+		full := withdrawal(bid.Volume, lossFactor)
+
+		sold := Allocation{
+			Status:     allocationStatus(delivered[bidKey], full),
+			Volume:     bid.Volume,
+			Delivered:  delivered[bidKey],
+			LossFactor: lossFactor,
+		}
+		if sold.Delivered < full {
+			sold.Volume = injection(sold.Delivered, lossFactor)
+		}
+		allocations[bidKey] = sold
+	}
+	for _, bidKey := range buyKeys {
+		bid := bids[bidKey]
+		allocations[bidKey] = Allocation{
+			Status:    allocationStatus(delivered[bidKey], bid.Volume),
+			Volume:    delivered[bidKey],
+			Delivered: delivered[bidKey],
+		}
+	}
+
+	// flows are reported in the order the interconnectors were defined
+	flows := []Flow{}
+	for _, interconnector := range input.Interconnectors {
+		link := Flow{From: interconnector.From, To: interconnector.To}
+		if transferred[link] > 0 {
+			flows = append(flows, Flow{From: link.From, To: link.To, Volume: transferred[link]})
+		}
+	}
+
+	return allocations, newClearingResult(bids, allocations, flows)
+}
+
+// allocationStatus returns the status of a bid of which allocated out of
+// requested volume was cleared
+func allocationStatus(allocated int, requested int) string {
+	if allocated == 0 {
+		return "Not Approved"
+	}
+	if allocated < requested {
+		return "Partially Approved"
+	}
+	return "Approved"
+}
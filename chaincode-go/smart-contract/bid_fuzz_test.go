@@ -0,0 +1,87 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// FuzzBid places, submits and reveals arbitrary transient bid JSON of the seller.
+// A bid that is placed must reserve the deposit of the session, and a bid that is
+// revealed must be the bid that was placed, without any cleared volume, with the
+// full exposure of a buy bid reserved
+func FuzzBid(f *testing.F) {
+	f.Add(bidTransient(sellBid(seller, "pv1", 50, 10))["bid"])
+	f.Add(bidTransient(buyBid(seller, 50, 20))["bid"])
+	f.Add([]byte(`{"bidType":"buy","volume":10,"price":20,"org":"Org1MSP","bidder":"` + seller.ID() + `","allocatedVolume":10,"status":"Approved"}`))
+	f.Add([]byte(`{"bidType":"buy","volume":4611686018427387904,"price":4,"org":"Org1MSP","bidder":"` + seller.ID() + `"}`))
+	f.Add([]byte(`{"bidType":"sell","volume":50,"price":10,"assetID":"pv1","carbonIntensity":-1}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{`))
+
+	f.Fuzz(func(t *testing.T, bidJSON []byte) {
+		m := newMarket(t)
+		m.fund(seller, 10000)
+		transient := mockledger.WithTransient(map[string][]byte{"bid": bidJSON})
+
+		txID, err := m.submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := contract.Bid(ctx, "s1")
+			return err
+		}, transient)
+
+		account := m.collateral(seller)
+		if err != nil {
+			if account.Reserved != 0 {
+				t.Fatalf("rejected bid reserved %d of collateral: %v", account.Reserved, err)
+			}
+			return
+		}
+
+		var placed FullBid
+		if err := json.Unmarshal(bidJSON, &placed); err != nil {
+			t.Fatalf("bid %s was placed but does not parse: %v", bidJSON, err)
+		}
+		if placed.Volume <= 0 || placed.Price <= 0 {
+			t.Fatalf("bid %s was placed without positive volume and price", bidJSON)
+		}
+		if account.Reserved != defaultBidDeposit {
+			t.Fatalf("bid %s reserved %d of collateral, want the deposit of %d", bidJSON, account.Reserved, defaultBidDeposit)
+		}
+
+		m.submitBid(seller, "s1", txID)
+		m.closeSession("s1")
+
+		_, err = m.submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+			return contract.FinalizeBid(ctx, "s1", txID)
+		}, transient)
+		if err != nil {
+			return
+		}
+
+		revealed := m.session("s1").FinalizedBids[bidKey("s1", txID)]
+		if revealed.BidType != placed.BidType || revealed.Volume != placed.Volume || revealed.Price != placed.Price || revealed.Bidder != seller.ID() {
+			t.Fatalf("revealed bid %+v differs from placed bid %+v", revealed, placed)
+		}
+		if revealed.Status != "Finalized" || revealed.Allocated != 0 || revealed.Delivered != 0 || revealed.SettlementPrice != 0 {
+			t.Fatalf("revealed bid %+v carries a clearing outcome", revealed)
+		}
+
+		account = m.collateral(seller)
+		exposure := float64(defaultBidDeposit)
+		if placed.BidType.IsSell() && placed.Volume*placed.Price > defaultBidDeposit {
+			exposure = float64(placed.Volume) * float64(placed.Price)
+		}
+		if float64(account.Reserved) != exposure || account.Reserved > account.Balance {
+			t.Fatalf("revealed bid %s reserved %d of %d collateral, want %.0f", bidJSON, account.Reserved, account.Balance, exposure)
+		}
+	})
+}
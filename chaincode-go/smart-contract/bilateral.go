@@ -0,0 +1,223 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// BilateralTrade is a trade agreed directly between a seller and a buyer outside
+// of the sessions. It is proposed by the seller and confirmed by the buyer
+type BilateralTrade struct {
+	TradeID       string `json:"tradeID"`
+	Seller        string `json:"seller"`
+	SellerOrg     string `json:"sellerOrg"`
+	Buyer         string `json:"buyer"`
+	BuyerOrg      string `json:"buyerOrg"`
+	Volume        int    `json:"volume"`
+	Price         int    `json:"price"`
+	DeliveryStart string `json:"deliveryStart"`
+	DeliveryEnd   string `json:"deliveryEnd"`
+	Status        string `json:"status"`
+}
+
+const bilateralTradeKeyType = "bilateralTrade"
+
+const (
+	TradeProposed  = "proposed"
+	TradeConfirmed = "confirmed"
+	TradeCancelled = "cancelled"
+)
+
+// RegisterBilateralTrade is used by a seller to propose a trade to a buyer,
+// identified by client ID and organization. Only the seller's organization
+// endorses changes to the proposal until the buyer accepts it. The function
+// returns the transaction ID, which identifies the trade
+func (s *SmartContract) RegisterBilateralTrade(ctx contractapi.TransactionContextInterface, buyer string, buyerOrg string, volume int, price int, deliveryStart string, deliveryEnd string) (string, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if buyer == clientID {
+		return "", fmt.Errorf("cannot trade with yourself")
+	}
+	if volume <= 0 || price <= 0 {
+		return "", fmt.Errorf("trade volume and price must be positive")
+	}
+
+	start, err := time.Parse(time.RFC3339, deliveryStart)
+	if err != nil {
+		return "", fmt.Errorf("delivery start must be an RFC3339 time: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, deliveryEnd)
+	if err != nil {
+		return "", fmt.Errorf("delivery end must be an RFC3339 time: %v", err)
+	}
+	if !end.After(start) {
+		return "", fmt.Errorf("delivery end must be after delivery start")
+	}
+
+	trade := BilateralTrade{
+		TradeID:       ctx.GetStub().GetTxID(),
+		Seller:        clientID,
+		SellerOrg:     clientOrgID,
+		Buyer:         buyer,
+		BuyerOrg:      buyerOrg,
+		Volume:        volume,
+		Price:         price,
+		DeliveryStart: deliveryStart,
+		DeliveryEnd:   deliveryEnd,
+		Status:        TradeProposed,
+	}
+
+	tradeKey, err := putBilateralTrade(ctx, &trade)
+	if err != nil {
+		return "", err
+	}
+
+	// the seller's organization endorses the proposal
+	err = setAssetStateBasedEndorsement(ctx, tradeKey, clientOrgID)
+	if err != nil {
+		return "", fmt.Errorf("failed setting state based endorsement for trade: %v", err)
+	}
+
+	return trade.TradeID, nil
+}
+
+// AcceptBilateralTrade is used by the buyer to confirm a proposed trade. The
+// buyer's organization is added to the endorsement policy of the trade, so that
+// the confirmed trade can only change with the endorsement of both organizations.
+// The transaction has to be endorsed by the seller's organization as well
+func (s *SmartContract) AcceptBilateralTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+
+	trade, err := s.QueryBilateralTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if trade.Buyer != clientID || trade.BuyerOrg != clientOrgID {
+		return fmt.Errorf("trade can only be accepted by its buyer")
+	}
+	if trade.Status != TradeProposed {
+		return fmt.Errorf("cannot accept a trade that is %v", trade.Status)
+	}
+
+	trade.Status = TradeConfirmed
+
+	tradeKey, err := putBilateralTrade(ctx, trade)
+	if err != nil {
+		return err
+	}
+
+	if trade.BuyerOrg != trade.SellerOrg {
+		err = addAssetStateBasedEndorsement(ctx, tradeKey, trade.BuyerOrg)
+		if err != nil {
+			return fmt.Errorf("failed setting state based endorsement for trade: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// CancelBilateralTrade is used by the seller to withdraw a proposed trade, or by
+// the buyer to reject it
+func (s *SmartContract) CancelBilateralTrade(ctx contractapi.TransactionContextInterface, tradeID string) error {
+
+	trade, err := s.QueryBilateralTrade(ctx, tradeID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if trade.Seller != clientID && trade.Buyer != clientID {
+		return fmt.Errorf("trade can only be cancelled by its seller or buyer")
+	}
+	if trade.Status != TradeProposed {
+		return fmt.Errorf("cannot cancel a trade that is %v", trade.Status)
+	}
+
+	trade.Status = TradeCancelled
+
+	_, err = putBilateralTrade(ctx, trade)
+
+	return err
+}
+
+// QueryBilateralTrade returns a bilateral trade
+func (s *SmartContract) QueryBilateralTrade(ctx contractapi.TransactionContextInterface, tradeID string) (*BilateralTrade, error) {
+
+	tradeKey, err := ctx.GetStub().CreateCompositeKey(bilateralTradeKeyType, []string{tradeID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	tradeBytes, err := ctx.GetStub().GetState(tradeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trade %v: %v", tradeID, err)
+	}
+	if tradeBytes == nil {
+		return nil, fmt.Errorf("trade %v does not exist", tradeID)
+	}
+
+	var trade BilateralTrade
+	err = json.Unmarshal(tradeBytes, &trade)
+	if err != nil {
+		return nil, err
+	}
+
+	return &trade, nil
+}
+
+// putBilateralTrade is an internal helper that writes a bilateral trade to state.
+// It returns the key of the trade, which carries its endorsement policy
+func putBilateralTrade(ctx contractapi.TransactionContextInterface, trade *BilateralTrade) (string, error) {
+
+	tradeKey, err := ctx.GetStub().CreateCompositeKey(bilateralTradeKeyType, []string{trade.TradeID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	tradeBytes, err := json.Marshal(trade)
+	if err != nil {
+		return "", err
+	}
+
+	err = ctx.GetStub().PutState(tradeKey, tradeBytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to put trade: %v", err)
+	}
+
+	return tradeKey, nil
+}
@@ -0,0 +1,209 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+const (
+	deliveryStart = "2021-03-02T00:00:00Z"
+	deliveryEnd   = "2021-03-02T01:00:00Z"
+)
+
+// registerTrade lets the seller propose 40 kWh at 12 to a buyer
+func (m *market) registerTrade(to *mockledger.Identity, toOrg string) string {
+	m.t.Helper()
+
+	var tradeID string
+	m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		tradeID, err = contract.RegisterBilateralTrade(ctx, to.ID(), toOrg, 40, 12, deliveryStart, deliveryEnd)
+		return err
+	})
+
+	return tradeID
+}
+
+// trade returns a bilateral trade and the organizations that endorse its changes
+func (m *market) trade(tradeID string) (*BilateralTrade, []string) {
+	m.t.Helper()
+
+	var trade *BilateralTrade
+	var tradeKey string
+	err := m.ledger.Evaluate(seller, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		trade, err = contract.QueryBilateralTrade(ctx, tradeID)
+		if err != nil {
+			return err
+		}
+		tradeKey, err = ctx.GetStub().CreateCompositeKey(bilateralTradeKeyType, []string{tradeID})
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	orgs, err := m.ledger.EndorsingOrgs(tradeKey)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return trade, orgs
+}
+
+func TestRegisterBilateralTrade(t *testing.T) {
+	tests := []struct {
+		name    string
+		buyer   *mockledger.Identity
+		volume  int
+		price   int
+		start   string
+		end     string
+		wantErr string
+	}{
+		{name: "proposal", buyer: buyer, volume: 40, price: 12, start: deliveryStart, end: deliveryEnd},
+		{name: "with yourself", buyer: seller, volume: 40, price: 12, start: deliveryStart, end: deliveryEnd, wantErr: "cannot trade with yourself"},
+		{name: "no volume", buyer: buyer, volume: 0, price: 12, start: deliveryStart, end: deliveryEnd, wantErr: "trade volume and price must be positive"},
+		{name: "no price", buyer: buyer, volume: 40, price: -1, start: deliveryStart, end: deliveryEnd, wantErr: "trade volume and price must be positive"},
+		{name: "start not RFC3339", buyer: buyer, volume: 40, price: 12, start: "2021-03-02", end: deliveryEnd, wantErr: "delivery start must be an RFC3339 time"},
+		{name: "end not RFC3339", buyer: buyer, volume: 40, price: 12, start: deliveryStart, end: "tomorrow", wantErr: "delivery end must be an RFC3339 time"},
+		{name: "end before start", buyer: buyer, volume: 40, price: 12, start: deliveryEnd, end: deliveryStart, wantErr: "delivery end must be after delivery start"},
+		{name: "empty delivery", buyer: buyer, volume: 40, price: 12, start: deliveryStart, end: deliveryStart, wantErr: "delivery end must be after delivery start"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			var tradeID string
+			_, err := m.submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				tradeID, err = contract.RegisterBilateralTrade(ctx, tt.buyer.ID(), org2, tt.volume, tt.price, tt.start, tt.end)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			trade, orgs := m.trade(tradeID)
+			want := &BilateralTrade{
+				TradeID:       tradeID,
+				Seller:        seller.ID(),
+				SellerOrg:     org1,
+				Buyer:         buyer.ID(),
+				BuyerOrg:      org2,
+				Volume:        40,
+				Price:         12,
+				DeliveryStart: deliveryStart,
+				DeliveryEnd:   deliveryEnd,
+				Status:        TradeProposed,
+			}
+			if !reflect.DeepEqual(trade, want) {
+				t.Errorf("trade = %+v, want %+v", trade, want)
+			}
+
+			// only the seller's organization endorses the proposal
+			if !reflect.DeepEqual(orgs, []string{org1}) {
+				t.Errorf("endorsing orgs = %v, want [%v]", orgs, org1)
+			}
+		})
+	}
+}
+
+func TestAcceptBilateralTrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		buyer      *mockledger.Identity
+		buyerOrg   string
+		cancelled  bool
+		client     *mockledger.Identity
+		wantErr    string
+		wantStatus string
+		wantOrgs   []string
+	}{
+		{name: "buyer of another org", buyer: buyer, buyerOrg: org2, client: buyer, wantStatus: TradeConfirmed, wantOrgs: []string{org1, org2}},
+		{name: "buyer of the same org", buyer: trader, buyerOrg: org1, client: trader, wantStatus: TradeConfirmed, wantOrgs: []string{org1}},
+		{name: "seller", buyer: buyer, buyerOrg: org2, client: seller, wantErr: "trade can only be accepted by its buyer", wantStatus: TradeProposed, wantOrgs: []string{org1}},
+		{name: "buyer in the wrong org", buyer: buyer, buyerOrg: org1, client: buyer, wantErr: "trade can only be accepted by its buyer", wantStatus: TradeProposed, wantOrgs: []string{org1}},
+		{name: "cancelled trade", buyer: buyer, buyerOrg: org2, cancelled: true, client: buyer, wantErr: "cannot accept a trade that is cancelled", wantStatus: TradeCancelled, wantOrgs: []string{org1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			tradeID := m.registerTrade(tt.buyer, tt.buyerOrg)
+			if tt.cancelled {
+				m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.CancelBilateralTrade(ctx, tradeID)
+				})
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.AcceptBilateralTrade(ctx, tradeID)
+			})
+			checkError(t, err, tt.wantErr)
+
+			trade, orgs := m.trade(tradeID)
+			if trade.Status != tt.wantStatus {
+				t.Errorf("trade status = %v, want %v", trade.Status, tt.wantStatus)
+			}
+			if !reflect.DeepEqual(orgs, tt.wantOrgs) {
+				t.Errorf("endorsing orgs = %v, want %v", orgs, tt.wantOrgs)
+			}
+		})
+	}
+}
+
+func TestCancelBilateralTrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		confirmed  bool
+		client     *mockledger.Identity
+		wantErr    string
+		wantStatus string
+	}{
+		{name: "withdrawn by the seller", client: seller, wantStatus: TradeCancelled},
+		{name: "rejected by the buyer", client: buyer, wantStatus: TradeCancelled},
+		{name: "not a party", client: trader, wantErr: "trade can only be cancelled by its seller or buyer", wantStatus: TradeProposed},
+		{name: "confirmed trade", confirmed: true, client: seller, wantErr: "cannot cancel a trade that is confirmed", wantStatus: TradeConfirmed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			tradeID := m.registerTrade(buyer, org2)
+			if tt.confirmed {
+				m.mustSubmit(buyer, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.AcceptBilateralTrade(ctx, tradeID)
+				})
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CancelBilateralTrade(ctx, tradeID)
+			})
+			checkError(t, err, tt.wantErr)
+
+			if trade, _ := m.trade(tradeID); trade.Status != tt.wantStatus {
+				t.Errorf("trade status = %v, want %v", trade.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestQueryBilateralTrade(t *testing.T) {
+	m := newMarket(t)
+
+	err := m.ledger.Evaluate(seller, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.QueryBilateralTrade(ctx, "t1")
+		return err
+	})
+	checkError(t, err, "trade t1 does not exist")
+}
@@ -0,0 +1,129 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CarbonReport describes the carbon intensity of the energy cleared in a session.
+// Intensities are in gCO2/kWh and emissions in gCO2. Green buyers are attributed
+// the intensity of the certified supply, all other buyers the residual mix
+type CarbonReport struct {
+	SessionID          string           `json:"sessionID"`
+	ClearedVolume      int              `json:"clearedVolume"`
+	MixIntensity       float64          `json:"mixIntensity"`
+	CertifiedIntensity float64          `json:"certifiedIntensity"`
+	ResidualIntensity  float64          `json:"residualIntensity"`
+	TotalEmissions     float64          `json:"totalEmissions"`
+	SourceVolumes      map[string]int   `json:"sourceVolumes"`
+	Buyers             []BuyerEmissions `json:"buyers"`
+}
+
+// BuyerEmissions are the emissions attributed to the cleared volume of one buyer
+type BuyerEmissions struct {
+	Buyer     string  `json:"buyer"`
+	Org       string  `json:"org"`
+	Volume    int     `json:"volume"`
+	Intensity float64 `json:"intensity"`
+	Emissions float64 `json:"emissions"`
+}
+
+// QueryCarbonReport computes the volume weighted carbon intensity of the energy
+// cleared in an ended session and the emissions attributed to every buyer
+func (s *SmartContract) QueryCarbonReport(ctx contractapi.TransactionContextInterface, sessionID string) (*CarbonReport, error) {
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if sessionJSON.Status == "Open" || sessionJSON.Status == "Close" {
+		return nil, fmt.Errorf("carbon report is only available once the session has ended")
+	}
+
+	return buildCarbonReport(sessionID, sessionJSON.FinalizedBids), nil
+}
+
+// buildCarbonReport computes the carbon report from the allocations of a session.
+// Sellers are counted with the volume that reached the buyers
+func buildCarbonReport(sessionID string, bids map[string]FullBid) *CarbonReport {
+
+	report := CarbonReport{
+		SessionID:     sessionID,
+		SourceVolumes: make(map[string]int),
+		Buyers:        []BuyerEmissions{},
+	}
+
+	var certifiedVolume, certifiedEmissions, greenDemand float64
+	for _, bid := range bids {
+		if bid.BidType.IsSell() && bid.Delivered > 0 {
+			emissions := float64(bid.Delivered * bid.CarbonIntensity)
+			report.ClearedVolume += bid.Delivered
+			report.TotalEmissions += emissions
+			report.SourceVolumes[bid.SourceType] += bid.Delivered
+			if bid.Green {
+				certifiedVolume += float64(bid.Delivered)
+				certifiedEmissions += emissions
+			}
+		}
+		if bid.BidType.IsBuy() && bid.Green {
+			greenDemand += float64(bid.Delivered)
+		}
+	}
+
+	if report.ClearedVolume == 0 {
+		return &report
+	}
+
+	report.MixIntensity = report.TotalEmissions / float64(report.ClearedVolume)
+	if certifiedVolume > 0 {
+		report.CertifiedIntensity = certifiedEmissions / certifiedVolume
+	}
+	if residualVolume := float64(report.ClearedVolume) - greenDemand; residualVolume > 0 {
+		report.ResidualIntensity = (report.TotalEmissions - greenDemand*report.CertifiedIntensity) / residualVolume
+	}
+
+	// buyers are reported in bid key order so that every peer returns the same report
+	bidKeys := make([]string, 0, len(bids))
+	for bidKey := range bids {
+		bidKeys = append(bidKeys, bidKey)
+	}
+	sort.Strings(bidKeys)
+
+	buyers := make(map[string]*BuyerEmissions)
+	var order []string
+	for _, bidKey := range bidKeys {
+		bid := bids[bidKey]
+		if !bid.BidType.IsBuy() || bid.Delivered == 0 {
+			continue
+		}
+
+		intensity := report.ResidualIntensity
+		if bid.Green {
+			intensity = report.CertifiedIntensity
+		}
+
+		buyer, ok := buyers[bid.Bidder]
+		if !ok {
+			buyer = &BuyerEmissions{Buyer: bid.Bidder, Org: bid.Org}
+			buyers[bid.Bidder] = buyer
+			order = append(order, bid.Bidder)
+		}
+		buyer.Volume += bid.Delivered
+		buyer.Emissions += float64(bid.Delivered) * intensity
+	}
+
+	for _, buyerID := range order {
+		buyer := buyers[buyerID]
+		buyer.Intensity = buyer.Emissions / float64(buyer.Volume)
+		report.Buyers = append(report.Buyers, *buyer)
+	}
+
+	return &report
+}
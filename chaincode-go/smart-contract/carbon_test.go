@@ -0,0 +1,120 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestBuildCarbonReport(t *testing.T) {
+	tests := []struct {
+		name string
+		bids map[string]FullBid
+		want CarbonReport
+	}{
+		{
+			name: "nothing cleared",
+			bids: map[string]FullBid{
+				"a": {BidType: Sell, Volume: 10, SourceType: "gas", CarbonIntensity: 400},
+			},
+			want: CarbonReport{SessionID: "s1", SourceVolumes: map[string]int{}, Buyers: []BuyerEmissions{}},
+		},
+		{
+			name: "green and residual buyers",
+			bids: map[string]FullBid{
+				"a": {BidType: Sell, Delivered: 30, SourceType: "solar", Green: true},
+				"b": {BidType: Sell, Delivered: 20, SourceType: "gas", CarbonIntensity: 500},
+				"c": {BidType: Buy, Delivered: 20, Bidder: "green", Org: org2, Green: true},
+				"d": {BidType: Buy, Delivered: 30, Bidder: "grey", Org: org2},
+				"e": {BidType: Buy, Volume: 10, Bidder: "idle", Org: org2},
+			},
+			want: CarbonReport{
+				SessionID:         "s1",
+				ClearedVolume:     50,
+				MixIntensity:      200,
+				ResidualIntensity: 10000.0 / 30,
+				TotalEmissions:    10000,
+				SourceVolumes:     map[string]int{"solar": 30, "gas": 20},
+				Buyers: []BuyerEmissions{
+					{Buyer: "green", Org: org2, Volume: 20},
+					{Buyer: "grey", Org: org2, Volume: 30, Intensity: 10000.0 / 30, Emissions: 10000},
+				},
+			},
+		},
+		{
+			name: "buyer in several bids",
+			bids: map[string]FullBid{
+				"a": {BidType: Sell, Delivered: 40, SourceType: "wind", Green: true, CarbonIntensity: 10},
+				"b": {BidType: Buy, Delivered: 10, Bidder: "buyer", Org: org2, Green: true},
+				"c": {BidType: Buy, Delivered: 30, Bidder: "buyer", Org: org2},
+			},
+			want: CarbonReport{
+				SessionID:          "s1",
+				ClearedVolume:      40,
+				MixIntensity:       10,
+				CertifiedIntensity: 10,
+				ResidualIntensity:  10,
+				TotalEmissions:     400,
+				SourceVolumes:      map[string]int{"wind": 40},
+				Buyers:             []BuyerEmissions{{Buyer: "buyer", Org: org2, Volume: 40, Intensity: 10, Emissions: 400}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildCarbonReport("s1", tt.bids)
+
+			// round away the floating point error of the divisions
+			round := func(value *float64) { *value = math.Round(*value*1e6) / 1e6 }
+			for _, report := range []*CarbonReport{got, &tt.want} {
+				round(&report.MixIntensity)
+				round(&report.CertifiedIntensity)
+				round(&report.ResidualIntensity)
+				round(&report.TotalEmissions)
+				for i := range report.Buyers {
+					round(&report.Buyers[i].Intensity)
+					round(&report.Buyers[i].Emissions)
+				}
+			}
+
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("buildCarbonReport() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryCarbonReport(t *testing.T) {
+	m := newMarket(t)
+	revealBids(m)
+
+	queryReport := func() (*CarbonReport, error) {
+		var report *CarbonReport
+		err := m.ledger.Evaluate(buyer, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			report, err = contract.QueryCarbonReport(ctx, "s1")
+			return err
+		})
+		return report, err
+	}
+
+	_, err := queryReport()
+	checkError(t, err, "carbon report is only available once the session has ended")
+
+	m.endSession("s1")
+
+	report, err := queryReport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ClearedVolume != 50 || len(report.Buyers) != 1 || report.Buyers[0].Buyer != buyer.ID() {
+		t.Errorf("carbon report = %+v, want 50 kWh cleared to the buyer", report)
+	}
+}
@@ -0,0 +1,506 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Certificate is a renewable energy certificate, the proof that Volume kWh were
+// generated by a renewable asset. SessionID records the session through which
+// the current owner acquired the certificate
+type Certificate struct {
+	CertificateID string `json:"certificateID"`
+	AssetID       string `json:"assetID"`
+	Technology    string `json:"technology"`
+	Owner         string `json:"owner"`
+	Volume        int    `json:"volume"`
+	SessionID     string `json:"sessionID,omitempty" metadata:"sessionID,optional"`
+}
+
+// Pledge is the certificate volume that a certified sell bid has pledged. It is
+// locked from the moment the bid is revealed until its session is settled, so
+// that the same certificates cannot back certified sell bids in several sessions
+type Pledge struct {
+	SessionID string `json:"sessionID"`
+	TxID      string `json:"txID"`
+	Owner     string `json:"owner"`
+	Volume    int    `json:"volume"`
+}
+
+const certificateKeyType = "certificate"
+const pledgeKeyType = "certificatePledge"
+
+// IssueCertificate is used by a metering agent to issue a certificate to the owner
+// of a renewable asset for its generation in the delivery interval of a session.
+// The volume has to be covered by the injection metered for the owner in the
+// session that is not certified yet, and the volume certified for the asset in
+// the session cannot exceed its capacity. The transaction ID becomes the
+// certificate ID
+func (s *SmartContract) IssueCertificate(ctx contractapi.TransactionContextInterface, assetID string, sessionID string, volume int) (string, error) {
+
+	err := assertClientRole(ctx, meteringRole)
+	if err != nil {
+		return "", err
+	}
+
+	if volume <= 0 {
+		return "", fmt.Errorf("certificate volume must be positive")
+	}
+
+	asset, err := getAsset(ctx, assetID)
+	if err != nil {
+		return "", err
+	}
+	if asset == nil {
+		return "", fmt.Errorf("asset %v does not exist", assetID)
+	}
+	if !asset.Renewable {
+		return "", fmt.Errorf("certificates can only be issued for renewable assets")
+	}
+
+	reading, err := getMeterReading(ctx, sessionID, asset.Owner)
+	if err != nil {
+		return "", err
+	}
+	if reading == nil {
+		return "", fmt.Errorf("no injection of the owner of asset %v was metered in session %v", assetID, sessionID)
+	}
+
+	uncertified := reading.Volume - reading.certifiedVolume()
+	if uncertified < 0 {
+		uncertified = 0
+	}
+	if volume > uncertified {
+		return "", fmt.Errorf("certificate volume %d exceeds the uncertified injection metered in session %v: %d", volume, sessionID, uncertified)
+	}
+	if reading.Certified[assetID]+volume > asset.Capacity {
+		return "", fmt.Errorf("certificate volume %d exceeds the capacity of asset %v: %d, already certified %d", volume, assetID, asset.Capacity, reading.Certified[assetID])
+	}
+
+	if reading.Certified == nil {
+		reading.Certified = make(map[string]int)
+	}
+	reading.Certified[assetID] += volume
+	err = putMeterReading(ctx, reading)
+	if err != nil {
+		return "", err
+	}
+
+	certificate := Certificate{
+		CertificateID: ctx.GetStub().GetTxID(),
+		AssetID:       assetID,
+		Technology:    asset.Technology,
+		Owner:         asset.Owner,
+		Volume:        volume,
+	}
+
+	err = putCertificate(ctx, &certificate)
+	if err != nil {
+		return "", err
+	}
+
+	return certificate.CertificateID, nil
+}
+
+// QueryCertificates returns the certificates held by a participant
+func (s *SmartContract) QueryCertificates(ctx contractapi.TransactionContextInterface, owner string) ([]*Certificate, error) {
+	return getCertificates(ctx, owner)
+}
+
+// certifiedVolume returns the total certificate volume held by a participant
+func certifiedVolume(ctx contractapi.TransactionContextInterface, owner string) (int, error) {
+
+	certificates, err := getCertificates(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	volume := 0
+	for _, certificate := range certificates {
+		volume += certificate.Volume
+	}
+
+	return volume, nil
+}
+
+// pledgeCertificates pledges volume of the certificates of owner to a revealed
+// certified sell bid. The certificates have to cover the bid together with the
+// volume the owner has pledged to its other bids
+func pledgeCertificates(ctx contractapi.TransactionContextInterface, sessionID string, txID string, owner string, volume int) error {
+
+	pledges, err := getPledges(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	pledged := volume
+	for _, pledge := range pledges {
+		if pledge.SessionID != sessionID || pledge.TxID != txID {
+			pledged += pledge.Volume
+		}
+	}
+
+	certified, err := certifiedVolume(ctx, owner)
+	if err != nil {
+		return err
+	}
+	if certified < pledged {
+		return fmt.Errorf("certified sell bids of %d exceed the certificates held: %d", pledged, certified)
+	}
+
+	return putPledge(ctx, &Pledge{SessionID: sessionID, TxID: txID, Owner: owner, Volume: volume})
+}
+
+// releaseSessionPledges releases the certificates pledged to the certified sell
+// bids of a session. An ended session keeps the pledge of the delivered volume
+// of every bid, which is transferred when the session is settled, and a settled
+// session releases all of it
+func releaseSessionPledges(ctx contractapi.TransactionContextInterface, sessionID string, bids map[string]FullBid, settled bool) error {
+
+	bidKeys := make([]string, 0, len(bids))
+	for bidKey, bid := range bids {
+		if bid.Green && bid.BidType.IsSell() {
+			bidKeys = append(bidKeys, bidKey)
+		}
+	}
+	sort.Strings(bidKeys)
+
+	for _, bidKey := range bidKeys {
+		bid := bids[bidKey]
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(bidKey)
+		if err != nil {
+			return fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		pledge, err := getPledge(ctx, bid.Bidder, sessionID, keyParts[1])
+		if err != nil {
+			return err
+		}
+		if pledge == nil {
+			continue
+		}
+
+		keep := bid.Delivered
+		if settled {
+			keep = 0
+		}
+		if keep >= pledge.Volume {
+			continue
+		}
+
+		pledge.Volume = keep
+		err = putPledge(ctx, pledge)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// transferSessionCertificates hands the certificates for the green volume of a
+// session from the certified sellers to the green buyers. Within every zone the
+// green buy allocations are paired with the certified sell deliveries in key
+// order. The transferred certificates get new IDs made from the ID of the
+// settling transaction, and the certified volume of the sellers is pledged since
+// their bids were revealed, so a seller without enough certificates is an error
+func transferSessionCertificates(ctx contractapi.TransactionContextInterface, sessionID string, bids map[string]FullBid) error {
+
+	bidKeys := make([]string, 0, len(bids))
+	for bidKey := range bids {
+		bidKeys = append(bidKeys, bidKey)
+	}
+	sort.Strings(bidKeys)
+
+	type share struct {
+		participant string
+		volume      int
+	}
+	sellers := make(map[string][]*share)
+	buyers := make(map[string][]*share)
+	seen := make(map[string]bool)
+	var zones []string
+
+	for _, bidKey := range bidKeys {
+		bid := bids[bidKey]
+		if !bid.Green || bid.Delivered == 0 {
+			continue
+		}
+		if !seen[bid.Zone] {
+			seen[bid.Zone] = true
+			zones = append(zones, bid.Zone)
+		}
+		if bid.BidType.IsSell() {
+			sellers[bid.Zone] = append(sellers[bid.Zone], &share{bid.Bidder, bid.Delivered})
+		}
+		if bid.BidType.IsBuy() {
+			buyers[bid.Zone] = append(buyers[bid.Zone], &share{bid.Bidder, bid.Delivered})
+		}
+	}
+
+	// certificates are loaded once per seller and written back at the end, because
+	// a transaction does not read its own writes
+	holdings := make(map[string][]*Certificate)
+	var received []*Certificate
+
+	for _, zone := range zones {
+		sellerShares, buyerShares := sellers[zone], buyers[zone]
+		for len(sellerShares) > 0 && len(buyerShares) > 0 {
+			seller, buyer := sellerShares[0], buyerShares[0]
+
+			volume := seller.volume
+			if buyer.volume < volume {
+				volume = buyer.volume
+			}
+
+			if _, ok := holdings[seller.participant]; !ok {
+				certificates, err := getCertificates(ctx, seller.participant)
+				if err != nil {
+					return err
+				}
+				holdings[seller.participant] = certificates
+			}
+
+			for _, certificate := range holdings[seller.participant] {
+				if volume == 0 {
+					break
+				}
+				if certificate.Volume == 0 {
+					continue
+				}
+
+				part := certificate.Volume
+				if volume < part {
+					part = volume
+				}
+				certificate.Volume -= part
+				volume -= part
+
+				received = append(received, &Certificate{
+					CertificateID: fmt.Sprintf("%s-%d", ctx.GetStub().GetTxID(), len(received)),
+					AssetID:       certificate.AssetID,
+					Technology:    certificate.Technology,
+					Owner:         buyer.participant,
+					Volume:        part,
+					SessionID:     sessionID,
+				})
+			}
+			if volume > 0 {
+				return fmt.Errorf("seller %v lacks %d of certified volume for its green deliveries", seller.participant, volume)
+			}
+
+			paired := seller.volume
+			if buyer.volume < paired {
+				paired = buyer.volume
+			}
+			seller.volume -= paired
+			buyer.volume -= paired
+			if seller.volume == 0 {
+				sellerShares = sellerShares[1:]
+			}
+			if buyer.volume == 0 {
+				buyerShares = buyerShares[1:]
+			}
+		}
+	}
+
+	sellerIDs := make([]string, 0, len(holdings))
+	for seller := range holdings {
+		sellerIDs = append(sellerIDs, seller)
+	}
+	sort.Strings(sellerIDs)
+
+	for _, seller := range sellerIDs {
+		for _, certificate := range holdings[seller] {
+			err := putCertificate(ctx, certificate)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, certificate := range received {
+		existing, err := getCertificate(ctx, certificate.Owner, certificate.CertificateID)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			return fmt.Errorf("certificate %v of %v already exists", certificate.CertificateID, certificate.Owner)
+		}
+
+		err = putCertificate(ctx, certificate)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getCertificates is an internal helper that reads the certificates of a
+// participant in key order
+func getCertificates(ctx contractapi.TransactionContextInterface, owner string) ([]*Certificate, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(certificateKeyType, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificates: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	certificates := []*Certificate{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var certificate Certificate
+		err = json.Unmarshal(queryResponse.Value, &certificate)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, &certificate)
+	}
+
+	return certificates, nil
+}
+
+// getCertificate is an internal helper that reads a certificate of a participant.
+// It returns nil if the participant does not hold the certificate
+func getCertificate(ctx contractapi.TransactionContextInterface, owner string, certificateID string) (*Certificate, error) {
+
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificateKeyType, []string{owner, certificateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	certificateBytes, err := ctx.GetStub().GetState(certificateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate: %v", err)
+	}
+	if certificateBytes == nil {
+		return nil, nil
+	}
+
+	var certificate Certificate
+	err = json.Unmarshal(certificateBytes, &certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &certificate, nil
+}
+
+// putCertificate is an internal helper that writes a certificate to state, or
+// deletes it once its whole volume has been transferred
+func putCertificate(ctx contractapi.TransactionContextInterface, certificate *Certificate) error {
+
+	certificateKey, err := ctx.GetStub().CreateCompositeKey(certificateKeyType, []string{certificate.Owner, certificate.CertificateID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if certificate.Volume == 0 {
+		return ctx.GetStub().DelState(certificateKey)
+	}
+
+	certificateBytes, err := json.Marshal(certificate)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(certificateKey, certificateBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put certificate: %v", err)
+	}
+
+	return nil
+}
+
+// getPledge is an internal helper that reads the pledge of a bid. It returns nil
+// if the bid has not pledged any certificates
+func getPledge(ctx contractapi.TransactionContextInterface, owner string, sessionID string, txID string) (*Pledge, error) {
+
+	pledgeKey, err := ctx.GetStub().CreateCompositeKey(pledgeKeyType, []string{owner, sessionID, txID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	pledgeBytes, err := ctx.GetStub().GetState(pledgeKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate pledge: %v", err)
+	}
+	if pledgeBytes == nil {
+		return nil, nil
+	}
+
+	var pledge Pledge
+	err = json.Unmarshal(pledgeBytes, &pledge)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pledge, nil
+}
+
+// getPledges is an internal helper that reads the pledges of a participant in
+// key order
+func getPledges(ctx contractapi.TransactionContextInterface, owner string) ([]*Pledge, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(pledgeKeyType, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get certificate pledges: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	pledges := []*Pledge{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var pledge Pledge
+		err = json.Unmarshal(queryResponse.Value, &pledge)
+		if err != nil {
+			return nil, err
+		}
+		pledges = append(pledges, &pledge)
+	}
+
+	return pledges, nil
+}
+
+// putPledge is an internal helper that writes a pledge to state, or deletes it
+// once nothing is pledged anymore
+func putPledge(ctx contractapi.TransactionContextInterface, pledge *Pledge) error {
+
+	pledgeKey, err := ctx.GetStub().CreateCompositeKey(pledgeKeyType, []string{pledge.Owner, pledge.SessionID, pledge.TxID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if pledge.Volume == 0 {
+		return ctx.GetStub().DelState(pledgeKey)
+	}
+
+	pledgeBytes, err := json.Marshal(pledge)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(pledgeKey, pledgeBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put certificate pledge: %v", err)
+	}
+
+	return nil
+}
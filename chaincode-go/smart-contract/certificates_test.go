@@ -0,0 +1,264 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// issueCertificate meters volume of injection by the seller in a new session and
+// issues a certificate for it to pv1
+func (m *market) issueCertificate(volume int) string {
+	m.t.Helper()
+
+	sessionID := "metered-" + m.ledger.NextTxID()
+	bid := sellBid(seller, "pv1", volume, 10)
+
+	m.createSession(sessionID, "")
+	txID := m.placeAndSubmitBid(seller, sessionID, bid)
+	m.closeSession(sessionID)
+	m.finalizeBid(seller, sessionID, txID, bid)
+	m.endSession(sessionID)
+
+	participant := seller.ID()
+	m.mustSubmit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SubmitMeterReading(ctx, sessionID, participant, volume)
+	})
+
+	var certificateID string
+	m.mustSubmit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		certificateID, err = contract.IssueCertificate(ctx, "pv1", sessionID, volume)
+		return err
+	})
+
+	return certificateID
+}
+
+// certificates returns the certificates held by a participant
+func (m *market) certificates(client *mockledger.Identity) []*Certificate {
+	m.t.Helper()
+
+	var certificates []*Certificate
+	err := m.ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		certificates, err = contract.QueryCertificates(ctx, client.ID())
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return certificates
+}
+
+// pledges returns the certificate volume a participant has pledged
+func (m *market) pledges(client *mockledger.Identity) int {
+	m.t.Helper()
+
+	var pledges []*Pledge
+	err := m.ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		pledges, err = getPledges(ctx, client.ID())
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	volume := 0
+	for _, pledge := range pledges {
+		volume += pledge.Volume
+	}
+
+	return volume
+}
+
+// green returns a bid as a certified sell bid or a green buy bid
+func green(bid FullBid) FullBid {
+	bid.Green = true
+	return bid
+}
+
+// settleGreenSession trades volume of certified energy from the seller to the
+// buyer in a new session and settles it
+func settleGreenSession(m *market, sessionID string, volume int) {
+	m.t.Helper()
+
+	sell := green(sellBid(seller, "pv1", volume, 10))
+	buy := green(buyBid(buyer, volume, 20))
+
+	m.createSession(sessionID, "")
+	sellID := m.placeAndSubmitBid(seller, sessionID, sell)
+	buyID := m.placeAndSubmitBid(buyer, sessionID, buy)
+	m.closeSession(sessionID)
+	m.finalizeBid(seller, sessionID, sellID, sell)
+	m.finalizeBid(buyer, sessionID, buyID, buy)
+
+	m.endSession(sessionID)
+	m.settleSession(sessionID)
+}
+
+func TestIssueCertificate(t *testing.T) {
+	tests := []struct {
+		name      string
+		client    *mockledger.Identity
+		assetID   string
+		sessionID string
+		metered   int
+		certified int
+		volume    int
+		wantErr   string
+	}{
+		{name: "renewable asset", client: meter, assetID: "pv1", metered: 45, volume: 30},
+		{name: "not a metering agent", client: seller, assetID: "pv1", metered: 45, volume: 30, wantErr: "client is not authorized as meteringAgent"},
+		{name: "no volume", client: meter, assetID: "pv1", metered: 45, volume: 0, wantErr: "certificate volume must be positive"},
+		{name: "unknown asset", client: meter, assetID: "pv2", metered: 45, volume: 30, wantErr: "asset pv2 does not exist"},
+		{name: "asset that is not renewable", client: meter, assetID: "gas1", metered: 45, volume: 30, wantErr: "certificates can only be issued for renewable assets"},
+		{name: "session without meter reading", client: meter, assetID: "pv1", sessionID: "s2", metered: 45, volume: 30, wantErr: "no injection of the owner of asset pv1 was metered in session s2"},
+		{name: "above the metered injection", client: meter, assetID: "pv1", metered: 45, volume: 50, wantErr: "certificate volume 50 exceeds the uncertified injection metered in session s1: 45"},
+		{name: "injection already certified", client: meter, assetID: "pv1", metered: 45, certified: 20, volume: 30, wantErr: "certificate volume 30 exceeds the uncertified injection metered in session s1: 25"},
+		{name: "withdrawal", client: meter, assetID: "pv1", metered: -10, volume: 30, wantErr: "certificate volume 30 exceeds the uncertified injection metered in session s1: 0"},
+		{name: "above the asset capacity", client: meter, assetID: "pv1", metered: 150, volume: 120, wantErr: "certificate volume 120 exceeds the capacity of asset pv1: 100, already certified 0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.RegisterAsset(ctx, "gas1", Generation, "gas", false, 100, 0, "")
+			})
+			revealBids(m)
+			m.endSession("s1")
+			m.submitMeterReading(seller, tt.metered)
+			m.createSession("s2", "")
+
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+
+			want := []*Certificate{}
+			if tt.certified > 0 {
+				m.mustSubmit(meter, func(ctx contractapi.TransactionContextInterface) error {
+					certificateID, err := contract.IssueCertificate(ctx, "pv1", "s1", tt.certified)
+					want = append(want, &Certificate{CertificateID: certificateID, AssetID: "pv1", Technology: "solar", Owner: seller.ID(), Volume: tt.certified})
+					return err
+				})
+			}
+
+			var certificateID string
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				certificateID, err = contract.IssueCertificate(ctx, tt.assetID, sessionID, tt.volume)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+
+			if err == nil {
+				want = append(want, &Certificate{CertificateID: certificateID, AssetID: "pv1", Technology: "solar", Owner: seller.ID(), Volume: 30})
+			}
+			if got := m.certificates(seller); !reflect.DeepEqual(got, want) {
+				t.Errorf("certificates = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryCertificates(t *testing.T) {
+	m := newMarket(t)
+	first := m.issueCertificate(30)
+	second := m.issueCertificate(20)
+
+	got := m.certificates(seller)
+	if len(got) != 2 {
+		t.Fatalf("certificates = %+v, want 2 certificates", got)
+	}
+	ids := map[string]int{got[0].CertificateID: got[0].Volume, got[1].CertificateID: got[1].Volume}
+	if want := map[string]int{first: 30, second: 20}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("certificate volumes = %v, want %v", ids, want)
+	}
+
+	if got := m.certificates(buyer); len(got) != 0 {
+		t.Errorf("buyer certificates = %+v, want none", got)
+	}
+}
+
+func TestPledgeCertificates(t *testing.T) {
+	m := newMarket(t)
+	m.issueCertificate(100)
+
+	sell := green(sellBid(seller, "pv1", 60, 10))
+
+	first := m.placeAndSubmitBid(seller, "s1", sell)
+	m.createSession("s2", "")
+	second := m.placeAndSubmitBid(seller, "s2", sell)
+	m.closeSession("s1")
+	m.closeSession("s2")
+
+	m.finalizeBid(seller, "s1", first, sell)
+	if pledged := m.pledges(seller); pledged != 60 {
+		t.Fatalf("pledged volume = %d, want 60", pledged)
+	}
+
+	// revealing the same bid again does not pledge its volume twice
+	m.finalizeBid(seller, "s1", first, sell)
+	if pledged := m.pledges(seller); pledged != 60 {
+		t.Fatalf("pledged volume after a second reveal = %d, want 60", pledged)
+	}
+
+	// the certificates pledged in s1 cannot back a bid in s2
+	_, err := m.submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.FinalizeBid(ctx, "s2", second)
+	}, mockledger.WithTransient(bidTransient(sell)))
+	checkError(t, err, "certified sell bids of 120 exceed the certificates held: 100")
+
+	// s1 ends without a buyer, so nothing is delivered and the pledge is released
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.EndSession(ctx, "s1")
+		return err
+	})
+	if pledged := m.pledges(seller); pledged != 0 {
+		t.Fatalf("pledged volume after s1 ended = %d, want 0", pledged)
+	}
+	m.finalizeBid(seller, "s2", second, sell)
+}
+
+func TestTransferSessionCertificates(t *testing.T) {
+	m := newMarket(t)
+	m.fund(buyer, 1000)
+	m.issueCertificate(100)
+
+	// the buyer receives certificates of the same source in two sessions
+	settleGreenSession(m, "s2", 10)
+	settleGreenSession(m, "s3", 10)
+
+	received := m.certificates(buyer)
+	if len(received) != 2 || received[0].CertificateID == received[1].CertificateID {
+		t.Fatalf("received certificates = %+v, want two distinct certificates", received)
+	}
+	volume := 0
+	for _, certificate := range received {
+		if certificate.AssetID != "pv1" || certificate.Owner != buyer.ID() {
+			t.Errorf("received certificate = %+v, want one of pv1 owned by the buyer", certificate)
+		}
+		volume += certificate.Volume
+	}
+	if volume != 20 {
+		t.Errorf("received volume = %d, want 20", volume)
+	}
+
+	held := m.certificates(seller)
+	if len(held) != 1 || held[0].Volume != 80 {
+		t.Errorf("seller certificates = %+v, want 80 left", held)
+	}
+	if pledged := m.pledges(seller); pledged != 0 {
+		t.Errorf("pledged volume after settlement = %d, want 0", pledged)
+	}
+}
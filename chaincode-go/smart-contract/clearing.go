@@ -0,0 +1,308 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ClearingResult is the outcome of clearing a session. Every bidding zone has its
+// own price, which differs between zones when an interconnector is congested.
+// ClearingPrice is the highest zone price
+type ClearingResult struct {
+	ClearingPrice int            `json:"clearingPrice"`
+	ZonePrices    map[string]int `json:"zonePrices"`
+	Flows         []Flow         `json:"flows"`
+}
+
+// Allocation is the cleared volume and resulting status of a single bid. For sell
+// bids Volume is the injection and Delivered the part of it that reaches the
+// buyers after losses; for buy bids both are the withdrawn volume. Price is the
+// price per unit at which the allocation settles
+type Allocation struct {
+	Status     string
+	Volume     int
+	Delivered  int
+	LossFactor float64
+	Price      int
+}
+
+// ClearingInput is what a clearing algorithm needs to clear a session: the
+// revealed bids keyed by bid key, the market config of the session, the
+// transfer capacities between its zones and the loss factors of the
+// connection points of its sell bids
+type ClearingInput struct {
+	Bids            map[string]FullBid
+	Config          MarketConfig
+	Interconnectors []Interconnector
+	LossFactors     map[string]float64
+}
+
+// ClearingAlgorithm matches the revealed bids of a session. It returns the
+// allocation of every bid, keyed like the bids, and the prices and flows of the
+// session. Implementations must be deterministic, because every endorsing peer
+// clears the session on its own
+type ClearingAlgorithm interface {
+	Clear(input ClearingInput) (map[string]Allocation, *ClearingResult)
+}
+
+// clearingAlgorithms are the algorithms a market config can select
+var clearingAlgorithms = map[string]ClearingAlgorithm{
+	VolumeNetting: volumeNetting{},
+	UniformPrice:  uniformPrice{},
+	PayAsBid:      payAsBid{},
+}
+
+// clearingAlgorithmFor returns the clearing algorithm with the given name.
+// Sessions that were created before market configs existed net volumes
+func clearingAlgorithmFor(name string) (ClearingAlgorithm, error) {
+	if name == "" {
+		name = VolumeNetting
+	}
+
+	algorithm, ok := clearingAlgorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported clearing algorithm %v", name)
+	}
+
+	return algorithm, nil
+}
+
+// volumeNetting clears a session with clearVolumeNetting
+type volumeNetting struct{}
+
+// Clear implements ClearingAlgorithm
+func (volumeNetting) Clear(input ClearingInput) (map[string]Allocation, *ClearingResult) {
+	return clearWithinBuyPrices(input, func(input ClearingInput) (map[string]Allocation, *ClearingResult) {
+		return clearVolumeNetting(input.Bids, input.Interconnectors, input.LossFactors)
+	})
+}
+
+// clearWithinBuyPrices clears a session with clear and settles every allocation
+// at the price of its zone. Green matching, imports and, when volumes are netted,
+// an expensive sell bid can raise the price of a zone above what one of its
+// buyers offers. Such a buy bid is left out and the session is cleared again, the
+// cheapest bid first and bids with the same price in key order, until every
+// approved buyer offers its zone price. Sellers are then never owed more than
+// their buyers locked in escrow
+func clearWithinBuyPrices(input ClearingInput, clear func(input ClearingInput) (map[string]Allocation, *ClearingResult)) (map[string]Allocation, *ClearingResult) {
+
+	bids := make(map[string]FullBid, len(input.Bids))
+	for bidKey, bid := range input.Bids {
+		bids[bidKey] = bid
+	}
+	input.Bids = bids
+
+	for {
+		allocations, result := clear(input)
+
+		excluded := ""
+		for bidKey, bid := range bids {
+			if !bid.BidType.IsBuy() || allocations[bidKey].Volume == 0 || bid.Price >= result.ZonePrices[bid.Zone] {
+				continue
+			}
+			if excluded == "" || bid.Price < bids[excluded].Price || bid.Price == bids[excluded].Price && bidKey < excluded {
+				excluded = bidKey
+			}
+		}
+
+		if excluded == "" {
+			priceAtZone(input.Bids, allocations, result)
+			return allocations, result
+		}
+
+		// a bid without volume is not approved, but still prices its zone
+		bid := bids[excluded]
+		bid.Volume = 0
+		bids[excluded] = bid
+	}
+}
+
+// clearVolumeNetting matches the revealed bids of a session on volume alone. Sell
+// volume is counted after the losses of its connection point. Green buy bids can
+// only be served by certified sell bids of their own zone, so their demand counts
+// only as far as that green supply reaches. The zones are coupled first, then in
+// every zone the sell bids are approved against the zone's demand plus its
+// exports and the buy bids against the zone's supply plus its imports. Green bids
+// are approved before the others, and bids are otherwise visited in key order so
+// that every endorsing peer computes the same allocations
+func clearVolumeNetting(bids map[string]FullBid, interconnectors []Interconnector, lossFactors map[string]float64) (map[string]Allocation, *ClearingResult) {
+
+	bidKeys := make([]string, 0, len(bids))
+	for bidKey := range bids {
+		bidKeys = append(bidKeys, bidKey)
+	}
+	sort.Strings(bidKeys)
+	sort.SliceStable(bidKeys, func(i, j int) bool {
+		return bids[bidKeys[i]].Green && !bids[bidKeys[j]].Green
+	})
+
+	sellVolume := make(map[string]int)
+	buyVolume := make(map[string]int)
+	greenSupply := make(map[string]int)
+	greenDemand := make(map[string]int)
+	for _, bid := range bids {
+		if bid.BidType.IsSell() {
+			deliverable := withdrawal(bid.Volume, lossFactors[bid.ConnectionPoint])
+			sellVolume[bid.Zone] += deliverable
+			if bid.Green {
+				greenSupply[bid.Zone] += deliverable
+			}
+		}
+		if bid.BidType.IsBuy() {
+			if bid.Green {
+				greenDemand[bid.Zone] += bid.Volume
+			} else {
+				buyVolume[bid.Zone] += bid.Volume
+			}
+		}
+	}
+	for zone, volume := range greenDemand {
+		if volume > greenSupply[zone] {
+			volume = greenSupply[zone]
+		}
+		buyVolume[zone] += volume
+	}
+
+	flows, exports, imports := coupleZones(sellVolume, buyVolume, interconnectors)
+
+	totalBuy := make(map[string]int)
+	totalSell := make(map[string]int)
+	for zone, volume := range buyVolume {
+		totalBuy[zone] = volume
+	}
+	for zone, volume := range sellVolume {
+		totalSell[zone] = volume
+	}
+	for zone, volume := range exports {
+		totalBuy[zone] += volume
+	}
+	for zone, volume := range imports {
+		totalSell[zone] += volume
+	}
+
+	allocations := make(map[string]Allocation)
+	for _, bidKey := range bidKeys {
+		bid := bids[bidKey]
+		if bid.BidType.IsSell() {
+			lossFactor := lossFactors[bid.ConnectionPoint]
+			deliverable := withdrawal(bid.Volume, lossFactor)
+
+			sold := allocate(deliverable, totalBuy, bid.Zone)
+			sold.LossFactor = lossFactor
+			sold.Delivered = sold.Volume
+			if sold.Volume == deliverable {
+				sold.Volume = bid.Volume
+			} else {
+				sold.Volume = injection(sold.Delivered, lossFactor)
+			}
+			allocations[bidKey] = sold
+		}
+		if bid.BidType.IsBuy() {
+			var bought Allocation
+			if bid.Green {
+				bought = allocateGreen(bid.Volume, totalSell, greenSupply, bid.Zone)
+			} else {
+				bought = allocate(bid.Volume, totalSell, bid.Zone)
+			}
+			bought.Delivered = bought.Volume
+			allocations[bidKey] = bought
+		}
+	}
+
+	return allocations, newClearingResult(bids, allocations, flows)
+}
+
+// newClearingResult prices the zones of a cleared session. Every zone clears at
+// the price of its most expensive approved sell bid, and an importing zone pays
+// at least the price of the zones it imports from
+func newClearingResult(bids map[string]FullBid, allocations map[string]Allocation, flows []Flow) *ClearingResult {
+
+	result := ClearingResult{
+		ZonePrices: make(map[string]int),
+		Flows:      flows,
+	}
+
+	for bidKey, bid := range bids {
+		if _, ok := result.ZonePrices[bid.Zone]; !ok {
+			result.ZonePrices[bid.Zone] = 0
+		}
+		if bid.BidType.IsSell() && allocations[bidKey].Volume > 0 && bid.Price > result.ZonePrices[bid.Zone] {
+			result.ZonePrices[bid.Zone] = bid.Price
+		}
+	}
+
+	for _, flow := range flows {
+		if result.ZonePrices[flow.From] > result.ZonePrices[flow.To] {
+			result.ZonePrices[flow.To] = result.ZonePrices[flow.From]
+		}
+	}
+
+	for _, price := range result.ZonePrices {
+		if price > result.ClearingPrice {
+			result.ClearingPrice = price
+		}
+	}
+
+	return &result
+}
+
+// allocate approves a bid against the volume remaining on the other side of its
+// zone. A bid that does not fit entirely takes whatever is left and is only
+// partially approved
+func allocate(volume int, remaining map[string]int, zone string) Allocation {
+	allocated := volume
+	if remaining[zone] < allocated {
+		allocated = remaining[zone]
+	}
+	remaining[zone] -= allocated
+
+	return Allocation{Status: allocationStatus(allocated, volume), Volume: allocated}
+}
+
+// allocateGreen approves a green buy bid against the volume remaining in its zone,
+// limited to the certified supply of the zone that is still unassigned
+func allocateGreen(volume int, remaining map[string]int, greenSupply map[string]int, zone string) Allocation {
+	available := map[string]int{zone: remaining[zone]}
+	if greenSupply[zone] < available[zone] {
+		available[zone] = greenSupply[zone]
+	}
+
+	bought := allocate(volume, available, zone)
+	remaining[zone] -= bought.Volume
+	greenSupply[zone] -= bought.Volume
+
+	return bought
+}
+
+// priceAtZone settles every allocation at the price of the zone of its bid
+func priceAtZone(bids map[string]FullBid, allocations map[string]Allocation, result *ClearingResult) {
+	for bidKey, allocated := range allocations {
+		if allocated.Volume > 0 {
+			bid := bids[bidKey]
+			allocated.Price = result.ZonePrices[bid.Zone]
+			allocations[bidKey] = allocated
+		}
+	}
+}
+
+// settlementPrice returns the price per unit at which the allocation of a bid
+// settles. Bids of sessions that were cleared before allocations carried their
+// own price settle at the price of their zone
+func (b *FullBid) settlementPrice(s *Session) int {
+	if b.SettlementPrice > 0 {
+		return b.SettlementPrice
+	}
+	return s.priceFor(b.Zone)
+}
+
+// priceFor returns the price at which bids in a zone settle
+func (s *Session) priceFor(zone string) int {
+	if price, ok := s.ZonePrices[zone]; ok {
+		return price
+	}
+	return s.ClearingPrice
+}
@@ -0,0 +1,323 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// clearingRuns is the number of random sessions every property is checked on
+const clearingRuns = 2000
+
+var zones = []string{"north", "south", "east"}
+
+var lossFactors = map[string]float64{"cp1": 0.02, "cp2": 0.1}
+
+// randomClearingInput returns a session of up to 12 random bids in three zones,
+// with random interconnectors between them. Sell bids are connected to points
+// with and without losses, and a quarter of the bids is green
+func randomClearingInput(r *rand.Rand) ClearingInput {
+
+	bids := make(map[string]FullBid)
+	for i := 0; i < 1+r.Intn(12); i++ {
+		bid := FullBid{
+			BidType: Buy,
+			Volume:  1 + r.Intn(100),
+			Price:   1 + r.Intn(50),
+			Zone:    zones[r.Intn(len(zones))],
+			Green:   r.Intn(4) == 0,
+		}
+		if r.Intn(2) == 0 {
+			bid.BidType = Sell
+			bid.ConnectionPoint = []string{"", "cp1", "cp2"}[r.Intn(3)]
+		}
+		bids[fmt.Sprintf("bid%03d", i)] = bid
+	}
+
+	interconnectors := []Interconnector{}
+	for _, from := range zones {
+		for _, to := range zones {
+			if from != to && r.Intn(3) == 0 {
+				interconnectors = append(interconnectors, Interconnector{From: from, To: to, Capacity: r.Intn(60)})
+			}
+		}
+	}
+	r.Shuffle(len(interconnectors), func(i, j int) {
+		interconnectors[i], interconnectors[j] = interconnectors[j], interconnectors[i]
+	})
+
+	return ClearingInput{
+		Bids:            bids,
+		Config:          defaultMarketConfig,
+		Interconnectors: interconnectors,
+		LossFactors:     lossFactors,
+	}
+}
+
+// checkClearingProperty clears random sessions with every clearing algorithm and
+// reports the sessions for which property returns an error
+func checkClearingProperty(t *testing.T, property func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error) {
+
+	for name, algorithm := range clearingAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			for run := 0; run < clearingRuns; run++ {
+				input := randomClearingInput(r)
+				allocations, result := algorithm.Clear(input)
+
+				if err := property(input, allocations, result); err != nil {
+					t.Fatalf("run %d: %v\nbids: %+v\ninterconnectors: %+v\nallocations: %+v", run, err, input.Bids, input.Interconnectors, allocations)
+				}
+			}
+		})
+	}
+}
+
+func TestClearingBalancesBuyAndSellVolume(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		bought, sold := 0, 0
+		for bidKey, bid := range input.Bids {
+			if bid.BidType.IsBuy() {
+				bought += allocations[bidKey].Volume
+			} else {
+				sold += allocations[bidKey].Delivered
+			}
+		}
+
+		if bought != sold {
+			return fmt.Errorf("approved buy volume %d, delivered sell volume %d", bought, sold)
+		}
+		return nil
+	})
+}
+
+func TestClearingBalancesZonesWithFlows(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		capacity := make(map[Flow]int)
+		for _, interconnector := range input.Interconnectors {
+			capacity[Flow{From: interconnector.From, To: interconnector.To}] = interconnector.Capacity
+		}
+
+		// the volume a zone sells beyond what it buys leaves it through the flows
+		surplus := make(map[string]int)
+		for bidKey, bid := range input.Bids {
+			if bid.BidType.IsBuy() {
+				surplus[bid.Zone] -= allocations[bidKey].Volume
+			} else {
+				surplus[bid.Zone] += allocations[bidKey].Delivered
+			}
+		}
+		for _, flow := range result.Flows {
+			if flow.Volume > capacity[Flow{From: flow.From, To: flow.To}] {
+				return fmt.Errorf("flow %+v exceeds the interconnector capacity %d", flow, capacity[Flow{From: flow.From, To: flow.To}])
+			}
+			surplus[flow.From] -= flow.Volume
+			surplus[flow.To] += flow.Volume
+		}
+
+		for _, zone := range zones {
+			if surplus[zone] != 0 {
+				return fmt.Errorf("zone %v is unbalanced by %d after flows %+v", zone, surplus[zone], result.Flows)
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingAllocationsWithinBids(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		if len(allocations) != len(input.Bids) {
+			return fmt.Errorf("%d allocations for %d bids", len(allocations), len(input.Bids))
+		}
+
+		for bidKey, bid := range input.Bids {
+			allocated, ok := allocations[bidKey]
+			if !ok {
+				return fmt.Errorf("bid %v has no allocation", bidKey)
+			}
+			if allocated.Delivered < 0 || allocated.Delivered > allocated.Volume || allocated.Volume > bid.Volume {
+				return fmt.Errorf("allocation %+v of bid %v does not fit the bid volume %d", allocated, bidKey, bid.Volume)
+			}
+			if bid.BidType.IsBuy() && allocated.Delivered != allocated.Volume {
+				return fmt.Errorf("buy allocation %+v of bid %v loses volume", allocated, bidKey)
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingStatusMatchesAllocatedVolume(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		for bidKey, bid := range input.Bids {
+			allocated := allocations[bidKey]
+
+			// sell bids are measured by the volume that reaches the buyers
+			cleared, requested := allocated.Volume, bid.Volume
+			if bid.BidType.IsSell() {
+				cleared, requested = allocated.Delivered, withdrawal(bid.Volume, input.LossFactors[bid.ConnectionPoint])
+			}
+
+			if want := allocationStatus(cleared, requested); allocated.Status != want {
+				return fmt.Errorf("bid %v cleared %d of %d with status %q, want %q", bidKey, cleared, requested, allocated.Status, want)
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingPricesApprovedBids(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		for bidKey, bid := range input.Bids {
+			allocated := allocations[bidKey]
+			if allocated.Volume == 0 {
+				if allocated.Price != 0 {
+					return fmt.Errorf("bid %v without allocation has price %d", bidKey, allocated.Price)
+				}
+				continue
+			}
+
+			if allocated.Price <= 0 || allocated.Price > result.ClearingPrice && allocated.Price != bid.Price {
+				return fmt.Errorf("allocation %+v of bid %v is priced outside the session prices %+v", allocated, bidKey, result)
+			}
+			if bid.BidType.IsSell() && bid.Price > result.ZonePrices[bid.Zone] {
+				return fmt.Errorf("approved sell bid %v asks %d, above the price %d of its zone", bidKey, bid.Price, result.ZonePrices[bid.Zone])
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingWithinBidPrices(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		for bidKey, bid := range input.Bids {
+			allocated := allocations[bidKey]
+			if allocated.Volume == 0 {
+				continue
+			}
+
+			if bid.BidType.IsBuy() && allocated.Price > bid.Price {
+				return fmt.Errorf("buy bid %v offering %d settles at %d", bidKey, bid.Price, allocated.Price)
+			}
+			if bid.BidType.IsSell() && allocated.Price < bid.Price {
+				return fmt.Errorf("sell bid %v asking %d settles at %d", bidKey, bid.Price, allocated.Price)
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingIndependentOfMapOrder(t *testing.T) {
+	checkClearingProperty(t, func(input ClearingInput, allocations map[string]Allocation, result *ClearingResult) error {
+
+		algorithm, _ := clearingAlgorithmFor(input.Config.ClearingAlgorithm)
+		allocations, result = algorithm.Clear(input)
+
+		keys := make([]string, 0, len(input.Bids))
+		for bidKey := range input.Bids {
+			keys = append(keys, bidKey)
+		}
+
+		// rebuild the bid and loss factor maps in other insertion orders, so that
+		// the maps iterate differently
+		r := rand.New(rand.NewSource(int64(len(keys))))
+		for i := 0; i < 5; i++ {
+			r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+			shuffled := input
+			shuffled.Bids = make(map[string]FullBid)
+			for _, bidKey := range keys {
+				shuffled.Bids[bidKey] = input.Bids[bidKey]
+			}
+			shuffled.LossFactors = make(map[string]float64)
+			for connectionPoint, lossFactor := range input.LossFactors {
+				shuffled.LossFactors[connectionPoint] = lossFactor
+			}
+
+			otherAllocations, otherResult := algorithm.Clear(shuffled)
+			if !reflect.DeepEqual(otherAllocations, allocations) || !reflect.DeepEqual(otherResult, result) {
+				return fmt.Errorf("clearing differs between runs:\n%+v %+v\n%+v %+v", allocations, result, otherAllocations, otherResult)
+			}
+		}
+		return nil
+	})
+}
+
+func TestClearingExactMatch(t *testing.T) {
+	bids := map[string]FullBid{
+		"bid1": {BidType: Sell, Volume: 50, Price: 10, Zone: "north"},
+		"bid2": {BidType: Buy, Volume: 50, Price: 20, Zone: "north"},
+	}
+
+	for name, algorithm := range clearingAlgorithms {
+		t.Run(name, func(t *testing.T) {
+			allocations, _ := algorithm.Clear(ClearingInput{Bids: bids, Config: defaultMarketConfig, Interconnectors: []Interconnector{}})
+
+			for bidKey, allocated := range allocations {
+				if allocated.Status != "Approved" || allocated.Volume != 50 {
+					t.Errorf("allocation of %v = %+v, want 50 Approved", bidKey, allocated)
+				}
+			}
+		})
+	}
+}
+
+func TestVolumeNettingBuyBelowAsk(t *testing.T) {
+	tests := []struct {
+		name  string
+		bids  map[string]FullBid
+		want  map[string]Allocation
+		price int
+	}{
+		{
+			name: "only buyer below the ask",
+			bids: map[string]FullBid{
+				"bid1": {BidType: Sell, Volume: 10, Price: 50, Zone: "north"},
+				"bid2": {BidType: Buy, Volume: 10, Price: 30, Zone: "north"},
+			},
+			want: map[string]Allocation{
+				"bid1": {Status: "Not Approved"},
+				"bid2": {Status: "Not Approved"},
+			},
+		},
+		{
+			name: "cheaper seller serves the remaining buyer",
+			bids: map[string]FullBid{
+				"bid1": {BidType: Sell, Volume: 10, Price: 20, Zone: "north"},
+				"bid2": {BidType: Sell, Volume: 10, Price: 50, Zone: "north"},
+				"bid3": {BidType: Buy, Volume: 10, Price: 30, Zone: "north"},
+				"bid4": {BidType: Buy, Volume: 10, Price: 25, Zone: "north"},
+			},
+			want: map[string]Allocation{
+				"bid1": {Status: "Approved", Volume: 10, Delivered: 10, Price: 20},
+				"bid2": {Status: "Not Approved"},
+				"bid3": {Status: "Approved", Volume: 10, Delivered: 10, Price: 20},
+				"bid4": {Status: "Not Approved"},
+			},
+			price: 20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocations, result := volumeNetting{}.Clear(ClearingInput{Bids: tt.bids, Config: defaultMarketConfig, Interconnectors: []Interconnector{}})
+
+			if !reflect.DeepEqual(allocations, tt.want) {
+				t.Errorf("allocations = %+v, want %+v", allocations, tt.want)
+			}
+			if result.ClearingPrice != tt.price {
+				t.Errorf("clearing price = %d, want %d", result.ClearingPrice, tt.price)
+			}
+		})
+	}
+}
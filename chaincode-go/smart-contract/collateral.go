@@ -0,0 +1,382 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// CollateralAccount is the prepaid collateral of a market participant. Reserved is
+// the part of the balance that is locked against bids that have not been settled
+type CollateralAccount struct {
+	Owner    string `json:"owner"`
+	Balance  int    `json:"balance"`
+	Reserved int    `json:"reserved"`
+}
+
+// Reservation is the collateral locked for a single bid. A sealed bid locks the
+// deposit of its session; once revealed, a sell bid locks its exposure of volume
+// × price, which backs the imbalance the seller is charged at settlement for
+// volume it does not deliver. Buy bids keep the deposit, as their payment is
+// locked in the escrow of the payment token ledger when they are revealed
+type Reservation struct {
+	SessionID string `json:"sessionID"`
+	BidKey    string `json:"bidKey"`
+	Owner     string `json:"owner"`
+	Amount    int    `json:"amount"`
+}
+
+const collateralKeyType = "collateral"
+const reservationKeyType = "reservation"
+
+// Available returns the part of the collateral balance that can back new bids
+func (a *CollateralAccount) Available() int {
+	return a.Balance - a.Reserved
+}
+
+// DepositCollateral is used by the market operator to credit collateral to the
+// account of a participant once the funds have been received off-chain
+func (s *SmartContract) DepositCollateral(ctx contractapi.TransactionContextInterface, owner string, amount int) error {
+
+	err := assertClientRole(ctx, operatorRole)
+	if err != nil {
+		return err
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("deposit amount must be positive")
+	}
+
+	account, err := getCollateralAccount(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	account.Balance += amount
+
+	return putCollateralAccount(ctx, account)
+}
+
+// WithdrawCollateral allows a participant to take back collateral that is not
+// reserved against any of their bids
+func (s *SmartContract) WithdrawCollateral(ctx contractapi.TransactionContextInterface, amount int) error {
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if amount <= 0 {
+		return fmt.Errorf("withdrawal amount must be positive")
+	}
+
+	account, err := getCollateralAccount(ctx, clientID)
+	if err != nil {
+		return err
+	}
+
+	if account.Available() < amount {
+		return fmt.Errorf("insufficient available collateral: requested %d, available %d", amount, account.Available())
+	}
+
+	account.Balance -= amount
+
+	return putCollateralAccount(ctx, account)
+}
+
+// QueryCollateral returns the collateral account of a participant
+func (s *SmartContract) QueryCollateral(ctx contractapi.TransactionContextInterface, owner string) (*CollateralAccount, error) {
+	return getCollateralAccount(ctx, owner)
+}
+
+// getCollateralAccount is an internal helper that reads the collateral account of
+// a participant. A participant that never deposited has an empty account
+func getCollateralAccount(ctx contractapi.TransactionContextInterface, owner string) (*CollateralAccount, error) {
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(collateralKeyType, []string{owner})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	accountBytes, err := ctx.GetStub().GetState(accountKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get collateral account: %v", err)
+	}
+	if accountBytes == nil {
+		return &CollateralAccount{Owner: owner}, nil
+	}
+
+	var account CollateralAccount
+	err = json.Unmarshal(accountBytes, &account)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create collateral account object JSON: %v", err)
+	}
+
+	return &account, nil
+}
+
+// putCollateralAccount is an internal helper that writes a collateral account to state
+func putCollateralAccount(ctx contractapi.TransactionContextInterface, account *CollateralAccount) error {
+
+	accountKey, err := ctx.GetStub().CreateCompositeKey(collateralKeyType, []string{account.Owner})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	accountBytes, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(accountKey, accountBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put collateral account: %v", err)
+	}
+
+	return nil
+}
+
+// reserveCollateral locks an amount for a bid against the collateral of its owner
+func reserveCollateral(ctx contractapi.TransactionContextInterface, sessionID string, txID string, bidKey string, owner string, amount int) error {
+
+	account, err := getCollateralAccount(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	if account.Available() < amount {
+		return fmt.Errorf("insufficient collateral for bid: deposit %d, available %d", amount, account.Available())
+	}
+
+	account.Reserved += amount
+	err = putCollateralAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	reservation := Reservation{
+		SessionID: sessionID,
+		BidKey:    bidKey,
+		Owner:     owner,
+		Amount:    amount,
+	}
+
+	return putReservation(ctx, txID, &reservation)
+}
+
+// reserveExposure raises the reservation of a revealed bid to its exposure. The
+// part that was already locked for the bid counts towards the exposure
+func reserveExposure(ctx contractapi.TransactionContextInterface, sessionID string, txID string, owner string, exposure int) error {
+
+	reservation, err := getReservation(ctx, sessionID, txID)
+	if err != nil {
+		return err
+	}
+	if reservation.Owner != owner {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", owner)
+	}
+
+	amount := exposure - reservation.Amount
+	if amount <= 0 {
+		return nil
+	}
+
+	account, err := getCollateralAccount(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	if account.Available() < amount {
+		return fmt.Errorf("insufficient collateral for bid: exposure %d, available %d", exposure, account.Available()+reservation.Amount)
+	}
+
+	account.Reserved += amount
+	err = putCollateralAccount(ctx, account)
+	if err != nil {
+		return err
+	}
+
+	reservation.Amount = exposure
+
+	return putReservation(ctx, txID, reservation)
+}
+
+// getReservation is an internal helper that reads the reservation made for a bid
+func getReservation(ctx contractapi.TransactionContextInterface, sessionID string, txID string) (*Reservation, error) {
+
+	reservationKey, err := ctx.GetStub().CreateCompositeKey(reservationKeyType, []string{sessionID, txID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	reservationBytes, err := ctx.GetStub().GetState(reservationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reservation: %v", err)
+	}
+	if reservationBytes == nil {
+		return nil, fmt.Errorf("no collateral reserved for bid %v", txID)
+	}
+
+	var reservation Reservation
+	err = json.Unmarshal(reservationBytes, &reservation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reservation object JSON: %v", err)
+	}
+
+	return &reservation, nil
+}
+
+// putReservation is an internal helper that writes a reservation to state, or
+// deletes it once nothing is reserved anymore
+func putReservation(ctx contractapi.TransactionContextInterface, txID string, reservation *Reservation) error {
+
+	reservationKey, err := ctx.GetStub().CreateCompositeKey(reservationKeyType, []string{reservation.SessionID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	if reservation.Amount == 0 {
+		return ctx.GetStub().DelState(reservationKey)
+	}
+
+	reservationBytes, err := json.Marshal(reservation)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(reservationKey, reservationBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put reservation: %v", err)
+	}
+
+	return nil
+}
+
+// releaseSessionReservations releases the collateral of every bid in the session
+// that is not needed to back its allocation. Bids that were never revealed, or
+// that were not approved, release their whole reservation, approved sell bids
+// keep the exposure of their allocation and approved buy bids at most their
+// deposit. The releases are added to adjustments, and the accounts are written when they are applied
+func releaseSessionReservations(ctx contractapi.TransactionContextInterface, sessionID string, finalizedBids map[string]FullBid, adjustments *collateralAdjustments) error {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(reservationKeyType, []string{sessionID})
+	if err != nil {
+		return fmt.Errorf("failed to get reservations of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return fmt.Errorf("failed to split composite key: %v", err)
+		}
+
+		var reservation Reservation
+		err = json.Unmarshal(queryResponse.Value, &reservation)
+		if err != nil {
+			return fmt.Errorf("failed to create reservation object JSON: %v", err)
+		}
+
+		keep := 0
+		if bid, ok := finalizedBids[reservation.BidKey]; ok {
+			keep = bid.Allocated * bid.Price
+		}
+		if keep > reservation.Amount {
+			keep = reservation.Amount
+		}
+
+		amount := reservation.Amount - keep
+		if amount == 0 {
+			continue
+		}
+
+		reservation.Amount = keep
+		err = putReservation(ctx, keyParts[1], &reservation)
+		if err != nil {
+			return err
+		}
+
+		adjustments.add(reservation.Owner, 0, -amount)
+	}
+
+	return nil
+}
+
+// collateralAdjustments collects the changes to several collateral accounts in
+// one transaction. An owner can be affected by several bids or contracts, so the
+// changes are added up and every account is written once
+type collateralAdjustments struct {
+	balance  map[string]int
+	reserved map[string]int
+}
+
+// newCollateralAdjustments returns an empty set of adjustments
+func newCollateralAdjustments() *collateralAdjustments {
+	return &collateralAdjustments{
+		balance:  make(map[string]int),
+		reserved: make(map[string]int),
+	}
+}
+
+// add records a change to the balance and the reserved amount of an account
+func (a *collateralAdjustments) add(owner string, balanceDelta int, reservedDelta int) {
+	a.balance[owner] += balanceDelta
+	a.reserved[owner] += reservedDelta
+}
+
+// apply writes the adjusted accounts, in owner order
+func (a *collateralAdjustments) apply(ctx contractapi.TransactionContextInterface) error {
+
+	owners := make([]string, 0, len(a.balance))
+	for owner := range a.balance {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	for _, owner := range owners {
+		if a.balance[owner] == 0 && a.reserved[owner] == 0 {
+			continue
+		}
+		err := adjustCollateral(ctx, owner, a.balance[owner], a.reserved[owner])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// adjustCollateral changes the balance and the reserved amount of an account,
+// and fails if either would fall below zero. Fabric does not return the writes
+// of a transaction to its own reads, so an account must only be adjusted once
+// per transaction
+func adjustCollateral(ctx contractapi.TransactionContextInterface, owner string, balanceDelta int, reservedDelta int) error {
+
+	account, err := getCollateralAccount(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	account.Balance += balanceDelta
+	account.Reserved += reservedDelta
+
+	if account.Balance < 0 {
+		return fmt.Errorf("collateral balance of %v cannot fall below zero: %d", owner, account.Balance)
+	}
+	if account.Reserved < 0 {
+		return fmt.Errorf("reserved collateral of %v cannot fall below zero: %d", owner, account.Reserved)
+	}
+
+	return putCollateralAccount(ctx, account)
+}
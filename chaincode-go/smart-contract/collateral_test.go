@@ -0,0 +1,85 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestDepositCollateral(t *testing.T) {
+	tests := []struct {
+		name        string
+		client      *mockledger.Identity
+		amount      int
+		wantErr     string
+		wantBalance int
+	}{
+		{name: "operator", client: operator, amount: 500, wantBalance: 10500},
+		{name: "not the operator", client: seller, amount: 500, wantErr: "client is not authorized as operator", wantBalance: 10000},
+		{name: "nothing", client: operator, amount: 0, wantErr: "deposit amount must be positive", wantBalance: 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.DepositCollateral(ctx, seller.ID(), tt.amount)
+			})
+			checkError(t, err, tt.wantErr)
+
+			if account := m.collateral(seller); account.Balance != tt.wantBalance {
+				t.Errorf("seller balance = %d, want %d", account.Balance, tt.wantBalance)
+			}
+		})
+	}
+}
+
+func TestWithdrawCollateral(t *testing.T) {
+	tests := []struct {
+		name        string
+		reserved    int
+		amount      int
+		wantErr     string
+		wantBalance int
+	}{
+		{name: "available collateral", amount: 2500, wantBalance: 7500},
+		{name: "everything", amount: 10000, wantBalance: 0},
+		{name: "reserved collateral", reserved: 4000, amount: 6000, wantBalance: 4000},
+		{
+			name:        "above the available collateral",
+			reserved:    4000,
+			amount:      6001,
+			wantErr:     "insufficient available collateral: requested 6001, available 6000",
+			wantBalance: 10000,
+		},
+		{name: "nothing", amount: 0, wantErr: "withdrawal amount must be positive", wantBalance: 10000},
+		{name: "negative amount", amount: -10, wantErr: "withdrawal amount must be positive", wantBalance: 10000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.reserved > 0 {
+				m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+					return adjustCollateral(ctx, seller.ID(), 0, tt.reserved)
+				})
+			}
+
+			_, err := m.submit(seller, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.WithdrawCollateral(ctx, tt.amount)
+			})
+			checkError(t, err, tt.wantErr)
+
+			account := m.collateral(seller)
+			if account.Balance != tt.wantBalance || account.Reserved != tt.reserved {
+				t.Errorf("seller collateral = %+v, want a balance of %d and %d reserved", account, tt.wantBalance, tt.reserved)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MarketConfig is a versioned template for the sessions of a market. A session
+// keeps a copy of the version it was created with, so publishing a new version
+// only changes the sessions created afterwards. BidDeposit is the collateral
+// every sealed bid locks; a config that leaves it out uses defaultBidDeposit
+type MarketConfig struct {
+	ConfigID          string      `json:"configID"`
+	Version           int         `json:"version"`
+	ClearingAlgorithm string      `json:"clearingAlgorithm"`
+	AllocationRule    string      `json:"allocationRule"`
+	Rules             MarketRules `json:"rules"`
+	BidDeposit        int         `json:"bidDeposit,omitempty" metadata:"bidDeposit,optional"`
+	Schedule          Schedule    `json:"schedule"`
+	Currency          string      `json:"currency"`
+	Unit              string      `json:"unit"`
+}
+
+// Schedule describes when the sessions of a market are run. Times of day are
+// given as HH:MM in UTC, and the delivery interval in minutes
+type Schedule struct {
+	BiddingOpens     string `json:"biddingOpens"`
+	GateClosure      string `json:"gateClosure"`
+	DeliveryInterval int    `json:"deliveryInterval"`
+}
+
+const marketConfigKeyType = "marketConfig"
+
+const (
+	VolumeNetting = "volumeNetting"
+	UniformPrice  = "uniformPrice"
+	PayAsBid      = "payAsBid"
+)
+
+const (
+	Sequential = "sequential"
+)
+
+// defaultBidDeposit is the collateral a sealed bid locks in sessions whose
+// market config does not set a deposit
+const defaultBidDeposit = 100
+
+// defaultMarketConfig is used by sessions that are created without a market config
+var defaultMarketConfig = MarketConfig{
+	ClearingAlgorithm: VolumeNetting,
+	AllocationRule:    Sequential,
+	Currency:          "EUR",
+	Unit:              "kWh",
+}
+
+// PublishMarketConfig is used by the market operator to create a market config,
+// or to publish a new version of an existing one. The config is passed as JSON,
+// and limits that are left out are not enforced. It returns the new version
+func (s *SmartContract) PublishMarketConfig(ctx contractapi.TransactionContextInterface, configID string, configJSON string) (int, error) {
+
+	err := assertClientRole(ctx, operatorRole)
+	if err != nil {
+		return 0, err
+	}
+
+	if configID == "" {
+		return 0, fmt.Errorf("market config ID cannot be empty")
+	}
+
+	var config MarketConfig
+	err = json.Unmarshal([]byte(configJSON), &config)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal market config JSON: %v", err)
+	}
+
+	// a deposit of 0 would lock the default deposit instead, so it has to be
+	// left out rather than set
+	var deposit struct {
+		BidDeposit *int `json:"bidDeposit"`
+	}
+	err = json.Unmarshal([]byte(configJSON), &deposit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unmarshal market config JSON: %v", err)
+	}
+	if deposit.BidDeposit != nil && *deposit.BidDeposit == 0 {
+		return 0, fmt.Errorf("bid deposit must be positive, leave it out to use the default of %d", defaultBidDeposit)
+	}
+
+	err = config.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	latest, err := getMarketConfig(ctx, configID, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	config.ConfigID = configID
+	config.Version = 1
+	if latest != nil {
+		config.Version = latest.Version + 1
+	}
+
+	err = putMarketConfig(ctx, &config)
+	if err != nil {
+		return 0, err
+	}
+
+	return config.Version, nil
+}
+
+// QueryMarketConfig returns a version of a market config, or its latest version
+// if version is 0
+func (s *SmartContract) QueryMarketConfig(ctx contractapi.TransactionContextInterface, configID string, version int) (*MarketConfig, error) {
+
+	config, err := getMarketConfig(ctx, configID, version)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil && version == 0 {
+		return nil, fmt.Errorf("market config %v does not exist", configID)
+	}
+	if config == nil {
+		return nil, fmt.Errorf("market config %v version %d does not exist", configID, version)
+	}
+
+	return config, nil
+}
+
+// QueryMarketConfigVersions returns all versions of a market config, oldest first
+func (s *SmartContract) QueryMarketConfigVersions(ctx contractapi.TransactionContextInterface, configID string) ([]*MarketConfig, error) {
+	return getMarketConfigVersions(ctx, configID)
+}
+
+// validate checks that the config names a supported clearing algorithm and
+// allocation rule and that its rules are consistent
+func (c *MarketConfig) validate() error {
+
+	if _, ok := clearingAlgorithms[c.ClearingAlgorithm]; !ok {
+		return fmt.Errorf("unsupported clearing algorithm %v", c.ClearingAlgorithm)
+	}
+
+	switch c.AllocationRule {
+	case Sequential:
+	default:
+		return fmt.Errorf("unsupported allocation rule %v", c.AllocationRule)
+	}
+
+	if c.Currency == "" || c.Unit == "" {
+		return fmt.Errorf("market config must name a currency and a unit")
+	}
+	if c.Schedule.DeliveryInterval < 0 {
+		return fmt.Errorf("delivery interval cannot be negative")
+	}
+	if c.BidDeposit < 0 {
+		return fmt.Errorf("bid deposit cannot be negative")
+	}
+
+	return c.Rules.validate()
+}
+
+// bidDeposit returns the collateral that every sealed bid of a session locks,
+// which is defaultBidDeposit if the config leaves it out
+func (c *MarketConfig) bidDeposit() int {
+	if c.BidDeposit > 0 {
+		return c.BidDeposit
+	}
+	return defaultBidDeposit
+}
+
+// getMarketConfig is an internal helper that reads a version of a market config,
+// or its latest version if version is 0. It returns nil if the config or the
+// version does not exist
+func getMarketConfig(ctx contractapi.TransactionContextInterface, configID string, version int) (*MarketConfig, error) {
+
+	if version == 0 {
+		versions, err := getMarketConfigVersions(ctx, configID)
+		if err != nil {
+			return nil, err
+		}
+		if len(versions) == 0 {
+			return nil, nil
+		}
+		return versions[len(versions)-1], nil
+	}
+
+	configKey, err := ctx.GetStub().CreateCompositeKey(marketConfigKeyType, []string{configID, versionKey(version)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	configBytes, err := ctx.GetStub().GetState(configKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market config %v: %v", configID, err)
+	}
+	if configBytes == nil {
+		return nil, nil
+	}
+
+	var config MarketConfig
+	err = json.Unmarshal(configBytes, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// getMarketConfigVersions is an internal helper that reads all versions of a
+// market config. The version is zero padded in the key, so the versions are
+// returned in order
+func getMarketConfigVersions(ctx contractapi.TransactionContextInterface, configID string) ([]*MarketConfig, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(marketConfigKeyType, []string{configID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get market config %v: %v", configID, err)
+	}
+	defer resultsIterator.Close()
+
+	var versions []*MarketConfig
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var config MarketConfig
+		err = json.Unmarshal(queryResponse.Value, &config)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, &config)
+	}
+
+	return versions, nil
+}
+
+// putMarketConfig is an internal helper that writes a version of a market config to state
+func putMarketConfig(ctx contractapi.TransactionContextInterface, config *MarketConfig) error {
+
+	configKey, err := ctx.GetStub().CreateCompositeKey(marketConfigKeyType, []string{config.ConfigID, versionKey(config.Version)})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(configKey, configBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put market config: %v", err)
+	}
+
+	return nil
+}
+
+// versionKey formats a version so that the keys of a config sort by version
+func versionKey(version int) string {
+	return fmt.Sprintf("%08d", version)
+}
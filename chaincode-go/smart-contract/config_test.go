@@ -0,0 +1,113 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+func TestPublishMarketConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		configJSON  string
+		wantDeposit int
+		wantErr     string
+	}{
+		{
+			name:        "deposit left out",
+			configJSON:  `{"clearingAlgorithm":"uniformPrice","allocationRule":"sequential","currency":"EUR","unit":"kWh"}`,
+			wantDeposit: defaultBidDeposit,
+		},
+		{
+			name:        "deposit set",
+			configJSON:  `{"clearingAlgorithm":"uniformPrice","allocationRule":"sequential","bidDeposit":250,"currency":"EUR","unit":"kWh"}`,
+			wantDeposit: 250,
+		},
+		{
+			name:       "zero deposit",
+			configJSON: `{"clearingAlgorithm":"uniformPrice","allocationRule":"sequential","bidDeposit":0,"currency":"EUR","unit":"kWh"}`,
+			wantErr:    "bid deposit must be positive, leave it out to use the default of 100",
+		},
+		{
+			name:       "negative deposit",
+			configJSON: `{"clearingAlgorithm":"uniformPrice","allocationRule":"sequential","bidDeposit":-1,"currency":"EUR","unit":"kWh"}`,
+			wantErr:    "bid deposit cannot be negative",
+		},
+		{
+			name:       "unsupported clearing algorithm",
+			configJSON: `{"clearingAlgorithm":"lottery","allocationRule":"sequential","currency":"EUR","unit":"kWh"}`,
+			wantErr:    "unsupported clearing algorithm lottery",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			_, err := m.submit(operator, func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.PublishMarketConfig(ctx, "dayAhead", tt.configJSON)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			var config *MarketConfig
+			err = m.ledger.Evaluate(operator, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				config, err = contract.QueryMarketConfig(ctx, "dayAhead", 0)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deposit := config.bidDeposit(); deposit != tt.wantDeposit {
+				t.Errorf("bid deposit = %d, want %d", deposit, tt.wantDeposit)
+			}
+		})
+	}
+}
+
+func TestQueryMarketConfigVersions(t *testing.T) {
+	m := newMarket(t)
+
+	queryVersions := func(configID string) []*MarketConfig {
+		t.Helper()
+
+		var versions []*MarketConfig
+		err := m.ledger.Evaluate(seller, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			versions, err = contract.QueryMarketConfigVersions(ctx, configID)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return versions
+	}
+
+	if versions := queryVersions("strict"); len(versions) != 0 {
+		t.Errorf("versions of an unpublished config = %+v, want none", versions)
+	}
+
+	m.publishConfig("strict", MarketRules{MaxVolume: 10})
+	m.publishConfig("strict", MarketRules{MaxVolume: 50})
+	m.publishConfig("other", MarketRules{MaxVolume: 20})
+
+	var got []MarketRules
+	for i, config := range queryVersions("strict") {
+		if config.ConfigID != "strict" || config.Version != i+1 {
+			t.Errorf("version %d = %+v, want version %d of strict", i, config, i+1)
+		}
+		got = append(got, config.Rules)
+	}
+	if want := []MarketRules{{MaxVolume: 10}, {MaxVolume: 50}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rules of the versions = %+v, want %+v", got, want)
+	}
+}
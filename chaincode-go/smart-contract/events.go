@@ -0,0 +1,87 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// The names of the chaincode events that the session transitions emit, so that
+// clients can follow gate closure and clearing without polling the session
+const (
+	SessionCreatedEvent = "SessionCreated"
+	SessionClosedEvent  = "SessionClosed"
+	SessionEndedEvent   = "SessionEnded"
+	SessionSettledEvent = "SessionSettled"
+)
+
+// SessionEvent is the payload of a session event. Result and Allocations are
+// only set by the SessionEnded event. The allocations are public like the
+// revealed bids of the session, and carry the bidder so that clients can pass
+// each allocation on to its owner only
+type SessionEvent struct {
+	SessionID   string          `json:"sessionID"`
+	Status      string          `json:"status"`
+	Result      *ClearingResult `json:"result,omitempty"`
+	Allocations []BidAllocation `json:"allocations,omitempty"`
+}
+
+// BidAllocation is the outcome of a revealed bid when its session is cleared
+type BidAllocation struct {
+	BidKey          string  `json:"bidKey"`
+	Bidder          string  `json:"bidder"`
+	Org             string  `json:"org"`
+	BidType         BidType `json:"bidType"`
+	Volume          int     `json:"volume"`
+	Allocated       int     `json:"allocatedVolume"`
+	Delivered       int     `json:"deliveredVolume"`
+	SettlementPrice int     `json:"settlementPrice"`
+	Status          string  `json:"status"`
+}
+
+// setSessionEvent sets the event of a session transition on the transaction
+func setSessionEvent(ctx contractapi.TransactionContextInterface, name string, event *SessionEvent) error {
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(name, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event %v: %v", name, err)
+	}
+
+	return nil
+}
+
+// bidAllocations returns the allocations of the revealed bids of a session,
+// ordered by bid key
+func bidAllocations(bids map[string]FullBid) []BidAllocation {
+
+	allocations := make([]BidAllocation, 0, len(bids))
+	for bidKey, bid := range bids {
+		allocations = append(allocations, BidAllocation{
+			BidKey:          bidKey,
+			Bidder:          bid.Bidder,
+			Org:             bid.Org,
+			BidType:         bid.BidType,
+			Volume:          bid.Volume,
+			Allocated:       bid.Allocated,
+			Delivered:       bid.Delivered,
+			SettlementPrice: bid.SettlementPrice,
+			Status:          bid.Status,
+		})
+	}
+	sort.Slice(allocations, func(i, j int) bool {
+		return allocations[i].BidKey < allocations[j].BidKey
+	})
+
+	return allocations
+}
@@ -0,0 +1,539 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Forward is a contract for difference on the price of a future session. When
+// the session ends, the seller pays the buyer the difference between the price
+// of the forward's zone and the strike price for the contracted volume, or the
+// buyer pays the seller if the price is below the strike. Both parties reserve
+// a margin from their collateral until then, and the payout is capped at the
+// margin. If the session has not ended by the expiry, either party can expire
+// the forward and both margins are released
+type Forward struct {
+	ForwardID       string `json:"forwardID"`
+	SessionID       string `json:"sessionID"`
+	Zone            string `json:"zone"`
+	Seller          string `json:"seller"`
+	SellerOrg       string `json:"sellerOrg"`
+	Buyer           string `json:"buyer"`
+	BuyerOrg        string `json:"buyerOrg"`
+	Volume          int    `json:"volume"`
+	StrikePrice     int    `json:"strikePrice"`
+	Margin          int    `json:"margin"`
+	Expiry          string `json:"expiry"`
+	Status          string `json:"status"`
+	SettlementPrice int    `json:"settlementPrice"`
+	Payout          int    `json:"payout"`
+}
+
+// MarkToMarket is the value of a forward to its buyer at a reference price. It is
+// negative when the buyer would have to pay
+type MarkToMarket struct {
+	ForwardID      string `json:"forwardID"`
+	ReferencePrice int    `json:"referencePrice"`
+	Final          bool   `json:"final"`
+	Value          int    `json:"value"`
+}
+
+// MarkPrice is the indicative price of a future session in a zone, published by
+// the market operator to value open forwards
+type MarkPrice struct {
+	SessionID string `json:"sessionID"`
+	Zone      string `json:"zone"`
+	Price     int    `json:"price"`
+}
+
+const forwardKeyType = "forward"
+const markPriceKeyType = "markPrice"
+
+const (
+	ForwardProposed  = "proposed"
+	ForwardOpen      = "open"
+	ForwardSettled   = "settled"
+	ForwardCancelled = "cancelled"
+	ForwardExpired   = "expired"
+)
+
+// ProposeForward is used by a seller to offer a forward on a session that has not
+// ended yet to a buyer, identified by client ID. The margin is reserved from the
+// seller's collateral. The expiry is an RFC3339 time after which the forward can
+// be expired if its session has not ended. The function returns the transaction
+// ID, which identifies the forward
+func (s *SmartContract) ProposeForward(ctx contractapi.TransactionContextInterface, sessionID string, zone string, buyer string, buyerOrg string, volume int, strikePrice int, margin int, expiry string) (string, error) {
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if buyer == clientID {
+		return "", fmt.Errorf("cannot trade with yourself")
+	}
+	if volume <= 0 || strikePrice <= 0 {
+		return "", fmt.Errorf("forward volume and strike price must be positive")
+	}
+	if margin <= 0 {
+		return "", fmt.Errorf("forward margin must be positive")
+	}
+
+	expiryTime, err := time.Parse(time.RFC3339, expiry)
+	if err != nil {
+		return "", fmt.Errorf("forward expiry must be an RFC3339 time: %v", err)
+	}
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !expiryTime.After(now) {
+		return "", fmt.Errorf("forward expiry must be in the future")
+	}
+
+	err = assertSessionNotEnded(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	err = reserveMargin(ctx, clientID, margin)
+	if err != nil {
+		return "", err
+	}
+
+	forward := Forward{
+		ForwardID:   ctx.GetStub().GetTxID(),
+		SessionID:   sessionID,
+		Zone:        zone,
+		Seller:      clientID,
+		SellerOrg:   clientOrgID,
+		Buyer:       buyer,
+		BuyerOrg:    buyerOrg,
+		Volume:      volume,
+		StrikePrice: strikePrice,
+		Margin:      margin,
+		Expiry:      expiry,
+		Status:      ForwardProposed,
+	}
+
+	err = putForward(ctx, &forward)
+	if err != nil {
+		return "", err
+	}
+
+	return forward.ForwardID, nil
+}
+
+// AcceptForward is used by the buyer to enter a proposed forward. The margin is
+// reserved from the buyer's collateral
+func (s *SmartContract) AcceptForward(ctx contractapi.TransactionContextInterface, sessionID string, forwardID string) error {
+
+	forward, err := s.QueryForward(ctx, sessionID, forwardID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// get org of submitting client
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if forward.Buyer != clientID || forward.BuyerOrg != clientOrgID {
+		return fmt.Errorf("forward can only be accepted by its buyer")
+	}
+	if forward.Status != ForwardProposed {
+		return fmt.Errorf("cannot accept a forward that is %v", forward.Status)
+	}
+
+	expired, err := forward.expired(ctx)
+	if err != nil {
+		return err
+	}
+	if expired {
+		return fmt.Errorf("cannot accept a forward after its expiry %v", forward.Expiry)
+	}
+
+	err = assertSessionNotEnded(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	err = reserveMargin(ctx, clientID, forward.Margin)
+	if err != nil {
+		return err
+	}
+
+	forward.Status = ForwardOpen
+
+	return putForward(ctx, forward)
+}
+
+// CancelForward is used by the seller to withdraw a proposed forward, or by the
+// buyer to reject it. The seller's margin is released
+func (s *SmartContract) CancelForward(ctx contractapi.TransactionContextInterface, sessionID string, forwardID string) error {
+
+	forward, err := s.QueryForward(ctx, sessionID, forwardID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if forward.Seller != clientID && forward.Buyer != clientID {
+		return fmt.Errorf("forward can only be cancelled by its seller or buyer")
+	}
+	if forward.Status != ForwardProposed {
+		return fmt.Errorf("cannot cancel a forward that is %v", forward.Status)
+	}
+
+	err = adjustCollateral(ctx, forward.Seller, 0, -forward.Margin)
+	if err != nil {
+		return err
+	}
+
+	forward.Status = ForwardCancelled
+
+	return putForward(ctx, forward)
+}
+
+// ExpireForward is used by the seller or the buyer to close a proposed or open
+// forward whose session has not ended by the expiry of the forward. Nothing is
+// paid out, and the margins of both parties are released
+func (s *SmartContract) ExpireForward(ctx contractapi.TransactionContextInterface, sessionID string, forwardID string) error {
+
+	forward, err := s.QueryForward(ctx, sessionID, forwardID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if forward.Seller != clientID && forward.Buyer != clientID {
+		return fmt.Errorf("forward can only be expired by its seller or buyer")
+	}
+	if forward.Status != ForwardProposed && forward.Status != ForwardOpen {
+		return fmt.Errorf("cannot expire a forward that is %v", forward.Status)
+	}
+
+	expired, err := forward.expired(ctx)
+	if err != nil {
+		return err
+	}
+	if !expired {
+		return fmt.Errorf("forward does not expire before %v", forward.Expiry)
+	}
+
+	err = adjustCollateral(ctx, forward.Seller, 0, -forward.Margin)
+	if err != nil {
+		return err
+	}
+	if forward.Status == ForwardOpen {
+		err = adjustCollateral(ctx, forward.Buyer, 0, -forward.Margin)
+		if err != nil {
+			return err
+		}
+	}
+
+	forward.Status = ForwardExpired
+
+	return putForward(ctx, forward)
+}
+
+// PublishMarkPrice is used by the market operator to publish the indicative price
+// of a future session in a zone, which is used to value open forwards
+func (s *SmartContract) PublishMarkPrice(ctx contractapi.TransactionContextInterface, sessionID string, zone string, price int) error {
+
+	err := assertClientRole(ctx, operatorRole)
+	if err != nil {
+		return err
+	}
+
+	if price < 0 {
+		return fmt.Errorf("mark price cannot be negative")
+	}
+
+	markPriceKey, err := ctx.GetStub().CreateCompositeKey(markPriceKeyType, []string{sessionID, zone})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	markPriceBytes, err := json.Marshal(MarkPrice{SessionID: sessionID, Zone: zone, Price: price})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(markPriceKey, markPriceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put mark price: %v", err)
+	}
+
+	return nil
+}
+
+// QueryMarkToMarket values a forward. Before its session has ended the forward is
+// valued at the latest mark price of its zone, afterwards at the settlement price
+func (s *SmartContract) QueryMarkToMarket(ctx contractapi.TransactionContextInterface, sessionID string, forwardID string) (*MarkToMarket, error) {
+
+	forward, err := s.QueryForward(ctx, sessionID, forwardID)
+	if err != nil {
+		return nil, err
+	}
+
+	valuation := MarkToMarket{ForwardID: forwardID}
+
+	if forward.Status == ForwardSettled {
+		valuation.ReferencePrice = forward.SettlementPrice
+		valuation.Final = true
+		valuation.Value = forward.Payout
+		return &valuation, nil
+	}
+
+	markPriceKey, err := ctx.GetStub().CreateCompositeKey(markPriceKeyType, []string{sessionID, forward.Zone})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	markPriceBytes, err := ctx.GetStub().GetState(markPriceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mark price: %v", err)
+	}
+	if markPriceBytes == nil {
+		return nil, fmt.Errorf("no mark price published for session %v", sessionID)
+	}
+
+	var markPrice MarkPrice
+	err = json.Unmarshal(markPriceBytes, &markPrice)
+	if err != nil {
+		return nil, err
+	}
+
+	valuation.ReferencePrice = markPrice.Price
+	valuation.Value = forward.payout(markPrice.Price)
+
+	return &valuation, nil
+}
+
+// QueryForward returns a forward on a session
+func (s *SmartContract) QueryForward(ctx contractapi.TransactionContextInterface, sessionID string, forwardID string) (*Forward, error) {
+
+	forwardKey, err := ctx.GetStub().CreateCompositeKey(forwardKeyType, []string{sessionID, forwardID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	forwardBytes, err := ctx.GetStub().GetState(forwardKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forward %v: %v", forwardID, err)
+	}
+	if forwardBytes == nil {
+		return nil, fmt.Errorf("forward %v does not exist", forwardID)
+	}
+
+	var forward Forward
+	err = json.Unmarshal(forwardBytes, &forward)
+	if err != nil {
+		return nil, err
+	}
+
+	return &forward, nil
+}
+
+// QueryForwards returns the forwards on a session
+func (s *SmartContract) QueryForwards(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Forward, error) {
+	return getForwards(ctx, sessionID)
+}
+
+// payout returns what the seller of the forward pays its buyer at a price. It is
+// capped at the margin, which is all that either party has reserved for the
+// forward
+func (f *Forward) payout(price int) int {
+	payout := (price - f.StrikePrice) * f.Volume
+	if payout > f.Margin {
+		return f.Margin
+	}
+	if payout < -f.Margin {
+		return -f.Margin
+	}
+	return payout
+}
+
+// expired reports whether the transaction runs after the expiry of the forward
+func (f *Forward) expired(ctx contractapi.TransactionContextInterface) (bool, error) {
+
+	expiry, err := time.Parse(time.RFC3339, f.Expiry)
+	if err != nil {
+		return false, fmt.Errorf("forward %v has an invalid expiry: %v", f.ForwardID, err)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return now.After(expiry), nil
+}
+
+// settleForwards settles the open forwards of an ended session at the price of
+// their zone, and cancels the forwards that were never accepted. The payouts
+// move collateral between the parties and the margins are released; the
+// changes are added to adjustments
+func settleForwards(ctx contractapi.TransactionContextInterface, sessionID string, sessionJSON *Session, adjustments *collateralAdjustments) error {
+
+	forwards, err := getForwards(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	for _, forward := range forwards {
+		switch forward.Status {
+		case ForwardProposed:
+			adjustments.add(forward.Seller, 0, -forward.Margin)
+			forward.Status = ForwardCancelled
+		case ForwardOpen:
+			forward.SettlementPrice = sessionJSON.priceFor(forward.Zone)
+			forward.Payout = forward.payout(forward.SettlementPrice)
+			adjustments.add(forward.Seller, -forward.Payout, -forward.Margin)
+			adjustments.add(forward.Buyer, forward.Payout, -forward.Margin)
+			forward.Status = ForwardSettled
+		default:
+			continue
+		}
+
+		err = putForward(ctx, forward)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// assertSessionNotEnded checks that a session has not been cleared yet. Forwards
+// can be entered on sessions that have not been created yet
+func assertSessionNotEnded(ctx contractapi.TransactionContextInterface, sessionID string) error {
+
+	sessionBytes, err := ctx.GetStub().GetState(sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session %v: %v", sessionID, err)
+	}
+	if sessionBytes == nil {
+		return nil
+	}
+
+	var sessionJSON Session
+	err = json.Unmarshal(sessionBytes, &sessionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to create session object JSON: %v", err)
+	}
+
+	if sessionJSON.Status != "Open" && sessionJSON.Status != "Close" {
+		return fmt.Errorf("session %v has already ended", sessionID)
+	}
+
+	return nil
+}
+
+// getTxTime returns the timestamp of the transaction
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)).UTC(), nil
+}
+
+// reserveMargin locks the margin of a forward against the collateral of a party
+func reserveMargin(ctx contractapi.TransactionContextInterface, owner string, margin int) error {
+
+	account, err := getCollateralAccount(ctx, owner)
+	if err != nil {
+		return err
+	}
+
+	if account.Available() < margin {
+		return fmt.Errorf("insufficient collateral for margin: margin %d, available %d", margin, account.Available())
+	}
+
+	account.Reserved += margin
+
+	return putCollateralAccount(ctx, account)
+}
+
+// getForwards is an internal helper that reads the forwards on a session
+func getForwards(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Forward, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(forwardKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get forwards of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	var forwards []*Forward
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var forward Forward
+		err = json.Unmarshal(queryResponse.Value, &forward)
+		if err != nil {
+			return nil, err
+		}
+		forwards = append(forwards, &forward)
+	}
+
+	return forwards, nil
+}
+
+// putForward is an internal helper that writes a forward to state
+func putForward(ctx contractapi.TransactionContextInterface, forward *Forward) error {
+
+	forwardKey, err := ctx.GetStub().CreateCompositeKey(forwardKeyType, []string{forward.SessionID, forward.ForwardID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	forwardBytes, err := json.Marshal(forward)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(forwardKey, forwardBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put forward: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,431 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+// hedger trades forwards on s1 without bidding in it
+var hedger = mockledger.NewIdentity("hedger", org2)
+
+// expiry is a day after the start of the test ledger
+const expiry = "2021-03-02T12:00:00Z"
+
+// forwardMarket is a market in which the hedger has 10000 of collateral as well
+func forwardMarket(t *testing.T) *market {
+	t.Helper()
+
+	m := newMarket(t)
+	owner := hedger.ID()
+	m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.DepositCollateral(ctx, owner, 10000)
+	})
+
+	return m
+}
+
+// proposeForward offers a forward on s1 from the trader to the hedger
+func (m *market) proposeForward(volume int, strikePrice int, margin int) string {
+	m.t.Helper()
+
+	var forwardID string
+	m.mustSubmit(trader, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		forwardID, err = contract.ProposeForward(ctx, "s1", "", hedger.ID(), hedger.MSPID, volume, strikePrice, margin, expiry)
+		return err
+	})
+
+	return forwardID
+}
+
+// openForward proposes a forward and lets the hedger accept it
+func (m *market) openForward(volume int, strikePrice int, margin int) string {
+	m.t.Helper()
+
+	forwardID := m.proposeForward(volume, strikePrice, margin)
+	m.mustSubmit(hedger, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.AcceptForward(ctx, "s1", forwardID)
+	})
+
+	return forwardID
+}
+
+// forward returns a forward on s1
+func (m *market) forward(forwardID string) *Forward {
+	m.t.Helper()
+
+	var forward *Forward
+	err := m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		forward, err = contract.QueryForward(ctx, "s1", forwardID)
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return forward
+}
+
+// checkReserved fails the test if the reserved collateral of a participant differs from want
+func (m *market) checkReserved(client *mockledger.Identity, want int) {
+	m.t.Helper()
+
+	if reserved := m.collateral(client).Reserved; reserved != want {
+		m.t.Errorf("reserved collateral of %v = %d, want %d", client.Name, reserved, want)
+	}
+}
+
+func TestProposeForward(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(m *market)
+		buyer   *mockledger.Identity
+		volume  int
+		margin  int
+		expiry  string
+		wantErr string
+	}{
+		{name: "forward", buyer: hedger, volume: 10, margin: 500, expiry: expiry},
+		{name: "with yourself", buyer: trader, volume: 10, margin: 500, expiry: expiry, wantErr: "cannot trade with yourself"},
+		{name: "zero volume", buyer: hedger, volume: 0, margin: 500, expiry: expiry, wantErr: "volume and strike price must be positive"},
+		{name: "zero margin", buyer: hedger, volume: 10, margin: 0, expiry: expiry, wantErr: "forward margin must be positive"},
+		{name: "margin above the collateral", buyer: hedger, volume: 10, margin: 10001, expiry: expiry, wantErr: "insufficient collateral for margin"},
+		{name: "invalid expiry", buyer: hedger, volume: 10, margin: 500, expiry: "tomorrow", wantErr: "must be an RFC3339 time"},
+		{name: "expiry in the past", buyer: hedger, volume: 10, margin: 500, expiry: "2021-03-01T00:00:00Z", wantErr: "expiry must be in the future"},
+		{
+			name:    "ended session",
+			setup:   func(m *market) { m.updateSession("s1", func(session *Session) { session.Status = "ended" }) },
+			buyer:   hedger,
+			volume:  10,
+			margin:  500,
+			expiry:  expiry,
+			wantErr: "session s1 has already ended",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := forwardMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+
+			_, err := m.submit(trader, func(ctx contractapi.TransactionContextInterface) error {
+				_, err := contract.ProposeForward(ctx, "s1", "", tt.buyer.ID(), tt.buyer.MSPID, tt.volume, 20, tt.margin, tt.expiry)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+
+			want := 0
+			if tt.wantErr == "" {
+				want = tt.margin
+			}
+			m.checkReserved(trader, want)
+		})
+	}
+}
+
+func TestAcceptForward(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(m *market, forwardID string)
+		client  *mockledger.Identity
+		wantErr string
+	}{
+		{name: "buyer", client: hedger},
+		{name: "not the buyer", client: buyer, wantErr: "forward can only be accepted by its buyer"},
+		{
+			name: "accepted twice",
+			setup: func(m *market, forwardID string) {
+				m.mustSubmit(hedger, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.AcceptForward(ctx, "s1", forwardID)
+				})
+			},
+			client:  hedger,
+			wantErr: "cannot accept a forward that is open",
+		},
+		{
+			name:    "after the expiry",
+			setup:   func(m *market, forwardID string) { m.ledger.Advance(48 * time.Hour) },
+			client:  hedger,
+			wantErr: "cannot accept a forward after its expiry",
+		},
+		{
+			name: "margin above the available collateral",
+			setup: func(m *market, forwardID string) {
+				m.mustSubmit(hedger, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.WithdrawCollateral(ctx, 9800)
+				})
+			},
+			client:  hedger,
+			wantErr: "insufficient collateral for margin: margin 500, available 200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := forwardMarket(t)
+			forwardID := m.proposeForward(10, 20, 500)
+			if tt.setup != nil {
+				tt.setup(m, forwardID)
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.AcceptForward(ctx, "s1", forwardID)
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if status := m.forward(forwardID).Status; status != ForwardOpen {
+				t.Errorf("forward status = %v, want %v", status, ForwardOpen)
+			}
+			m.checkReserved(hedger, 500)
+		})
+	}
+}
+
+func TestCancelForward(t *testing.T) {
+	tests := []struct {
+		name    string
+		open    bool
+		client  *mockledger.Identity
+		wantErr string
+	}{
+		{name: "withdrawn by the seller", client: trader},
+		{name: "rejected by the buyer", client: hedger},
+		{name: "not a party", client: buyer, wantErr: "forward can only be cancelled by its seller or buyer"},
+		{name: "open forward", open: true, client: trader, wantErr: "cannot cancel a forward that is open"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := forwardMarket(t)
+			var forwardID string
+			if tt.open {
+				forwardID = m.openForward(10, 20, 500)
+			} else {
+				forwardID = m.proposeForward(10, 20, 500)
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CancelForward(ctx, "s1", forwardID)
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if status := m.forward(forwardID).Status; status != ForwardCancelled {
+				t.Errorf("forward status = %v, want %v", status, ForwardCancelled)
+			}
+			m.checkReserved(trader, 0)
+		})
+	}
+}
+
+func TestExpireForward(t *testing.T) {
+	tests := []struct {
+		name         string
+		open         bool
+		advance      time.Duration
+		settle       bool
+		client       *mockledger.Identity
+		wantErr      string
+		wantReserved int
+	}{
+		{name: "proposed forward", advance: 48 * time.Hour, client: trader},
+		{name: "open forward", open: true, advance: 48 * time.Hour, client: hedger},
+		{name: "before the expiry", open: true, client: trader, wantErr: "forward does not expire before " + expiry, wantReserved: 500},
+		{name: "not a party", open: true, advance: 48 * time.Hour, client: buyer, wantErr: "forward can only be expired by its seller or buyer", wantReserved: 500},
+		{name: "settled forward", open: true, advance: 48 * time.Hour, settle: true, client: trader, wantErr: "cannot expire a forward that is settled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := forwardMarket(t)
+			var forwardID string
+			if tt.open {
+				forwardID = m.openForward(10, 20, 500)
+			} else {
+				forwardID = m.proposeForward(10, 20, 500)
+			}
+			if tt.settle {
+				revealBids(m)
+				m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+					_, err := contract.EndSession(ctx, "s1")
+					return err
+				})
+			}
+			m.ledger.Advance(tt.advance)
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.ExpireForward(ctx, "s1", forwardID)
+			})
+			checkError(t, err, tt.wantErr)
+
+			if err == nil {
+				if status := m.forward(forwardID).Status; status != ForwardExpired {
+					t.Errorf("forward status = %v, want %v", status, ForwardExpired)
+				}
+			}
+			m.checkReserved(trader, tt.wantReserved)
+			m.checkReserved(hedger, tt.wantReserved)
+		})
+	}
+}
+
+func TestQueryMarkToMarket(t *testing.T) {
+	tests := []struct {
+		name      string
+		markPrice int
+		wantValue int
+		wantErr   string
+	}{
+		{name: "price above the strike", markPrice: 25, wantValue: 50},
+		{name: "price below the strike", markPrice: 12, wantValue: -80},
+		{name: "gain capped at the margin", markPrice: 200, wantValue: 100},
+		{name: "loss capped at the margin", markPrice: 5, wantValue: -100},
+		{name: "no mark price", markPrice: -1, wantErr: "no mark price published for session s1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := forwardMarket(t)
+			forwardID := m.openForward(10, 20, 100)
+
+			if tt.markPrice >= 0 {
+				m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.PublishMarkPrice(ctx, "s1", "", tt.markPrice)
+				})
+			}
+
+			var valuation *MarkToMarket
+			err := m.ledger.Evaluate(hedger, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				valuation, err = contract.QueryMarkToMarket(ctx, "s1", forwardID)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			want := MarkToMarket{ForwardID: forwardID, ReferencePrice: tt.markPrice, Value: tt.wantValue}
+			if *valuation != want {
+				t.Errorf("QueryMarkToMarket() = %+v, want %+v", *valuation, want)
+			}
+		})
+	}
+}
+
+func TestPublishMarkPrice(t *testing.T) {
+	m := forwardMarket(t)
+
+	_, err := m.submit(trader, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.PublishMarkPrice(ctx, "s1", "", 20)
+	})
+	checkError(t, err, "not authorized")
+
+	_, err = m.submit(operator, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.PublishMarkPrice(ctx, "s1", "", -1)
+	})
+	checkError(t, err, "mark price cannot be negative")
+}
+
+func TestSettleForwards(t *testing.T) {
+	m := forwardMarket(t)
+
+	uncapped := m.openForward(10, 8, 500)
+	capped := m.openForward(100, 30, 300)
+	proposed := m.proposeForward(10, 20, 200)
+	m.checkReserved(trader, 1000)
+	m.checkReserved(hedger, 800)
+
+	revealBids(m)
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.EndSession(ctx, "s1")
+		return err
+	})
+
+	price := m.session("s1").priceFor("")
+	if price <= 8 || price >= 30 {
+		t.Fatalf("zone price = %d, want a price between the strikes", price)
+	}
+
+	// the hedger gains on the first forward and loses the whole margin of the second
+	first, second := m.forward(uncapped), m.forward(capped)
+	if first.Status != ForwardSettled || first.SettlementPrice != price || first.Payout != (price-8)*10 {
+		t.Errorf("uncapped forward = %+v, want a payout of %d", first, (price-8)*10)
+	}
+	if second.Status != ForwardSettled || second.Payout != -300 {
+		t.Errorf("capped forward = %+v, want a payout of -300", second)
+	}
+	if status := m.forward(proposed).Status; status != ForwardCancelled {
+		t.Errorf("proposed forward status = %v, want %v", status, ForwardCancelled)
+	}
+
+	payout := first.Payout + second.Payout
+	if account := m.collateral(trader); account.Balance != 10000-payout || account.Reserved != 0 {
+		t.Errorf("trader collateral = %+v, want a balance of %d and nothing reserved", account, 10000-payout)
+	}
+	if account := m.collateral(hedger); account.Balance != 10000+payout || account.Reserved != 0 {
+		t.Errorf("hedger collateral = %+v, want a balance of %d and nothing reserved", account, 10000+payout)
+	}
+
+	var valuation *MarkToMarket
+	err := m.ledger.Evaluate(hedger, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		valuation, err = contract.QueryMarkToMarket(ctx, "s1", capped)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (MarkToMarket{ForwardID: capped, ReferencePrice: price, Final: true, Value: -300}); *valuation != want {
+		t.Errorf("QueryMarkToMarket() of a settled forward = %+v, want %+v", *valuation, want)
+	}
+}
+
+func TestAdjustCollateral(t *testing.T) {
+	tests := []struct {
+		name          string
+		balanceDelta  int
+		reservedDelta int
+		wantErr       string
+	}{
+		{name: "credit", balanceDelta: 100, reservedDelta: 50},
+		{name: "whole balance", balanceDelta: -10000},
+		{name: "balance below zero", balanceDelta: -10001, wantErr: "collateral balance of " + trader.ID() + " cannot fall below zero: -1"},
+		{name: "reserved below zero", reservedDelta: -1, wantErr: "reserved collateral of " + trader.ID() + " cannot fall below zero: -1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			_, err := m.submit(admin, func(ctx contractapi.TransactionContextInterface) error {
+				return adjustCollateral(ctx, trader.ID(), tt.balanceDelta, tt.reservedDelta)
+			})
+			checkError(t, err, tt.wantErr)
+
+			want := CollateralAccount{Owner: trader.ID(), Balance: 10000, Reserved: 0}
+			if err == nil {
+				want.Balance += tt.balanceDelta
+				want.Reserved += tt.reservedDelta
+			}
+			if account := m.collateral(trader); *account != want {
+				t.Errorf("collateral = %+v, want %+v", *account, want)
+			}
+		})
+	}
+}
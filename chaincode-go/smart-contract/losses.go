@@ -0,0 +1,121 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// LossFactor is the share of the energy injected at a connection point that is
+// lost in transmission before it reaches the buyers
+type LossFactor struct {
+	ConnectionPoint string  `json:"connectionPoint"`
+	LossFactor      float64 `json:"lossFactor"`
+}
+
+const lossFactorKeyType = "lossFactor"
+
+const gridOperatorRole = "gridOperator"
+
+// SetLossFactor is used by the grid operator to maintain the loss factor of a
+// connection point. It applies to sessions that end after it was set
+func (s *SmartContract) SetLossFactor(ctx contractapi.TransactionContextInterface, connectionPoint string, lossFactor float64) error {
+
+	err := assertClientRole(ctx, gridOperatorRole)
+	if err != nil {
+		return err
+	}
+
+	if lossFactor < 0 || lossFactor >= 1 {
+		return fmt.Errorf("loss factor must be at least 0 and below 1")
+	}
+
+	lossFactorKey, err := ctx.GetStub().CreateCompositeKey(lossFactorKeyType, []string{connectionPoint})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	lossFactorBytes, err := json.Marshal(LossFactor{ConnectionPoint: connectionPoint, LossFactor: lossFactor})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(lossFactorKey, lossFactorBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put loss factor: %v", err)
+	}
+
+	return nil
+}
+
+// QueryLossFactor returns the loss factor of a connection point
+func (s *SmartContract) QueryLossFactor(ctx contractapi.TransactionContextInterface, connectionPoint string) (*LossFactor, error) {
+	return getLossFactor(ctx, connectionPoint)
+}
+
+// getLossFactor is an internal helper that reads the loss factor of a connection
+// point. Connection points without a loss factor are lossless
+func getLossFactor(ctx contractapi.TransactionContextInterface, connectionPoint string) (*LossFactor, error) {
+
+	lossFactorKey, err := ctx.GetStub().CreateCompositeKey(lossFactorKeyType, []string{connectionPoint})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	lossFactorBytes, err := ctx.GetStub().GetState(lossFactorKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loss factor: %v", err)
+	}
+	if lossFactorBytes == nil {
+		return &LossFactor{ConnectionPoint: connectionPoint}, nil
+	}
+
+	var lossFactor LossFactor
+	err = json.Unmarshal(lossFactorBytes, &lossFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lossFactor, nil
+}
+
+// getLossFactors is an internal helper that reads the loss factors of the
+// connection points of all sell bids
+func getLossFactors(ctx contractapi.TransactionContextInterface, bids map[string]FullBid) (map[string]float64, error) {
+
+	lossFactors := make(map[string]float64)
+	for _, bid := range bids {
+		if !bid.BidType.IsSell() || bid.ConnectionPoint == "" {
+			continue
+		}
+		if _, ok := lossFactors[bid.ConnectionPoint]; ok {
+			continue
+		}
+
+		lossFactor, err := getLossFactor(ctx, bid.ConnectionPoint)
+		if err != nil {
+			return nil, err
+		}
+		lossFactors[bid.ConnectionPoint] = lossFactor.LossFactor
+	}
+
+	return lossFactors, nil
+}
+
+// withdrawal returns the volume that reaches the buyers when volume is injected
+// with the given loss factor
+func withdrawal(volume int, lossFactor float64) int {
+	return int(math.Floor(float64(volume)*(1-lossFactor) + 1e-9))
+}
+
+// injection returns the volume that has to be injected with the given loss factor
+// so that the buyers can withdraw volume
+func injection(volume int, lossFactor float64) int {
+	return int(math.Ceil(float64(volume)/(1-lossFactor) - 1e-9))
+}
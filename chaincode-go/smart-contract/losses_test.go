@@ -0,0 +1,53 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestSetLossFactor(t *testing.T) {
+	tests := []struct {
+		name       string
+		client     *mockledger.Identity
+		lossFactor float64
+		wantErr    string
+		want       float64
+	}{
+		{name: "grid operator", client: grid, lossFactor: 0.05, want: 0.05},
+		{name: "lossless", client: grid, lossFactor: 0, want: 0},
+		{name: "not the grid operator", client: admin, lossFactor: 0.05, wantErr: "client is not authorized as gridOperator"},
+		{name: "negative", client: grid, lossFactor: -0.01, wantErr: "loss factor must be at least 0 and below 1"},
+		{name: "everything lost", client: grid, lossFactor: 1, wantErr: "loss factor must be at least 0 and below 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.SetLossFactor(ctx, "cp1", tt.lossFactor)
+			})
+			checkError(t, err, tt.wantErr)
+
+			// connection points without a loss factor are lossless
+			var lossFactor *LossFactor
+			err = m.ledger.Evaluate(seller, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				lossFactor, err = contract.QueryLossFactor(ctx, "cp1")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (LossFactor{ConnectionPoint: "cp1", LossFactor: tt.want}); *lossFactor != want {
+				t.Errorf("loss factor = %+v, want %+v", *lossFactor, want)
+			}
+		})
+	}
+}
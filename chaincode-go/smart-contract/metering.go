@@ -0,0 +1,262 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MeterReading is the metered net injection of a participant during the delivery
+// interval of a session. Injection is positive and withdrawal is negative.
+// Certified is the injection that certificates were issued for, per asset
+type MeterReading struct {
+	SessionID   string         `json:"sessionID"`
+	Participant string         `json:"participant"`
+	Volume      int            `json:"volume"`
+	MeteredBy   string         `json:"meteredBy"`
+	Certified   map[string]int `json:"certified,omitempty" metadata:"certified,optional"`
+}
+
+// Imbalance compares the metered net injection of a participant with the net
+// position cleared in the session. Amount is credited to the participant when
+// positive and debited when negative
+type Imbalance struct {
+	SessionID      string `json:"sessionID"`
+	Participant    string `json:"participant"`
+	Org            string `json:"org"`
+	Position       int    `json:"position"`
+	Metered        int    `json:"metered"`
+	Imbalance      int    `json:"imbalance"`
+	ImbalancePrice int    `json:"imbalancePrice"`
+	Amount         int    `json:"amount"`
+}
+
+const meterReadingKeyType = "meterReading"
+const imbalanceKeyType = "imbalance"
+
+const meteringRole = "meteringAgent"
+
+// SubmitMeterReading is used by a metering agent to record the net injection of
+// a participant during the delivery interval of an ended session. The imbalance
+// against the cleared position is calculated right away and priced at the zone
+// price of the participant, so that it is included when the session is settled
+func (s *SmartContract) SubmitMeterReading(ctx contractapi.TransactionContextInterface, sessionID string, participant string, volume int) error {
+
+	err := assertClientRole(ctx, meteringRole)
+	if err != nil {
+		return err
+	}
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if sessionJSON.Status != "ended" {
+		return fmt.Errorf("meter readings can only be submitted for an ended session")
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	reading := MeterReading{
+		SessionID:   sessionID,
+		Participant: participant,
+		Volume:      volume,
+		MeteredBy:   clientID,
+	}
+
+	// a corrected reading keeps the injection that was already certified
+	previous, err := getMeterReading(ctx, sessionID, participant)
+	if err != nil {
+		return err
+	}
+	if previous != nil {
+		reading.Certified = previous.Certified
+		if certified := reading.certifiedVolume(); volume < certified {
+			return fmt.Errorf("meter reading %d is below the injection of %d already certified", volume, certified)
+		}
+	}
+
+	err = putMeterReading(ctx, &reading)
+	if err != nil {
+		return err
+	}
+
+	imbalance := calculateImbalance(sessionID, sessionJSON, participant, volume)
+
+	imbalanceKey, err := ctx.GetStub().CreateCompositeKey(imbalanceKeyType, []string{sessionID, participant})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	imbalanceBytes, err := json.Marshal(imbalance)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(imbalanceKey, imbalanceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put imbalance: %v", err)
+	}
+
+	return nil
+}
+
+// QueryImbalances returns the imbalances calculated for a session
+func (s *SmartContract) QueryImbalances(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Imbalance, error) {
+	return getImbalances(ctx, sessionID)
+}
+
+// calculateImbalance compares a metered net injection with the net position of the
+// participant, which is the volume allocated to their sell bids minus the volume
+// allocated to their buy bids. A participant can bid in several zones, so the
+// imbalance is priced at the average of their zone prices weighted by allocated
+// volume, or by bid volume if nothing was allocated to them. A participant
+// without bids pays the clearing price. The bids are visited in key order, so
+// that every endorsing peer computes the same imbalance
+func calculateImbalance(sessionID string, sessionJSON *Session, participant string, metered int) *Imbalance {
+
+	imbalance := Imbalance{
+		SessionID:      sessionID,
+		Participant:    participant,
+		Metered:        metered,
+		ImbalancePrice: sessionJSON.ClearingPrice,
+	}
+
+	bidKeys := make([]string, 0, len(sessionJSON.FinalizedBids))
+	for bidKey, bid := range sessionJSON.FinalizedBids {
+		if bid.Bidder == participant {
+			bidKeys = append(bidKeys, bidKey)
+		}
+	}
+	sort.Strings(bidKeys)
+
+	allocatedValue, allocatedVolume := 0, 0
+	bidValue, bidVolume := 0, 0
+	for _, bidKey := range bidKeys {
+		bid := sessionJSON.FinalizedBids[bidKey]
+		if imbalance.Org == "" {
+			imbalance.Org = bid.Org
+		}
+
+		price := sessionJSON.priceFor(bid.Zone)
+		allocatedValue += bid.Allocated * price
+		allocatedVolume += bid.Allocated
+		bidValue += bid.Volume * price
+		bidVolume += bid.Volume
+
+		if bid.BidType.IsSell() {
+			imbalance.Position += bid.Allocated
+		}
+		if bid.BidType.IsBuy() {
+			imbalance.Position -= bid.Allocated
+		}
+	}
+
+	switch {
+	case allocatedVolume > 0:
+		imbalance.ImbalancePrice = allocatedValue / allocatedVolume
+	case bidVolume > 0:
+		imbalance.ImbalancePrice = bidValue / bidVolume
+	}
+
+	imbalance.Imbalance = imbalance.Metered - imbalance.Position
+	imbalance.Amount = imbalance.Imbalance * imbalance.ImbalancePrice
+
+	return &imbalance
+}
+
+// certifiedVolume returns the injection of a meter reading that certificates were
+// issued for
+func (r *MeterReading) certifiedVolume() int {
+	volume := 0
+	for _, certified := range r.Certified {
+		volume += certified
+	}
+	return volume
+}
+
+// getMeterReading is an internal helper that reads the meter reading of a
+// participant in a session. It returns nil if no reading was submitted
+func getMeterReading(ctx contractapi.TransactionContextInterface, sessionID string, participant string) (*MeterReading, error) {
+
+	readingKey, err := ctx.GetStub().CreateCompositeKey(meterReadingKeyType, []string{sessionID, participant})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	readingBytes, err := ctx.GetStub().GetState(readingKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get meter reading: %v", err)
+	}
+	if readingBytes == nil {
+		return nil, nil
+	}
+
+	var reading MeterReading
+	err = json.Unmarshal(readingBytes, &reading)
+	if err != nil {
+		return nil, err
+	}
+
+	return &reading, nil
+}
+
+// putMeterReading is an internal helper that writes a meter reading to state
+func putMeterReading(ctx contractapi.TransactionContextInterface, reading *MeterReading) error {
+
+	readingKey, err := ctx.GetStub().CreateCompositeKey(meterReadingKeyType, []string{reading.SessionID, reading.Participant})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	readingBytes, err := json.Marshal(reading)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(readingKey, readingBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put meter reading: %v", err)
+	}
+
+	return nil
+}
+
+// getImbalances is an internal helper that reads the imbalances of a session in
+// participant order
+func getImbalances(ctx contractapi.TransactionContextInterface, sessionID string) ([]*Imbalance, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(imbalanceKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get imbalances of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	imbalances := []*Imbalance{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var imbalance Imbalance
+		err = json.Unmarshal(queryResponse.Value, &imbalance)
+		if err != nil {
+			return nil, err
+		}
+		imbalances = append(imbalances, &imbalance)
+	}
+
+	return imbalances, nil
+}
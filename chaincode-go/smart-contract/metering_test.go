@@ -0,0 +1,148 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestCalculateImbalance(t *testing.T) {
+	session := &Session{
+		ClearingPrice: 30,
+		ZonePrices:    map[string]int{"north": 10, "south": 30},
+		FinalizedBids: map[string]FullBid{
+			"a": {BidType: Sell, Volume: 40, Zone: "north", Org: org1, Bidder: "seller", Allocated: 30},
+			"b": {BidType: Sell, Volume: 20, Zone: "south", Org: org1, Bidder: "seller", Allocated: 10},
+			"c": {BidType: Buy, Volume: 50, Zone: "south", Org: org2, Bidder: "buyer", Allocated: 40},
+			"d": {BidType: Buy, Volume: 30, Zone: "north", Org: org2, Bidder: "idle"},
+			"e": {BidType: Buy, Volume: 10, Zone: "south", Org: org2, Bidder: "idle"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		participant string
+		metered     int
+		want        Imbalance
+	}{
+		{
+			name:        "allocations in two zones",
+			participant: "seller",
+			metered:     36,
+			want:        Imbalance{Org: org1, Position: 40, Metered: 36, Imbalance: -4, ImbalancePrice: (30*10 + 10*30) / 40, Amount: -4 * 15},
+		},
+		{
+			name:        "buyer in one zone",
+			participant: "buyer",
+			metered:     -45,
+			want:        Imbalance{Org: org2, Position: -40, Metered: -45, Imbalance: -5, ImbalancePrice: 30, Amount: -150},
+		},
+		{
+			name:        "bids without allocation",
+			participant: "idle",
+			metered:     -8,
+			want:        Imbalance{Org: org2, Metered: -8, Imbalance: -8, ImbalancePrice: (30*10 + 10*30) / 40, Amount: -8 * 15},
+		},
+		{
+			name:        "participant without bids",
+			participant: "other",
+			metered:     5,
+			want:        Imbalance{Metered: 5, Imbalance: 5, ImbalancePrice: 30, Amount: 150},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.want.SessionID = "s1"
+			tt.want.Participant = tt.participant
+
+			// map order differs between runs, the imbalance must not
+			for i := 0; i < 20; i++ {
+				if got := calculateImbalance("s1", session, tt.participant, tt.metered); *got != tt.want {
+					t.Fatalf("calculateImbalance() = %+v, want %+v", *got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSubmitMeterReading(t *testing.T) {
+	tests := []struct {
+		name    string
+		ended   bool
+		client  *mockledger.Identity
+		wantErr string
+	}{
+		{name: "metering agent", ended: true, client: meter},
+		{name: "not a metering agent", ended: true, client: seller, wantErr: "client is not authorized as " + meteringRole},
+		{name: "session not ended", client: meter, wantErr: "meter readings can only be submitted for an ended session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			revealBids(m)
+			if tt.ended {
+				m.endSession("s1")
+			}
+
+			participant := seller.ID()
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.SubmitMeterReading(ctx, "s1", participant, 45)
+			})
+			checkError(t, err, tt.wantErr)
+
+			var imbalances []*Imbalance
+			err = m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				imbalances, err = contract.QueryImbalances(ctx, "s1")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != "" {
+				if len(imbalances) != 0 {
+					t.Errorf("imbalances = %+v, want none", imbalances)
+				}
+				return
+			}
+
+			want := Imbalance{SessionID: "s1", Participant: participant, Org: org1, Position: 50, Metered: 45, Imbalance: -5, ImbalancePrice: 10, Amount: -50}
+			if len(imbalances) != 1 || *imbalances[0] != want {
+				t.Errorf("imbalances = %+v, want %+v", imbalances, want)
+			}
+		})
+	}
+}
+
+func TestCorrectCertifiedMeterReading(t *testing.T) {
+	m := newMarket(t)
+	revealBids(m)
+	m.endSession("s1")
+	m.submitMeterReading(seller, 45)
+	m.mustSubmit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.IssueCertificate(ctx, "pv1", "s1", 30)
+		return err
+	})
+
+	participant := seller.ID()
+	_, err := m.submit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SubmitMeterReading(ctx, "s1", participant, 20)
+	})
+	checkError(t, err, "meter reading 20 is below the injection of 30 already certified")
+
+	// a correction keeps the certified injection, so only the rest can be certified
+	m.submitMeterReading(seller, 40)
+	_, err = m.submit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.IssueCertificate(ctx, "pv1", "s1", 15)
+		return err
+	})
+	checkError(t, err, "certificate volume 15 exceeds the uncertified injection metered in session s1: 10")
+}
@@ -0,0 +1,155 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/energy-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
+)
+
+// ClaimPayment releases escrowed funds to a seller of a settled session for the
+// volume the seller has delivered into the session pool of the energy ledger
+func (s *SmartContract) ClaimPayment(ctx contractapi.TransactionContextInterface, sessionID string) error {
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	if sessionJSON.Status != "settled" {
+		return fmt.Errorf("can only claim payments of a settled session")
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	invoice, err := s.QueryInvoice(ctx, sessionID, clientID)
+	if err != nil {
+		return err
+	}
+
+	obligation, err := energy.GetObligation(ctx, sessionID, clientID, energy.Deliver)
+	if err != nil {
+		return err
+	}
+	if obligation == nil {
+		return fmt.Errorf("client has no delivery obligation in session %v", sessionID)
+	}
+
+	// the seller earns the share of their energy credits that matches the share
+	// of the obligation they have delivered, so transmission losses stay with them
+	credits := 0
+	for _, line := range invoice.LineItems {
+		if line.Item == EnergyItem && line.BidType.IsSell() {
+			credits += line.Amount
+		}
+	}
+	earned := credits * obligation.Fulfilled / obligation.Volume
+
+	due := earned - invoice.Paid
+	if due <= 0 {
+		return fmt.Errorf("no payment due for delivered volume")
+	}
+
+	err = payment.ReleaseEscrow(ctx, sessionID, clientID, due)
+	if err != nil {
+		return fmt.Errorf("failed to release escrow: %v", err)
+	}
+
+	invoice.Paid += due
+
+	return putInvoice(ctx, invoice)
+}
+
+// RefundUndelivered returns the escrowed funds that were not paid out for
+// delivered volume to the buyers and completes the session. Only the admin can
+// refund a session, after the delivery period
+func (s *SmartContract) RefundUndelivered(ctx contractapi.TransactionContextInterface, sessionID string) error {
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if sessionJSON.Admin != clientID {
+		return fmt.Errorf("session can only be refunded by admin")
+	}
+
+	if sessionJSON.Status != "settled" {
+		return fmt.Errorf("can only refund a settled session")
+	}
+
+	err = payment.RefundEscrow(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to refund escrow: %v", err)
+	}
+
+	sessionJSON.Status = "completed"
+
+	completedSession, _ := json.Marshal(sessionJSON)
+
+	err = ctx.GetStub().PutState(sessionID, completedSession)
+	if err != nil {
+		return fmt.Errorf("failed to complete session: %v", err)
+	}
+
+	return nil
+}
+
+// settleBuyerEscrows leaves every buyer of an ended session with the payment for
+// its approved allocations in escrow, at their settlement price. The funds for
+// a buy bid are locked when it is revealed, at the bid's own price, so the part
+// that the allocations do not need is refunded. Bids that were revealed before
+// funds were locked at reveal have their payment locked now. Allocations are
+// added up per buyer because an escrow can only be written once per transaction
+func settleBuyerEscrows(ctx contractapi.TransactionContextInterface, sessionID string, sessionJSON *Session) error {
+
+	amounts := make(map[string]int)
+	for _, bid := range sessionJSON.FinalizedBids {
+		if bid.BidType.IsBuy() {
+			amounts[bid.Bidder] += bid.Allocated * bid.settlementPrice(sessionJSON)
+		}
+	}
+
+	buyers := make([]string, 0, len(amounts))
+	for buyer := range amounts {
+		buyers = append(buyers, buyer)
+	}
+	sort.Strings(buyers)
+
+	for _, buyer := range buyers {
+		escrow, err := payment.GetEscrow(ctx, sessionID, buyer)
+		if err != nil {
+			return err
+		}
+
+		locked := escrow.Remaining()
+		switch {
+		case amounts[buyer] > locked:
+			err = payment.LockEscrow(ctx, sessionID, buyer, amounts[buyer]-locked)
+		case amounts[buyer] < locked:
+			err = payment.RefundPayer(ctx, sessionID, buyer, locked-amounts[buyer])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
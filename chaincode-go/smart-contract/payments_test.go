@@ -0,0 +1,151 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/energy-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
+)
+
+// deliver lets the seller deliver volume into the pool of s1 on the energy token ledger
+func (m *market) deliver(volume int) {
+	m.t.Helper()
+
+	account := seller.ID()
+	m.mustSubmit(grid, func(ctx contractapi.TransactionContextInterface) error {
+		return new(energy.EnergyContract).Mint(ctx, account, volume)
+	})
+	m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		return new(energy.EnergyContract).FulfilObligation(ctx, "s1", energy.Deliver)
+	})
+}
+
+// claimPayment is a ClaimPayment transaction on s1
+func claimPayment(ctx contractapi.TransactionContextInterface) error {
+	return contract.ClaimPayment(ctx, "s1")
+}
+
+// tokens returns the payment token balance of a participant
+func (m *market) tokens(client *mockledger.Identity) int {
+	m.t.Helper()
+
+	var balance int
+	err := m.ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		balance, err = new(payment.PaymentContract).BalanceOf(ctx, client.ID())
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return balance
+}
+
+func TestClaimPayment(t *testing.T) {
+	tests := []struct {
+		name     string
+		settled  bool
+		setup    func(m *market)
+		client   *mockledger.Identity
+		wantErr  string
+		wantPaid int
+	}{
+		{name: "full delivery", settled: true, setup: func(m *market) { m.deliver(50) }, client: seller, wantPaid: 500},
+		{name: "partial delivery", settled: true, setup: func(m *market) { m.deliver(20) }, client: seller, wantPaid: 200},
+		{name: "nothing delivered", settled: true, client: seller, wantErr: "no payment due for delivered volume"},
+		{
+			name:    "claimed twice",
+			settled: true,
+			setup: func(m *market) {
+				m.deliver(50)
+				m.mustSubmit(seller, claimPayment)
+			},
+			client:   seller,
+			wantErr:  "no payment due for delivered volume",
+			wantPaid: 500,
+		},
+		{
+			name:    "more delivered after a claim",
+			settled: true,
+			setup: func(m *market) {
+				m.deliver(20)
+				m.mustSubmit(seller, claimPayment)
+				m.deliver(30)
+			},
+			client:   seller,
+			wantPaid: 500,
+		},
+		{name: "buyer", settled: true, client: buyer, wantErr: "client has no delivery obligation in session s1"},
+		{name: "participant without bids", settled: true, client: trader, wantErr: "no invoice for participant in session s1"},
+		{name: "session not settled", client: seller, wantErr: "can only claim payments of a settled session"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			revealBids(m)
+			m.endSession("s1")
+			if tt.settled {
+				m.settleSession("s1")
+			}
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+
+			_, err := m.submit(tt.client, claimPayment)
+			checkError(t, err, tt.wantErr)
+
+			if balance := m.tokens(seller); balance != tt.wantPaid {
+				t.Errorf("seller balance = %d, want %d", balance, tt.wantPaid)
+			}
+		})
+	}
+}
+
+func TestRefundUndelivered(t *testing.T) {
+	tests := []struct {
+		name       string
+		settled    bool
+		client     *mockledger.Identity
+		wantErr    string
+		wantBuyer  int
+		wantStatus string
+	}{
+		{name: "undelivered volume", settled: true, client: admin, wantBuyer: 5000 - 200, wantStatus: "completed"},
+		{name: "not the admin", settled: true, client: buyer, wantErr: "session can only be refunded by admin", wantBuyer: 5000 - 500, wantStatus: "settled"},
+		{name: "session not settled", client: admin, wantErr: "can only refund a settled session", wantBuyer: 5000 - 500, wantStatus: "ended"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			revealBids(m)
+			m.endSession("s1")
+			if tt.settled {
+				m.settleSession("s1")
+				m.deliver(20)
+				m.mustSubmit(seller, claimPayment)
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.RefundUndelivered(ctx, "s1")
+			})
+			checkError(t, err, tt.wantErr)
+
+			// the buyer pays for the 20 kWh that were delivered and gets the rest back
+			if balance := m.tokens(buyer); balance != tt.wantBuyer {
+				t.Errorf("buyer balance = %d, want %d", balance, tt.wantBuyer)
+			}
+			if status := m.session("s1").Status; status != tt.wantStatus {
+				t.Errorf("session status = %v, want %v", status, tt.wantStatus)
+			}
+		})
+	}
+}
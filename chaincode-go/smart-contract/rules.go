@@ -0,0 +1,95 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MarketRules are the bid limits of a session. A limit that is zero is not enforced
+type MarketRules struct {
+	MinVolume             int `json:"minVolume"`
+	MaxVolume             int `json:"maxVolume"`
+	PriceFloor            int `json:"priceFloor"`
+	PriceCap              int `json:"priceCap"`
+	TickSize              int `json:"tickSize"`
+	MaxBidsPerParticipant int `json:"maxBidsPerParticipant"`
+}
+
+// validate checks that the limits of the rules are consistent
+func (r *MarketRules) validate() error {
+
+	if r.MinVolume < 0 || r.MaxVolume < 0 || r.PriceFloor < 0 || r.PriceCap < 0 || r.TickSize < 0 || r.MaxBidsPerParticipant < 0 {
+		return fmt.Errorf("market rules cannot be negative")
+	}
+	if r.MaxVolume > 0 && r.MinVolume > r.MaxVolume {
+		return fmt.Errorf("minimum bid volume %d is above the maximum %d", r.MinVolume, r.MaxVolume)
+	}
+	if r.PriceCap > 0 && r.PriceFloor > r.PriceCap {
+		return fmt.Errorf("price floor %d is above the price cap %d", r.PriceFloor, r.PriceCap)
+	}
+
+	return nil
+}
+
+// checkBid checks the volume and price of a bid against the rules. bids is the
+// number of bids the bidder already has in the session
+func (r *MarketRules) checkBid(volume int, price int, bids int) error {
+
+	if volume < r.MinVolume {
+		return fmt.Errorf("bid volume %d is below the minimum of %d", volume, r.MinVolume)
+	}
+	if r.MaxVolume > 0 && volume > r.MaxVolume {
+		return fmt.Errorf("bid volume %d is above the maximum of %d", volume, r.MaxVolume)
+	}
+	if price < r.PriceFloor {
+		return fmt.Errorf("bid price %d is below the price floor of %d", price, r.PriceFloor)
+	}
+	if r.PriceCap > 0 && price > r.PriceCap {
+		return fmt.Errorf("bid price %d is above the price cap of %d", price, r.PriceCap)
+	}
+	if r.TickSize > 0 && price%r.TickSize != 0 {
+		return fmt.Errorf("bid price %d is not a multiple of the tick size %d", price, r.TickSize)
+	}
+	if r.MaxBidsPerParticipant > 0 && bids >= r.MaxBidsPerParticipant {
+		return fmt.Errorf("participant already has the maximum of %d bids in the session", r.MaxBidsPerParticipant)
+	}
+
+	return nil
+}
+
+// countReservations is an internal helper that counts the bids a participant has
+// placed in a session, using the collateral reserved for every bid
+func countReservations(ctx contractapi.TransactionContextInterface, sessionID string, owner string) (int, error) {
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(reservationKeyType, []string{sessionID})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get reservations of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	count := 0
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return 0, err
+		}
+
+		var reservation Reservation
+		err = json.Unmarshal(queryResponse.Value, &reservation)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create reservation object JSON: %v", err)
+		}
+
+		if reservation.Owner == owner {
+			count++
+		}
+	}
+
+	return count, nil
+}
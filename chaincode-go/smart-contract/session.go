@@ -11,6 +11,7 @@ import (
 	"fmt"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
 )
 
 type SmartContract struct {
@@ -24,15 +25,31 @@ type Session struct {
 	PrivateBids  	map[string]BidHash `json:"privateBids"`
 	FinalizedBids 	map[string]FullBid `json:"finalizedBids"`
 	Status       	string             `json:"status"`
+	Config       	MarketConfig       `json:"config"`
+	ClearingPrice	int                `json:"clearingPrice"`
+	Interconnectors	[]Interconnector   `json:"interconnectors,omitempty" metadata:"interconnectors,optional"`
+	ZonePrices   	map[string]int     `json:"zonePrices,omitempty" metadata:"zonePrices,optional"`
+	Flows        	[]Flow             `json:"flows,omitempty" metadata:"flows,optional"`
 }
 
 // FullBid is the structure of a revealed bid
 type FullBid struct {
 	BidType     BidType `json:"bidType"`
 	Volume    	int    	`json:"volume"`
+	Price    	int    	`json:"price"`
+	Zone     	string 	`json:"zone,omitempty" metadata:"zone,optional"`
+	ConnectionPoint	string	`json:"connectionPoint,omitempty" metadata:"connectionPoint,optional"`
+	AssetID  	string 	`json:"assetID,omitempty" metadata:"assetID,optional"`
+	Green    	bool   	`json:"green,omitempty" metadata:"green,optional"`
+	SourceType	string	`json:"sourceType,omitempty" metadata:"sourceType,optional"`
+	CarbonIntensity	int	`json:"carbonIntensity,omitempty" metadata:"carbonIntensity,optional"`
 	Org      	string 	`json:"org"`
 	Bidder   	string 	`json:"bidder"`
 	Status      string  `json:"status"`
+	Allocated   int     `json:"allocatedVolume"`
+	LossFactor  float64 `json:"lossFactor,omitempty" metadata:"lossFactor,optional"`
+	Delivered   int     `json:"deliveredVolume"`
+	SettlementPrice	int	`json:"settlementPrice"`
 }
 
 // BidHash is the structure of a private bid
@@ -47,11 +64,23 @@ const(
 	Buy = "buy"
 )
 
+// IsSell reports whether the bid offers volume to the session
+func (t BidType) IsSell() bool {
+	return t == "sell" || t == "Sell"
+}
+
+// IsBuy reports whether the bid requests volume from the session
+func (t BidType) IsBuy() bool {
+	return t == "buy" || t == "Buy"
+}
+
 const bidKeyType = "bid"
 
 // CreateSession creates on session on the public channel. The identity that
-// submits the transacion becomes the admin of the session
-func (s *SmartContract) CreateSession(ctx contractapi.TransactionContextInterface, sessionID string) error {
+// submits the transacion becomes the admin of the session. The session runs
+// under the latest version of the market config, or the default config if no
+// config ID is given
+func (s *SmartContract) CreateSession(ctx contractapi.TransactionContextInterface, sessionID string, configID string) error {
 
 	// get ID of submitting client
 	clientID, err := ctx.GetClientIdentity().GetID()
@@ -65,6 +94,15 @@ func (s *SmartContract) CreateSession(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to get client identity %v", err)
 	}
 
+	config := defaultMarketConfig
+	if configID != "" {
+		latest, err := s.QueryMarketConfig(ctx, configID, 0)
+		if err != nil {
+			return err
+		}
+		config = *latest
+	}
+
 	// Create session
 	bidders := make(map[string]BidHash)
 	finalizedBids := make(map[string]FullBid)
@@ -75,6 +113,7 @@ func (s *SmartContract) CreateSession(ctx contractapi.TransactionContextInterfac
 		PrivateBids:  	bidders,
 		FinalizedBids: 	finalizedBids,
 		Status:     	"Open",
+		Config:     	config,
 	}
 
 	sessionBytes, err := json.Marshal(session)
@@ -94,7 +133,7 @@ func (s *SmartContract) CreateSession(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 	}
 
-	return nil
+	return setSessionEvent(ctx, SessionCreatedEvent, &SessionEvent{SessionID: sessionID, Status: session.Status})
 }
 
 // Bid is used to add a user's bid to the session. The bid is stored in the private
@@ -125,6 +164,54 @@ func (s *SmartContract) Bid(ctx contractapi.TransactionContextInterface, session
 		return "", fmt.Errorf("Cannot store bid on this peer, not a member of this org: Error %v", err)
 	}
 
+	var bidInput FullBid
+	err = json.Unmarshal(BidJSON, &bidInput)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if bidInput.Volume <= 0 || bidInput.Price <= 0 {
+		return "", fmt.Errorf("bid volume and price must be positive")
+	}
+
+	// the exposure of the bid must not overflow, or its reveal would reserve too little collateral
+	exposure := bidInput.Volume * bidInput.Price
+	if exposure/bidInput.Price != bidInput.Volume {
+		return "", fmt.Errorf("bid exposure of volume %d at price %d is too large", bidInput.Volume, bidInput.Price)
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	// a bid cannot offer or request more than the capacity of its asset
+	err = checkBidAsset(ctx, &bidInput, clientID, 0)
+	if err != nil {
+		return "", err
+	}
+
+	// the bid has to respect the market rules of the session
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	if sessionJSON.Status != "Open" {
+		return "", fmt.Errorf("cannot bid in a session that is not open")
+	}
+
+	bids, err := countReservations(ctx, sessionID, clientID)
+	if err != nil {
+		return "", err
+	}
+
+	err = sessionJSON.Config.Rules.checkBid(bidInput.Volume, bidInput.Price, bids)
+	if err != nil {
+		return "", err
+	}
+
 	// the session ID is used as a unique index for the bid
 	txID := ctx.GetStub().GetTxID()
 
@@ -134,6 +221,14 @@ func (s *SmartContract) Bid(ctx contractapi.TransactionContextInterface, session
 		return "", fmt.Errorf("failed to create composite key: %v", err)
 	}
 
+	// a sealed bid only locks the deposit of the session, so that its public
+	// reservation does not disclose its volume or price. The exposure of a sell
+	// bid is reserved when the bid is revealed
+	err = reserveCollateral(ctx, sessionID, txID, bidKey, clientID, sessionJSON.Config.bidDeposit())
+	if err != nil {
+		return "", err
+	}
+
 	// put the bid into the organization's implicit data collection
 	err = ctx.GetStub().PutPrivateData(collection, bidKey, BidJSON)
 	if err != nil {
@@ -155,6 +250,12 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, s
 		return fmt.Errorf("failed to get client MSP ID: %v", err)
 	}
 
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
 	// get the session from state
 	sessionBytes, err := ctx.GetStub().GetState(sessionID)
 	var sessionJSON Session
@@ -194,6 +295,15 @@ func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface, s
 		return fmt.Errorf("bid hash does not exist: %s", bidKey)
 	}
 
+	// only bids backed by collateral can be added to the session
+	reservation, err := getReservation(ctx, sessionID, txID)
+	if err != nil {
+		return err
+	}
+	if reservation.Owner != clientID {
+		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
+	}
+
 	// store the hash along with the bidder's organization
 	NewHash := BidHash{
 		Org:  clientOrgID,
@@ -323,6 +433,13 @@ func (s *SmartContract) FinalizeBid(ctx contractapi.TransactionContextInterface,
 	type transientBidInput struct {
 		BidType	 BidType `json:"bidType"`
 		Volume   int    `json:"volume"`
+		Price    int    `json:"price"`
+		Zone     string `json:"zone"`
+		ConnectionPoint string `json:"connectionPoint"`
+		AssetID  string `json:"assetID"`
+		Green    bool   `json:"green"`
+		SourceType string `json:"sourceType"`
+		CarbonIntensity int `json:"carbonIntensity"`
 		Org      string `json:"org"`
 		Bidder   string `json:"bidder"`
 	}
@@ -344,6 +461,13 @@ func (s *SmartContract) FinalizeBid(ctx contractapi.TransactionContextInterface,
 	NewBid := FullBid{
 		BidType:  bidInput.BidType,
 		Volume:   bidInput.Volume,
+		Price:    bidInput.Price,
+		Zone:     bidInput.Zone,
+		ConnectionPoint: bidInput.ConnectionPoint,
+		AssetID:  bidInput.AssetID,
+		Green:    bidInput.Green,
+		SourceType: bidInput.SourceType,
+		CarbonIntensity: bidInput.CarbonIntensity,
 		Org:      bidInput.Org,
 		Bidder:   bidInput.Bidder,
 		Status:	  "Finalized",
@@ -354,6 +478,75 @@ func (s *SmartContract) FinalizeBid(ctx contractapi.TransactionContextInterface,
 		return fmt.Errorf("Permission denied, client id %v is not the owner of the bid", clientID)
 	}
 
+	// check 5: a certified sell bid has to be covered by the certificates of the
+	// bidder that are not pledged to the bidder's other certified sell bids. Its
+	// volume stays pledged until the session is settled
+	if NewBid.Green && NewBid.BidType.IsSell() {
+		err = pledgeCertificates(ctx, sessionID, txID, clientID, NewBid.Volume)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check 6: the bid, together with the bids already revealed for the same
+	// asset, cannot exceed the capacity of the asset in the session interval
+	committed := 0
+	for key, bid := range sessionJSON.FinalizedBids {
+		if key != bidKey && bid.AssetID != "" && bid.AssetID == NewBid.AssetID {
+			committed += bid.Volume
+		}
+	}
+	err = checkBidAsset(ctx, &NewBid, clientID, committed)
+	if err != nil {
+		return err
+	}
+	if NewBid.AssetID != "" {
+		err = commitAssetVolume(ctx, &AssetCommitment{AssetID: NewBid.AssetID, SessionID: sessionID, TxID: txID, Volume: NewBid.Volume})
+		if err != nil {
+			return err
+		}
+	}
+
+	// check 7: the revealed bid has to respect the market rules of the session
+	bids := 0
+	for key, bid := range sessionJSON.FinalizedBids {
+		if key != bidKey && bid.Bidder == clientID {
+			bids++
+		}
+	}
+	err = sessionJSON.Config.Rules.checkBid(NewBid.Volume, NewBid.Price, bids)
+	if err != nil {
+		return err
+	}
+
+	// check 8: carbon intensity is reported for generation only
+	if NewBid.CarbonIntensity < 0 {
+		return fmt.Errorf("carbon intensity cannot be negative")
+	}
+	if NewBid.CarbonIntensity > 0 && !NewBid.BidType.IsSell() {
+		return fmt.Errorf("carbon intensity can only be set on sell bids")
+	}
+
+	// check 9: a sell bid has to be backed by collateral for its delivery risk of
+	// volume × price, which replaces the deposit it locked while it was sealed.
+	// A buy bid keeps its deposit, as its payment is locked in escrow instead
+	if NewBid.BidType.IsSell() {
+		err = reserveExposure(ctx, sessionID, txID, clientID, NewBid.Volume*NewBid.Price)
+		if err != nil {
+			return err
+		}
+	}
+
+	// check 10: a buy bid has to be funded. Its payment at the bid's price is
+	// locked in escrow now, so that a buyer that cannot pay is left out of the
+	// clearing instead of keeping the session from ending
+	if NewBid.BidType.IsBuy() {
+		err = payment.LockEscrow(ctx, sessionID, clientID, NewBid.Volume*NewBid.Price)
+		if err != nil {
+			return err
+		}
+	}
+
 	finalizedBids := make(map[string]FullBid)
 	finalizedBids = sessionJSON.FinalizedBids
 	finalizedBids[bidKey] = NewBid
@@ -416,26 +609,27 @@ func (s *SmartContract) CloseSession(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed to close session: %v", err)
 	}
 
-	return nil
+	return setSessionEvent(ctx, SessionClosedEvent, &SessionEvent{SessionID: sessionID, Status: sessionJSON.Status})
 }
 
 // EndSession both changes the session status to Finalized and calculates the winners
-// of the session
-func (s *SmartContract) EndSession(ctx contractapi.TransactionContextInterface, sessionID string) error {
+// of the session. Bids are cleared per bidding zone, coupled by the transmission
+// capacities of the session, and the zone prices and cross-zone flows are returned
+func (s *SmartContract) EndSession(ctx contractapi.TransactionContextInterface, sessionID string) (*ClearingResult, error) {
 
 	sessionBytes, err := ctx.GetStub().GetState(sessionID)
 	if err != nil {
-		return fmt.Errorf("failed to get session %v: %v", sessionID, err)
+		return nil, fmt.Errorf("failed to get session %v: %v", sessionID, err)
 	}
 
 	if sessionBytes == nil {
-		return fmt.Errorf("Session interest object %v not found", sessionID)
+		return nil, fmt.Errorf("Session interest object %v not found", sessionID)
 	}
 
 	var sessionJSON Session
 	err = json.Unmarshal(sessionBytes, &sessionJSON)
 	if err != nil {
-		return fmt.Errorf("failed to create session object JSON: %v", err)
+		return nil, fmt.Errorf("failed to create session object JSON: %v", err)
 	}
 
 	// Check that the session is being ended by the admin
@@ -443,87 +637,116 @@ func (s *SmartContract) EndSession(ctx contractapi.TransactionContextInterface,
 	// get ID of submitting client
 	clientID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
-		return fmt.Errorf("failed to get client identity %v", err)
+		return nil, fmt.Errorf("failed to get client identity %v", err)
 	}
 
 	Admin := sessionJSON.Admin
 	if Admin != clientID {
-		return fmt.Errorf("session can only be ended by admin: %v", err)
+		return nil, fmt.Errorf("session can only be ended by admin: %v", err)
 	}
 
 	Status := sessionJSON.Status
 	if Status != "Close" {
-		return fmt.Errorf("Can only end a closed session")
+		return nil, fmt.Errorf("Can only end a closed session")
 	}
 
 	// get the list of revealed bids
 	revealedBidMap := sessionJSON.FinalizedBids
 	if len(sessionJSON.FinalizedBids) == 0 {
-		return fmt.Errorf("No bids have been revealed, cannot end session: %v", err)
+		return nil, fmt.Errorf("No bids have been revealed, cannot end session: %v", err)
 	}
 
-	var totalSell, totalBuy int
-	// approve or decline bids
-	for _, bid := range revealedBidMap {
-		if bid.BidType == "sell" || bid.BidType == "Sell" {
-			totalSell += bid.Volume
-		}
+	// sell bids lose part of their volume on the way to the buyers
+	lossFactors, err := getLossFactors(ctx, revealedBidMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get loss factors: %v", err)
+	}
 
-		if bid.BidType == "buy" || bid.BidType == "Buy" {
-			totalBuy += bid.Volume
-		}
+	// clear the bids with the algorithm of the session's market config
+	algorithm, err := clearingAlgorithmFor(sessionJSON.Config.ClearingAlgorithm)
+	if err != nil {
+		return nil, err
 	}
 
+	allocations, result := algorithm.Clear(ClearingInput{
+		Bids:            revealedBidMap,
+		Config:          sessionJSON.Config,
+		Interconnectors: sessionJSON.Interconnectors,
+		LossFactors:     lossFactors,
+	})
+
 	for bidKey, bid := range revealedBidMap {
-		if bid.BidType == "sell" || bid.BidType == "Sell" {
-			if bid.Volume < totalBuy {
-				totalBuy = totalBuy - bid.Volume
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}			
-			}else if totalBuy != 0 {
-				totalBuy -= totalBuy
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Partially Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}
-			}else {
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Not Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}
-			}
+		allocated, ok := allocations[bidKey]
+		if !ok {
+			continue
 		}
-		if bid.BidType == "buy" || bid.BidType == "Buy" {
-			if bid.Volume < totalSell {
-				totalSell = totalSell - bid.Volume
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}				
-			}else if totalSell != 0 {
-				totalSell -= totalSell
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Partially Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}
-			}else {
-				err = UpdateStatus(ctx,sessionID,sessionJSON, bid,"Not Approved",bidKey)
-				if err != nil {
-					return fmt.Errorf("failed to update session: %v", err)
-				}
-			}
+		bid.LossFactor = allocated.LossFactor
+		bid.Delivered = allocated.Delivered
+		bid.SettlementPrice = allocated.Price
+		err = UpdateStatus(ctx,sessionID,sessionJSON, bid,allocated.Status,allocated.Volume,bidKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update session: %v", err)
 		}
 	}
 
+	sessionJSON.ClearingPrice = result.ClearingPrice
+	sessionJSON.ZonePrices = result.ZonePrices
+	sessionJSON.Flows = result.Flows
+
+	// the buyers' funds are held in escrow until the sellers have delivered
+	err = settleBuyerEscrows(ctx, sessionID, &sessionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to escrow buyer funds: %v", err)
+	}
+
+	// collateral that does not back an allocation is available again
+	adjustments := newCollateralAdjustments()
+	err = releaseSessionReservations(ctx, sessionID, sessionJSON.FinalizedBids, adjustments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release collateral: %v", err)
+	}
+
+	// certificates pledged beyond the delivered green volume are free again
+	err = releaseSessionPledges(ctx, sessionID, sessionJSON.FinalizedBids, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release certificates: %v", err)
+	}
+
+	// the capacity of the assets of the session can be lowered again
+	err = releaseAssetCommitments(ctx, sessionID, sessionJSON.FinalizedBids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release assets: %v", err)
+	}
+
+	// forward contracts on the session settle the difference to the new prices
+	err = settleForwards(ctx, sessionID, &sessionJSON, adjustments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to settle forwards: %v", err)
+	}
+
+	err = adjustments.apply(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update collateral: %v", err)
+	}
+
 	sessionJSON.Status = string("ended")
 
 	FinalizedTransaction, _ := json.Marshal(sessionJSON)
 
 	err = ctx.GetStub().PutState(sessionID, FinalizedTransaction)
 	if err != nil {
-		return fmt.Errorf("failed to end session: %v", err)
+		return nil, fmt.Errorf("failed to end session: %v", err)
 	}
-	return nil
+
+	err = setSessionEvent(ctx, SessionEndedEvent, &SessionEvent{
+		SessionID:   sessionID,
+		Status:      sessionJSON.Status,
+		Result:      result,
+		Allocations: bidAllocations(sessionJSON.FinalizedBids),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
@@ -30,6 +30,26 @@ func (s *SmartContract) QuerySession(ctx contractapi.TransactionContextInterface
 	return session, nil
 }
 
+// getSession is an internal helper that reads a session from public state
+func getSession(ctx contractapi.TransactionContextInterface, sessionID string) (*Session, error) {
+
+	sessionBytes, err := ctx.GetStub().GetState(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session %v: %v", sessionID, err)
+	}
+	if sessionBytes == nil {
+		return nil, fmt.Errorf("Session interest object %v not found", sessionID)
+	}
+
+	var sessionJSON Session
+	err = json.Unmarshal(sessionBytes, &sessionJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session object JSON: %v", err)
+	}
+
+	return &sessionJSON, nil
+}
+
 // QueryBid allows the submitter of the bid to read their bid from public state
 func (s *SmartContract) QueryBid(ctx contractapi.TransactionContextInterface, sessionID string, txID string) (*FullBid, error) {
 
@@ -88,14 +108,10 @@ func (s *SmartContract) GetID(ctx contractapi.TransactionContextInterface) (stri
 }
 
 // Internal call to update status of bids
-func UpdateStatus(ctx contractapi.TransactionContextInterface,sessionID string,sessionJSON Session, bid FullBid, status string, bidKey string) error {
-	NewBid := FullBid{
-		BidType:  bid.BidType,
-		Volume:   bid.Volume,
-		Org:      bid.Org,
-		Bidder:   bid.Bidder,
-		Status:	  status,
-	}
+func UpdateStatus(ctx contractapi.TransactionContextInterface,sessionID string,sessionJSON Session, bid FullBid, status string, allocated int, bidKey string) error {
+	NewBid := bid
+	NewBid.Status = status
+	NewBid.Allocated = allocated
 	
 	revealedBids := make(map[string]FullBid)
 	revealedBids = sessionJSON.FinalizedBids
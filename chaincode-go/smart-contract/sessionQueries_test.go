@@ -0,0 +1,148 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestQuerySession(t *testing.T) {
+	tests := []struct {
+		name      string
+		sessionID string
+		wantErr   string
+	}{
+		{name: "existing session", sessionID: "s1"},
+		{name: "unknown session", sessionID: "s9", wantErr: "session does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+
+			var session *Session
+			err := m.ledger.Evaluate(buyer, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				session, err = contract.QuerySession(ctx, tt.sessionID)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(session, m.session(tt.sessionID)) {
+				t.Errorf("QuerySession() = %+v, want %+v", session, m.session(tt.sessionID))
+			}
+		})
+	}
+}
+
+func TestQueryBid(t *testing.T) {
+	bid := sellBid(seller, "pv1", 50, 10)
+
+	tests := []struct {
+		name    string
+		client  *mockledger.Identity
+		txID    string
+		options []mockledger.Option
+		wantErr string
+	}{
+		{
+			name:   "own bid",
+			client: seller,
+		},
+		{
+			name:    "peer of another org",
+			client:  seller,
+			options: []mockledger.Option{mockledger.WithPeerOrg(org2)},
+			wantErr: "is not authorized to read or write private data",
+		},
+		{
+			name:    "unknown bid",
+			client:  seller,
+			txID:    "tx999999",
+			wantErr: "does not exist",
+		},
+		{
+			name:    "bid of another client of the org",
+			client:  trader,
+			wantErr: "is not the owner of the bid",
+		},
+		{
+			name:    "bid of another org",
+			client:  buyer,
+			wantErr: "does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			txID := m.placeBid(seller, "s1", bid)
+			if tt.txID != "" {
+				txID = tt.txID
+			}
+
+			var got *FullBid
+			err := m.ledger.Evaluate(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				got, err = contract.QueryBid(ctx, "s1", txID)
+				return err
+			}, tt.options...)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(*got, bid) {
+				t.Errorf("QueryBid() = %+v, want %+v", *got, bid)
+			}
+		})
+	}
+}
+
+func TestGetID(t *testing.T) {
+	m := newMarket(t)
+
+	for _, client := range []*mockledger.Identity{seller, buyer} {
+		var id string
+		err := m.ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			id, err = contract.GetID(ctx)
+			return err
+		})
+		checkError(t, err, "")
+
+		if id != client.ID() {
+			t.Errorf("GetID() of %v = %v, want %v", client.Name, id, client.ID())
+		}
+	}
+}
+
+func TestUpdateStatus(t *testing.T) {
+	m := newMarket(t)
+	bid := sellBid(seller, "pv1", 50, 10)
+	txID := m.placeAndSubmitBid(seller, "s1", bid)
+	m.closeSession("s1")
+	m.finalizeBid(seller, "s1", txID, bid)
+
+	session := m.session("s1")
+	key := bidKey("s1", txID)
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		return UpdateStatus(ctx, "s1", *session, session.FinalizedBids[key], "partial", 30, key)
+	})
+
+	want := bid
+	want.Status = "partial"
+	want.Allocated = 30
+	if got := m.session("s1").FinalizedBids[key]; !reflect.DeepEqual(got, want) {
+		t.Errorf("bid = %+v, want %+v", got, want)
+	}
+}
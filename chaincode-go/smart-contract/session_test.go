@@ -0,0 +1,1105 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
+)
+
+const (
+	org1 = "Org1MSP"
+	org2 = "Org2MSP"
+)
+
+var contract = new(SmartContract)
+
+var (
+	admin    = mockledger.NewIdentity("admin", org1)
+	operator = mockledger.NewIdentity("operator", org1).WithAttribute(roleAttribute, operatorRole)
+	issuer   = mockledger.NewIdentity("issuer", org1).WithAttribute(roleAttribute, "paymentIssuer")
+	meter    = mockledger.NewIdentity("meter", org1).WithAttribute(roleAttribute, meteringRole)
+	grid     = mockledger.NewIdentity("grid", org1).WithAttribute(roleAttribute, gridOperatorRole)
+	seller   = mockledger.NewIdentity("seller", org1)
+	trader   = mockledger.NewIdentity("trader", org1)
+	buyer    = mockledger.NewIdentity("buyer", org2)
+)
+
+// transaction is a call of the contract in a transaction context
+type transaction = func(ctx contractapi.TransactionContextInterface) error
+
+// market is a ledger with an open session s1. The seller owns the 100 kWh
+// generation asset pv1, and every participant has 10000 of collateral
+type market struct {
+	t      *testing.T
+	ledger *mockledger.Ledger
+}
+
+func newMarket(t *testing.T) *market {
+	t.Helper()
+
+	m := &market{t: t, ledger: mockledger.New(time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC))}
+
+	for _, participant := range []*mockledger.Identity{seller, trader, buyer} {
+		owner := participant.ID()
+		m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+			return contract.DepositCollateral(ctx, owner, 10000)
+		})
+	}
+	m.mustSubmit(seller, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.RegisterAsset(ctx, "pv1", Generation, "solar", true, 100, 0, "")
+	})
+	m.createSession("s1", "")
+
+	return m
+}
+
+// submit runs a transaction of the client on the ledger
+func (m *market) submit(client *mockledger.Identity, fn transaction, options ...mockledger.Option) (string, error) {
+	return m.ledger.Submit(client, fn, options...)
+}
+
+// mustSubmit runs a transaction of the client and fails the test if it fails
+func (m *market) mustSubmit(client *mockledger.Identity, fn transaction, options ...mockledger.Option) string {
+	m.t.Helper()
+
+	txID, err := m.ledger.Submit(client, fn, options...)
+	if err != nil {
+		m.t.Fatalf("transaction %v failed: %v", txID, err)
+	}
+
+	return txID
+}
+
+func (m *market) createSession(sessionID string, configID string) {
+	m.t.Helper()
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CreateSession(ctx, sessionID, configID)
+	})
+}
+
+func (m *market) closeSession(sessionID string) {
+	m.t.Helper()
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.CloseSession(ctx, sessionID)
+	})
+}
+
+// placeBid stores a bid of the client in the private data of its organization
+// and returns the ID of the bid
+func (m *market) placeBid(client *mockledger.Identity, sessionID string, bid FullBid) string {
+	m.t.Helper()
+	return m.mustSubmit(client, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.Bid(ctx, sessionID)
+		return err
+	}, mockledger.WithTransient(bidTransient(bid)))
+}
+
+func (m *market) submitBid(client *mockledger.Identity, sessionID string, txID string) {
+	m.t.Helper()
+	m.mustSubmit(client, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SubmitBid(ctx, sessionID, txID)
+	})
+}
+
+// placeAndSubmitBid places a bid and adds its hash to the session
+func (m *market) placeAndSubmitBid(client *mockledger.Identity, sessionID string, bid FullBid) string {
+	m.t.Helper()
+	txID := m.placeBid(client, sessionID, bid)
+	m.submitBid(client, sessionID, txID)
+	return txID
+}
+
+func (m *market) finalizeBid(client *mockledger.Identity, sessionID string, txID string, bid FullBid) {
+	m.t.Helper()
+	m.mustSubmit(client, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.FinalizeBid(ctx, sessionID, txID)
+	}, mockledger.WithTransient(bidTransient(bid)))
+}
+
+// session returns the committed state of a session
+func (m *market) session(sessionID string) *Session {
+	m.t.Helper()
+
+	var session *Session
+	err := m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		session, err = getSession(ctx, sessionID)
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return session
+}
+
+// collateral returns the collateral account of a participant
+func (m *market) collateral(client *mockledger.Identity) *CollateralAccount {
+	m.t.Helper()
+
+	var account *CollateralAccount
+	err := m.ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		account, err = contract.QueryCollateral(ctx, client.ID())
+		return err
+	})
+	if err != nil {
+		m.t.Fatal(err)
+	}
+
+	return account
+}
+
+// updateSession writes a session changed by update to state, bypassing the
+// checks of the contract
+func (m *market) updateSession(sessionID string, update func(session *Session)) {
+	m.t.Helper()
+
+	session := m.session(sessionID)
+	update(session)
+
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		sessionBytes, _ := json.Marshal(session)
+		return ctx.GetStub().PutState(sessionID, sessionBytes)
+	})
+}
+
+// putPrivateBid writes a bid to the collection of the client's organization,
+// bypassing the checks of the contract
+func (m *market) putPrivateBid(client *mockledger.Identity, sessionID string, txID string, bidJSON []byte) {
+	m.t.Helper()
+	m.mustSubmit(client, func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().PutPrivateData("_implicit_org_"+client.MSPID, bidKey(sessionID, txID), bidJSON)
+	})
+}
+
+// publishConfig publishes a market config with the rules of the default config
+func (m *market) publishConfig(configID string, rules MarketRules) {
+	m.t.Helper()
+
+	config := defaultMarketConfig
+	config.Rules = rules
+	configJSON, _ := json.Marshal(config)
+
+	m.mustSubmit(operator, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.PublishMarketConfig(ctx, configID, string(configJSON))
+		return err
+	})
+}
+
+// fund mints payment tokens to a participant
+func (m *market) fund(client *mockledger.Identity, amount int) {
+	m.t.Helper()
+
+	account := client.ID()
+	m.mustSubmit(issuer, func(ctx contractapi.TransactionContextInterface) error {
+		return new(payment.PaymentContract).Mint(ctx, account, amount)
+	})
+}
+
+func sellBid(client *mockledger.Identity, assetID string, volume int, price int) FullBid {
+	return FullBid{BidType: Sell, Volume: volume, Price: price, AssetID: assetID, Org: client.MSPID, Bidder: client.ID()}
+}
+
+func buyBid(client *mockledger.Identity, volume int, price int) FullBid {
+	return FullBid{BidType: Buy, Volume: volume, Price: price, Org: client.MSPID, Bidder: client.ID()}
+}
+
+func bidTransient(bid FullBid) map[string][]byte {
+	bidJSON, _ := json.Marshal(bid)
+	return map[string][]byte{"bid": bidJSON}
+}
+
+func bidKey(sessionID string, txID string) string {
+	key, _ := shim.CreateCompositeKey(bidKeyType, []string{sessionID, txID})
+	return key
+}
+
+// checkError fails the test if err does not contain want, or if err is not
+// nil when want is empty
+func checkError(t *testing.T, err error, want string) {
+	t.Helper()
+
+	if want == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("error = nil, want %q", want)
+	}
+	if !strings.Contains(err.Error(), want) {
+		t.Fatalf("error = %q, want %q", err, want)
+	}
+}
+
+func TestCreateSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      func(m *market)
+		configID   string
+		wantConfig MarketConfig
+		wantErr    string
+	}{
+		{
+			name:       "default config",
+			wantConfig: defaultMarketConfig,
+		},
+		{
+			name: "latest version of config",
+			setup: func(m *market) {
+				m.publishConfig("strict", MarketRules{MaxVolume: 10})
+				m.publishConfig("strict", MarketRules{MaxVolume: 50})
+			},
+			configID: "strict",
+			wantConfig: MarketConfig{
+				ConfigID: "strict", Version: 2, ClearingAlgorithm: VolumeNetting, AllocationRule: Sequential,
+				Rules: MarketRules{MaxVolume: 50}, Currency: "EUR", Unit: "kWh",
+			},
+		},
+		{
+			name:     "unknown config",
+			configID: "missing",
+			wantErr:  "market config missing does not exist",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+
+			_, err := m.submit(admin, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CreateSession(ctx, "s2", tt.configID)
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			session := m.session("s2")
+			want := &Session{
+				Admin:         admin.ID(),
+				Orgs:          []string{org1},
+				PrivateBids:   map[string]BidHash{},
+				FinalizedBids: map[string]FullBid{},
+				Status:        "Open",
+				Config:        tt.wantConfig,
+			}
+			if !reflect.DeepEqual(session, want) {
+				t.Errorf("session = %+v, want %+v", session, want)
+			}
+
+			orgs, _ := m.ledger.EndorsingOrgs("s2")
+			if !reflect.DeepEqual(orgs, []string{org1}) {
+				t.Errorf("endorsing orgs = %v, want [%v]", orgs, org1)
+			}
+		})
+	}
+}
+
+func TestBid(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(m *market)
+		client    *mockledger.Identity
+		sessionID string
+		transient map[string][]byte
+		options   []mockledger.Option
+		wantErr   string
+	}{
+		{
+			name:      "sell bid",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv1", 50, 10)),
+		},
+		{
+			name:      "buy bid without asset",
+			client:    buyer,
+			transient: bidTransient(buyBid(buyer, 50, 20)),
+		},
+		{
+			name:    "missing transient bid",
+			client:  seller,
+			wantErr: "bid key not found in the transient map",
+		},
+		{
+			name:      "peer of another org",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv1", 50, 10)),
+			options:   []mockledger.Option{mockledger.WithPeerOrg(org2)},
+			wantErr:   "Cannot store bid on this peer",
+		},
+		{
+			name:      "invalid JSON",
+			client:    seller,
+			transient: map[string][]byte{"bid": []byte("{")},
+			wantErr:   "failed to unmarshal JSON",
+		},
+		{
+			name:      "zero volume",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv1", 0, 10)),
+			wantErr:   "bid volume and price must be positive",
+		},
+		{
+			name:      "negative price",
+			client:    buyer,
+			transient: bidTransient(buyBid(buyer, 50, -1)),
+			wantErr:   "bid volume and price must be positive",
+		},
+		{
+			name:      "exposure overflows",
+			client:    buyer,
+			transient: bidTransient(buyBid(buyer, 1<<62, 4)),
+			wantErr:   "is too large",
+		},
+		{
+			name:      "sell bid without asset",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "", 50, 10)),
+			wantErr:   "sell bids must reference a generation asset",
+		},
+		{
+			name:      "unknown asset",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv9", 50, 10)),
+			wantErr:   "asset pv9 does not exist",
+		},
+		{
+			name:      "asset of another participant",
+			client:    trader,
+			transient: bidTransient(sellBid(trader, "pv1", 50, 10)),
+			wantErr:   "asset pv1 is not owned by the bidder",
+		},
+		{
+			name:      "volume above asset capacity",
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv1", 101, 10)),
+			wantErr:   "exceeds the capacity of asset pv1",
+		},
+		{
+			name:   "source type that differs from the asset",
+			client: seller,
+			transient: bidTransient(func() FullBid {
+				bid := sellBid(seller, "pv1", 50, 10)
+				bid.SourceType = "wind"
+				return bid
+			}()),
+			wantErr: "bid source type wind does not match the technology of asset pv1: solar",
+		},
+		{
+			name:      "unknown session",
+			client:    seller,
+			sessionID: "s9",
+			transient: bidTransient(sellBid(seller, "pv1", 50, 10)),
+			wantErr:   "Session interest object s9 not found",
+		},
+		{
+			name:      "closed session",
+			setup:     func(m *market) { m.closeSession("s1") },
+			client:    seller,
+			transient: bidTransient(sellBid(seller, "pv1", 50, 10)),
+			wantErr:   "cannot bid in a session that is not open",
+		},
+		{
+			name: "volume above market rules",
+			setup: func(m *market) {
+				m.publishConfig("strict", MarketRules{MaxVolume: 40})
+				m.createSession("s2", "strict")
+			},
+			client:    seller,
+			sessionID: "s2",
+			transient: bidTransient(sellBid(seller, "pv1", 50, 10)),
+			wantErr:   "bid volume 50 is above the maximum of 40",
+		},
+		{
+			name: "too many bids",
+			setup: func(m *market) {
+				m.publishConfig("strict", MarketRules{MaxBidsPerParticipant: 1})
+				m.createSession("s2", "strict")
+				m.placeBid(buyer, "s2", buyBid(buyer, 10, 20))
+			},
+			client:    buyer,
+			sessionID: "s2",
+			transient: bidTransient(buyBid(buyer, 10, 20)),
+			wantErr:   "participant already has the maximum of 1 bids",
+		},
+		{
+			name:      "exposure above the collateral",
+			client:    buyer,
+			transient: bidTransient(buyBid(buyer, 100, 101)),
+		},
+		{
+			name: "insufficient collateral",
+			setup: func(m *market) {
+				m.updateSession("s1", func(session *Session) { session.Config.BidDeposit = 10001 })
+			},
+			client:    buyer,
+			transient: bidTransient(buyBid(buyer, 10, 20)),
+			wantErr:   "insufficient collateral for bid: deposit 10001, available 10000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+
+			var bidID string
+			options := append([]mockledger.Option{mockledger.WithTransient(tt.transient)}, tt.options...)
+			txID, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				bidID, err = contract.Bid(ctx, sessionID)
+				return err
+			}, options...)
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if bidID != txID {
+				t.Errorf("Bid() = %v, want transaction ID %v", bidID, txID)
+			}
+
+			stored := m.ledger.PrivateData("_implicit_org_"+tt.client.MSPID, bidKey(sessionID, txID))
+			if string(stored) != string(tt.transient["bid"]) {
+				t.Errorf("private bid = %s, want %s", stored, tt.transient["bid"])
+			}
+
+			// the reservation of a sealed bid does not depend on its volume or price
+			if reserved := m.collateral(tt.client).Reserved; reserved != defaultBidDeposit {
+				t.Errorf("reserved collateral = %d, want the deposit of %d", reserved, defaultBidDeposit)
+			}
+		})
+	}
+}
+
+func TestSubmitBid(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(m *market) string
+		client    *mockledger.Identity
+		sessionID string
+		wantOrgs  []string
+		wantErr   string
+	}{
+		{
+			name:     "bid of the admin org",
+			setup:    func(m *market) string { return m.placeBid(seller, "s1", sellBid(seller, "pv1", 50, 10)) },
+			client:   seller,
+			wantOrgs: []string{org1},
+		},
+		{
+			name:     "bid of a new org",
+			setup:    func(m *market) string { return m.placeBid(buyer, "s1", buyBid(buyer, 50, 20)) },
+			client:   buyer,
+			wantOrgs: []string{org1, org2},
+		},
+		{
+			name:      "unknown session",
+			setup:     func(m *market) string { return m.placeBid(seller, "s1", sellBid(seller, "pv1", 50, 10)) },
+			client:    seller,
+			sessionID: "s9",
+			wantErr:   "Session not found: s9",
+		},
+		{
+			name: "closed session",
+			setup: func(m *market) string {
+				txID := m.placeBid(seller, "s1", sellBid(seller, "pv1", 50, 10))
+				m.closeSession("s1")
+				return txID
+			},
+			client:  seller,
+			wantErr: "cannot change finalized or ended session",
+		},
+		{
+			name:    "unknown bid",
+			setup:   func(m *market) string { return "tx999999" },
+			client:  seller,
+			wantErr: "bid hash does not exist",
+		},
+		{
+			name: "bid of another org",
+			setup: func(m *market) string {
+				return m.placeBid(seller, "s1", sellBid(seller, "pv1", 50, 10))
+			},
+			client:  buyer,
+			wantErr: "bid hash does not exist",
+		},
+		{
+			name: "bid without collateral",
+			setup: func(m *market) string {
+				m.putPrivateBid(seller, "s1", "unreserved", bidTransient(sellBid(seller, "pv1", 50, 10))["bid"])
+				return "unreserved"
+			},
+			client:  seller,
+			wantErr: "no collateral reserved for bid unreserved",
+		},
+		{
+			name:    "bid of another client of the org",
+			setup:   func(m *market) string { return m.placeBid(seller, "s1", sellBid(seller, "pv1", 50, 10)) },
+			client:  trader,
+			wantErr: "is not the owner of the bid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			txID := tt.setup(m)
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.SubmitBid(ctx, sessionID, txID)
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			collection := "_implicit_org_" + tt.client.MSPID
+			hash := sha256.Sum256(m.ledger.PrivateData(collection, bidKey("s1", txID)))
+			want := BidHash{Org: tt.client.MSPID, Hash: fmt.Sprintf("%x", hash)}
+
+			session := m.session("s1")
+			if got := session.PrivateBids[bidKey("s1", txID)]; got != want {
+				t.Errorf("bid hash = %+v, want %+v", got, want)
+			}
+			if !reflect.DeepEqual(session.Orgs, tt.wantOrgs) {
+				t.Errorf("session orgs = %v, want %v", session.Orgs, tt.wantOrgs)
+			}
+			if orgs, _ := m.ledger.EndorsingOrgs("s1"); !reflect.DeepEqual(orgs, tt.wantOrgs) {
+				t.Errorf("endorsing orgs = %v, want %v", orgs, tt.wantOrgs)
+			}
+		})
+	}
+}
+
+func TestFinalizeBid(t *testing.T) {
+	offer := sellBid(seller, "pv1", 60, 10)
+
+	tests := []struct {
+		name      string
+		bid       FullBid
+		setup     func(m *market, bid FullBid) string
+		client    *mockledger.Identity
+		sessionID string
+		transient map[string][]byte
+		wantErr   string
+	}{
+		{
+			name:  "sell bid",
+			bid:   offer,
+			setup: submitAndClose,
+		},
+		{
+			name: "buy bid",
+			bid:  buyBid(buyer, 50, 20),
+			setup: func(m *market, bid FullBid) string {
+				m.fund(buyer, 1000)
+				return submitAndClose(m, bid)
+			},
+		},
+		{
+			name:    "buy bid without funds",
+			bid:     buyBid(buyer, 50, 20),
+			setup:   submitAndClose,
+			wantErr: "failed to escrow funds of buyer: insufficient payment token balance: 0, required 1000",
+		},
+		{
+			name:      "missing transient bid",
+			bid:       offer,
+			setup:     submitAndClose,
+			transient: map[string][]byte{},
+			wantErr:   "bid key not found in the transient map",
+		},
+		{
+			name:    "unknown bid",
+			bid:     offer,
+			setup:   func(m *market, bid FullBid) string { m.closeSession("s1"); return "tx999999" },
+			wantErr: "bid hash does not exist",
+		},
+		{
+			name: "unknown session",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				m.putPrivateBid(seller, "s9", "orphan", bidTransient(bid)["bid"])
+				return "orphan"
+			},
+			sessionID: "s9",
+			wantErr:   "Session interest object s9 not found",
+		},
+		{
+			name: "open session",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				return m.placeAndSubmitBid(seller, "s1", bid)
+			},
+			wantErr: "cannot reveal bid for Placed or ended session",
+		},
+		{
+			name:      "revealed bid differs from private bid",
+			bid:       offer,
+			setup:     submitAndClose,
+			transient: bidTransient(sellBid(seller, "pv1", 60, 9)),
+			wantErr:   "does not match hash in session",
+		},
+		{
+			name: "bid not submitted to the session",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				txID := m.placeBid(seller, "s1", bid)
+				m.closeSession("s1")
+				return txID
+			},
+			wantErr: "bidder must have changed bid",
+		},
+		{
+			name: "private bid is not a bid",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				m.putPrivateBid(seller, "s1", "invalid", []byte("[]"))
+				m.updateSession("s1", func(session *Session) {
+					hash := sha256.Sum256([]byte("[]"))
+					session.PrivateBids[bidKey("s1", "invalid")] = BidHash{Org: org1, Hash: fmt.Sprintf("%x", hash)}
+					session.Status = "Close"
+				})
+				return "invalid"
+			},
+			transient: map[string][]byte{"bid": []byte("[]")},
+			wantErr:   "failed to unmarshal JSON",
+		},
+		{
+			name:    "bid of another bidder",
+			bid:     sellBid(trader, "pv1", 60, 10),
+			setup:   submitAndClose,
+			client:  seller,
+			wantErr: "is not the owner of the bid",
+		},
+		{
+			name: "green bid without certificates",
+			bid: func() FullBid {
+				bid := offer
+				bid.Green = true
+				return bid
+			}(),
+			setup:   submitAndClose,
+			wantErr: "certified sell bids of 60 exceed the certificates held: 0",
+		},
+		{
+			name: "asset capacity used by another bid",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				first := m.placeAndSubmitBid(seller, "s1", bid)
+				second := m.placeAndSubmitBid(seller, "s1", bid)
+				m.closeSession("s1")
+				m.finalizeBid(seller, "s1", first, bid)
+				return second
+			},
+			wantErr: "bid volume 60 exceeds the capacity of asset pv1: 100, already bid 60",
+		},
+		{
+			name: "rules changed after bidding",
+			bid:  offer,
+			setup: func(m *market, bid FullBid) string {
+				txID := submitAndClose(m, bid)
+				m.updateSession("s1", func(session *Session) { session.Config.Rules.PriceCap = 5 })
+				return txID
+			},
+			wantErr: "bid price 10 is above the price cap of 5",
+		},
+		{
+			name: "negative carbon intensity",
+			bid: func() FullBid {
+				bid := offer
+				bid.CarbonIntensity = -1
+				return bid
+			}(),
+			setup:   submitAndClose,
+			wantErr: "carbon intensity cannot be negative",
+		},
+		{
+			name: "carbon intensity of a buy bid",
+			bid: func() FullBid {
+				bid := buyBid(buyer, 50, 20)
+				bid.CarbonIntensity = 300
+				return bid
+			}(),
+			setup:   submitAndClose,
+			wantErr: "carbon intensity can only be set on sell bids",
+		},
+		{
+			name: "source type of the asset",
+			bid: func() FullBid {
+				bid := offer
+				bid.SourceType = "solar"
+				return bid
+			}(),
+			setup: submitAndClose,
+		},
+		{
+			name:    "sell bid exposure above the collateral",
+			bid:     sellBid(seller, "pv1", 100, 101),
+			setup:   submitAndClose,
+			wantErr: "insufficient collateral for bid: exposure 10100, available 10000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			txID := tt.setup(m, tt.bid)
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+			transient := tt.transient
+			if transient == nil {
+				transient = bidTransient(tt.bid)
+			}
+			client := tt.client
+			if client == nil {
+				client = clientOf(tt.bid)
+			}
+
+			_, err := m.submit(client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.FinalizeBid(ctx, sessionID, txID)
+			}, mockledger.WithTransient(transient))
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			want := tt.bid
+			want.Status = "Finalized"
+			if got := m.session("s1").FinalizedBids[bidKey("s1", txID)]; !reflect.DeepEqual(got, want) {
+				t.Errorf("finalized bid = %+v, want %+v", got, want)
+			}
+
+			// a revealed sell bid reserves its exposure, a buy bid keeps its deposit
+			wantReserved := defaultBidDeposit
+			if tt.bid.BidType.IsSell() {
+				wantReserved = tt.bid.Volume * tt.bid.Price
+			}
+			if reserved := m.collateral(client).Reserved; reserved != wantReserved {
+				t.Errorf("reserved collateral = %d, want %d", reserved, wantReserved)
+			}
+		})
+	}
+}
+
+// submitAndClose places and submits a bid of the participant the bid names in s1,
+// and closes the session. Bids of the trader are placed by the seller
+func submitAndClose(m *market, bid FullBid) string {
+	m.t.Helper()
+
+	client := clientOf(bid)
+	if client == trader {
+		client = seller
+	}
+
+	txID := m.placeAndSubmitBid(client, "s1", bid)
+	m.closeSession("s1")
+
+	return txID
+}
+
+// clientOf returns the participant that a bid names as bidder
+func clientOf(bid FullBid) *mockledger.Identity {
+	for _, participant := range []*mockledger.Identity{seller, trader, buyer} {
+		if participant.ID() == bid.Bidder {
+			return participant
+		}
+	}
+	return nil
+}
+
+func TestCloseSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(m *market)
+		client    *mockledger.Identity
+		sessionID string
+		wantErr   string
+	}{
+		{
+			name:   "open session",
+			client: admin,
+		},
+		{
+			name:      "unknown session",
+			client:    admin,
+			sessionID: "s9",
+			wantErr:   "Session interest object s9 not found",
+		},
+		{
+			name:    "not the admin",
+			client:  seller,
+			wantErr: "session can only be Finalized by admin",
+		},
+		{
+			name:    "closed session",
+			setup:   func(m *market) { m.closeSession("s1") },
+			client:  admin,
+			wantErr: "cannot close session that is not open",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.CloseSession(ctx, sessionID)
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			if status := m.session("s1").Status; status != "Close" {
+				t.Errorf("session status = %v, want Close", status)
+			}
+		})
+	}
+}
+
+func TestEndSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(m *market)
+		client    *mockledger.Identity
+		sessionID string
+		wantErr   string
+	}{
+		{
+			name: "closed session with bids",
+			setup: func(m *market) {
+				m.placeAndSubmitBid(trader, "s1", buyBid(trader, 10, 5))
+				revealBids(m)
+			},
+			client: admin,
+		},
+		{
+			name:      "unknown session",
+			client:    admin,
+			sessionID: "s9",
+			wantErr:   "Session interest object s9 not found",
+		},
+		{
+			name:    "not the admin",
+			setup:   revealBids,
+			client:  seller,
+			wantErr: "session can only be ended by admin",
+		},
+		{
+			name:    "open session",
+			client:  admin,
+			wantErr: "Can only end a closed session",
+		},
+		{
+			name:    "no revealed bids",
+			setup:   func(m *market) { m.closeSession("s1") },
+			client:  admin,
+			wantErr: "No bids have been revealed, cannot end session",
+		},
+		{
+			name: "buyer that cannot pay is left out",
+			setup: func(m *market) {
+				unfunded := buyBid(trader, 10, 20)
+				txID := m.placeAndSubmitBid(trader, "s1", unfunded)
+				revealBids(m)
+
+				_, err := m.submit(trader, func(ctx contractapi.TransactionContextInterface) error {
+					return contract.FinalizeBid(ctx, "s1", txID)
+				}, mockledger.WithTransient(bidTransient(unfunded)))
+				checkError(m.t, err, "failed to escrow funds of buyer")
+			},
+			client: admin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			if tt.setup != nil {
+				tt.setup(m)
+			}
+			sessionID := tt.sessionID
+			if sessionID == "" {
+				sessionID = "s1"
+			}
+
+			var result *ClearingResult
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				result, err = contract.EndSession(ctx, sessionID)
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			session := m.session("s1")
+			if session.Status != "ended" {
+				t.Errorf("session status = %v, want ended", session.Status)
+			}
+			if session.ClearingPrice != result.ClearingPrice {
+				t.Errorf("session clearing price = %d, result %d", session.ClearingPrice, result.ClearingPrice)
+			}
+
+			allocated := map[BidType]int{}
+			for _, bid := range session.FinalizedBids {
+				allocated[bid.BidType] += bid.Allocated
+				if bid.Allocated > 0 && bid.SettlementPrice != result.ClearingPrice {
+					t.Errorf("settlement price = %d, want %d", bid.SettlementPrice, result.ClearingPrice)
+				}
+			}
+			if allocated[Sell] != 50 || allocated[Buy] != 50 {
+				t.Errorf("allocated volume = %v, want 50 sold and bought", allocated)
+			}
+
+			// the allocated sell bid keeps its exposure reserved and the allocated
+			// buy bid its deposit, the bid that was never revealed releases it
+			wantReserved := map[*mockledger.Identity]int{seller: 500, buyer: defaultBidDeposit, trader: 0}
+			for participant, want := range wantReserved {
+				if reserved := m.collateral(participant).Reserved; reserved != want {
+					t.Errorf("reserved collateral of %v = %d, want %d", participant.Name, reserved, want)
+				}
+			}
+		})
+	}
+}
+
+// revealBids reveals a 50 kWh sell bid and a 50 kWh buy bid in s1 and funds the
+// buyer so that the buy bid can be escrowed when it is revealed
+func revealBids(m *market) {
+	m.t.Helper()
+
+	m.fund(buyer, 5000)
+
+	sell := m.placeAndSubmitBid(seller, "s1", sellBid(seller, "pv1", 50, 10))
+	buy := m.placeAndSubmitBid(buyer, "s1", buyBid(buyer, 50, 20))
+	m.closeSession("s1")
+	m.finalizeBid(seller, "s1", sell, sellBid(seller, "pv1", 50, 10))
+	m.finalizeBid(buyer, "s1", buy, buyBid(buyer, 50, 20))
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	m := newMarket(t)
+
+	revealBids(m)
+
+	var result *ClearingResult
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = contract.EndSession(ctx, "s1")
+		return err
+	})
+
+	session := m.session("s1")
+	for key, bid := range session.FinalizedBids {
+		if bid.Allocated != 50 {
+			t.Errorf("bid %v allocated %d, want 50", key, bid.Allocated)
+		}
+	}
+	if len(session.PrivateBids) != 2 || len(session.FinalizedBids) != 2 {
+		t.Errorf("session has %d private and %d finalized bids, want 2 each", len(session.PrivateBids), len(session.FinalizedBids))
+	}
+	if !reflect.DeepEqual(session.Orgs, []string{org1, org2}) {
+		t.Errorf("session orgs = %v, want [%v %v]", session.Orgs, org1, org2)
+	}
+
+	var escrows []*payment.Escrow
+	m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		escrows, err = new(payment.PaymentContract).QueryEscrows(ctx, "s1")
+		return err
+	})
+	// the buyer locked its bid price when revealing, and got back what the
+	// clearing price does not need
+	if len(escrows) != 1 || escrows[0].Amount != 50*20 || escrows[0].Remaining() != 50*result.ClearingPrice {
+		t.Fatalf("escrows = %+v, want one escrow of %d holding %d", escrows, 50*20, 50*result.ClearingPrice)
+	}
+
+	var balance int
+	m.ledger.Evaluate(buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		balance, err = new(payment.PaymentContract).BalanceOf(ctx, buyer.ID())
+		return err
+	})
+	if balance != 5000-50*result.ClearingPrice {
+		t.Errorf("buyer balance = %d, want %d", balance, 5000-50*result.ClearingPrice)
+	}
+}
+
+func TestSessionEvents(t *testing.T) {
+	m := newMarket(t)
+
+	revealBids(m)
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.EndSession(ctx, "s1")
+		return err
+	})
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SettleSession(ctx, "s1")
+	})
+
+	var names []string
+	var ended SessionEvent
+	for _, event := range m.ledger.Events() {
+		names = append(names, event.Name)
+		if event.Name == SessionEndedEvent {
+			if err := json.Unmarshal(event.Payload, &ended); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	want := []string{SessionCreatedEvent, SessionClosedEvent, SessionEndedEvent, SessionSettledEvent}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("events = %v, want %v", names, want)
+	}
+
+	if ended.SessionID != "s1" || ended.Status != "ended" || ended.Result == nil || len(ended.Allocations) != 2 {
+		t.Fatalf("SessionEnded event = %+v, want the result and two allocations", ended)
+	}
+	for _, allocation := range ended.Allocations {
+		if allocation.Allocated != 50 || allocation.Bidder == "" || allocation.SettlementPrice != ended.Result.ClearingPrice {
+			t.Errorf("allocation = %+v, want 50 allocated to its bidder at the clearing price", allocation)
+		}
+	}
+}
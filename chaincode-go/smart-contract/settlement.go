@@ -0,0 +1,474 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/energy-token"
+)
+
+// Settlement is the financial outcome of an ended session. OrgBalances holds the
+// net amount per organization, positive when the organization is owed money.
+// ImbalancePool is what the imbalance debits of the session collected beyond the
+// imbalance credits it paid; it stays with the market operator
+type Settlement struct {
+	SessionID     string         `json:"sessionID"`
+	ClearingPrice int            `json:"clearingPrice"`
+	ZonePrices    map[string]int `json:"zonePrices,omitempty" metadata:"zonePrices,optional"`
+	Invoices      []Invoice      `json:"invoices"`
+	OrgBalances   map[string]int `json:"orgBalances"`
+	ImbalancePool int            `json:"imbalancePool"`
+}
+
+// Invoice lists the settlement entries of one participant. Total is positive when
+// the participant is credited and negative when the participant is debited. Paid
+// is the part of the credits that was released from escrow for delivered volume.
+// UnsettledImbalance is the part of the imbalance that could not be booked
+// against collateral: negative for a charge the participant's collateral did not
+// cover, positive for a credit the imbalance pool could not pay
+type Invoice struct {
+	SessionID          string     `json:"sessionID"`
+	Participant        string     `json:"participant"`
+	Org                string     `json:"org"`
+	LineItems          []LineItem `json:"lineItems"`
+	Total              int        `json:"total"`
+	Paid               int        `json:"paid"`
+	UnsettledImbalance int        `json:"unsettledImbalance"`
+}
+
+// LineItem is a single debit or credit entry of an invoice, either for the energy
+// allocated to a bid or for the imbalance between metered and cleared volume
+type LineItem struct {
+	Item      string  `json:"item"`
+	BidKey    string  `json:"bidKey,omitempty" metadata:"bidKey,optional"`
+	BidType   BidType `json:"bidType,omitempty" metadata:"bidType,optional"`
+	Entry     string  `json:"entry"`
+	Volume    int     `json:"volume"`
+	UnitPrice int     `json:"unitPrice"`
+	Amount    int     `json:"amount"`
+}
+
+const (
+	Debit  = "debit"
+	Credit = "credit"
+)
+
+const (
+	EnergyItem    = "energy"
+	ImbalanceItem = "imbalance"
+)
+
+const settlementKeyType = "settlement"
+const invoiceKeyType = "invoice"
+
+// SettleSession turns the allocations of an ended session into debit and credit
+// entries at their settlement price, adds the imbalances computed from the meter
+// readings and stores the resulting invoices. Every allocation becomes a delivery
+// obligation on the energy token ledger, green volume moves its renewable energy
+// certificates from the sellers to the buyers, and the collateral reserved for
+// the allocations is released because the buyers' funds are held in escrow since
+// the session ended. Only the admin can settle a session
+func (s *SmartContract) SettleSession(ctx contractapi.TransactionContextInterface, sessionID string) error {
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if sessionJSON.Admin != clientID {
+		return fmt.Errorf("session can only be settled by admin")
+	}
+
+	if sessionJSON.Status != "ended" {
+		return fmt.Errorf("can only settle an ended session")
+	}
+
+	imbalances, err := getImbalances(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	settlement := buildSettlement(sessionID, sessionJSON, imbalances)
+
+	settlement.ImbalancePool, err = releaseInvoiceCollateral(ctx, settlement.Invoices)
+	if err != nil {
+		return err
+	}
+
+	for _, invoice := range settlement.Invoices {
+		err = putInvoice(ctx, &invoice)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = createDeliveryObligations(ctx, sessionID, settlement.Invoices, sessionJSON.FinalizedBids)
+	if err != nil {
+		return err
+	}
+
+	err = transferSessionCertificates(ctx, sessionID, sessionJSON.FinalizedBids)
+	if err != nil {
+		return fmt.Errorf("failed to transfer certificates: %v", err)
+	}
+
+	err = releaseSessionPledges(ctx, sessionID, sessionJSON.FinalizedBids, true)
+	if err != nil {
+		return fmt.Errorf("failed to release certificates: %v", err)
+	}
+
+	// the invoices are stored under their own keys
+	settlement.Invoices = nil
+
+	settlementKey, err := ctx.GetStub().CreateCompositeKey(settlementKeyType, []string{sessionID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	settlementBytes, err := json.Marshal(settlement)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(settlementKey, settlementBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put settlement: %v", err)
+	}
+
+	sessionJSON.Status = "settled"
+
+	settledSession, _ := json.Marshal(sessionJSON)
+
+	err = ctx.GetStub().PutState(sessionID, settledSession)
+	if err != nil {
+		return fmt.Errorf("failed to settle session: %v", err)
+	}
+
+	return setSessionEvent(ctx, SessionSettledEvent, &SessionEvent{SessionID: sessionID, Status: sessionJSON.Status})
+}
+
+// QuerySettlement returns the settlement of a session together with the invoice
+// of every participant
+func (s *SmartContract) QuerySettlement(ctx contractapi.TransactionContextInterface, sessionID string) (*Settlement, error) {
+
+	settlementKey, err := ctx.GetStub().CreateCompositeKey(settlementKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	settlementBytes, err := ctx.GetStub().GetState(settlementKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get settlement %v: %v", sessionID, err)
+	}
+	if settlementBytes == nil {
+		return nil, fmt.Errorf("session %v has not been settled", sessionID)
+	}
+
+	var settlement Settlement
+	err = json.Unmarshal(settlementBytes, &settlement)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(invoiceKeyType, []string{sessionID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoices of session %v: %v", sessionID, err)
+	}
+	defer resultsIterator.Close()
+
+	settlement.Invoices = []Invoice{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var invoice Invoice
+		err = json.Unmarshal(queryResponse.Value, &invoice)
+		if err != nil {
+			return nil, err
+		}
+		settlement.Invoices = append(settlement.Invoices, invoice)
+	}
+
+	return &settlement, nil
+}
+
+// QueryInvoice returns the invoice of a single participant of a settled session
+func (s *SmartContract) QueryInvoice(ctx contractapi.TransactionContextInterface, sessionID string, participant string) (*Invoice, error) {
+
+	invoiceKey, err := ctx.GetStub().CreateCompositeKey(invoiceKeyType, []string{sessionID, participant})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	invoiceBytes, err := ctx.GetStub().GetState(invoiceKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %v", err)
+	}
+	if invoiceBytes == nil {
+		return nil, fmt.Errorf("no invoice for participant in session %v", sessionID)
+	}
+
+	var invoice Invoice
+	err = json.Unmarshal(invoiceBytes, &invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	return &invoice, nil
+}
+
+// buildSettlement computes the invoices and the per organization net amounts of
+// an ended session. Allocations are priced at their settlement price, which is
+// the price of the bid's zone or, in a pay-as-bid session, the bid's own price.
+// Sellers are paid for the volume that reaches the buyers after losses. Bids are
+// visited in key order so that every endorsing peer produces the same settlement
+func buildSettlement(sessionID string, sessionJSON *Session, imbalances []*Imbalance) *Settlement {
+
+	bidKeys := make([]string, 0, len(sessionJSON.FinalizedBids))
+	for bidKey := range sessionJSON.FinalizedBids {
+		bidKeys = append(bidKeys, bidKey)
+	}
+	sort.Strings(bidKeys)
+
+	settlement := Settlement{
+		SessionID:     sessionID,
+		ClearingPrice: sessionJSON.ClearingPrice,
+		ZonePrices:    sessionJSON.ZonePrices,
+		OrgBalances:   make(map[string]int),
+	}
+
+	invoices := make(map[string]*Invoice)
+	var participants []string
+
+	addLine := func(participant string, org string, line LineItem, signedAmount int) {
+		invoice, ok := invoices[participant]
+		if !ok {
+			invoice = &Invoice{
+				SessionID:   sessionID,
+				Participant: participant,
+				Org:         org,
+			}
+			invoices[participant] = invoice
+			participants = append(participants, participant)
+		}
+
+		invoice.LineItems = append(invoice.LineItems, line)
+		invoice.Total += signedAmount
+		settlement.OrgBalances[org] += signedAmount
+	}
+
+	for _, bidKey := range bidKeys {
+		bid := sessionJSON.FinalizedBids[bidKey]
+		if bid.Allocated == 0 {
+			continue
+		}
+
+		line := LineItem{
+			Item:      EnergyItem,
+			BidKey:    bidKey,
+			BidType:   bid.BidType,
+			Volume:    bid.Delivered,
+			UnitPrice: bid.settlementPrice(sessionJSON),
+			Amount:    bid.Delivered * bid.settlementPrice(sessionJSON),
+		}
+
+		signedAmount := line.Amount
+		if bid.BidType.IsBuy() {
+			line.Entry = Debit
+			signedAmount = -line.Amount
+		} else {
+			line.Entry = Credit
+		}
+
+		addLine(bid.Bidder, bid.Org, line, signedAmount)
+	}
+
+	for _, imbalance := range imbalances {
+		if imbalance.Amount == 0 {
+			continue
+		}
+
+		line := LineItem{
+			Item:      ImbalanceItem,
+			Entry:     Credit,
+			Volume:    imbalance.Imbalance,
+			UnitPrice: imbalance.ImbalancePrice,
+			Amount:    imbalance.Amount,
+		}
+		if imbalance.Amount < 0 {
+			line.Entry = Debit
+			line.Volume = -imbalance.Imbalance
+			line.Amount = -imbalance.Amount
+		}
+
+		addLine(imbalance.Participant, imbalance.Org, line, imbalance.Amount)
+	}
+
+	for _, participant := range participants {
+		settlement.Invoices = append(settlement.Invoices, *invoices[participant])
+	}
+
+	return &settlement
+}
+
+// releaseInvoiceCollateral releases the collateral that was reserved for the
+// invoiced bids and books the imbalance entries against the collateral balances.
+// Imbalance debits are charged up to the collateral that the participant does
+// not need for other bids, and the charges form the imbalance pool of the
+// session. Imbalance credits are paid from that pool in invoice order, so the
+// market never pays out more than it collected. What could not be booked is
+// recorded on the invoice as UnsettledImbalance, and what remains in the pool is
+// returned. The payments for energy are made through the payment escrow
+func releaseInvoiceCollateral(ctx contractapi.TransactionContextInterface, invoices []Invoice) (int, error) {
+
+	adjustments := newCollateralAdjustments()
+	credits := make([]int, len(invoices))
+	pool := 0
+
+	for i := range invoices {
+		invoice := &invoices[i]
+
+		released := 0
+		imbalance := 0
+		for _, line := range invoice.LineItems {
+			if line.Item == ImbalanceItem {
+				if line.Entry == Debit {
+					imbalance -= line.Amount
+				} else {
+					imbalance += line.Amount
+				}
+				continue
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(line.BidKey)
+			if err != nil {
+				return 0, fmt.Errorf("failed to split composite key: %v", err)
+			}
+
+			reservation, err := getReservation(ctx, keyParts[0], keyParts[1])
+			if err != nil {
+				return 0, err
+			}
+
+			released += reservation.Amount
+			reservation.Amount = 0
+			err = putReservation(ctx, keyParts[1], reservation)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		adjustments.add(invoice.Participant, 0, -released)
+
+		if imbalance > 0 {
+			credits[i] = imbalance
+			continue
+		}
+		if imbalance == 0 {
+			continue
+		}
+
+		account, err := getCollateralAccount(ctx, invoice.Participant)
+		if err != nil {
+			return 0, err
+		}
+
+		charged := -imbalance
+		if available := account.Available() + released; charged > available {
+			charged = available
+		}
+
+		adjustments.add(invoice.Participant, -charged, 0)
+		invoice.UnsettledImbalance = imbalance + charged
+		pool += charged
+	}
+
+	for i, credit := range credits {
+		if credit == 0 {
+			continue
+		}
+
+		paid := credit
+		if paid > pool {
+			paid = pool
+		}
+
+		adjustments.add(invoices[i].Participant, paid, 0)
+		invoices[i].UnsettledImbalance = credit - paid
+		pool -= paid
+	}
+
+	return pool, adjustments.apply(ctx)
+}
+
+// createDeliveryObligations makes the sellers of a session owe their allocated
+// injection to the session pool of the energy token ledger, and the buyers
+// entitled to take their allocated withdrawal from there. The pool keeps the
+// transmission losses
+func createDeliveryObligations(ctx contractapi.TransactionContextInterface, sessionID string, invoices []Invoice, bids map[string]FullBid) error {
+
+	// a participant has at most one obligation per direction in a session
+	volumes := make(map[string]map[string]int)
+	for _, bid := range bids {
+		if volumes[bid.Bidder] == nil {
+			volumes[bid.Bidder] = make(map[string]int)
+		}
+		if bid.BidType.IsBuy() {
+			volumes[bid.Bidder][energy.Receive] += bid.Allocated
+		}
+		if bid.BidType.IsSell() {
+			volumes[bid.Bidder][energy.Deliver] += bid.Allocated
+		}
+	}
+
+	for _, invoice := range invoices {
+		for _, direction := range []string{energy.Deliver, energy.Receive} {
+			volume := volumes[invoice.Participant][direction]
+			if volume == 0 {
+				continue
+			}
+
+			err := energy.CreateObligation(ctx, sessionID, invoice.Participant, direction, volume)
+			if err != nil {
+				return fmt.Errorf("failed to create delivery obligation: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// putInvoice is an internal helper that writes an invoice to state
+func putInvoice(ctx contractapi.TransactionContextInterface, invoice *Invoice) error {
+
+	invoiceKey, err := ctx.GetStub().CreateCompositeKey(invoiceKeyType, []string{invoice.SessionID, invoice.Participant})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	invoiceBytes, err := json.Marshal(invoice)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(invoiceKey, invoiceBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put invoice: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,225 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func (m *market) endSession(sessionID string) {
+	m.t.Helper()
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.EndSession(ctx, sessionID)
+		return err
+	})
+}
+
+func (m *market) settleSession(sessionID string) {
+	m.t.Helper()
+	m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SettleSession(ctx, sessionID)
+	})
+}
+
+// submitMeterReading records the metered net injection of a participant in s1
+func (m *market) submitMeterReading(client *mockledger.Identity, volume int) {
+	m.t.Helper()
+
+	participant := client.ID()
+	m.mustSubmit(meter, func(ctx contractapi.TransactionContextInterface) error {
+		return contract.SubmitMeterReading(ctx, "s1", participant, volume)
+	})
+}
+
+// settledMarket is a market in which the seller sold 50 kWh to the buyer in s1
+// at a clearing price of 10, the seller metered 45 kWh and s1 is settled
+func settledMarket(t *testing.T) *market {
+	t.Helper()
+
+	m := newMarket(t)
+	revealBids(m)
+	m.endSession("s1")
+	m.submitMeterReading(seller, 45)
+	m.settleSession("s1")
+
+	return m
+}
+
+func TestQuerySettlement(t *testing.T) {
+	m := newMarket(t)
+	revealBids(m)
+	m.endSession("s1")
+
+	err := m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := contract.QuerySettlement(ctx, "s1")
+		return err
+	})
+	checkError(t, err, "session s1 has not been settled")
+
+	m.submitMeterReading(seller, 45)
+	m.settleSession("s1")
+
+	var settlement *Settlement
+	err = m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		settlement, err = contract.QuerySettlement(ctx, "s1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settlement.ClearingPrice != 10 {
+		t.Errorf("clearing price = %d, want 10", settlement.ClearingPrice)
+	}
+	if want := map[string]int{org1: 500 - 50, org2: -500}; !reflect.DeepEqual(settlement.OrgBalances, want) {
+		t.Errorf("org balances = %v, want %v", settlement.OrgBalances, want)
+	}
+	totals := make(map[string]int)
+	for _, invoice := range settlement.Invoices {
+		totals[invoice.Participant] = invoice.Total
+	}
+	if want := map[string]int{seller.ID(): 450, buyer.ID(): -500}; !reflect.DeepEqual(totals, want) {
+		t.Errorf("invoice totals = %v, want %v", totals, want)
+	}
+
+	// the imbalance is booked against the collateral of the seller, and the
+	// deposits of both bids are released
+	if account := m.collateral(seller); account.Balance != 10000-50 || account.Reserved != 0 {
+		t.Errorf("seller collateral = %+v, want a balance of 9950 and nothing reserved", account)
+	}
+	if account := m.collateral(buyer); account.Balance != 10000 || account.Reserved != 0 {
+		t.Errorf("buyer collateral = %+v, want a balance of 10000 and nothing reserved", account)
+	}
+	if status := m.session("s1").Status; status != "settled" {
+		t.Errorf("session status = %v, want settled", status)
+	}
+}
+
+func TestQueryInvoice(t *testing.T) {
+	tests := []struct {
+		name        string
+		participant *mockledger.Identity
+		wantLines   []LineItem
+		wantTotal   int
+		wantErr     string
+	}{
+		{
+			name:        "seller with an imbalance",
+			participant: seller,
+			wantLines: []LineItem{
+				{Item: EnergyItem, BidType: Sell, Entry: Credit, Volume: 50, UnitPrice: 10, Amount: 500},
+				{Item: ImbalanceItem, Entry: Debit, Volume: 5, UnitPrice: 10, Amount: 50},
+			},
+			wantTotal: 450,
+		},
+		{
+			name:        "buyer",
+			participant: buyer,
+			wantLines:   []LineItem{{Item: EnergyItem, BidType: Buy, Entry: Debit, Volume: 50, UnitPrice: 10, Amount: 500}},
+			wantTotal:   -500,
+		},
+		{name: "participant without bids", participant: trader, wantErr: "no invoice for participant in session s1"},
+	}
+
+	m := settledMarket(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var invoice *Invoice
+			err := m.ledger.Evaluate(tt.participant, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				invoice, err = contract.QueryInvoice(ctx, "s1", tt.participant.ID())
+				return err
+			})
+			checkError(t, err, tt.wantErr)
+			if err != nil {
+				return
+			}
+
+			for i := range invoice.LineItems {
+				invoice.LineItems[i].BidKey = ""
+			}
+			if !reflect.DeepEqual(invoice.LineItems, tt.wantLines) || invoice.Total != tt.wantTotal {
+				t.Errorf("invoice = %+v, want lines %+v and a total of %d", invoice, tt.wantLines, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestSettleImbalances(t *testing.T) {
+	tests := []struct {
+		name          string
+		readings      map[*mockledger.Identity]int
+		wantBalances  map[*mockledger.Identity]int
+		wantUnsettled map[*mockledger.Identity]int
+		wantPool      int
+	}{
+		{
+			name:          "charge above the collateral balance",
+			readings:      map[*mockledger.Identity]int{buyer: -3000},
+			wantBalances:  map[*mockledger.Identity]int{seller: 10000, buyer: 0},
+			wantUnsettled: map[*mockledger.Identity]int{seller: 0, buyer: 10000 - 29500},
+			wantPool:      10000,
+		},
+		{
+			name:          "credit without charges",
+			readings:      map[*mockledger.Identity]int{seller: 60},
+			wantBalances:  map[*mockledger.Identity]int{seller: 10000, buyer: 10000},
+			wantUnsettled: map[*mockledger.Identity]int{seller: 100, buyer: 0},
+		},
+		{
+			name:          "credit paid from the charges",
+			readings:      map[*mockledger.Identity]int{seller: 60, buyer: -70},
+			wantBalances:  map[*mockledger.Identity]int{seller: 10100, buyer: 9800},
+			wantUnsettled: map[*mockledger.Identity]int{seller: 0, buyer: 0},
+			wantPool:      100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			revealBids(m)
+			m.endSession("s1")
+			for participant, volume := range tt.readings {
+				m.submitMeterReading(participant, volume)
+			}
+			m.settleSession("s1")
+
+			var settlement *Settlement
+			err := m.ledger.Evaluate(admin, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				settlement, err = contract.QuerySettlement(ctx, "s1")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if settlement.ImbalancePool != tt.wantPool {
+				t.Errorf("imbalance pool = %d, want %d", settlement.ImbalancePool, tt.wantPool)
+			}
+			unsettled := make(map[string]int)
+			for _, invoice := range settlement.Invoices {
+				unsettled[invoice.Participant] = invoice.UnsettledImbalance
+			}
+			for participant, want := range tt.wantUnsettled {
+				if unsettled[participant.ID()] != want {
+					t.Errorf("unsettled imbalance of %v = %d, want %d", participant.ID(), unsettled[participant.ID()], want)
+				}
+			}
+			for participant, want := range tt.wantBalances {
+				if account := m.collateral(participant); account.Balance != want || account.Reserved != 0 {
+					t.Errorf("collateral of %v = %+v, want a balance of %d and nothing reserved", participant.ID(), account, want)
+				}
+			}
+		})
+	}
+}
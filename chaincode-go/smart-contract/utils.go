@@ -12,6 +12,11 @@ import (
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// roleAttribute is the certificate attribute that carries the market role of a client
+const roleAttribute = "gepx.role"
+
+const operatorRole = "operator"
+
 // setAssetStateBasedEndorsement sets the endorsement policy of a new auction
 func setAssetStateBasedEndorsement(ctx contractapi.TransactionContextInterface, sessionID string, orgToEndorse string) error {
 
@@ -97,6 +102,17 @@ func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
+// assertClientRole is an internal function used to verify that the submitting client
+// was enrolled with the given market role.
+func assertClientRole(ctx contractapi.TransactionContextInterface, role string) error {
+	err := ctx.GetClientIdentity().AssertAttributeValue(roleAttribute, role)
+	if err != nil {
+		return fmt.Errorf("client is not authorized as %v: %v", role, err)
+	}
+
+	return nil
+}
+
 func contains(sli []string, str string) bool {
 	for _, a := range sli {
 		if a == str {
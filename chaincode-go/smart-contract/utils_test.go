@@ -0,0 +1,133 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestGetCollectionName(t *testing.T) {
+	ledger := mockledger.New(time.Now())
+
+	for client, want := range map[*mockledger.Identity]string{seller: "_implicit_org_Org1MSP", buyer: "_implicit_org_Org2MSP"} {
+		var collection string
+		err := ledger.Evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			collection, err = getCollectionName(ctx)
+			return err
+		})
+		checkError(t, err, "")
+
+		if collection != want {
+			t.Errorf("getCollectionName() of %v = %v, want %v", client.Name, collection, want)
+		}
+	}
+}
+
+func TestVerifyClientOrgMatchesPeerOrg(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *mockledger.Identity
+		peerOrg string
+		wantErr string
+	}{
+		{name: "peer of the client org", client: seller, peerOrg: org1},
+		{name: "peer of another org", client: seller, peerOrg: org2, wantErr: "client from org Org1MSP is not authorized to read or write private data from an org Org2MSP peer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := mockledger.New(time.Now())
+
+			err := ledger.Evaluate(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return verifyClientOrgMatchesPeerOrg(ctx)
+			}, mockledger.WithPeerOrg(tt.peerOrg))
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestAssertClientRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		client  *mockledger.Identity
+		wantErr string
+	}{
+		{name: "client with role", client: operator},
+		{name: "client with another role", client: issuer, wantErr: "client is not authorized as operator"},
+		{name: "client without role", client: seller, wantErr: "client is not authorized as operator"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := mockledger.New(time.Now())
+
+			err := ledger.Evaluate(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return assertClientRole(ctx, operatorRole)
+			})
+			checkError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestStateBasedEndorsement(t *testing.T) {
+	tests := []struct {
+		name string
+		add  []string
+		want []string
+	}{
+		{name: "new policy", want: []string{org1}},
+		{name: "added org", add: []string{org2}, want: []string{org1, org2}},
+		{name: "org added twice", add: []string{org2, org2}, want: []string{org1, org2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ledger := mockledger.New(time.Now())
+
+			_, err := ledger.Submit(admin, func(ctx contractapi.TransactionContextInterface) error {
+				return setAssetStateBasedEndorsement(ctx, "s1", org1)
+			})
+			checkError(t, err, "")
+
+			// every org is added in its own transaction, as the policy is read from committed state
+			for _, org := range tt.add {
+				_, err := ledger.Submit(admin, func(ctx contractapi.TransactionContextInterface) error {
+					return addAssetStateBasedEndorsement(ctx, "s1", org)
+				})
+				checkError(t, err, "")
+			}
+
+			orgs, err := ledger.EndorsingOrgs("s1")
+			checkError(t, err, "")
+			if !reflect.DeepEqual(orgs, tt.want) {
+				t.Errorf("endorsing orgs = %v, want %v", orgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		slice []string
+		str   string
+		want  bool
+	}{
+		{slice: []string{org1, org2}, str: org2, want: true},
+		{slice: []string{org1}, str: org2, want: false},
+		{slice: nil, str: org1, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := contains(tt.slice, tt.str); got != tt.want {
+			t.Errorf("contains(%v, %v) = %v, want %v", tt.slice, tt.str, got, tt.want)
+		}
+	}
+}
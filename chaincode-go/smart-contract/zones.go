@@ -0,0 +1,128 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Interconnector is the available transfer capacity from one bidding zone to
+// another. Capacities are directional
+type Interconnector struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Capacity int    `json:"capacity"`
+}
+
+// Flow is the volume that the clearing of a session moves between two zones
+type Flow struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Volume int    `json:"volume"`
+}
+
+// SetTransmissionCapacity is used by the admin to define the capacity available
+// from one bidding zone to another while the session is open. Setting a capacity
+// again replaces the previous value
+func (s *SmartContract) SetTransmissionCapacity(ctx contractapi.TransactionContextInterface, sessionID string, fromZone string, toZone string, capacity int) error {
+
+	sessionJSON, err := getSession(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// get ID of submitting client
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	if sessionJSON.Admin != clientID {
+		return fmt.Errorf("transmission capacity can only be set by admin")
+	}
+
+	if sessionJSON.Status != "Open" {
+		return fmt.Errorf("cannot change transmission capacity of a session that is not open")
+	}
+
+	if fromZone == toZone {
+		return fmt.Errorf("interconnector must connect two different zones")
+	}
+
+	if capacity < 0 {
+		return fmt.Errorf("transmission capacity cannot be negative")
+	}
+
+	interconnector := Interconnector{From: fromZone, To: toZone, Capacity: capacity}
+
+	replaced := false
+	for i, existing := range sessionJSON.Interconnectors {
+		if existing.From == fromZone && existing.To == toZone {
+			sessionJSON.Interconnectors[i] = interconnector
+			replaced = true
+		}
+	}
+	if !replaced {
+		sessionJSON.Interconnectors = append(sessionJSON.Interconnectors, interconnector)
+	}
+
+	sessionBytes, _ := json.Marshal(sessionJSON)
+
+	err = ctx.GetStub().PutState(sessionID, sessionBytes)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %v", err)
+	}
+
+	return nil
+}
+
+// coupleZones moves the surplus of zones that offer more than they request to
+// zones that request more than they offer, as far as the interconnectors allow.
+// Interconnectors are used in the order they were defined. The returned maps
+// hold the exported and imported volume per zone
+func coupleZones(sellVolume map[string]int, buyVolume map[string]int, interconnectors []Interconnector) ([]Flow, map[string]int, map[string]int) {
+
+	surplus := make(map[string]int)
+	deficit := make(map[string]int)
+	for zone, volume := range sellVolume {
+		if volume > buyVolume[zone] {
+			surplus[zone] = volume - buyVolume[zone]
+		}
+	}
+	for zone, volume := range buyVolume {
+		if volume > sellVolume[zone] {
+			deficit[zone] = volume - sellVolume[zone]
+		}
+	}
+
+	flows := []Flow{}
+	exports := make(map[string]int)
+	imports := make(map[string]int)
+
+	for _, interconnector := range interconnectors {
+		volume := interconnector.Capacity
+		if surplus[interconnector.From] < volume {
+			volume = surplus[interconnector.From]
+		}
+		if deficit[interconnector.To] < volume {
+			volume = deficit[interconnector.To]
+		}
+		if volume <= 0 {
+			continue
+		}
+
+		surplus[interconnector.From] -= volume
+		deficit[interconnector.To] -= volume
+		exports[interconnector.From] += volume
+		imports[interconnector.To] += volume
+
+		flows = append(flows, Flow{From: interconnector.From, To: interconnector.To, Volume: volume})
+	}
+
+	return flows, exports, imports
+}
@@ -0,0 +1,81 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package session
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/mock-ledger"
+)
+
+func TestSetTransmissionCapacity(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   *mockledger.Identity
+		closed   bool
+		from     string
+		to       string
+		capacity int
+		wantErr  string
+		want     []Interconnector
+	}{
+		{
+			name: "new interconnector", client: admin, from: "north", to: "south", capacity: 20,
+			want: []Interconnector{{From: "south", To: "north", Capacity: 10}, {From: "north", To: "south", Capacity: 20}},
+		},
+		{
+			name: "replaced capacity", client: admin, from: "south", to: "north", capacity: 5,
+			want: []Interconnector{{From: "south", To: "north", Capacity: 5}},
+		},
+		{
+			name: "no capacity", client: admin, from: "south", to: "north", capacity: 0,
+			want: []Interconnector{{From: "south", To: "north", Capacity: 0}},
+		},
+		{
+			name: "not the admin", client: seller, from: "north", to: "south", capacity: 20,
+			wantErr: "transmission capacity can only be set by admin",
+		},
+		{
+			name: "closed session", client: admin, closed: true, from: "north", to: "south", capacity: 20,
+			wantErr: "cannot change transmission capacity of a session that is not open",
+		},
+		{
+			name: "same zone", client: admin, from: "north", to: "north", capacity: 20,
+			wantErr: "interconnector must connect two different zones",
+		},
+		{
+			name: "negative capacity", client: admin, from: "north", to: "south", capacity: -1,
+			wantErr: "transmission capacity cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t)
+			m.mustSubmit(admin, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.SetTransmissionCapacity(ctx, "s1", "south", "north", 10)
+			})
+			if tt.closed {
+				m.closeSession("s1")
+			}
+
+			_, err := m.submit(tt.client, func(ctx contractapi.TransactionContextInterface) error {
+				return contract.SetTransmissionCapacity(ctx, "s1", tt.from, tt.to, tt.capacity)
+			})
+			checkError(t, err, tt.wantErr)
+
+			// a failed transaction leaves the existing interconnector as it was
+			want := tt.want
+			if tt.wantErr != "" {
+				want = []Interconnector{{From: "south", To: "north", Capacity: 10}}
+			}
+			if got := m.session("s1").Interconnectors; !reflect.DeepEqual(got, want) {
+				t.Errorf("interconnectors = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -8,11 +8,25 @@ import (
 	"log"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/energy-token"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/intraday-market"
+	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/payment-token"
 	"github.com/hyperledger/fabric-samples/GEPx-Blockchain/chaincode-go/smart-contract"
 )
 
 func main() {
-	sessionSmartContract, err := contractapi.NewChaincode(&session.SmartContract{})
+	// the session contract is the default contract, the other contracts are
+	// invoked with their name as prefix, e.g. "energy:Transfer"
+	energyContract := new(energy.EnergyContract)
+	energyContract.Name = "energy"
+
+	paymentContract := new(payment.PaymentContract)
+	paymentContract.Name = "payment"
+
+	intradayContract := new(intraday.IntradayContract)
+	intradayContract.Name = "intraday"
+
+	sessionSmartContract, err := contractapi.NewChaincode(&session.SmartContract{}, energyContract, paymentContract, intradayContract)
 	if err != nil {
 		log.Panicf("Error creating session chaincode: %v", err)
 	}